@@ -18,6 +18,8 @@ type config struct {
 	cryptoKey      string
 	ipAddress      string
 	grpcURL        string
+	token          string
+	agentID        string
 	reportInterval time.Duration
 	pollInterval   time.Duration
 	rateLimit      int64
@@ -30,14 +32,14 @@ func run(ctx context.Context, conf *config) {
 	)
 
 	if conf.grpcURL != "" {
-		newClient, err = grpcclient.NewMetricsClient(conf.grpcURL)
+		newClient, err = grpcclient.NewMetricsClient(conf.grpcURL, conf.token, conf.agentID)
 		if err != nil {
 			fmt.Printf("failed to create gRPC client: %v\n", err)
 			os.Exit(1)
 			return
 		}
 	} else {
-		newClient = client.NewClient(conf.addr, conf.hashKey, conf.cryptoKey)
+		newClient = client.NewClient(conf.addr, conf.hashKey, conf.cryptoKey, conf.token, conf.agentID)
 	}
 
 	collector := services.NewCollector()
@@ -22,6 +22,8 @@ type configParams struct {
 	ReportInterval string `json:"report_interval"`
 	PollInterval   string `json:"poll_interval"`
 	GrpcURL        string `json:"grpc_url"`
+	Token          string `json:"token"`
+	AgentID        string `json:"agent_id"`
 	RateLimit      int64  `json:"-"`
 }
 
@@ -39,6 +41,8 @@ func loadAgentConfig() (*configParams, error) {
 	rateLimit := flag.Int64("l", 0, "rate limit")
 	cryptoKey := flag.String("s", "", "crypto key")
 	configPath := flag.String("c", "", "Path to configuration file")
+	token := flag.String("t", "", "auth token")
+	agentID := flag.String("id", "", "agent id, hostname by default")
 	flag.Parse()
 
 	// Переменные окружения
@@ -49,6 +53,8 @@ func loadAgentConfig() (*configParams, error) {
 	envReportInterval := os.Getenv("REPORT_INTERVAL")
 	envPollInterval := os.Getenv("POLL_INTERVAL")
 	envRateLimit := os.Getenv("RATE_LIMIT")
+	envToken := os.Getenv("AUTH_TOKEN")
+	envAgentID := os.Getenv("AGENT_ID")
 
 	// Проверка наличия конфигурационного файла
 	var config = &configParams{}
@@ -125,6 +131,29 @@ func loadAgentConfig() (*configParams, error) {
 		config.CryptoKey = envCryptoKey
 	}
 
+	if *token != "" {
+		config.Token = *token
+	}
+
+	if envToken != "" {
+		config.Token = envToken
+	}
+
+	if *agentID != "" {
+		config.AgentID = *agentID
+	}
+
+	if envAgentID != "" {
+		config.AgentID = envAgentID
+	}
+
+	if config.AgentID == "" {
+		// без явного идентификатора агенты различаются по имени хоста
+		if hostname, err := os.Hostname(); err == nil {
+			config.AgentID = hostname
+		}
+	}
+
 	if _, err := strconv.Atoi(config.ReportInterval); err == nil {
 		config.ReportInterval += "s"
 	}
@@ -193,6 +222,8 @@ func main() {
 		cryptoKey:      agentConfig.CryptoKey,
 		ipAddress:      ipAddress,
 		grpcURL:        agentConfig.GrpcURL,
+		token:          agentConfig.Token,
+		agentID:        agentConfig.AgentID,
 	})
 
 	log.Println("Stopping agent...")
@@ -2,13 +2,22 @@ package main
 
 import (
 	"context"
+	"encoding/json"
+	"fmt"
+	"os"
 	"time"
 
 	"go.uber.org/zap"
 
+	"metricalert/internal/server/core/alerting"
 	"metricalert/internal/server/core/application"
+	"metricalert/internal/server/core/model"
 	"metricalert/internal/server/infra/api/rest"
+	"metricalert/internal/server/infra/auth"
 	"metricalert/internal/server/infra/grpc"
+	"metricalert/internal/server/infra/ipfilter"
+	"metricalert/internal/server/infra/notify"
+	"metricalert/internal/server/infra/ratelimit"
 	"metricalert/internal/server/infra/store"
 	"metricalert/internal/server/infra/store/db"
 	"metricalert/internal/server/infra/store/file"
@@ -16,16 +25,37 @@ import (
 )
 
 type config struct {
-	logger        zap.SugaredLogger
-	fileStorePath string
-	databaseDsn   string
-	hashKey       string
-	cryptoKey     string
-	storeInterval string
-	trustedSubnet string
-	grpcURL       string
-	port          int64
-	restore       bool
+	logger            zap.SugaredLogger
+	fileStorePath     string
+	databaseDsn       string
+	hashKey           string
+	cryptoKey         string
+	storeInterval     string
+	grpcURL           string
+	tokens            []auth.TokenConfig
+	ipFilter          ipfilter.Config
+	rateLimit         ratelimit.Config
+	routeTimeouts     map[string]string
+	requestTimeout    string
+	idempotencyWindow string
+	expiryInterval    string
+	agentExpiry       string
+	staleness         []stalenessParams
+	metadata          []model.MetricMeta
+	naming            application.NamingPolicy
+	cardinality       model.CardinalityLimits
+	relabelFile       string
+	recordingInterval string
+	recording         []application.RecordingRule
+	alertInterval     string
+	alerts            []alerting.Rule
+	notifications     []notify.Config
+	alertRouting      alerting.Routing
+	maxBodySize       int64
+	maxUnzipSize      int64
+	batchChunkSize    int
+	port              int64
+	restore           bool
 }
 
 func run(ctx context.Context, conf *config, stop chan<- struct{}) {
@@ -61,7 +91,138 @@ func run(ctx context.Context, conf *config, stop chan<- struct{}) {
 		conf.logger.Fatalf("failed to create store: %v", err)
 	}
 
-	newApplication := application.NewApplication(newStore)
+	idempotencyWindow, err := time.ParseDuration(conf.idempotencyWindow)
+	if err != nil {
+		conf.logger.Fatalf("failed to parse idempotency window: %v", err)
+	}
+
+	agentExpiry, err := time.ParseDuration(conf.agentExpiry)
+	if err != nil {
+		conf.logger.Fatalf("failed to parse agent expiry: %v", err)
+	}
+
+	staleness, err := parseStaleness(conf.staleness)
+	if err != nil {
+		conf.logger.Fatalf("failed to parse staleness rules: %v", err)
+	}
+
+	for _, meta := range conf.metadata {
+		if err = application.ValidateMetadata(meta); err != nil {
+			conf.logger.Fatalf("invalid metadata for metric %s: %v", meta.Name, err)
+		}
+	}
+
+	if err = application.ValidateCardinalityLimits(conf.cardinality); err != nil {
+		conf.logger.Fatalf("invalid cardinality limits: %v", err)
+	}
+
+	var (
+		relabel       []model.RelabelRule
+		relabelSource application.RelabelSource
+	)
+
+	if conf.relabelFile != "" {
+		relabelSource = func() ([]model.RelabelRule, error) {
+			return loadRelabelRules(conf.relabelFile)
+		}
+
+		if relabel, err = relabelSource(); err != nil {
+			conf.logger.Fatalf("failed to load relabel rules: %v", err)
+		}
+	}
+
+	newApplication, err := application.NewApplication(newStore, application.Config{
+		Naming:            conf.naming,
+		Cardinality:       conf.cardinality,
+		Relabel:           relabel,
+		RelabelSource:     relabelSource,
+		Staleness:         staleness,
+		Recording:         conf.recording,
+		Metadata:          conf.metadata,
+		IdempotencyWindow: idempotencyWindow,
+		AgentExpiry:       agentExpiry,
+	})
+	if err != nil {
+		conf.logger.Fatalf("failed to create application: %v", err)
+	}
+
+	if len(staleness) > 0 || agentExpiry > 0 {
+		expiryInterval, err := time.ParseDuration(conf.expiryInterval)
+		if err != nil {
+			conf.logger.Fatalf("failed to parse expiry interval: %v", err)
+		}
+
+		go newApplication.RunExpiry(ctx, expiryInterval)
+	}
+
+	if len(conf.recording) > 0 {
+		recordingInterval, err := time.ParseDuration(conf.recordingInterval)
+		if err != nil {
+			conf.logger.Fatalf("failed to parse recording interval: %v", err)
+		}
+
+		go newApplication.RunRecording(ctx, recordingInterval)
+	}
+
+	if err = alerting.ValidateRules(conf.alerts); err != nil {
+		conf.logger.Fatalf("invalid alert rules: %v", err)
+	}
+
+	channels, err := notify.New(conf.notifications)
+	if err != nil {
+		conf.logger.Fatalf("failed to create notification channels: %v", err)
+	}
+
+	if err = alerting.ValidateRouting(conf.alertRouting, channels); err != nil {
+		conf.logger.Fatalf("invalid alert routing: %v", err)
+	}
+
+	records := alerting.NewRecords(newStore)
+	alerts := alerting.NewEngine(newStore, alerting.Config{
+		Agents:    newApplication,
+		Silences:  records,
+		State:     records,
+		RuleStore: records,
+		Channels:  channels,
+		Rules:     conf.alerts,
+		Routing:   conf.alertRouting,
+	})
+
+	// правила можно создать через API после запуска, поэтому движок работает и без правил в конфигурации
+	alertInterval, err := time.ParseDuration(conf.alertInterval)
+	if err != nil {
+		conf.logger.Fatalf("failed to parse alert interval: %v", err)
+	}
+
+	go alerts.Run(ctx, alertInterval)
+
+	authenticator, err := auth.New(conf.tokens)
+	if err != nil {
+		conf.logger.Fatalf("failed to load tokens: %v", err)
+	}
+
+	ipFilter, err := ipfilter.New(conf.ipFilter)
+	if err != nil {
+		conf.logger.Fatalf("failed to create ip filter: %v", err)
+	}
+
+	limiter := ratelimit.New(conf.rateLimit)
+
+	var requestTimeout time.Duration
+	if conf.requestTimeout != "" {
+		requestTimeout, err = time.ParseDuration(conf.requestTimeout)
+		if err != nil {
+			conf.logger.Fatalf("failed to parse request timeout: %v", err)
+		}
+	}
+
+	routeTimeouts := make(map[string]time.Duration, len(conf.routeTimeouts))
+	for route, value := range conf.routeTimeouts {
+		routeTimeouts[route], err = time.ParseDuration(value)
+		if err != nil {
+			conf.logger.Fatalf("failed to parse timeout for route %s: %v", route, err)
+		}
+	}
 
 	go func() {
 		newStore.Sync(ctx)
@@ -78,7 +239,11 @@ func run(ctx context.Context, conf *config, stop chan<- struct{}) {
 			stop <- struct{}{}
 		}()
 
-		if err := grpc.StartGRPCServer(newApplication, conf.grpcURL); err != nil {
+		if err := grpc.StartGRPCServer(newApplication, &grpc.Config{
+			Auth:    authenticator,
+			Limiter: limiter,
+			Address: conf.grpcURL,
+		}); err != nil {
 			conf.logger.Fatalf("failed to start grpc server: %v", err)
 		}
 
@@ -86,12 +251,21 @@ func run(ctx context.Context, conf *config, stop chan<- struct{}) {
 	}
 
 	api := rest.NewServerAPI(&rest.Config{
-		Server:        newApplication,
-		Port:          conf.port,
-		Logger:        conf.logger,
-		HashKey:       conf.hashKey,
-		CryptoKey:     conf.cryptoKey,
-		TrustedSubnet: conf.trustedSubnet,
+		Server:         newApplication,
+		Alerts:         alerts,
+		Auth:           authenticator,
+		IPFilter:       ipFilter,
+		Limiter:        limiter,
+		Port:           conf.port,
+		RequestTimeout: requestTimeout,
+		RouteTimeouts:  routeTimeouts,
+		Logger:         conf.logger,
+		HashKey:        conf.hashKey,
+		CryptoKey:      conf.cryptoKey,
+
+		MaxBodySize:         conf.maxBodySize,
+		MaxDecompressedSize: conf.maxUnzipSize,
+		BatchChunkSize:      conf.batchChunkSize,
 	})
 
 	go func() {
@@ -114,3 +288,47 @@ func run(ctx context.Context, conf *config, stop chan<- struct{}) {
 		conf.logger.Fatalw("failed to run server", "error", err)
 	}
 }
+
+// parseStaleness разбирает правила устаревания метрик из конфигурации.
+func parseStaleness(params []stalenessParams) ([]application.StalenessRule, error) {
+	rules := make([]application.StalenessRule, 0, len(params))
+	for _, p := range params {
+		rule := application.StalenessRule{Pattern: p.Pattern}
+
+		var err error
+		if p.StaleAfter != "" {
+			if rule.StaleAfter, err = time.ParseDuration(p.StaleAfter); err != nil {
+				return nil, fmt.Errorf("invalid stale_after for %s: %w", p.Pattern, err)
+			}
+		}
+
+		if p.DeleteAfter != "" {
+			if rule.DeleteAfter, err = time.ParseDuration(p.DeleteAfter); err != nil {
+				return nil, fmt.Errorf("invalid delete_after for %s: %w", p.Pattern, err)
+			}
+		}
+
+		rules = append(rules, rule)
+	}
+
+	if err := application.ValidateStalenessRules(rules); err != nil {
+		return nil, fmt.Errorf("invalid staleness rules: %w", err)
+	}
+
+	return rules, nil
+}
+
+// loadRelabelRules читает правила преобразования метрик из JSON-файла со списком правил.
+func loadRelabelRules(path string) ([]model.RelabelRule, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read relabel file: %w", err)
+	}
+
+	var rules []model.RelabelRule
+	if err = json.Unmarshal(data, &rules); err != nil {
+		return nil, fmt.Errorf("failed to decode relabel file: %w", err)
+	}
+
+	return rules, nil
+}
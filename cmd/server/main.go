@@ -13,19 +13,66 @@ import (
 	"syscall"
 
 	"go.uber.org/zap"
+
+	"metricalert/internal/server/core/alerting"
+	"metricalert/internal/server/core/application"
+	"metricalert/internal/server/core/model"
+	"metricalert/internal/server/infra/auth"
+	"metricalert/internal/server/infra/ipfilter"
+	"metricalert/internal/server/infra/notify"
+	"metricalert/internal/server/infra/ratelimit"
 )
 
 type configParams struct {
-	Addr          string `json:"address"`
-	FileStorePath string `json:"store_file"`
-	DatabaseDsn   string `json:"database_dsn"`
-	HashKey       string `json:"-"`
-	CryptoKey     string `json:"crypto_key"`
-	StoreInterval string `json:"store_interval"`
-	TrustedSubnet string `json:"trusted_subnet"`
-	GrpcURL       string `json:"grpc_url"`
-	Restore       bool   `json:"restore"`
-	port          int64
+	Addr              string                      `json:"address"`
+	FileStorePath     string                      `json:"store_file"`
+	DatabaseDsn       string                      `json:"database_dsn"`
+	HashKey           string                      `json:"-"`
+	CryptoKey         string                      `json:"crypto_key"`
+	StoreInterval     string                      `json:"store_interval"`
+	TrustedSubnet     string                      `json:"trusted_subnet"`
+	GrpcURL           string                      `json:"grpc_url"`
+	Tokens            []auth.TokenConfig          `json:"tokens"`
+	AllowedSubnets    []string                    `json:"allowed_subnets"`
+	DeniedSubnets     []string                    `json:"denied_subnets"`
+	TrustedProxies    []string                    `json:"trusted_proxies"`
+	RateLimit         rateLimitParams             `json:"rate_limit"`
+	RequestTimeout    string                      `json:"request_timeout"`
+	RouteTimeouts     map[string]string           `json:"route_timeouts"`
+	IdempotencyWindow string                      `json:"idempotency_window"`
+	MaxBodySize       int64                       `json:"max_body_size"`
+	MaxUnzipSize      int64                       `json:"max_decompressed_size"`
+	BatchChunkSize    int                         `json:"batch_chunk_size"`
+	Staleness         []stalenessParams           `json:"staleness"`
+	ExpiryInterval    string                      `json:"expiry_interval"`
+	AgentExpiry       string                      `json:"agent_expiry"`
+	Metadata          []model.MetricMeta          `json:"metadata"`
+	Naming            application.NamingPolicy    `json:"naming"`
+	Cardinality       model.CardinalityLimits     `json:"cardinality"`
+	RelabelFile       string                      `json:"relabel_file"`
+	Recording         []application.RecordingRule `json:"recording_rules"`
+	RecordingInterval string                      `json:"recording_interval"`
+	Alerts            []alerting.Rule             `json:"alert_rules"`
+	AlertInterval     string                      `json:"alert_interval"`
+	Notifications     []notify.Config             `json:"notification_channels"`
+	AlertRouting      alerting.Routing            `json:"alert_routing"`
+	Restore           bool                        `json:"restore"`
+	port              int64
+}
+
+// stalenessParams правило устаревания метрик: через stale_after метрика помечается устаревшей,
+// через delete_after удаляется. Сроки задаются в формате time.ParseDuration.
+type stalenessParams struct {
+	Pattern     string `json:"pattern"`
+	StaleAfter  string `json:"stale_after"`
+	DeleteAfter string `json:"delete_after"`
+}
+
+type rateLimitParams struct {
+	RequestsPerSecond float64 `json:"requests_per_second"`
+	MetricsPerSecond  float64 `json:"metrics_per_second"`
+	RequestBurst      int     `json:"request_burst"`
+	MetricsBurst      int     `json:"metrics_burst"`
 }
 
 var (
@@ -40,6 +87,13 @@ func loadServerConfig() (*configParams, error) {
 		defaultStoreInterval = "300s"
 		defaultAddr          = "localhost:8080"
 		defaultFileStorePath = "store.json"
+		defaultIdempotency   = "1h"
+		defaultExpiry        = "1m"
+		defaultAgentExpiry   = "24h"
+		defaultRecording     = "30s"
+		defaultAlert         = "30s"
+		defaultMaxBodySize   = 10 << 20
+		defaultMaxUnzipSize  = 50 << 20
 	)
 	configPath := flag.String("c", "", "Path to configuration file")
 	address := flag.String("a", defaultAddr, "The address to listen on for HTTP requests.")
@@ -49,7 +103,7 @@ func loadServerConfig() (*configParams, error) {
 	databaseDsn := flag.String("d", "", "Database dsn")
 	hashKey := flag.String("k", "", "Hash key")
 	cryptoKey := flag.String("s", "", "Crypto key")
-	trustedSubnet := flag.String("t", "", "Trusted subnet")
+	trustedSubnet := flag.String("t", "", "Trusted subnets, comma separated")
 	flag.Parse()
 
 	// Переменные окружения
@@ -62,6 +116,11 @@ func loadServerConfig() (*configParams, error) {
 	envHashKey := os.Getenv("KEY")
 	envCryptoKey := os.Getenv("CRYPTO_KEY")
 	envTrustedSubnet := os.Getenv("TRUSTED_SUBNET")
+	envTrustedProxies := os.Getenv("TRUSTED_PROXIES")
+	envRequestTimeout := os.Getenv("REQUEST_TIMEOUT")
+	envIdempotencyWindow := os.Getenv("IDEMPOTENCY_WINDOW")
+	envMaxBodySize := os.Getenv("MAX_BODY_SIZE")
+	envMaxUnzipSize := os.Getenv("MAX_DECOMPRESSED_SIZE")
 
 	// Проверка наличия конфигурационного файла
 	var config = &configParams{}
@@ -172,6 +231,68 @@ func loadServerConfig() (*configParams, error) {
 		config.TrustedSubnet = envTrustedSubnet
 	}
 
+	if config.TrustedSubnet != "" {
+		config.AllowedSubnets = append(config.AllowedSubnets, strings.Split(config.TrustedSubnet, ",")...)
+	}
+
+	if envTrustedProxies != "" {
+		config.TrustedProxies = strings.Split(envTrustedProxies, ",")
+	}
+
+	if envRequestTimeout != "" {
+		config.RequestTimeout = envRequestTimeout
+	}
+
+	if envIdempotencyWindow != "" {
+		config.IdempotencyWindow = envIdempotencyWindow
+	}
+
+	if config.IdempotencyWindow == "" {
+		config.IdempotencyWindow = defaultIdempotency
+	}
+
+	if config.ExpiryInterval == "" {
+		config.ExpiryInterval = defaultExpiry
+	}
+
+	if config.AgentExpiry == "" {
+		config.AgentExpiry = defaultAgentExpiry
+	}
+
+	if config.RecordingInterval == "" {
+		config.RecordingInterval = defaultRecording
+	}
+
+	if config.AlertInterval == "" {
+		config.AlertInterval = defaultAlert
+	}
+
+	if envMaxBodySize != "" {
+		size, err := strconv.ParseInt(envMaxBodySize, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse MAX_BODY_SIZE: %w", err)
+		}
+
+		config.MaxBodySize = size
+	}
+
+	if envMaxUnzipSize != "" {
+		size, err := strconv.ParseInt(envMaxUnzipSize, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse MAX_DECOMPRESSED_SIZE: %w", err)
+		}
+
+		config.MaxUnzipSize = size
+	}
+
+	if config.MaxBodySize == 0 {
+		config.MaxBodySize = defaultMaxBodySize
+	}
+
+	if config.MaxUnzipSize == 0 {
+		config.MaxUnzipSize = defaultMaxUnzipSize
+	}
+
 	return config, nil
 }
 
@@ -219,8 +340,38 @@ func main() {
 		databaseDsn:   serverConfig.DatabaseDsn,
 		hashKey:       serverConfig.HashKey,
 		cryptoKey:     serverConfig.CryptoKey,
-		trustedSubnet: serverConfig.TrustedSubnet,
 		grpcURL:       serverConfig.GrpcURL,
+		tokens:        serverConfig.Tokens,
+		ipFilter: ipfilter.Config{
+			Allowed:        serverConfig.AllowedSubnets,
+			Denied:         serverConfig.DeniedSubnets,
+			TrustedProxies: serverConfig.TrustedProxies,
+		},
+		rateLimit: ratelimit.Config{
+			RequestsPerSecond: serverConfig.RateLimit.RequestsPerSecond,
+			MetricsPerSecond:  serverConfig.RateLimit.MetricsPerSecond,
+			RequestBurst:      serverConfig.RateLimit.RequestBurst,
+			MetricsBurst:      serverConfig.RateLimit.MetricsBurst,
+		},
+		requestTimeout:    serverConfig.RequestTimeout,
+		routeTimeouts:     serverConfig.RouteTimeouts,
+		idempotencyWindow: serverConfig.IdempotencyWindow,
+		maxBodySize:       serverConfig.MaxBodySize,
+		maxUnzipSize:      serverConfig.MaxUnzipSize,
+		batchChunkSize:    serverConfig.BatchChunkSize,
+		staleness:         serverConfig.Staleness,
+		expiryInterval:    serverConfig.ExpiryInterval,
+		agentExpiry:       serverConfig.AgentExpiry,
+		metadata:          serverConfig.Metadata,
+		naming:            serverConfig.Naming,
+		cardinality:       serverConfig.Cardinality,
+		relabelFile:       serverConfig.RelabelFile,
+		recording:         serverConfig.Recording,
+		recordingInterval: serverConfig.RecordingInterval,
+		alerts:            serverConfig.Alerts,
+		alertInterval:     serverConfig.AlertInterval,
+		notifications:     serverConfig.Notifications,
+		alertRouting:      serverConfig.AlertRouting,
 	}, stop)
 
 	<-stop
@@ -109,7 +109,7 @@ func (a *Agent) worker(ctx context.Context, wg *sync.WaitGroup, metricsChan <-ch
 				return
 			}
 
-			if err := a.client.SendMetrics(context.Background(), metrics, a.ipAddress); err != nil {
+			if err := a.client.SendMetrics(ctx, metrics, a.ipAddress); err != nil {
 				zap.L().Error("can't send metrics", zap.Error(err))
 				continue
 			}
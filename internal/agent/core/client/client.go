@@ -15,9 +15,11 @@ import (
 	"encoding/pem"
 	"errors"
 	"fmt"
+	"io"
 	"net"
 	"net/http"
 	"os"
+	"sync/atomic"
 	"time"
 
 	"go.uber.org/zap"
@@ -33,6 +35,11 @@ type handler struct {
 	publicKey *rsa.PublicKey
 	addr      string
 	hashKey   string
+	token     string
+	agentID   string
+	// legacy устанавливается, если сервер не знает маршрут /api/v1/updates/,
+	// после этого пакеты отправляются на /updates/
+	legacy atomic.Bool
 }
 
 type metrics struct {
@@ -42,10 +49,12 @@ type metrics struct {
 	MType string   `json:"type"`            // параметр, принимающий значение gauge или counter
 }
 
-func NewClient(addr, hashKey, cryptoKey string) Client {
+func NewClient(addr, hashKey, cryptoKey, token, agentID string) Client {
 	h := &handler{
 		addr:    addr,
 		hashKey: hashKey,
+		token:   token,
+		agentID: agentID,
 	}
 
 	if cryptoKey != "" {
@@ -84,9 +93,7 @@ func loadPublicKey(path string) (*rsa.PublicKey, error) {
 	return publicKey, nil
 }
 
-func (c *handler) SendMetrics(_ context.Context, list []model.Metric, ipAddress string) error {
-	url := fmt.Sprintf("http://%s/updates/", c.addr)
-
+func (c *handler) SendMetrics(ctx context.Context, list []model.Metric, ipAddress string) error {
 	request := make([]metrics, 0, len(list))
 	for _, metric := range list {
 		var m = metrics{
@@ -126,9 +133,50 @@ func (c *handler) SendMetrics(_ context.Context, list []model.Metric, ipAddress
 		byteData = encrypted
 	}
 
-	req, err := http.NewRequest(http.MethodPost, url, bytes.NewBuffer(byteData))
+	// ключ создается один раз на пакет и переиспользуется при повторах,
+	// чтобы сервер не применил счетчики дважды
+	key, err := NewIdempotencyKey()
+	if err != nil {
+		return fmt.Errorf("failed to create idempotency key: %w", err)
+	}
+
+	status, body, err := c.post(ctx, c.updatesURL(), byteData, ipAddress, key)
+	if err == nil && status == http.StatusNotFound && !c.legacy.Load() && !isAPIError(body) {
+		// сервер старой версии без маршрутов /api/v1/ отвечает 404 без тела ошибки API
+		zap.L().Info("server does not support /api/v1/updates/, falling back to /updates/")
+		c.legacy.Store(true)
+
+		status, body, err = c.post(ctx, c.updatesURL(), byteData, ipAddress, key)
+	}
+
+	if err != nil {
+		return fmt.Errorf("failed to send metric: %w", err)
+	}
+
+	if status != http.StatusOK {
+		return fmt.Errorf("failed to send metric: %w", decodeError(status, body))
+	}
+
+	logRejected(body)
+
+	return nil
+}
+
+// updatesURL возвращает адрес пакетной отправки метрик.
+func (c *handler) updatesURL() string {
+	if c.legacy.Load() {
+		return fmt.Sprintf("http://%s/updates/", c.addr)
+	}
+
+	return fmt.Sprintf("http://%s/api/v1/updates/", c.addr)
+}
+
+// post отправляет подготовленное тело пакета с повторами при сетевых ошибках
+// и возвращает код и тело ответа.
+func (c *handler) post(ctx context.Context, url string, byteData []byte, ipAddress, key string) (int, []byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, http.NoBody)
 	if err != nil {
-		return fmt.Errorf("failed to create request: %w", err)
+		return 0, nil, fmt.Errorf("failed to create request: %w", err)
 	}
 
 	req.Header.Set("Content-Type", "application/json")
@@ -139,17 +187,32 @@ func (c *handler) SendMetrics(_ context.Context, list []model.Metric, ipAddress
 		req.Header.Set("HashSHA256", hashRequest(byteData, c.hashKey))
 	}
 
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+
+	if c.agentID != "" {
+		req.Header.Set("X-Agent-ID", c.agentID)
+	}
+
+	req.Header.Set("Idempotency-Key", key)
+
 	const timeout = 5 * time.Second
 
 	var (
 		client = &http.Client{
 			Timeout: timeout,
 		}
-		resp *http.Response
+		status int
+		body   []byte
 	)
 
-	err = retry(func() error {
-		resp, err = client.Do(req)
+	err = retry(ctx, func() error {
+		// тело запроса вычитывается при каждой попытке, поэтому создаем его заново
+		req.Body = io.NopCloser(bytes.NewReader(byteData))
+		req.ContentLength = int64(len(byteData))
+
+		resp, err := client.Do(req)
 		if err != nil {
 			return fmt.Errorf("failed to send metric: %w", err)
 		}
@@ -160,17 +223,96 @@ func (c *handler) SendMetrics(_ context.Context, list []model.Metric, ipAddress
 			}
 		}()
 
+		status = resp.StatusCode
+
+		body, err = io.ReadAll(io.LimitReader(resp.Body, maxErrorBodySize))
+		if err != nil {
+			return fmt.Errorf("failed to read response: %w", err)
+		}
+
 		return nil
 	})
-	if err != nil {
-		return fmt.Errorf("failed to send metric: %w", err)
+
+	return status, body, err
+}
+
+// batchResult результат обработки пакета метрик сервером.
+type batchResult struct {
+	Items []struct {
+		ID      string `json:"id"`
+		Status  string `json:"status"`
+		Code    string `json:"code"`
+		Message string `json:"message"`
+	} `json:"items"`
+	Rejected int `json:"rejected"`
+}
+
+// logRejected выводит в лог метрики, отклоненные сервером.
+func logRejected(body []byte) {
+	var result batchResult
+	if err := json.Unmarshal(body, &result); err != nil || result.Rejected == 0 {
+		return
 	}
 
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("failed to send metric: status code %d", resp.StatusCode)
+	for _, item := range result.Items {
+		if item.Status == "rejected" {
+			zap.L().Warn("metric rejected by server",
+				zap.String("id", item.ID),
+				zap.String("code", item.Code),
+				zap.String("message", item.Message),
+			)
+		}
 	}
+}
 
-	return nil
+// maxErrorBodySize ограничивает размер читаемого тела ответа.
+const maxErrorBodySize = 64 << 10
+
+// apiError ошибка, возвращенная сервером в формате JSON.
+type apiError struct {
+	Error struct {
+		Code    string `json:"code"`
+		Message string `json:"message"`
+		Details []struct {
+			ID      string `json:"id"`
+			Code    string `json:"code"`
+			Message string `json:"message"`
+			Index   int    `json:"index"`
+		} `json:"details"`
+	} `json:"error"`
+}
+
+// isAPIError проверяет, что тело ответа содержит ошибку API, а не ответ на неизвестный маршрут.
+func isAPIError(body []byte) bool {
+	var apiErr apiError
+	return json.Unmarshal(body, &apiErr) == nil && apiErr.Error.Code != ""
+}
+
+// decodeError формирует ошибку по коду и телу ответа сервера.
+func decodeError(status int, body []byte) error {
+	var apiErr apiError
+	if err := json.Unmarshal(body, &apiErr); err != nil || apiErr.Error.Code == "" {
+		return fmt.Errorf("status code %d", status)
+	}
+
+	msg := fmt.Sprintf("status code %d, code: %s, message: %s", status, apiErr.Error.Code, apiErr.Error.Message)
+	for _, d := range apiErr.Error.Details {
+		msg += fmt.Sprintf("; metric #%d %q: %s (%s)", d.Index, d.ID, d.Message, d.Code)
+	}
+
+	return errors.New(msg)
+}
+
+// NewIdempotencyKey создает случайный ключ идемпотентности пакета метрик.
+func NewIdempotencyKey() (string, error) {
+	const keySize = 16
+
+	key := make([]byte, keySize)
+	if _, err := rand.Read(key); err != nil {
+		return "", fmt.Errorf("can't read random bytes: %w", err)
+	}
+
+	return hex.EncodeToString(key), nil
 }
 
 // Получаем данные и шифрируем их по публику.
@@ -187,7 +329,9 @@ func (c *handler) rsaEncrypt(data []byte) ([]byte, error) {
 	return encryptPKCS1v15, nil
 }
 
-func retry(operation func() error) error {
+// retry выполняет операцию с повторными попытками при сетевых ошибках.
+// Ожидание между попытками прерывается при отмене контекста.
+func retry(ctx context.Context, operation func() error) error {
 	const maxRetries = 3
 	retryIntervals := []time.Duration{1 * time.Second, 3 * time.Second, 5 * time.Second}
 
@@ -204,8 +348,13 @@ func retry(operation func() error) error {
 
 		lastErr = err
 		if i < maxRetries {
-			time.Sleep(retryIntervals[i])
-			continue
+			timer := time.NewTimer(retryIntervals[i])
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return fmt.Errorf("operation canceled after %d retries: %w", i+1, errors.Join(ctx.Err(), lastErr))
+			case <-timer.C:
+			}
 		}
 	}
 
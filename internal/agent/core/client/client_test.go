@@ -0,0 +1,62 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"metricalert/internal/server/core/model"
+)
+
+func TestSendMetrics_LegacyFallback(t *testing.T) {
+	var paths, keys, agents []string
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.URL.Path)
+		keys = append(keys, r.Header.Get("Idempotency-Key"))
+		agents = append(agents, r.Header.Get("X-Agent-ID"))
+
+		if r.URL.Path != "/updates/" {
+			http.NotFound(w, r)
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	c := NewClient(strings.TrimPrefix(server.URL, "http://"), "", "", "", "host-1")
+	metrics := []model.Metric{{Name: "Alloc", Type: "gauge", Value: 1.5}}
+
+	require.NoError(t, c.SendMetrics(context.Background(), metrics, "127.0.0.1"))
+	require.NoError(t, c.SendMetrics(context.Background(), metrics, "127.0.0.1"))
+
+	// после первого 404 клиент запоминает старый маршрут, ключ идемпотентности пакета сохраняется
+	assert.Equal(t, []string{"/api/v1/updates/", "/updates/", "/updates/"}, paths)
+	assert.Equal(t, keys[0], keys[1])
+	assert.Equal(t, []string{"host-1", "host-1", "host-1"}, agents)
+}
+
+func TestSendMetrics_APINotFound(t *testing.T) {
+	var calls int
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		calls++
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusNotFound)
+		_, _ = w.Write([]byte(`{"error":{"code":"not_found","message":"not found"}}`))
+	}))
+	defer server.Close()
+
+	c := NewClient(strings.TrimPrefix(server.URL, "http://"), "", "", "", "")
+
+	err := c.SendMetrics(context.Background(), []model.Metric{{Name: "Alloc", Type: "gauge", Value: 1.5}}, "")
+	require.Error(t, err)
+	assert.Equal(t, 1, calls, "ошибка API не считается признаком старого сервера")
+}
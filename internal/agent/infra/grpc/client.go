@@ -2,11 +2,17 @@ package grpcclient
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
+	"time"
 
+	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
 
+	"metricalert/internal/agent/core/client"
 	"metricalert/internal/server/core/model"
 	pb "metricalert/proto"
 
@@ -18,10 +24,14 @@ type Client interface {
 }
 
 type MetricsClient struct {
-	client pb.MetricsServiceClient
+	client  pb.MetricsServiceClient
+	token   string
+	agentID string
+	// retryIntervals паузы перед повторами отправки, когда сервер недоступен
+	retryIntervals []time.Duration
 }
 
-func NewMetricsClient(address string) (Client, error) {
+func NewMetricsClient(address, token, agentID string) (Client, error) {
 	conn, err := grpc.NewClient(address, grpc.WithTransportCredentials(insecure.NewCredentials()))
 	if err != nil {
 		return nil, fmt.Errorf("failed to create grpc client: %w", err)
@@ -30,7 +40,11 @@ func NewMetricsClient(address string) (Client, error) {
 	log.Printf("grpc client created")
 
 	return &MetricsClient{
-		client: pb.NewMetricsServiceClient(conn),
+		client:  pb.NewMetricsServiceClient(conn),
+		token:   token,
+		agentID: agentID,
+
+		retryIntervals: []time.Duration{1 * time.Second, 3 * time.Second, 5 * time.Second},
 	}, nil
 }
 
@@ -60,10 +74,64 @@ func (c *MetricsClient) SendMetrics(ctx context.Context, metrics []model.Metric,
 		grpcMetrics = append(grpcMetrics, m)
 	}
 
-	_, err := c.client.UpdateMetrics(ctx, &pb.UpdateMetricsRequest{Metrics: grpcMetrics})
+	if c.token != "" {
+		ctx = metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer "+c.token)
+	}
+
+	if c.agentID != "" {
+		ctx = metadata.AppendToOutgoingContext(ctx, "x-agent-id", c.agentID)
+	}
+
+	// ключ создается один раз на пакет и переиспользуется при повторах,
+	// чтобы сервер не применил счетчики дважды
+	key, err := client.NewIdempotencyKey()
+	if err != nil {
+		return fmt.Errorf("failed to create idempotency key: %w", err)
+	}
+
+	resp, err := c.updateMetrics(ctx, &pb.UpdateMetricsRequest{
+		Metrics:        grpcMetrics,
+		IdempotencyKey: key,
+	})
 	if err != nil {
 		return fmt.Errorf("failed to send metrics to grpc server: %w", err)
 	}
 
+	for _, result := range resp.GetResults() {
+		if result.GetStatus() == model.ItemRejected {
+			log.Printf("metric %q rejected by server: %s (%s)", result.GetId(), result.GetMessage(), result.GetCode())
+		}
+	}
+
 	return nil
 }
+
+// updateMetrics отправляет пакет, повторяя запрос с тем же ключом идемпотентности,
+// пока сервер недоступен или не ответил вовремя.
+func (c *MetricsClient) updateMetrics(ctx context.Context,
+	req *pb.UpdateMetricsRequest) (*pb.UpdateMetricsResponse, error) {
+	for i := 0; ; i++ {
+		resp, err := c.client.UpdateMetrics(ctx, req)
+		if err == nil || !isRetriable(err) || i >= len(c.retryIntervals) {
+			return resp, err //nolint:wrapcheck // ошибка оборачивается в SendMetrics
+		}
+
+		timer := time.NewTimer(c.retryIntervals[i])
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, errors.Join(ctx.Err(), err)
+		case <-timer.C:
+		}
+	}
+}
+
+// isRetriable сообщает, что запрос можно повторить: сервер недоступен или не ответил вовремя.
+func isRetriable(err error) bool {
+	switch status.Code(err) {
+	case codes.Unavailable, codes.DeadlineExceeded:
+		return true
+	default:
+		return false
+	}
+}
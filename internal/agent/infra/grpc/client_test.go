@@ -0,0 +1,68 @@
+package grpcclient
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"metricalert/internal/server/core/model"
+	pb "metricalert/proto"
+)
+
+// fakeMetricsClient отвечает заданными ошибками и запоминает ключи идемпотентности запросов.
+type fakeMetricsClient struct {
+	errs []error
+	keys []string
+}
+
+func (c *fakeMetricsClient) UpdateMetrics(_ context.Context, in *pb.UpdateMetricsRequest,
+	_ ...grpc.CallOption) (*pb.UpdateMetricsResponse, error) {
+	c.keys = append(c.keys, in.GetIdempotencyKey())
+
+	if len(c.errs) > 0 {
+		err := c.errs[0]
+		c.errs = c.errs[1:]
+
+		return nil, err
+	}
+
+	return &pb.UpdateMetricsResponse{}, nil
+}
+
+func TestMetricsClient_SendMetricsRetry(t *testing.T) {
+	metrics := []model.Metric{{Name: "PollCount", Type: "counter", Value: int64(1)}}
+
+	t.Run("unavailable", func(t *testing.T) {
+		fake := &fakeMetricsClient{errs: []error{status.Error(codes.Unavailable, "connection refused")}}
+		c := &MetricsClient{client: fake, retryIntervals: []time.Duration{0, 0}}
+
+		require.NoError(t, c.SendMetrics(context.Background(), metrics, ""))
+		require.Len(t, fake.keys, 2)
+		assert.NotEmpty(t, fake.keys[0])
+		assert.Equal(t, fake.keys[0], fake.keys[1], "retry reuses the idempotency key")
+	})
+
+	t.Run("not retriable", func(t *testing.T) {
+		fake := &fakeMetricsClient{errs: []error{status.Error(codes.InvalidArgument, "bad metric")}}
+		c := &MetricsClient{client: fake, retryIntervals: []time.Duration{0, 0}}
+
+		assert.Error(t, c.SendMetrics(context.Background(), metrics, ""))
+		assert.Len(t, fake.keys, 1)
+	})
+
+	t.Run("retries exhausted", func(t *testing.T) {
+		unavailable := status.Error(codes.Unavailable, "connection refused")
+		fake := &fakeMetricsClient{errs: []error{unavailable, unavailable, unavailable}}
+		c := &MetricsClient{client: fake, retryIntervals: []time.Duration{0, 0}}
+
+		err := c.SendMetrics(context.Background(), metrics, "")
+		assert.Equal(t, codes.Unavailable, status.Code(err))
+		assert.Len(t, fake.keys, 3)
+	})
+}
@@ -0,0 +1,119 @@
+package alerting
+
+import (
+	"fmt"
+	"math"
+	"slices"
+	"time"
+)
+
+// Нижняя граница стандартного отклонения базовой линии: абсолютная и относительно среднего.
+// Без нее у метрики с постоянным значением любое изменение давало бы бесконечное отклонение.
+const (
+	minStd         = 1e-3
+	minRelativeStd = 0.01
+)
+
+// detector базовая линия одной метрики для правила anomaly.
+type detector struct {
+	since    time.Time // время первого наблюдения метрики
+	updated  time.Time // время обновления метрики при последнем наблюдении
+	window   []float64 // последние значения для zscore
+	mean     float64   // среднее для ewma
+	variance float64   // дисперсия для ewma
+	score    float64   // отклонение последнего наблюдения
+	samples  int
+}
+
+// clone возвращает независимую копию базовой линии.
+func (d *detector) clone() *detector {
+	c := *d
+	c.window = slices.Clone(d.window)
+
+	return &c
+}
+
+// observe сравнивает значение с базовой линией, построенной по предыдущим значениям, и добавляет
+// его в базовую линию. Возвращает z-оценку отклонения и признак того, что прогрев завершен.
+// Если метрика не обновлялась с прошлого наблюдения (updated не изменилось), значение не добавляется
+// повторно и возвращается прежняя оценка. Нулевое updated означает, что время обновления неизвестно.
+func (d *detector) observe(params Anomaly, value float64, updated, now time.Time) (float64, bool) {
+	if d.samples > 0 && !updated.IsZero() && updated.Equal(d.updated) {
+		return d.score, d.ready(params, now)
+	}
+
+	if d.samples == 0 {
+		d.since = now
+	}
+
+	var mean, std float64
+
+	switch params.Method {
+	case MethodEWMA:
+		mean, std = d.mean, math.Sqrt(d.variance)
+	default:
+		mean, std = meanStd(d.window)
+	}
+
+	ready := d.ready(params, now)
+	score := zScore(value, mean, std)
+
+	switch params.Method {
+	case MethodEWMA:
+		if d.samples == 0 {
+			d.mean = value
+		} else {
+			diff := value - d.mean
+			d.mean += params.Alpha * diff
+			d.variance = (1 - params.Alpha) * (d.variance + params.Alpha*diff*diff)
+		}
+	default:
+		d.window = append(d.window, value)
+		if len(d.window) > params.Window {
+			d.window = d.window[len(d.window)-params.Window:]
+		}
+	}
+
+	d.samples++
+	d.updated = updated
+	d.score = score
+
+	return score, ready
+}
+
+// ready сообщает, что базовая линия построена и прогрев завершен.
+func (d *detector) ready(params Anomaly, now time.Time) bool {
+	return d.samples >= 2 && now.Sub(d.since) >= time.Duration(params.WarmUp)
+}
+
+// zScore возвращает отклонение значения от среднего в стандартных отклонениях.
+// Стандартное отклонение ограничено снизу minStd и minRelativeStd от среднего.
+func zScore(value, mean, std float64) float64 {
+	return (value - mean) / max(std, minStd, math.Abs(mean)*minRelativeStd)
+}
+
+func meanStd(values []float64) (float64, float64) {
+	if len(values) == 0 {
+		return 0, 0
+	}
+
+	var sum float64
+	for _, v := range values {
+		sum += v
+	}
+
+	mean := sum / float64(len(values))
+
+	var squares float64
+	for _, v := range values {
+		squares += (v - mean) * (v - mean)
+	}
+
+	return mean, math.Sqrt(squares / float64(len(values)))
+}
+
+// describeAnomaly формирует описание аномального значения.
+func describeAnomaly(value, score, sensitivity float64) string {
+	return fmt.Sprintf("value %g deviates from baseline by %.2f standard deviations (sensitivity %g)",
+		value, score, sensitivity)
+}
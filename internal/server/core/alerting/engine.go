@@ -0,0 +1,611 @@
+package alerting
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"metricalert/internal/server/core/model"
+)
+
+// Состояния оповещения.
+const (
+	StateInactive = "inactive" // условие не выполняется, используется только как исходное состояние перехода
+	StatePending  = "pending"  // условие выполняется меньше, чем For правила
+	StateFiring   = "firing"   // условие выполняется дольше, чем For правила
+	StateResolved = "resolved" // условие перестало выполняться
+)
+
+// Alert экземпляр оповещения: правило, примененное к одной метрике или, для правил absence
+// по агентам, к одному агенту. Для absence Value содержит количество секунд с последнего обновления.
+type Alert struct {
+	ActiveAt    time.Time         `json:"active_at"`
+	FiredAt     time.Time         `json:"fired_at,omitzero"`
+	ResolvedAt  time.Time         `json:"resolved_at,omitzero"`
+	Labels      map[string]string `json:"labels,omitempty"`
+	Rule        string            `json:"rule"`
+	Metric      string            `json:"metric,omitempty"`
+	MType       string            `json:"type,omitempty"`
+	Agent       string            `json:"agent,omitempty"`
+	SilencedBy  []string          `json:"silenced_by,omitempty"`
+	State       string            `json:"state"`
+	Description string            `json:"description,omitempty"`
+	Value       float64           `json:"value"`
+}
+
+// Key возвращает ключ экземпляра оповещения, уникальный среди активных оповещений.
+func (a Alert) Key() string {
+	return metricValue{name: a.Metric, mType: a.MType, agent: a.Agent}.key(a.Rule)
+}
+
+// Transition переход оповещения из одного состояния в другое. Alert содержит оповещение
+// после перехода.
+type Transition struct {
+	At    time.Time `json:"at"`
+	From  string    `json:"from"`
+	To    string    `json:"to"`
+	Alert Alert     `json:"alert"`
+}
+
+// Source источник значений метрик и времени их обновления для вычисления правил.
+type Source interface {
+	GetGaugeList(ctx context.Context) (map[string]float64, error)
+	GetCounterList(ctx context.Context) (map[string]int64, error)
+	GetUpdateTimes(ctx context.Context) (model.UpdateTimes, error)
+}
+
+// AgentSource источник времени последнего отчета агентов для правил absence.
+type AgentSource interface {
+	AgentActivity(ctx context.Context) (map[string]time.Time, error)
+}
+
+// AgentStatus состояние агента. Агент молчит, если по нему активно оповещение absence;
+// Rules содержит имена таких правил.
+type AgentStatus struct {
+	LastSeen time.Time `json:"last_seen"`
+	Agent    string    `json:"agent"`
+	Rules    []string  `json:"rules,omitempty"`
+	Silent   bool      `json:"silent"`
+}
+
+// Config параметры вычисления оповещений.
+// Rules задает статические правила оповещений, их следует проверить ValidateRules.
+// RuleStore хранит версии правил, управляемых через API, без него такие правила
+// действуют до перезапуска сервера.
+// Agents нужен для правил absence по агентам, без него такие правила не срабатывают.
+// Silences хранит заглушки, без него заглушки действуют до перезапуска сервера.
+// State хранит активные оповещения и журнал переходов, без него состояние теряется при перезапуске.
+// Routing задает группировку и эскалацию уведомлений по каналам Channels, его следует проверить
+// ValidateRouting.
+type Config struct {
+	Agents    AgentSource
+	Silences  SilenceStore
+	State     StateStore
+	RuleStore RuleStore
+	Channels  map[string]Channel
+	Rules     []Rule
+	Routing   Routing
+}
+
+// ValidateRules проверяет правила и уникальность их имен.
+func ValidateRules(rules []Rule) error {
+	names := make(map[string]bool, len(rules))
+
+	for _, rule := range rules {
+		if err := rule.Validate(); err != nil {
+			return err
+		}
+
+		if names[rule.Name] {
+			return fmt.Errorf("rule %q: %w: duplicate name", rule.Name, ErrInvalidRule)
+		}
+
+		names[rule.Name] = true
+	}
+
+	return nil
+}
+
+// Engine вычисляет правила оповещений и хранит активные оповещения.
+type Engine struct {
+	source       Source
+	agents       AgentSource
+	silenceStore SilenceStore
+	stateStore   StateStore
+	ruleStore    RuleStore
+	mu           *sync.Mutex
+	alerts       map[string]*Alert
+	detectors    map[string]*detector
+	silenceMu    *sync.Mutex
+	silenceByID  map[string]Silence // загружаются из silenceStore при первом обращении
+	ruleMu       *sync.Mutex
+	ruleVersions map[string][]RuleVersion // загружаются из ruleStore при первом обращении
+	resets       map[string]bool          // правила API, условие которых изменилось или которые удалены
+	channels     map[string]Channel
+	groupMu      *sync.Mutex
+	groups       map[string]*group
+	now          func() time.Time
+	rules        []Rule // статические правила из конфигурации
+	routing      Routing
+	restoredAt   time.Time    // время загрузки активных оповещений из stateStore
+	unsaved      []Transition // переходы, которые не удалось сохранить в stateStore
+	restored     bool         // активные оповещения загружены из stateStore
+}
+
+// NewEngine создает новый экземпляр Engine.
+func NewEngine(source Source, conf Config) *Engine {
+	return &Engine{
+		source:       source,
+		agents:       conf.Agents,
+		silenceStore: conf.Silences,
+		stateStore:   conf.State,
+		ruleStore:    conf.RuleStore,
+		mu:           &sync.Mutex{},
+		alerts:       make(map[string]*Alert),
+		detectors:    make(map[string]*detector),
+		silenceMu:    &sync.Mutex{},
+		ruleMu:       &sync.Mutex{},
+		resets:       make(map[string]bool),
+		channels:     conf.Channels,
+		groupMu:      &sync.Mutex{},
+		groups:       make(map[string]*group),
+		now:          time.Now,
+		rules:        conf.Rules,
+		routing:      conf.Routing,
+	}
+}
+
+// metricValue значение метрики, по которому вычисляется правило. Для правил absence value
+// содержит количество секунд с последнего обновления метрики или отчета агента agent.
+type metricValue struct {
+	updated time.Time // время обновления метрики, нужно только правилам anomaly
+	name    string
+	mType   string
+	agent   string
+	value   float64
+}
+
+// key возвращает ключ оповещения правила по этому значению.
+func (m metricValue) key(rule string) string {
+	if m.agent != "" {
+		return rule + "/agent/" + m.agent
+	}
+
+	return rule + "/" + m.mType + "/" + m.name
+}
+
+// matchedBy сообщает, что значение подходит под правило.
+func (m metricValue) matchedBy(rule Rule) bool {
+	if m.agent != "" {
+		return rule.matchesAgent(m.agent)
+	}
+
+	return rule.matches(m.name, m.mType)
+}
+
+// Evaluate вычисляет все правила по текущим значениям метрик и возвращает переходы оповещений.
+// Оповещения по метрикам, которые больше не существуют, и по удаленным правилам разрешаются. Активные оповещения
+// помечаются действующими заглушками. Переходы сохраняются в хранилище состояния; если
+// сохранить их не удалось, возвращаются и переходы, и ошибка.
+func (e *Engine) Evaluate(ctx context.Context) ([]Transition, error) {
+	rules, err := e.activeRules(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	metrics, err := e.metricValues(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if hasRules(rules, KindAnomaly) {
+		if err = e.addUpdateTimes(ctx, metrics); err != nil {
+			return nil, err
+		}
+	}
+
+	now := e.now()
+
+	var idle []metricValue
+	if hasRules(rules, KindAbsence) {
+		if idle, err = e.idleTimes(ctx, now); err != nil {
+			return nil, err
+		}
+	}
+
+	silences, err := e.activeSilences(ctx, now)
+	if err != nil {
+		return nil, err
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if err = e.restore(ctx); err != nil {
+		return nil, err
+	}
+
+	var (
+		seen        = make(map[string]bool)
+		transitions []Transition
+		resets      = e.takeResets()
+	)
+
+	// оповещения правила, условие которого изменилось, разрешаются, а его базовые линии строятся
+	// заново: прежние время активации и базовая линия к новому условию не относятся
+	for _, key := range sortedKeys(e.alerts) {
+		if resets[e.alerts[key].Rule] {
+			transitions = e.resolve(transitions, key, now)
+		}
+	}
+
+	for _, rule := range rules {
+		targets := metrics
+		if rule.Kind == KindAbsence {
+			targets = idle
+		}
+
+		for _, metric := range targets {
+			if !metric.matchedBy(rule) {
+				continue
+			}
+
+			key := metric.key(rule.Name)
+			seen[key] = true
+
+			if resets[rule.Name] {
+				delete(e.detectors, key)
+			}
+
+			var d *detector
+			if rule.Kind == KindAnomaly {
+				d = e.detector(key)
+			}
+
+			active, description := check(rule, d, metric, now)
+			if d != nil && e.alerts[key] != nil && !d.ready(rule.Anomaly.withDefaults(), now) {
+				// базовая линия после перезапуска еще прогревается: восстановленное оповещение
+				// сохраняет состояние, пока отклонение нельзя вычислить
+				continue
+			}
+
+			transitions = e.update(transitions, rule, metric, active, description, silences, now)
+		}
+	}
+
+	reported := reportedAgents(idle)
+
+	for _, key := range sortedKeys(e.alerts) {
+		if !seen[key] && (e.agents == nil || !forgottenAgent(e.alerts[key], rules, reported)) {
+			transitions = e.resolve(transitions, key, now)
+		}
+	}
+
+	for key := range e.detectors {
+		if !seen[key] {
+			delete(e.detectors, key)
+		}
+	}
+
+	return transitions, e.save(ctx, transitions)
+}
+
+func (e *Engine) metricValues(ctx context.Context) ([]metricValue, error) {
+	gauges, err := e.source.GetGaugeList(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get gauge list: %w", err)
+	}
+
+	counters, err := e.source.GetCounterList(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get counter list: %w", err)
+	}
+
+	metrics := make([]metricValue, 0, len(gauges)+len(counters))
+	for name, value := range gauges {
+		metrics = append(metrics, metricValue{name: name, mType: "gauge", value: value})
+	}
+
+	for name, delta := range counters {
+		metrics = append(metrics, metricValue{name: name, mType: "counter", value: float64(delta)})
+	}
+
+	sort.Slice(metrics, func(i, j int) bool {
+		if metrics[i].mType != metrics[j].mType {
+			return metrics[i].mType > metrics[j].mType
+		}
+
+		return metrics[i].name < metrics[j].name
+	})
+
+	return metrics, nil
+}
+
+// addUpdateTimes добавляет к значениям метрик время их обновления. Базовая линия anomaly
+// пополняется только новыми значениями, а не каждым вычислением.
+func (e *Engine) addUpdateTimes(ctx context.Context, metrics []metricValue) error {
+	times, err := e.source.GetUpdateTimes(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get update times: %w", err)
+	}
+
+	for i, metric := range metrics {
+		if metric.mType == "counter" {
+			metrics[i].updated = times.Counters[metric.name]
+		} else {
+			metrics[i].updated = times.Gauges[metric.name]
+		}
+	}
+
+	return nil
+}
+
+func hasRules(rules []Rule, kind string) bool {
+	for _, rule := range rules {
+		if rule.Kind == kind {
+			return true
+		}
+	}
+
+	return false
+}
+
+// idleTimes возвращает для каждой метрики с известным временем обновления и каждого агента
+// количество секунд с последнего обновления.
+func (e *Engine) idleTimes(ctx context.Context, now time.Time) ([]metricValue, error) {
+	times, err := e.source.GetUpdateTimes(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get update times: %w", err)
+	}
+
+	var agents map[string]time.Time
+	if e.agents != nil {
+		if agents, err = e.agents.AgentActivity(ctx); err != nil {
+			return nil, fmt.Errorf("failed to get agent activity: %w", err)
+		}
+	}
+
+	idle := make([]metricValue, 0, len(times.Gauges)+len(times.Counters)+len(agents))
+	for _, name := range sortedKeys(times.Gauges) {
+		idle = append(idle, metricValue{name: name, mType: "gauge", value: now.Sub(times.Gauges[name]).Seconds()})
+	}
+
+	for _, name := range sortedKeys(times.Counters) {
+		idle = append(idle,
+			metricValue{name: name, mType: "counter", value: now.Sub(times.Counters[name]).Seconds()})
+	}
+
+	for _, agent := range sortedKeys(agents) {
+		idle = append(idle, metricValue{agent: agent, value: now.Sub(agents[agent]).Seconds()})
+	}
+
+	return idle, nil
+}
+
+// reportedAgents возвращает агентов, известных источнику активности.
+func reportedAgents(idle []metricValue) map[string]bool {
+	agents := make(map[string]bool)
+
+	for _, metric := range idle {
+		if metric.agent != "" {
+			agents[metric.agent] = true
+		}
+	}
+
+	return agents
+}
+
+// forgottenAgent сообщает, что оповещение absence относится к агенту, которого источник
+// активности забыл после долгого молчания. Такое оповещение не разрешается, пока агент
+// снова не пришлет отчет или правило не перестанет к нему относиться: агент по-прежнему молчит.
+func forgottenAgent(alert *Alert, rules []Rule, reported map[string]bool) bool {
+	if alert.Agent == "" || reported[alert.Agent] {
+		return false
+	}
+
+	for _, rule := range rules {
+		if rule.Name == alert.Rule && rule.Kind == KindAbsence && rule.matchesAgent(alert.Agent) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// detector возвращает базовую линию оповещения key, создавая ее при первом обращении.
+func (e *Engine) detector(key string) *detector {
+	d, ok := e.detectors[key]
+	if !ok {
+		d = &detector{}
+		e.detectors[key] = d
+	}
+
+	return d
+}
+
+// check вычисляет условие правила для значения метрики и возвращает его описание.
+// Базовая линия d нужна только правилам anomaly и обновляется значением.
+func check(rule Rule, d *detector, metric metricValue, now time.Time) (bool, string) {
+	value := metric.value
+
+	switch rule.Kind {
+	case KindThreshold:
+		return operators[rule.Op](value, rule.Threshold), fmt.Sprintf("value %g %s %g", value, rule.Op, rule.Threshold)
+	case KindAnomaly:
+		params := rule.Anomaly.withDefaults()
+		score, ready := d.observe(params, value, metric.updated, now)
+
+		return ready && math.Abs(score) > params.Sensitivity, describeAnomaly(value, score, params.Sensitivity)
+	case KindAbsence:
+		silence := time.Duration(value * float64(time.Second)).Truncate(time.Second)
+
+		return silence >= rule.silenceLimit(),
+			fmt.Sprintf("no updates for %s (expected every %s)", silence, time.Duration(rule.Interval))
+	default:
+		return false, ""
+	}
+}
+
+// update обновляет оповещение по результату проверки условия и добавляет переходы.
+func (e *Engine) update(transitions []Transition, rule Rule, metric metricValue, active bool,
+	description string, silences []Silence, now time.Time) []Transition {
+	key := metric.key(rule.Name)
+
+	alert, ok := e.alerts[key]
+	if !active {
+		if ok {
+			transitions = e.resolve(transitions, key, now)
+		}
+
+		return transitions
+	}
+
+	if !ok {
+		alert = &Alert{
+			Rule:     rule.Name,
+			Metric:   metric.name,
+			MType:    metric.mType,
+			Agent:    metric.agent,
+			Labels:   maps.Clone(rule.Labels),
+			State:    StatePending,
+			ActiveAt: now,
+		}
+		e.alerts[key] = alert
+	}
+
+	alert.Value = metric.value
+	alert.Description = description
+	alert.SilencedBy = silencedBy(silences, alert)
+
+	if !ok {
+		transitions = append(transitions, Transition{At: now, From: StateInactive, To: StatePending, Alert: *alert})
+	}
+
+	if alert.State == StatePending && now.Sub(alert.ActiveAt) >= time.Duration(rule.For) {
+		alert.State = StateFiring
+		alert.FiredAt = now
+		transitions = append(transitions, Transition{At: now, From: StatePending, To: StateFiring, Alert: *alert})
+	}
+
+	return transitions
+}
+
+// resolve разрешает активное оповещение и удаляет его из активных.
+func (e *Engine) resolve(transitions []Transition, key string, now time.Time) []Transition {
+	alert := e.alerts[key]
+	from := alert.State
+
+	alert.State = StateResolved
+	alert.ResolvedAt = now
+	delete(e.alerts, key)
+
+	return append(transitions, Transition{At: now, From: from, To: StateResolved, Alert: *alert})
+}
+
+// Alerts возвращает активные оповещения, отсортированные по ключу.
+func (e *Engine) Alerts(ctx context.Context) ([]Alert, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if err := e.restore(ctx); err != nil {
+		return nil, err
+	}
+
+	alerts := make([]Alert, 0, len(e.alerts))
+	for _, key := range sortedKeys(e.alerts) {
+		alerts = append(alerts, *e.alerts[key])
+	}
+
+	return alerts, nil
+}
+
+// Agents возвращает состояние агентов, известных источнику активности, отсортированное по имени.
+// Если silent, возвращаются только молчащие агенты.
+func (e *Engine) Agents(ctx context.Context, silent bool) ([]AgentStatus, error) {
+	if e.agents == nil {
+		return []AgentStatus{}, nil
+	}
+
+	activity, err := e.agents.AgentActivity(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get agent activity: %w", err)
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if err = e.restore(ctx); err != nil {
+		return nil, err
+	}
+
+	rules := make(map[string][]string)
+	for _, key := range sortedKeys(e.alerts) {
+		if alert := e.alerts[key]; alert.Agent != "" {
+			rules[alert.Agent] = append(rules[alert.Agent], alert.Rule)
+		}
+	}
+
+	agents := make([]AgentStatus, 0, len(activity))
+	for _, agent := range sortedKeys(activity) {
+		status := AgentStatus{Agent: agent, LastSeen: activity[agent], Rules: rules[agent], Silent: len(rules[agent]) > 0}
+		if silent && !status.Silent {
+			continue
+		}
+
+		agents = append(agents, status)
+	}
+
+	return agents, nil
+}
+
+// Run периодически вычисляет правила и отправляет уведомления, пока не отменен контекст.
+// Уведомления отправляются в отдельной горутине.
+func (e *Engine) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	notifications := newNotifier()
+	go notifications.run(ctx, e)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			transitions, err := e.Evaluate(ctx)
+			if err != nil {
+				zap.L().Error("failed to evaluate alert rules", zap.Error(err))
+			}
+
+			for _, t := range transitions {
+				zap.L().Info("alert state changed",
+					zap.String("rule", t.Alert.Rule),
+					zap.String("metric", t.Alert.Metric),
+					zap.String("agent", t.Alert.Agent),
+					zap.String("from", t.From),
+					zap.String("to", t.To),
+					zap.String("description", t.Alert.Description),
+					zap.Strings("silenced_by", t.Alert.SilencedBy))
+			}
+
+			notifications.push(transitions)
+		}
+	}
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+
+	sort.Strings(keys)
+
+	return keys
+}
@@ -0,0 +1,322 @@
+//nolint:wrapcheck,nolintlint,errcheck,forcetypeassert
+package alerting
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"metricalert/internal/server/core/model"
+)
+
+// fakeSource источник метрик с изменяемыми значениями.
+type fakeSource struct {
+	err      error
+	gauges   map[string]float64
+	counters map[string]int64
+	times    model.UpdateTimes
+}
+
+func (s *fakeSource) GetGaugeList(context.Context) (map[string]float64, error) {
+	return s.gauges, s.err
+}
+
+func (s *fakeSource) GetCounterList(context.Context) (map[string]int64, error) {
+	return s.counters, s.err
+}
+
+func (s *fakeSource) GetUpdateTimes(context.Context) (model.UpdateTimes, error) {
+	return s.times, s.err
+}
+
+// fakeAgents источник активности агентов.
+type fakeAgents map[string]time.Time
+
+func (a fakeAgents) AgentActivity(context.Context) (map[string]time.Time, error) {
+	return a, nil
+}
+
+// testClock управляемое время для движка.
+type testClock struct {
+	now time.Time
+}
+
+func (c *testClock) advance(d time.Duration) {
+	c.now = c.now.Add(d)
+}
+
+func newTestEngine(source Source, rules ...Rule) (*Engine, *testClock) {
+	clock := &testClock{now: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+	engine := NewEngine(source, Config{Rules: rules})
+	engine.now = func() time.Time { return clock.now }
+
+	return engine, clock
+}
+
+func states(transitions []Transition) []string {
+	result := make([]string, 0, len(transitions))
+	for _, t := range transitions {
+		result = append(result, t.Alert.Metric+t.Alert.Agent+":"+t.From+"->"+t.To)
+	}
+
+	return result
+}
+
+func TestEngine_ThresholdLifecycle(t *testing.T) {
+	source := &fakeSource{gauges: map[string]float64{"cpu_1": 95, "cpu_2": 10}}
+	engine, clock := newTestEngine(source, Rule{
+		Name: "high_cpu", Kind: KindThreshold, Metric: "cpu_*", Op: ">", Threshold: 90,
+		For: Duration(time.Minute), Labels: map[string]string{"severity": "page"},
+	})
+	ctx := context.Background()
+
+	transitions, err := engine.Evaluate(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"cpu_1:inactive->pending"}, states(transitions))
+
+	clock.advance(30 * time.Second)
+	transitions, err = engine.Evaluate(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, transitions)
+
+	clock.advance(30 * time.Second)
+	transitions, err = engine.Evaluate(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"cpu_1:pending->firing"}, states(transitions))
+
+	alerts, err := engine.Alerts(ctx)
+	require.NoError(t, err)
+	require.Len(t, alerts, 1)
+	assert.Equal(t, StateFiring, alerts[0].State)
+	assert.Equal(t, "page", alerts[0].Labels["severity"])
+	assert.Equal(t, "value 95 > 90", alerts[0].Description)
+	assert.Equal(t, "high_cpu/gauge/cpu_1", alerts[0].Key())
+
+	source.gauges["cpu_1"] = 50
+	clock.advance(time.Minute)
+	transitions, err = engine.Evaluate(ctx)
+	require.NoError(t, err)
+	require.Len(t, transitions, 1)
+	assert.Equal(t, StateResolved, transitions[0].To)
+	assert.Equal(t, clock.now, transitions[0].Alert.ResolvedAt)
+
+	alerts, err = engine.Alerts(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, alerts)
+}
+
+func TestEngine_ThresholdWithoutFor(t *testing.T) {
+	source := &fakeSource{counters: map[string]int64{"errors": 5}}
+	engine, _ := newTestEngine(source, Rule{Name: "errors", Kind: KindThreshold, Metric: "errors", Op: ">=", Threshold: 5})
+
+	transitions, err := engine.Evaluate(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, []string{"errors:inactive->pending", "errors:pending->firing"}, states(transitions))
+
+	// метрика удалена: оповещение разрешается
+	source.counters = map[string]int64{}
+	transitions, err = engine.Evaluate(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, []string{"errors:firing->resolved"}, states(transitions))
+}
+
+func TestEngine_PendingResolved(t *testing.T) {
+	source := &fakeSource{gauges: map[string]float64{"cpu": 95}}
+	engine, clock := newTestEngine(source, Rule{
+		Name: "cpu", Kind: KindThreshold, Metric: "cpu", Op: ">", Threshold: 90, For: Duration(time.Hour),
+	})
+
+	_, err := engine.Evaluate(context.Background())
+	require.NoError(t, err)
+
+	source.gauges["cpu"] = 10
+	clock.advance(time.Minute)
+	transitions, err := engine.Evaluate(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, []string{"cpu:pending->resolved"}, states(transitions))
+}
+
+func TestEngine_Anomaly(t *testing.T) {
+	for _, method := range []string{MethodEWMA, MethodZScore} {
+		t.Run(method, func(t *testing.T) {
+			source := &fakeSource{gauges: map[string]float64{}}
+			engine, clock := newTestEngine(source, Rule{
+				Name: "gc", Kind: KindAnomaly, Metric: "GCCPUFraction",
+				Anomaly: &Anomaly{Method: method, Window: 10, Sensitivity: 3, WarmUp: Duration(5 * time.Minute)},
+			})
+			ctx := context.Background()
+
+			// во время прогрева даже резкий скачок не создает оповещения
+			for i, value := range []float64{0.10, 0.12, 0.9, 0.11, 0.10, 0.12} {
+				source.gauges["GCCPUFraction"] = value
+				transitions, err := engine.Evaluate(ctx)
+				require.NoError(t, err)
+				assert.Empty(t, transitions, "sample %d", i)
+				clock.advance(time.Minute)
+			}
+
+			for _, value := range []float64{0.11, 0.10, 0.12, 0.11} {
+				source.gauges["GCCPUFraction"] = value
+				transitions, err := engine.Evaluate(ctx)
+				require.NoError(t, err)
+				assert.Empty(t, transitions)
+				clock.advance(time.Minute)
+			}
+
+			source.gauges["GCCPUFraction"] = 5
+			transitions, err := engine.Evaluate(ctx)
+			require.NoError(t, err)
+			assert.Equal(t, []string{"GCCPUFraction:inactive->pending", "GCCPUFraction:pending->firing"},
+				states(transitions))
+			assert.Contains(t, transitions[1].Alert.Description, "standard deviations")
+
+			source.gauges["GCCPUFraction"] = 0.11
+			clock.advance(time.Minute)
+			transitions, err = engine.Evaluate(ctx)
+			require.NoError(t, err)
+			assert.Equal(t, []string{"GCCPUFraction:firing->resolved"}, states(transitions))
+		})
+	}
+}
+
+func TestEngine_AnomalyFlatMetric(t *testing.T) {
+	source := &fakeSource{gauges: map[string]float64{"latency": 100}}
+	engine, clock := newTestEngine(source, Rule{
+		Name: "latency", Kind: KindAnomaly, Metric: "latency", Anomaly: &Anomaly{Method: MethodEWMA},
+	})
+	ctx := context.Background()
+
+	// значение, не обновлявшееся между вычислениями, учитывается в базовой линии один раз
+	for i := range 10 {
+		if i%5 == 0 {
+			source.times.Gauges = map[string]time.Time{"latency": clock.now}
+		}
+
+		transitions, err := engine.Evaluate(ctx)
+		require.NoError(t, err)
+		assert.Empty(t, transitions)
+		clock.advance(time.Minute)
+	}
+
+	assert.Equal(t, 2, engine.detectors["latency/gauge/latency"].samples)
+
+	// у постоянной метрики небольшое изменение не считается бесконечным отклонением
+	source.gauges["latency"] = 100.5
+	source.times.Gauges = map[string]time.Time{"latency": clock.now}
+	transitions, err := engine.Evaluate(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, transitions)
+
+	source.gauges["latency"] = 110
+	source.times.Gauges = map[string]time.Time{"latency": clock.now.Add(time.Second)}
+	transitions, err = engine.Evaluate(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"latency:inactive->pending", "latency:pending->firing"}, states(transitions))
+}
+
+func TestEngine_SourceError(t *testing.T) {
+	engine, _ := newTestEngine(&fakeSource{err: errors.New("db is down")},
+		Rule{Name: "cpu", Kind: KindThreshold, Metric: "cpu", Op: ">", Threshold: 90})
+
+	_, err := engine.Evaluate(context.Background())
+	assert.Error(t, err)
+}
+
+func TestEngine_Absence(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	source := &fakeSource{times: model.UpdateTimes{
+		Gauges:   map[string]time.Time{"Alloc": start, "cpu": start},
+		Counters: map[string]time.Time{"PollCount": start},
+	}}
+	agents := fakeAgents{"ip:10.0.0.1": start, "ip:10.0.0.2": start}
+
+	engine, clock := newTestEngine(source,
+		Rule{Name: "stale_alloc", Kind: KindAbsence, Metric: "Alloc", MType: "gauge", Interval: Duration(10 * time.Second)},
+		Rule{Name: "agent_down", Kind: KindAbsence, Agent: "ip:*", Interval: Duration(10 * time.Second), Multiple: 2,
+			Labels: map[string]string{"severity": "page"}},
+	)
+	engine.agents = agents
+	ctx := context.Background()
+
+	clock.advance(20 * time.Second)
+	agents["ip:10.0.0.1"] = clock.now
+
+	transitions, err := engine.Evaluate(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"ip:10.0.0.2:inactive->pending", "ip:10.0.0.2:pending->firing"}, states(transitions))
+	assert.Equal(t, "no updates for 20s (expected every 10s)", transitions[1].Alert.Description)
+	assert.Equal(t, "page", transitions[1].Alert.Labels["severity"])
+
+	silent, err := engine.Agents(ctx, true)
+	require.NoError(t, err)
+	assert.Equal(t, []AgentStatus{{Agent: "ip:10.0.0.2", LastSeen: start, Rules: []string{"agent_down"}, Silent: true}},
+		silent)
+
+	all, err := engine.Agents(ctx, false)
+	require.NoError(t, err)
+	assert.Len(t, all, 2)
+	assert.False(t, all[0].Silent)
+
+	// метрика молчит дольше трех интервалов по умолчанию
+	clock.advance(10 * time.Second)
+	transitions, err = engine.Evaluate(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"Alloc:inactive->pending", "Alloc:pending->firing"}, states(transitions))
+	assert.Equal(t, float64(30), transitions[0].Alert.Value)
+
+	// отчеты возобновились
+	source.times.Gauges["Alloc"] = clock.now
+	agents["ip:10.0.0.2"] = clock.now
+	transitions, err = engine.Evaluate(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"Alloc:firing->resolved", "ip:10.0.0.2:firing->resolved"}, states(transitions))
+
+	silent, err = engine.Agents(ctx, true)
+	require.NoError(t, err)
+	assert.Empty(t, silent)
+}
+
+func TestEngine_AbsenceForgottenAgent(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	agents := fakeAgents{"ip:10.0.0.1": start}
+
+	engine, clock := newTestEngine(&fakeSource{},
+		Rule{Name: "agent_down", Kind: KindAbsence, Agent: "ip:*", Interval: Duration(10 * time.Second)})
+	engine.agents = agents
+	ctx := context.Background()
+
+	clock.advance(time.Minute)
+	transitions, err := engine.Evaluate(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"ip:10.0.0.1:inactive->pending", "ip:10.0.0.1:pending->firing"}, states(transitions))
+
+	// агент забыт после долгого молчания: оповещение продолжает срабатывать
+	delete(agents, "ip:10.0.0.1")
+	clock.advance(24 * time.Hour)
+	transitions, err = engine.Evaluate(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, transitions)
+
+	alerts, err := engine.Alerts(ctx)
+	require.NoError(t, err)
+	require.Len(t, alerts, 1)
+	assert.Equal(t, StateFiring, alerts[0].State)
+
+	// оповещение разрешается, когда агент снова присылает отчет
+	agents["ip:10.0.0.1"] = clock.now
+	transitions, err = engine.Evaluate(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"ip:10.0.0.1:firing->resolved"}, states(transitions))
+}
+
+func TestEngine_AgentsWithoutSource(t *testing.T) {
+	engine, _ := newTestEngine(&fakeSource{})
+
+	agents, err := engine.Agents(context.Background(), false)
+	require.NoError(t, err)
+	assert.Empty(t, agents)
+}
@@ -0,0 +1,382 @@
+package alerting
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sort"
+	"time"
+)
+
+// RuleVersion версия правила. Правила, управляемые через API, версионируются: каждое изменение
+// сохраняется новой версией с номером на единицу больше предыдущего, удаление сохраняется
+// версией с Deleted. Статические правила из конфигурации отмечены Static и имеют нулевую версию,
+// изменить их через API нельзя.
+type RuleVersion struct {
+	UpdatedAt time.Time `json:"updated_at,omitzero"`
+	UpdatedBy string    `json:"updated_by,omitempty"`
+	Rule      Rule      `json:"rule"`
+	Version   int       `json:"version"`
+	Deleted   bool      `json:"deleted,omitempty"`
+	Static    bool      `json:"static,omitempty"`
+}
+
+// RuleStore хранилище версий правил, управляемых через API.
+type RuleStore interface {
+	GetRuleVersions(ctx context.Context) ([]RuleVersion, error)
+	// SaveRuleVersion добавляет версию правила. Если версия с тем же номером уже есть,
+	// возвращается ошибка ErrConflict.
+	SaveRuleVersion(ctx context.Context, version RuleVersion) error
+}
+
+// RuleResult результат пробного вычисления правила для одной метрики или агента.
+// State содержит состояние, в котором оказалось бы оповещение: inactive, pending или firing.
+type RuleResult struct {
+	Metric      string  `json:"metric,omitempty"`
+	MType       string  `json:"type,omitempty"`
+	Agent       string  `json:"agent,omitempty"`
+	State       string  `json:"state"`
+	Description string  `json:"description,omitempty"`
+	Value       float64 `json:"value"`
+}
+
+// loadRules загружает версии правил из хранилища при первом обращении. Вызывается под ruleMu.
+func (e *Engine) loadRules(ctx context.Context) error {
+	if e.ruleVersions != nil {
+		return nil
+	}
+
+	versions := make(map[string][]RuleVersion)
+
+	if e.ruleStore != nil {
+		stored, err := e.ruleStore.GetRuleVersions(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to load rules: %w", err)
+		}
+
+		for _, v := range stored {
+			versions[v.Rule.Name] = append(versions[v.Rule.Name], v)
+		}
+
+		for _, list := range versions {
+			sort.Slice(list, func(i, j int) bool { return list[i].Version < list[j].Version })
+		}
+	}
+
+	e.ruleVersions = versions
+
+	return nil
+}
+
+// staticRule возвращает статическое правило по имени.
+func (e *Engine) staticRule(name string) (Rule, bool) {
+	for _, rule := range e.rules {
+		if rule.Name == name {
+			return rule, true
+		}
+	}
+
+	return Rule{}, false
+}
+
+// current возвращает последнюю версию правила, управляемого через API, если оно не удалено.
+// Вызывается под ruleMu.
+func (e *Engine) current(name string) (RuleVersion, bool) {
+	list := e.ruleVersions[name]
+	if len(list) == 0 || list[len(list)-1].Deleted {
+		return RuleVersion{}, false
+	}
+
+	return list[len(list)-1], true
+}
+
+// ruleList возвращает статические правила и текущие версии правил, управляемых через API,
+// отсортированные по имени. Правило API с именем статического правила не действует.
+// Вызывается под ruleMu.
+func (e *Engine) ruleList() []RuleVersion {
+	rules := make([]RuleVersion, 0, len(e.rules)+len(e.ruleVersions))
+	for _, rule := range e.rules {
+		rules = append(rules, RuleVersion{Rule: rule, Static: true})
+	}
+
+	for _, name := range sortedKeys(e.ruleVersions) {
+		if _, ok := e.staticRule(name); ok {
+			continue
+		}
+
+		if v, ok := e.current(name); ok {
+			rules = append(rules, v)
+		}
+	}
+
+	return rules
+}
+
+// activeRules возвращает правила, которые вычисляются движком: сначала статические
+// в порядке конфигурации, затем правила API по имени.
+func (e *Engine) activeRules(ctx context.Context) ([]Rule, error) {
+	e.ruleMu.Lock()
+	defer e.ruleMu.Unlock()
+
+	if err := e.loadRules(ctx); err != nil {
+		return nil, err
+	}
+
+	list := e.ruleList()
+	rules := make([]Rule, 0, len(list))
+
+	for _, v := range list {
+		rules = append(rules, v.Rule)
+	}
+
+	return rules, nil
+}
+
+// Rules возвращает статические правила и текущие версии правил, управляемых через API.
+func (e *Engine) Rules(ctx context.Context) ([]RuleVersion, error) {
+	e.ruleMu.Lock()
+	defer e.ruleMu.Unlock()
+
+	if err := e.loadRules(ctx); err != nil {
+		return nil, err
+	}
+
+	rules := e.ruleList()
+	sort.SliceStable(rules, func(i, j int) bool { return rules[i].Rule.Name < rules[j].Rule.Name })
+
+	return rules, nil
+}
+
+// Rule возвращает текущую версию правила или ошибку ErrNotFound.
+func (e *Engine) Rule(ctx context.Context, name string) (RuleVersion, error) {
+	if rule, ok := e.staticRule(name); ok {
+		return RuleVersion{Rule: rule, Static: true}, nil
+	}
+
+	e.ruleMu.Lock()
+	defer e.ruleMu.Unlock()
+
+	if err := e.loadRules(ctx); err != nil {
+		return RuleVersion{}, err
+	}
+
+	v, ok := e.current(name)
+	if !ok {
+		return RuleVersion{}, fmt.Errorf("rule %q: %w", name, ErrNotFound)
+	}
+
+	return v, nil
+}
+
+// RuleVersions возвращает все версии правила от старых к новым, включая удаления.
+// Для статического правила возвращается единственная версия. Если версий нет,
+// возвращается ErrNotFound.
+func (e *Engine) RuleVersions(ctx context.Context, name string) ([]RuleVersion, error) {
+	if rule, ok := e.staticRule(name); ok {
+		return []RuleVersion{{Rule: rule, Static: true}}, nil
+	}
+
+	e.ruleMu.Lock()
+	defer e.ruleMu.Unlock()
+
+	if err := e.loadRules(ctx); err != nil {
+		return nil, err
+	}
+
+	list := e.ruleVersions[name]
+	if len(list) == 0 {
+		return nil, fmt.Errorf("rule %q: %w", name, ErrNotFound)
+	}
+
+	return append([]RuleVersion(nil), list...), nil
+}
+
+// CreateRule проверяет и сохраняет новое правило. Если правило с таким именем уже есть,
+// возвращается ErrConflict. Нумерация версий удаленного правила продолжается.
+func (e *Engine) CreateRule(ctx context.Context, rule Rule, by string) (RuleVersion, error) {
+	return e.saveRule(ctx, RuleVersion{Rule: rule, UpdatedBy: by}, func(_ RuleVersion, exists bool) error {
+		if exists {
+			return fmt.Errorf("rule %q: %w: rule already exists", rule.Name, ErrConflict)
+		}
+
+		return nil
+	})
+}
+
+// UpdateRule сохраняет новую версию правила. Ненулевой version задает ожидаемую текущую версию:
+// если правило успело измениться, возвращается ErrConflict. Если правила нет, возвращается
+// ErrNotFound. Если новая версия меняет не только метки, при следующем вычислении оповещения
+// правила разрешаются, а его базовые линии anomaly строятся заново.
+func (e *Engine) UpdateRule(ctx context.Context, rule Rule, version int, by string) (RuleVersion, error) {
+	return e.saveRule(ctx, RuleVersion{Rule: rule, UpdatedBy: by}, func(current RuleVersion, exists bool) error {
+		return checkVersion(rule.Name, current, exists, version)
+	})
+}
+
+// DeleteRule удаляет правило, сохраняя версию-отметку об удалении. Оповещения правила
+// разрешаются при следующем вычислении, а базовые линии удаляются. Ненулевой version проверяется как в UpdateRule.
+func (e *Engine) DeleteRule(ctx context.Context, name string, version int, by string) error {
+	_, err := e.saveRule(ctx, RuleVersion{Rule: Rule{Name: name}, UpdatedBy: by, Deleted: true},
+		func(current RuleVersion, exists bool) error {
+			return checkVersion(name, current, exists, version)
+		})
+
+	return err
+}
+
+func checkVersion(name string, current RuleVersion, exists bool, version int) error {
+	switch {
+	case !exists:
+		return fmt.Errorf("rule %q: %w", name, ErrNotFound)
+	case version != 0 && version != current.Version:
+		return fmt.Errorf("rule %q: %w: current version is %d", name, ErrConflict, current.Version)
+	}
+
+	return nil
+}
+
+// saveRule сохраняет следующую версию правила, если ее разрешает allow.
+func (e *Engine) saveRule(ctx context.Context, v RuleVersion,
+	allow func(current RuleVersion, exists bool) error) (RuleVersion, error) {
+	if !v.Deleted {
+		if err := v.Rule.Validate(); err != nil {
+			return RuleVersion{}, err
+		}
+	}
+
+	if _, ok := e.staticRule(v.Rule.Name); ok {
+		return RuleVersion{}, fmt.Errorf("rule %q: %w: rule is defined in the configuration", v.Rule.Name, ErrConflict)
+	}
+
+	e.ruleMu.Lock()
+	defer e.ruleMu.Unlock()
+
+	if err := e.loadRules(ctx); err != nil {
+		return RuleVersion{}, err
+	}
+
+	current, exists := e.current(v.Rule.Name)
+	if err := allow(current, exists); err != nil {
+		return RuleVersion{}, err
+	}
+
+	if list := e.ruleVersions[v.Rule.Name]; len(list) > 0 {
+		v.Version = list[len(list)-1].Version
+	}
+
+	v.Version++
+	v.UpdatedAt = e.now()
+
+	if e.ruleStore != nil {
+		if err := e.ruleStore.SaveRuleVersion(ctx, v); err != nil {
+			return RuleVersion{}, fmt.Errorf("failed to save rule: %w", err)
+		}
+	}
+
+	e.ruleVersions[v.Rule.Name] = append(e.ruleVersions[v.Rule.Name], v)
+
+	if exists && (v.Deleted || !sameCondition(current.Rule, v.Rule)) {
+		e.resets[v.Rule.Name] = true
+	}
+
+	return v, nil
+}
+
+// sameCondition сообщает, что правила отличаются только метками, и оповещения и базовые линии
+// одного подходят другому.
+func sameCondition(a, b Rule) bool {
+	a.Labels, b.Labels = nil, nil
+
+	return reflect.DeepEqual(a, b)
+}
+
+// takeResets возвращает правила, состояние которых нужно сбросить, и очищает их список.
+func (e *Engine) takeResets() map[string]bool {
+	e.ruleMu.Lock()
+	defer e.ruleMu.Unlock()
+
+	resets := e.resets
+	e.resets = make(map[string]bool)
+
+	return resets
+}
+
+// EvaluateRule вычисляет правило по текущим значениям метрик, не меняя состояние оповещений.
+// Если правило с тем же именем уже действует, учитываются время активации его оповещений
+// и базовые линии anomaly; для нового правила anomaly базовая линия еще не построена,
+// и оно не срабатывает.
+func (e *Engine) EvaluateRule(ctx context.Context, rule Rule) ([]RuleResult, error) {
+	if err := rule.Validate(); err != nil {
+		return nil, err
+	}
+
+	now := e.now()
+
+	var (
+		targets []metricValue
+		err     error
+	)
+
+	switch rule.Kind {
+	case KindAbsence:
+		targets, err = e.idleTimes(ctx, now)
+	case KindAnomaly:
+		if targets, err = e.metricValues(ctx); err == nil {
+			err = e.addUpdateTimes(ctx, targets)
+		}
+	default:
+		targets, err = e.metricValues(ctx)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if err = e.restore(ctx); err != nil {
+		return nil, err
+	}
+
+	results := []RuleResult{}
+
+	for _, metric := range targets {
+		if !metric.matchedBy(rule) {
+			continue
+		}
+
+		key := metric.key(rule.Name)
+
+		d := &detector{}
+		if existing, ok := e.detectors[key]; ok {
+			d = existing.clone()
+		}
+
+		active, description := check(rule, d, metric, now)
+
+		state := StateInactive
+		if active {
+			since := now
+			if alert, ok := e.alerts[key]; ok {
+				since = alert.ActiveAt
+			}
+
+			state = StatePending
+			if now.Sub(since) >= time.Duration(rule.For) {
+				state = StateFiring
+			}
+		}
+
+		results = append(results, RuleResult{
+			Metric:      metric.name,
+			MType:       metric.mType,
+			Agent:       metric.agent,
+			State:       state,
+			Description: description,
+			Value:       metric.value,
+		})
+	}
+
+	return results, nil
+}
@@ -0,0 +1,274 @@
+//nolint:wrapcheck,nolintlint,errcheck
+package alerting
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeRuleStore хранилище версий правил в памяти.
+type fakeRuleStore struct {
+	err      error
+	versions []RuleVersion
+}
+
+func (s *fakeRuleStore) GetRuleVersions(context.Context) ([]RuleVersion, error) {
+	return s.versions, s.err
+}
+
+func (s *fakeRuleStore) SaveRuleVersion(_ context.Context, version RuleVersion) error {
+	if s.err != nil {
+		return s.err
+	}
+
+	s.versions = append(s.versions, version)
+
+	return nil
+}
+
+func TestEngine_ManagedRules(t *testing.T) {
+	static := Rule{Name: "disk_full", Kind: KindThreshold, Metric: "disk", Op: ">", Threshold: 95}
+	source := &fakeSource{gauges: map[string]float64{"cpu": 95, "disk": 50}}
+	engine, clock := newTestEngine(source, static)
+	store := &fakeRuleStore{}
+	engine.ruleStore = store
+	ctx := context.Background()
+
+	rule := Rule{Name: "high_cpu", Kind: KindThreshold, Metric: "cpu", Op: ">", Threshold: 90}
+
+	created, err := engine.CreateRule(ctx, rule, "alice")
+	require.NoError(t, err)
+	assert.Equal(t, RuleVersion{Rule: rule, Version: 1, UpdatedBy: "alice", UpdatedAt: clock.now}, created)
+
+	_, err = engine.CreateRule(ctx, rule, "alice")
+	assert.ErrorIs(t, err, ErrConflict)
+
+	transitions, err := engine.Evaluate(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"cpu:inactive->pending", "cpu:pending->firing"}, states(transitions))
+
+	// новая версия начинает действовать со следующего вычисления
+	clock.advance(time.Minute)
+	rule.Threshold = 99
+
+	_, err = engine.UpdateRule(ctx, rule, 2, "bob")
+	require.ErrorIs(t, err, ErrConflict, "stale version")
+
+	updated, err := engine.UpdateRule(ctx, rule, 1, "bob")
+	require.NoError(t, err)
+	assert.Equal(t, 2, updated.Version)
+
+	transitions, err = engine.Evaluate(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"cpu:firing->resolved"}, states(transitions))
+
+	rules, err := engine.Rules(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []RuleVersion{{Rule: static, Static: true}, updated}, rules)
+
+	source.gauges["cpu"] = 100
+	transitions, err = engine.Evaluate(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"cpu:inactive->pending", "cpu:pending->firing"}, states(transitions))
+
+	// оповещения удаленного правила разрешаются при следующем вычислении
+	require.NoError(t, engine.DeleteRule(ctx, "high_cpu", 0, "carol"))
+
+	transitions, err = engine.Evaluate(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"cpu:firing->resolved"}, states(transitions))
+
+	_, err = engine.Rule(ctx, "high_cpu")
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	versions, err := engine.RuleVersions(ctx, "high_cpu")
+	require.NoError(t, err)
+	require.Len(t, versions, 3)
+	assert.True(t, versions[2].Deleted)
+	assert.Equal(t, "carol", versions[2].UpdatedBy)
+
+	// правило можно создать заново, нумерация версий продолжается
+	recreated, err := engine.CreateRule(ctx, rule, "alice")
+	require.NoError(t, err)
+	assert.Equal(t, 4, recreated.Version)
+
+	// после перезапуска правила загружаются из хранилища
+	restarted, _ := newTestEngine(source, static)
+	restarted.ruleStore = store
+
+	current, err := restarted.Rule(ctx, "high_cpu")
+	require.NoError(t, err)
+	assert.Equal(t, recreated, current)
+}
+
+func TestEngine_ManagedRuleReset(t *testing.T) {
+	source := &fakeSource{gauges: map[string]float64{"cpu": 95}}
+	engine, clock := newTestEngine(source)
+	ctx := context.Background()
+
+	rule := Rule{Name: "high_cpu", Kind: KindThreshold, Metric: "cpu", Op: ">", Threshold: 90, For: Duration(10 * time.Minute)}
+
+	_, err := engine.CreateRule(ctx, rule, "alice")
+	require.NoError(t, err)
+
+	transitions, err := engine.Evaluate(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"cpu:inactive->pending"}, states(transitions))
+
+	// изменение меток не меняет условие: оповещение продолжает ожидание
+	clock.advance(5 * time.Minute)
+	rule.Labels = map[string]string{"severity": "page"}
+	_, err = engine.UpdateRule(ctx, rule, 0, "alice")
+	require.NoError(t, err)
+
+	transitions, err = engine.Evaluate(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, transitions)
+
+	// новое условие: ожидание начинается заново, а не с прежнего времени активации
+	rule.Threshold = 80
+	_, err = engine.UpdateRule(ctx, rule, 0, "alice")
+	require.NoError(t, err)
+
+	transitions, err = engine.Evaluate(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"cpu:pending->resolved", "cpu:inactive->pending"}, states(transitions))
+
+	clock.advance(5 * time.Minute)
+	transitions, err = engine.Evaluate(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, transitions)
+
+	// базовая линия anomaly строится заново после изменения параметров
+	anomaly := Rule{Name: "cpu_anomaly", Kind: KindAnomaly, Metric: "cpu", Anomaly: &Anomaly{Method: MethodEWMA}}
+	_, err = engine.CreateRule(ctx, anomaly, "alice")
+	require.NoError(t, err)
+
+	for range 3 {
+		_, err = engine.Evaluate(ctx)
+		require.NoError(t, err)
+		clock.advance(time.Minute)
+	}
+
+	assert.Equal(t, 3, engine.detectors["cpu_anomaly/gauge/cpu"].samples)
+
+	anomaly.Anomaly = &Anomaly{Method: MethodEWMA, Alpha: 0.5}
+	_, err = engine.UpdateRule(ctx, anomaly, 0, "alice")
+	require.NoError(t, err)
+
+	_, err = engine.Evaluate(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 1, engine.detectors["cpu_anomaly/gauge/cpu"].samples)
+
+	require.NoError(t, engine.DeleteRule(ctx, "cpu_anomaly", 0, "alice"))
+	_, err = engine.Evaluate(ctx)
+	require.NoError(t, err)
+	assert.NotContains(t, engine.detectors, "cpu_anomaly/gauge/cpu")
+}
+
+func TestEngine_ManagedRuleErrors(t *testing.T) {
+	static := Rule{Name: "disk_full", Kind: KindThreshold, Metric: "disk", Op: ">", Threshold: 95}
+	engine, _ := newTestEngine(&fakeSource{}, static)
+	ctx := context.Background()
+
+	_, err := engine.CreateRule(ctx, Rule{Name: "bad", Kind: KindThreshold, Metric: "cpu", Op: "~"}, "alice")
+	assert.ErrorIs(t, err, ErrInvalidRule)
+
+	_, err = engine.CreateRule(ctx, static, "alice")
+	assert.ErrorIs(t, err, ErrConflict)
+
+	_, err = engine.UpdateRule(ctx, static, 0, "alice")
+	assert.ErrorIs(t, err, ErrConflict)
+
+	assert.ErrorIs(t, engine.DeleteRule(ctx, "disk_full", 0, "alice"), ErrConflict)
+	assert.ErrorIs(t, engine.DeleteRule(ctx, "missing", 0, "alice"), ErrNotFound)
+
+	_, err = engine.UpdateRule(ctx, Rule{Name: "missing", Kind: KindThreshold, Metric: "cpu", Op: ">"}, 0, "alice")
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	_, err = engine.RuleVersions(ctx, "missing")
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	versions, err := engine.RuleVersions(ctx, "disk_full")
+	require.NoError(t, err)
+	assert.Equal(t, []RuleVersion{{Rule: static, Static: true}}, versions)
+
+	store := &fakeRuleStore{err: errors.New("store unavailable")}
+	failing, _ := newTestEngine(&fakeSource{})
+	failing.ruleStore = store
+
+	_, err = failing.Rules(ctx)
+	assert.ErrorIs(t, err, store.err)
+
+	_, err = failing.Evaluate(ctx)
+	assert.ErrorIs(t, err, store.err)
+}
+
+func TestEngine_EvaluateRule(t *testing.T) {
+	source := &fakeSource{gauges: map[string]float64{"cpu_1": 95, "cpu_2": 10}}
+	rule := Rule{Name: "high_cpu", Kind: KindThreshold, Metric: "cpu_*", Op: ">", Threshold: 90, For: Duration(time.Minute)}
+	engine, clock := newTestEngine(source, rule)
+	ctx := context.Background()
+
+	results, err := engine.EvaluateRule(ctx, rule)
+	require.NoError(t, err)
+	assert.Equal(t, []RuleResult{
+		{Metric: "cpu_1", MType: "gauge", State: StatePending, Description: "value 95 > 90", Value: 95},
+		{Metric: "cpu_2", MType: "gauge", State: StateInactive, Description: "value 10 > 90", Value: 10},
+	}, results)
+
+	// пробное вычисление не меняет состояние
+	alerts, err := engine.Alerts(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, alerts)
+
+	// время активации действующего оповещения учитывается
+	_, err = engine.Evaluate(ctx)
+	require.NoError(t, err)
+
+	clock.advance(time.Minute)
+
+	results, err = engine.EvaluateRule(ctx, rule)
+	require.NoError(t, err)
+	assert.Equal(t, StateFiring, results[0].State)
+
+	_, err = engine.EvaluateRule(ctx, Rule{Name: "bad", Kind: KindThreshold})
+	assert.ErrorIs(t, err, ErrInvalidRule)
+}
+
+func TestEngine_EvaluateRuleAnomaly(t *testing.T) {
+	source := &fakeSource{gauges: map[string]float64{"latency": 100}}
+	rule := Rule{Name: "latency_spike", Kind: KindAnomaly, Metric: "latency", Anomaly: &Anomaly{Method: MethodZScore}}
+	engine, clock := newTestEngine(source, rule)
+	ctx := context.Background()
+
+	for _, v := range []float64{100, 101, 99, 100, 102} {
+		source.gauges["latency"] = v
+		_, err := engine.Evaluate(ctx)
+		require.NoError(t, err)
+		clock.advance(time.Minute)
+	}
+
+	source.gauges["latency"] = 500
+
+	for range 2 {
+		results, err := engine.EvaluateRule(ctx, rule)
+		require.NoError(t, err)
+		require.Len(t, results, 1)
+		assert.Equal(t, StateFiring, results[0].State)
+	}
+
+	// базовая линия не изменилась: пробные значения в нее не попали
+	assert.Equal(t, 5, engine.detectors["latency_spike/gauge/latency"].samples)
+
+	// у нового правила базовой линии еще нет
+	rule.Name = "latency_new"
+	results, err := engine.EvaluateRule(ctx, rule)
+	require.NoError(t, err)
+	assert.Equal(t, StateInactive, results[0].State)
+}
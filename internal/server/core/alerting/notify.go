@@ -0,0 +1,503 @@
+package alerting
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// ErrInvalidRouting ошибка проверки параметров доставки уведомлений.
+var ErrInvalidRouting = errors.New("invalid routing")
+
+// Channel канал доставки уведомлений, например вебхук.
+type Channel interface {
+	Notify(ctx context.Context, n Notification) error
+}
+
+// Notification уведомление о группе оповещений для одного уровня эскалации.
+// Alerts содержит срабатывающие оповещения группы и оповещения, разрешенные после прошлого
+// уведомления. Status равен firing, если в группе есть срабатывающие оповещения, иначе resolved.
+type Notification struct {
+	Labels  map[string]string `json:"group_labels"`
+	GroupID string            `json:"group_id"`
+	Status  string            `json:"status"`
+	Channel string            `json:"channel"`
+	Alerts  []Alert           `json:"alerts"`
+	Tier    int               `json:"tier"`
+}
+
+// Tier уровень эскалации: канал Channel уведомляется, когда группа срабатывает дольше After.
+// Уровни после первого уведомляются, только пока группа не подтверждена.
+type Tier struct {
+	Channel string   `json:"channel"`
+	After   Duration `json:"after,omitempty"`
+}
+
+// Routing параметры доставки уведомлений.
+//
+// Срабатывающие оповещения объединяются в группы по значениям полей GroupBy (rule, metric,
+// agent или имена меток правила, по умолчанию rule), и по группе отправляется одно уведомление.
+// Первое уведомление откладывается на GroupWait, чтобы собрать оповещения, сработавшие почти
+// одновременно. Следующие уведомления отправляются, когда состав группы меняется, и повторяются
+// каждые RepeatInterval, пока группа срабатывает и не подтверждена. Нулевой RepeatInterval
+// отключает повторы. Escalation задает уровни эскалации по возрастанию After; без уровней
+// уведомления не отправляются. Заглушенные оповещения в уведомления не попадают.
+//
+// Группы и подтверждения хранятся в памяти. После перезапуска сервера эскалация групп
+// восстановленных оповещений начинается заново с первого уровня.
+type Routing struct {
+	GroupBy        []string `json:"group_by,omitempty"`
+	Escalation     []Tier   `json:"escalation"`
+	GroupWait      Duration `json:"group_wait,omitempty"`
+	RepeatInterval Duration `json:"repeat_interval,omitempty"`
+}
+
+// groupBy возвращает поля группировки с учетом значения по умолчанию.
+func (r Routing) groupBy() []string {
+	if len(r.GroupBy) == 0 {
+		return []string{MatchRule}
+	}
+
+	return r.GroupBy
+}
+
+// ValidateRouting проверяет параметры доставки уведомлений по известным каналам.
+// Ошибка оборачивает ErrInvalidRouting.
+func ValidateRouting(r Routing, channels map[string]Channel) error {
+	if err := validateRouting(r, channels); err != nil {
+		return fmt.Errorf("%w: %w", ErrInvalidRouting, err)
+	}
+
+	return nil
+}
+
+func validateRouting(r Routing, channels map[string]Channel) error {
+	names := make(map[string]bool, len(r.GroupBy))
+
+	for _, name := range r.GroupBy {
+		switch {
+		case strings.TrimSpace(name) == "":
+			return errors.New("empty group_by field")
+		case names[name]:
+			return fmt.Errorf("duplicate group_by field %q", name)
+		}
+
+		names[name] = true
+	}
+
+	if r.GroupWait < 0 || r.RepeatInterval < 0 {
+		return errors.New("group_wait and repeat_interval must not be negative")
+	}
+
+	for i, tier := range r.Escalation {
+		if _, ok := channels[tier.Channel]; !ok {
+			return fmt.Errorf("tier %d: unknown channel %q", i, tier.Channel)
+		}
+
+		switch {
+		case tier.After < 0:
+			return fmt.Errorf("tier %d: negative after", i)
+		case i > 0 && tier.After < r.Escalation[i-1].After:
+			return fmt.Errorf("tier %d: tiers must be ordered by after", i)
+		}
+	}
+
+	return nil
+}
+
+// Group группа срабатывающих оповещений с одинаковыми значениями полей группировки Labels.
+// Tiers содержит количество уже уведомленных уровней эскалации.
+type Group struct {
+	FiringSince    time.Time         `json:"firing_since"`
+	NotifiedAt     time.Time         `json:"notified_at,omitzero"`
+	AcknowledgedAt time.Time         `json:"acknowledged_at,omitzero"`
+	Labels         map[string]string `json:"labels"`
+	ID             string            `json:"id"`
+	AcknowledgedBy string            `json:"acknowledged_by,omitempty"`
+	Alerts         []Alert           `json:"alerts"`
+	Tiers          int               `json:"tiers"`
+}
+
+// group состояние группы оповещений. Разрешенные оповещения остаются в группе до уведомления
+// о них на всех уровнях.
+type group struct {
+	info    Group
+	alerts  map[string]Alert
+	failed  map[int]bool // уровни, которым не удалось доставить последнее уведомление
+	changed bool         // состав группы изменился после последнего уведомления
+}
+
+func (g *group) view() Group {
+	info := g.info
+	info.Labels = maps.Clone(g.info.Labels)
+	info.Alerts = make([]Alert, 0, len(g.alerts))
+
+	for _, key := range sortedKeys(g.alerts) {
+		info.Alerts = append(info.Alerts, g.alerts[key])
+	}
+
+	return info
+}
+
+func (g *group) firing() bool {
+	for _, alert := range g.alerts {
+		if alert.State == StateFiring {
+			return true
+		}
+	}
+
+	return false
+}
+
+// groupLabels возвращает значения полей группировки оповещения и идентификатор его группы.
+func (e *Engine) groupLabels(alert *Alert) (map[string]string, string) {
+	fields := e.routing.groupBy()
+	labels := make(map[string]string, len(fields))
+	h := fnv.New64a()
+
+	for _, name := range fields {
+		labels[name] = alert.field(name)
+		_, _ = h.Write([]byte(name + "=" + labels[name] + "\x00"))
+	}
+
+	return labels, strconv.FormatUint(h.Sum64(), 16)
+}
+
+// delivery уведомление, подготовленное к отправке в канал, и результат его отправки.
+type delivery struct {
+	channel      Channel
+	err          error
+	notification Notification
+}
+
+// notify обновляет группы по активным оповещениям и переходам последнего вычисления и отправляет
+// назревшие уведомления. Если канал вернул ошибку, уведомление отправляется повторно при
+// следующем вызове только на тот уровень, которому его не удалось доставить.
+func (e *Engine) notify(ctx context.Context, transitions []Transition) error {
+	if len(e.routing.Escalation) == 0 {
+		return nil
+	}
+
+	alerts, err := e.Alerts(ctx)
+	if err != nil {
+		return err
+	}
+
+	now := e.now()
+	deliveries := e.planDeliveries(alerts, transitions, now)
+
+	var errs []error
+
+	for i, d := range deliveries {
+		if deliveries[i].err = d.channel.Notify(ctx, d.notification); deliveries[i].err != nil {
+			errs = append(errs, fmt.Errorf("failed to notify channel %q: %w", d.notification.Channel, deliveries[i].err))
+		}
+	}
+
+	e.groupMu.Lock()
+	defer e.groupMu.Unlock()
+
+	e.delivered(deliveries, now)
+
+	return errors.Join(errs...)
+}
+
+// planDeliveries обновляет группы и возвращает уведомления, которые пора отправить.
+func (e *Engine) planDeliveries(alerts []Alert, transitions []Transition, now time.Time) []delivery {
+	e.groupMu.Lock()
+	defer e.groupMu.Unlock()
+
+	firing := make(map[string]bool)
+
+	for _, alert := range alerts {
+		if alert.State != StateFiring || len(alert.SilencedBy) > 0 {
+			continue
+		}
+
+		key := alert.Key()
+		firing[key] = true
+
+		labels, id := e.groupLabels(&alert)
+
+		g, ok := e.groups[id]
+		if !ok {
+			// оповещение сработало до перезапуска, а состояние его группы не сохранилось:
+			// эскалация начинается заново, а не сразу со всех уровней, чьи сроки уже прошли
+			since := alert.FiredAt
+			if since.Before(e.restoredAt) {
+				since = now
+			}
+
+			g = &group{
+				info:   Group{ID: id, Labels: labels, FiringSince: since},
+				alerts: make(map[string]Alert),
+				failed: make(map[int]bool),
+			}
+			e.groups[id] = g
+		}
+
+		if _, ok = g.alerts[key]; !ok {
+			g.changed = true
+		}
+
+		g.alerts[key] = alert
+	}
+
+	for _, t := range transitions {
+		// оповещение, разрешенное при сбросе правила, могло сразу сработать снова по новому условию
+		if t.To != StateResolved || firing[t.Alert.Key()] {
+			continue
+		}
+
+		_, id := e.groupLabels(&t.Alert)
+		if g, ok := e.groups[id]; ok {
+			if _, ok = g.alerts[t.Alert.Key()]; ok {
+				g.alerts[t.Alert.Key()] = t.Alert
+				g.changed = true
+			}
+		}
+	}
+
+	var deliveries []delivery
+
+	for _, id := range sortedKeys(e.groups) {
+		g := e.groups[id]
+
+		// оповещения, которые заглушены или пропали без перехода, убираются без уведомления
+		for key, alert := range g.alerts {
+			if alert.State == StateFiring && !firing[key] {
+				delete(g.alerts, key)
+			}
+		}
+
+		if len(g.alerts) == 0 {
+			delete(e.groups, id)
+			continue
+		}
+
+		deliveries = append(deliveries, e.planGroup(g, now)...)
+	}
+
+	return deliveries
+}
+
+// planGroup возвращает уведомления группы, которые пора отправить.
+func (e *Engine) planGroup(g *group, now time.Time) []delivery {
+	if g.info.Tiers == 0 && now.Sub(g.info.FiringSince) < time.Duration(e.routing.GroupWait) {
+		return nil
+	}
+
+	firing := g.firing()
+	acknowledged := !g.info.AcknowledgedAt.IsZero()
+
+	reached := 0
+	for i, tier := range e.routing.Escalation {
+		if !firing || now.Sub(g.info.FiringSince) < time.Duration(tier.After) || (i > 0 && acknowledged) {
+			break
+		}
+
+		reached = i + 1
+	}
+
+	var tiers []int
+
+	repeat := time.Duration(e.routing.RepeatInterval)
+
+	switch {
+	case g.changed:
+		tiers = tierRange(0, max(reached, g.info.Tiers))
+	case reached > g.info.Tiers:
+		tiers = tierRange(g.info.Tiers, reached)
+	case firing && !acknowledged && repeat > 0 && now.Sub(g.info.NotifiedAt) >= repeat:
+		tiers = tierRange(0, g.info.Tiers)
+	}
+
+	// уровни, которым не удалось доставить прошлое уведомление, получают его повторно
+	for tier := range g.failed {
+		if !slices.Contains(tiers, tier) {
+			tiers = append(tiers, tier)
+		}
+	}
+
+	slices.Sort(tiers)
+
+	if len(tiers) == 0 {
+		if !firing {
+			// группа разрешилась до первого уведомления
+			delete(e.groups, g.info.ID)
+		}
+
+		return nil
+	}
+
+	status := StateResolved
+	if firing {
+		status = StateFiring
+	}
+
+	info := g.view()
+	deliveries := make([]delivery, 0, len(tiers))
+
+	for _, i := range tiers {
+		tier := e.routing.Escalation[i]
+		deliveries = append(deliveries, delivery{
+			channel: e.channels[tier.Channel],
+			notification: Notification{
+				Labels:  info.Labels,
+				GroupID: info.ID,
+				Status:  status,
+				Channel: tier.Channel,
+				Alerts:  info.Alerts,
+				Tier:    i,
+			},
+		})
+	}
+
+	return deliveries
+}
+
+// tierRange возвращает номера уровней эскалации от from до to, не включая to.
+func tierRange(from, to int) []int {
+	tiers := make([]int, 0, max(to-from, 0))
+	for i := from; i < to; i++ {
+		tiers = append(tiers, i)
+	}
+
+	return tiers
+}
+
+// delivered учитывает результаты отправки уведомлений. Уровень, которому уведомление доставлено,
+// считается уведомленным, а уровень с ошибкой получает уведомление повторно. Разрешенные оповещения
+// убираются из группы, когда уведомление о них доставлено на все уровни, а опустевшая группа
+// удаляется. Вызывается под groupMu.
+func (e *Engine) delivered(deliveries []delivery, now time.Time) {
+	sent := make(map[string][]Alert)
+
+	for _, d := range deliveries {
+		n := d.notification
+
+		g, ok := e.groups[n.GroupID]
+		if !ok {
+			continue
+		}
+
+		g.changed = false
+		sent[n.GroupID] = n.Alerts
+
+		if d.err != nil {
+			g.failed[n.Tier] = true
+			continue
+		}
+
+		delete(g.failed, n.Tier)
+
+		g.info.NotifiedAt = now
+		g.info.Tiers = max(g.info.Tiers, n.Tier+1)
+	}
+
+	for id, alerts := range sent {
+		g, ok := e.groups[id]
+		if !ok || len(g.failed) > 0 {
+			continue
+		}
+
+		for _, alert := range alerts {
+			if current, ok := g.alerts[alert.Key()]; ok && current.State == StateResolved {
+				delete(g.alerts, alert.Key())
+			}
+		}
+
+		if len(g.alerts) == 0 {
+			delete(e.groups, id)
+		}
+	}
+}
+
+// notifier отправляет уведомления в отдельной горутине, чтобы медленный канал не задерживал
+// вычисление правил. Переходы, накопившиеся за время отправки, обрабатываются одним вызовом notify.
+type notifier struct {
+	mu          *sync.Mutex
+	wake        chan struct{}
+	transitions []Transition
+}
+
+func newNotifier() *notifier {
+	return &notifier{mu: &sync.Mutex{}, wake: make(chan struct{}, 1)}
+}
+
+// push добавляет переходы вычисления и будит горутину отправки. Вызывается после каждого
+// вычисления, даже без переходов, чтобы наступали повторы и эскалация.
+func (n *notifier) push(transitions []Transition) {
+	n.mu.Lock()
+	n.transitions = append(n.transitions, transitions...)
+	n.mu.Unlock()
+
+	select {
+	case n.wake <- struct{}{}:
+	default:
+	}
+}
+
+// run отправляет уведомления по накопленным переходам, пока не отменен контекст.
+func (n *notifier) run(ctx context.Context, e *Engine) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-n.wake:
+			n.mu.Lock()
+			transitions := n.transitions
+			n.transitions = nil
+			n.mu.Unlock()
+
+			if err := e.notify(ctx, transitions); err != nil {
+				zap.L().Error("failed to send alert notifications", zap.Error(err))
+			}
+		}
+	}
+}
+
+// Groups возвращает группы срабатывающих оповещений, по которым отправляются уведомления,
+// отсортированные по идентификатору.
+func (e *Engine) Groups(_ context.Context) ([]Group, error) {
+	e.groupMu.Lock()
+	defer e.groupMu.Unlock()
+
+	groups := make([]Group, 0, len(e.groups))
+	for _, id := range sortedKeys(e.groups) {
+		groups = append(groups, e.groups[id].view())
+	}
+
+	return groups, nil
+}
+
+// Acknowledge подтверждает группу оповещений: по ней прекращаются повторы и эскалация.
+// Подтверждение действует, пока группа не разрешится полностью. Если группы нет,
+// возвращается ErrNotFound.
+func (e *Engine) Acknowledge(_ context.Context, id, by string) (Group, error) {
+	e.groupMu.Lock()
+	defer e.groupMu.Unlock()
+
+	g, ok := e.groups[id]
+	if !ok {
+		return Group{}, fmt.Errorf("alert group %q: %w", id, ErrNotFound)
+	}
+
+	if g.info.AcknowledgedAt.IsZero() {
+		g.info.AcknowledgedAt = e.now()
+		g.info.AcknowledgedBy = by
+
+		zap.L().Info("alert group acknowledged", zap.String("group", id), zap.String("by", by))
+	}
+
+	return g.view(), nil
+}
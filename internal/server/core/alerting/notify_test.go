@@ -0,0 +1,421 @@
+//nolint:wrapcheck,nolintlint,errcheck
+package alerting
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeChannel канал, запоминающий полученные уведомления.
+type fakeChannel struct {
+	err  error
+	sent []Notification
+}
+
+func (c *fakeChannel) Notify(_ context.Context, n Notification) error {
+	if c.err != nil {
+		return c.err
+	}
+
+	c.sent = append(c.sent, n)
+
+	return nil
+}
+
+// summary возвращает статус и метрики оповещений каждого уведомления.
+func (c *fakeChannel) summary() []string {
+	result := make([]string, 0, len(c.sent))
+	for _, n := range c.sent {
+		line := n.Status + ":"
+		for _, alert := range n.Alerts {
+			line += " " + alert.Metric + "=" + alert.State
+		}
+
+		result = append(result, line)
+	}
+
+	return result
+}
+
+func newNotifyEngine(source Source, routing Routing, rules ...Rule) (*Engine, *testClock, *fakeChannel, *fakeChannel) {
+	engine, clock := newTestEngine(source, rules...)
+	oncall, manager := &fakeChannel{}, &fakeChannel{}
+
+	engine.channels = map[string]Channel{"oncall": oncall, "manager": manager}
+	engine.routing = routing
+
+	return engine, clock, oncall, manager
+}
+
+// tick вычисляет правила и отправляет уведомления, как один шаг Run.
+func tick(t *testing.T, engine *Engine) {
+	t.Helper()
+
+	transitions, err := engine.Evaluate(context.Background())
+	require.NoError(t, err)
+	require.NoError(t, engine.notify(context.Background(), transitions))
+}
+
+var cpuRule = Rule{Name: "high_cpu", Kind: KindThreshold, Metric: "cpu_*", Op: ">", Threshold: 90}
+
+func TestEngine_NotifyGrouping(t *testing.T) {
+	source := &fakeSource{gauges: map[string]float64{"cpu_1": 95}}
+	engine, clock, oncall, _ := newNotifyEngine(source, Routing{
+		Escalation:     []Tier{{Channel: "oncall"}},
+		GroupWait:      Duration(30 * time.Second),
+		RepeatInterval: Duration(time.Hour),
+	}, cpuRule)
+
+	tick(t, engine)
+	assert.Empty(t, oncall.sent, "group wait")
+
+	// оповещения, сработавшие во время ожидания, попадают в одно уведомление
+	clock.advance(10 * time.Second)
+	source.gauges["cpu_2"] = 97
+	tick(t, engine)
+
+	clock.advance(20 * time.Second)
+	tick(t, engine)
+	assert.Equal(t, []string{"firing: cpu_1=firing cpu_2=firing"}, oncall.summary())
+	assert.Equal(t, map[string]string{"rule": "high_cpu"}, oncall.sent[0].Labels)
+
+	// без изменений уведомление не повторяется до RepeatInterval
+	clock.advance(time.Minute)
+	tick(t, engine)
+	assert.Len(t, oncall.sent, 1)
+
+	clock.advance(time.Hour)
+	tick(t, engine)
+	assert.Len(t, oncall.sent, 2)
+
+	// разрешение отправляется сразу, разрешенное оповещение больше не повторяется
+	source.gauges["cpu_1"] = 10
+	tick(t, engine)
+
+	source.gauges["cpu_2"] = 10
+	tick(t, engine)
+	assert.Equal(t, []string{
+		"firing: cpu_1=firing cpu_2=firing",
+		"firing: cpu_1=firing cpu_2=firing",
+		"firing: cpu_1=resolved cpu_2=firing",
+		"resolved: cpu_2=resolved",
+	}, oncall.summary())
+
+	groups, err := engine.Groups(context.Background())
+	require.NoError(t, err)
+	assert.Empty(t, groups)
+}
+
+func TestEngine_NotifyGroupBy(t *testing.T) {
+	source := &fakeSource{gauges: map[string]float64{"cpu_1": 95, "cpu_2": 97}}
+	engine, _, oncall, _ := newNotifyEngine(source, Routing{
+		GroupBy:    []string{MatchRule, MatchMetric},
+		Escalation: []Tier{{Channel: "oncall"}},
+	}, cpuRule)
+
+	tick(t, engine)
+	assert.ElementsMatch(t, []string{"firing: cpu_1=firing", "firing: cpu_2=firing"}, oncall.summary())
+
+	groups, err := engine.Groups(context.Background())
+	require.NoError(t, err)
+	require.Len(t, groups, 2)
+	assert.NotEqual(t, groups[0].ID, groups[1].ID)
+	assert.Equal(t, 1, groups[0].Tiers)
+}
+
+func TestEngine_NotifySkipsSilenced(t *testing.T) {
+	source := &fakeSource{gauges: map[string]float64{"cpu_1": 95, "cpu_2": 97}}
+	engine, clock, oncall, _ := newNotifyEngine(source, Routing{Escalation: []Tier{{Channel: "oncall"}}}, cpuRule)
+	ctx := context.Background()
+
+	silence, err := engine.CreateSilence(ctx, Silence{
+		Matchers: []Matcher{{Name: MatchMetric, Value: "cpu_2"}}, CreatedBy: "ops", EndsAt: clock.now.Add(time.Hour),
+	})
+	require.NoError(t, err)
+
+	tick(t, engine)
+	assert.Equal(t, []string{"firing: cpu_1=firing"}, oncall.summary())
+
+	// оповещение, заглушенное после уведомления, убирается из группы без уведомления о разрешении
+	require.NoError(t, engine.DeleteSilence(ctx, silence.ID))
+	tick(t, engine)
+
+	_, err = engine.CreateSilence(ctx, Silence{
+		Matchers: []Matcher{{Name: MatchMetric, Value: "cpu_1"}}, CreatedBy: "ops", EndsAt: clock.now.Add(time.Hour),
+	})
+	require.NoError(t, err)
+	tick(t, engine)
+
+	groups, err := engine.Groups(ctx)
+	require.NoError(t, err)
+	require.Len(t, groups, 1)
+	require.Len(t, groups[0].Alerts, 1)
+	assert.Equal(t, "cpu_2", groups[0].Alerts[0].Metric)
+	assert.Equal(t, []string{"firing: cpu_1=firing", "firing: cpu_1=firing cpu_2=firing"}, oncall.summary())
+}
+
+func TestEngine_NotifyEscalation(t *testing.T) {
+	routing := Routing{
+		Escalation:     []Tier{{Channel: "oncall"}, {Channel: "manager", After: Duration(15 * time.Minute)}},
+		RepeatInterval: Duration(10 * time.Minute),
+	}
+
+	t.Run("unacknowledged", func(t *testing.T) {
+		source := &fakeSource{gauges: map[string]float64{"cpu_1": 95}}
+		engine, clock, oncall, manager := newNotifyEngine(source, routing, cpuRule)
+
+		tick(t, engine)
+		assert.Len(t, oncall.sent, 1)
+
+		clock.advance(10 * time.Minute)
+		tick(t, engine)
+		assert.Len(t, oncall.sent, 2)
+		assert.Empty(t, manager.sent)
+
+		// второй уровень уведомляется отдельно, не дожидаясь повтора первого
+		clock.advance(5 * time.Minute)
+		tick(t, engine)
+		assert.Len(t, oncall.sent, 2)
+		require.Len(t, manager.sent, 1)
+		assert.Equal(t, 1, manager.sent[0].Tier)
+
+		// повторы и разрешение отправляются на все уведомленные уровни
+		clock.advance(10 * time.Minute)
+		tick(t, engine)
+		assert.Len(t, oncall.sent, 3)
+		assert.Len(t, manager.sent, 2)
+
+		source.gauges["cpu_1"] = 10
+		tick(t, engine)
+		assert.Equal(t, StateResolved, oncall.sent[3].Status)
+		assert.Equal(t, StateResolved, manager.sent[2].Status)
+	})
+
+	t.Run("acknowledged", func(t *testing.T) {
+		source := &fakeSource{gauges: map[string]float64{"cpu_1": 95}}
+		engine, clock, oncall, manager := newNotifyEngine(source, routing, cpuRule)
+		ctx := context.Background()
+
+		tick(t, engine)
+
+		groups, err := engine.Groups(ctx)
+		require.NoError(t, err)
+		require.Len(t, groups, 1)
+
+		clock.advance(time.Minute)
+		group, err := engine.Acknowledge(ctx, groups[0].ID, "alice")
+		require.NoError(t, err)
+		assert.Equal(t, "alice", group.AcknowledgedBy)
+		assert.Equal(t, clock.now, group.AcknowledgedAt)
+
+		// повторное подтверждение не меняет автора
+		group, err = engine.Acknowledge(ctx, groups[0].ID, "bob")
+		require.NoError(t, err)
+		assert.Equal(t, "alice", group.AcknowledgedBy)
+
+		clock.advance(30 * time.Minute)
+		tick(t, engine)
+		assert.Len(t, oncall.sent, 1)
+		assert.Empty(t, manager.sent)
+
+		// изменения состава группы отправляются и после подтверждения
+		source.gauges["cpu_2"] = 99
+		tick(t, engine)
+		assert.Len(t, oncall.sent, 2)
+		assert.Empty(t, manager.sent)
+
+		_, err = engine.Acknowledge(ctx, "missing", "alice")
+		assert.ErrorIs(t, err, ErrNotFound)
+	})
+}
+
+func TestEngine_NotifyResolvedBeforeWait(t *testing.T) {
+	source := &fakeSource{gauges: map[string]float64{"cpu_1": 95}}
+	engine, clock, oncall, _ := newNotifyEngine(source, Routing{
+		Escalation: []Tier{{Channel: "oncall"}},
+		GroupWait:  Duration(time.Minute),
+	}, cpuRule)
+
+	tick(t, engine)
+
+	clock.advance(10 * time.Second)
+	source.gauges["cpu_1"] = 10
+	tick(t, engine)
+
+	clock.advance(time.Minute)
+	tick(t, engine)
+	assert.Empty(t, oncall.sent)
+
+	groups, err := engine.Groups(context.Background())
+	require.NoError(t, err)
+	assert.Empty(t, groups)
+}
+
+func TestEngine_NotifyChannelError(t *testing.T) {
+	source := &fakeSource{gauges: map[string]float64{"cpu_1": 95}}
+	engine, _, oncall, _ := newNotifyEngine(source, Routing{Escalation: []Tier{{Channel: "oncall"}}}, cpuRule)
+	ctx := context.Background()
+
+	oncall.err = errors.New("connection refused")
+
+	transitions, err := engine.Evaluate(ctx)
+	require.NoError(t, err)
+	assert.ErrorIs(t, engine.notify(ctx, transitions), oncall.err)
+
+	// неотправленное уведомление повторяется при следующем вызове
+	oncall.err = nil
+	tick(t, engine)
+	assert.Equal(t, []string{"firing: cpu_1=firing"}, oncall.summary())
+}
+
+func TestEngine_NotifyTierError(t *testing.T) {
+	source := &fakeSource{gauges: map[string]float64{"cpu_1": 95}}
+	engine, clock, oncall, manager := newNotifyEngine(source, Routing{
+		Escalation: []Tier{{Channel: "oncall"}, {Channel: "manager", After: Duration(time.Minute)}},
+	}, cpuRule)
+	ctx := context.Background()
+
+	tick(t, engine)
+	assert.Len(t, oncall.sent, 1)
+
+	manager.err = errors.New("connection refused")
+	clock.advance(time.Minute)
+	transitions, err := engine.Evaluate(ctx)
+	require.NoError(t, err)
+	assert.ErrorIs(t, engine.notify(ctx, transitions), manager.err)
+
+	// повторяется только уровень, которому не удалось доставить уведомление
+	transitions, err = engine.Evaluate(ctx)
+	require.NoError(t, err)
+	assert.ErrorIs(t, engine.notify(ctx, transitions), manager.err)
+	assert.Len(t, oncall.sent, 1)
+
+	manager.err = nil
+	tick(t, engine)
+	assert.Len(t, oncall.sent, 1)
+	assert.Len(t, manager.sent, 1)
+
+	// разрешение доставляется на все уровни, пока каждый его не получит
+	manager.err = errors.New("connection refused")
+	source.gauges["cpu_1"] = 10
+	transitions, err = engine.Evaluate(ctx)
+	require.NoError(t, err)
+	assert.ErrorIs(t, engine.notify(ctx, transitions), manager.err)
+
+	manager.err = nil
+	tick(t, engine)
+	assert.Equal(t, []string{"firing: cpu_1=firing", "resolved: cpu_1=resolved"}, oncall.summary())
+	assert.Equal(t, []string{"firing: cpu_1=firing", "resolved: cpu_1=resolved"}, manager.summary())
+
+	groups, err := engine.Groups(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, groups)
+}
+
+func TestEngine_NotifyAfterRestart(t *testing.T) {
+	store := newFakeStateStore()
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	store.alerts["high_cpu/gauge/cpu_1"] = Alert{
+		Rule: "high_cpu", Metric: "cpu_1", MType: "gauge", State: StateFiring, ActiveAt: start, FiredAt: start,
+	}
+
+	source := &fakeSource{gauges: map[string]float64{"cpu_1": 95}}
+	engine, clock, oncall, manager := newNotifyEngine(source, Routing{
+		Escalation: []Tier{{Channel: "oncall"}, {Channel: "manager", After: Duration(15 * time.Minute)}},
+	}, cpuRule)
+	engine.stateStore = store
+	clock.advance(time.Hour)
+
+	// сроки всех уровней прошли, но эскалация начинается с первого уровня
+	tick(t, engine)
+	tick(t, engine)
+	assert.Len(t, oncall.sent, 1)
+	assert.Empty(t, manager.sent)
+
+	clock.advance(15 * time.Minute)
+	tick(t, engine)
+	assert.Len(t, manager.sent, 1)
+}
+
+func TestNotifier(t *testing.T) {
+	source := &fakeSource{gauges: map[string]float64{"cpu_1": 95}}
+	engine, _, oncall, _ := newNotifyEngine(source, Routing{Escalation: []Tier{{Channel: "oncall"}}}, cpuRule)
+
+	transitions, err := engine.Evaluate(context.Background())
+	require.NoError(t, err)
+
+	// переходы, добавленные до отправки, обрабатываются одним вызовом notify
+	n := newNotifier()
+	n.push(transitions[:1])
+	n.push(transitions[1:])
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+
+	go func() {
+		n.run(ctx, engine)
+		close(done)
+	}()
+
+	require.Eventually(t, func() bool {
+		groups, err := engine.Groups(context.Background())
+		return err == nil && len(groups) == 1 && groups[0].Tiers == 1
+	}, time.Second, time.Millisecond)
+
+	cancel()
+	<-done
+
+	assert.Equal(t, []string{"firing: cpu_1=firing"}, oncall.summary())
+}
+
+func TestEngine_NotifyDisabled(t *testing.T) {
+	engine, _ := newTestEngine(&fakeSource{gauges: map[string]float64{"cpu_1": 95}}, cpuRule)
+
+	tick(t, engine)
+
+	groups, err := engine.Groups(context.Background())
+	require.NoError(t, err)
+	assert.Empty(t, groups)
+}
+
+func TestValidateRouting(t *testing.T) {
+	channels := map[string]Channel{"oncall": &fakeChannel{}, "manager": &fakeChannel{}}
+
+	tests := []struct {
+		name    string
+		routing Routing
+		wantErr bool
+	}{
+		{name: "empty", routing: Routing{}},
+		{name: "escalation", routing: Routing{
+			GroupBy:    []string{MatchRule, "severity"},
+			Escalation: []Tier{{Channel: "oncall"}, {Channel: "manager", After: Duration(time.Hour)}},
+		}},
+		{name: "unknown channel", routing: Routing{Escalation: []Tier{{Channel: "pager"}}}, wantErr: true},
+		{name: "unordered tiers", routing: Routing{
+			Escalation: []Tier{{Channel: "oncall", After: Duration(time.Hour)}, {Channel: "manager"}},
+		}, wantErr: true},
+		{name: "negative after", routing: Routing{
+			Escalation: []Tier{{Channel: "oncall", After: Duration(-time.Minute)}},
+		}, wantErr: true},
+		{name: "negative wait", routing: Routing{GroupWait: Duration(-time.Second)}, wantErr: true},
+		{name: "duplicate group_by", routing: Routing{GroupBy: []string{MatchRule, MatchRule}}, wantErr: true},
+		{name: "empty group_by", routing: Routing{GroupBy: []string{" "}}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateRouting(tt.routing, channels)
+			if tt.wantErr {
+				assert.ErrorIs(t, err, ErrInvalidRouting)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
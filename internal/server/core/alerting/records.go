@@ -0,0 +1,194 @@
+package alerting
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"metricalert/internal/server/core/model"
+	"metricalert/internal/server/core/repositories"
+)
+
+// RecordStore хранилище заглушек, оповещений и версий правил в виде записей model.
+// Хранилище не зависит от типов alerting: содержимое записей хранится в JSON.
+type RecordStore interface {
+	GetSilences(ctx context.Context) ([]model.SilenceRecord, error)
+	SaveSilence(ctx context.Context, silence model.SilenceRecord) error
+	DeleteSilence(ctx context.Context, id string) error
+	GetActiveAlerts(ctx context.Context) ([]model.AlertRecord, error)
+	SaveTransitions(ctx context.Context, transitions []model.TransitionRecord) error
+	GetAlertHistory(ctx context.Context, offset, limit int) ([]model.TransitionRecord, int, error)
+	GetRuleVersions(ctx context.Context) ([]model.RuleVersionRecord, error)
+	// SaveRuleVersion добавляет версию правила. Если версия с тем же номером уже есть,
+	// возвращается ошибка repositories.ErrConflict.
+	SaveRuleVersion(ctx context.Context, version model.RuleVersionRecord) error
+}
+
+// Records реализует SilenceStore, StateStore и RuleStore поверх RecordStore.
+type Records struct {
+	store RecordStore
+}
+
+// NewRecords создает хранилища движка поверх store.
+func NewRecords(store RecordStore) *Records {
+	return &Records{store: store}
+}
+
+// GetSilences возвращает заглушки из хранилища.
+func (r *Records) GetSilences(ctx context.Context) ([]Silence, error) {
+	records, err := r.store.GetSilences(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("can't get silences: %w", err)
+	}
+
+	silences := make([]Silence, 0, len(records))
+
+	for _, record := range records {
+		var silence Silence
+		if err = json.Unmarshal(record.Silence, &silence); err != nil {
+			return nil, fmt.Errorf("can't unmarshal silence %s: %w", record.ID, err)
+		}
+
+		silences = append(silences, silence)
+	}
+
+	return silences, nil
+}
+
+// SaveSilence добавляет или заменяет заглушку.
+func (r *Records) SaveSilence(ctx context.Context, silence Silence) error {
+	data, err := json.Marshal(silence)
+	if err != nil {
+		return fmt.Errorf("can't marshal silence: %w", err)
+	}
+
+	if err = r.store.SaveSilence(ctx, model.SilenceRecord{ID: silence.ID, Silence: data}); err != nil {
+		return fmt.Errorf("can't save silence: %w", err)
+	}
+
+	return nil
+}
+
+// DeleteSilence удаляет заглушку.
+func (r *Records) DeleteSilence(ctx context.Context, id string) error {
+	if err := r.store.DeleteSilence(ctx, id); err != nil {
+		return fmt.Errorf("can't delete silence: %w", err)
+	}
+
+	return nil
+}
+
+// GetActiveAlerts возвращает активные оповещения из хранилища.
+func (r *Records) GetActiveAlerts(ctx context.Context) ([]Alert, error) {
+	records, err := r.store.GetActiveAlerts(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("can't get active alerts: %w", err)
+	}
+
+	alerts := make([]Alert, 0, len(records))
+
+	for _, record := range records {
+		var alert Alert
+		if err = json.Unmarshal(record.Alert, &alert); err != nil {
+			return nil, fmt.Errorf("can't unmarshal alert %s: %w", record.Key, err)
+		}
+
+		alerts = append(alerts, alert)
+	}
+
+	return alerts, nil
+}
+
+// SaveTransitions добавляет переходы в журнал и обновляет по ним активные оповещения.
+func (r *Records) SaveTransitions(ctx context.Context, transitions []Transition) error {
+	records := make([]model.TransitionRecord, 0, len(transitions))
+
+	for _, t := range transitions {
+		data, err := json.Marshal(t.Alert)
+		if err != nil {
+			return fmt.Errorf("can't marshal alert: %w", err)
+		}
+
+		records = append(records, model.TransitionRecord{
+			At:       t.At,
+			Key:      t.Alert.Key(),
+			Rule:     t.Alert.Rule,
+			From:     t.From,
+			To:       t.To,
+			Alert:    data,
+			Resolved: t.To == StateResolved,
+		})
+	}
+
+	if err := r.store.SaveTransitions(ctx, records); err != nil {
+		return fmt.Errorf("can't save transitions: %w", err)
+	}
+
+	return nil
+}
+
+// GetAlertHistory возвращает страницу журнала переходов и общее число переходов.
+func (r *Records) GetAlertHistory(ctx context.Context, offset, limit int) ([]Transition, int, error) {
+	records, total, err := r.store.GetAlertHistory(ctx, offset, limit)
+	if err != nil {
+		return nil, 0, fmt.Errorf("can't get alert history: %w", err)
+	}
+
+	transitions := make([]Transition, 0, len(records))
+
+	for _, record := range records {
+		t := Transition{At: record.At, From: record.From, To: record.To}
+		if err = json.Unmarshal(record.Alert, &t.Alert); err != nil {
+			return nil, 0, fmt.Errorf("can't unmarshal alert: %w", err)
+		}
+
+		transitions = append(transitions, t)
+	}
+
+	return transitions, total, nil
+}
+
+// GetRuleVersions возвращает сохраненные версии правил.
+func (r *Records) GetRuleVersions(ctx context.Context) ([]RuleVersion, error) {
+	records, err := r.store.GetRuleVersions(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("can't get rule versions: %w", err)
+	}
+
+	versions := make([]RuleVersion, 0, len(records))
+
+	for _, record := range records {
+		var version RuleVersion
+		if err = json.Unmarshal(record.Version, &version); err != nil {
+			return nil, fmt.Errorf("can't unmarshal rule %s version %d: %w", record.Name, record.Number, err)
+		}
+
+		versions = append(versions, version)
+	}
+
+	return versions, nil
+}
+
+// SaveRuleVersion добавляет версию правила. Если версия с тем же номером уже есть,
+// возвращается ошибка ErrConflict.
+func (r *Records) SaveRuleVersion(ctx context.Context, version RuleVersion) error {
+	data, err := json.Marshal(version)
+	if err != nil {
+		return fmt.Errorf("can't marshal rule version: %w", err)
+	}
+
+	err = r.store.SaveRuleVersion(ctx, model.RuleVersionRecord{
+		Name:    version.Rule.Name,
+		Number:  version.Version,
+		Version: data,
+	})
+	switch {
+	case errors.Is(err, repositories.ErrConflict):
+		return fmt.Errorf("rule %q version %d: %w", version.Rule.Name, version.Version, ErrConflict)
+	case err != nil:
+		return fmt.Errorf("can't save rule version: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,101 @@
+//nolint:wrapcheck,nolintlint
+package alerting
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"metricalert/internal/server/core/model"
+	"metricalert/internal/server/core/repositories"
+)
+
+// fakeRecordStore хранилище записей, сохраняющее их как есть.
+type fakeRecordStore struct {
+	silences    []model.SilenceRecord
+	alerts      []model.AlertRecord
+	transitions []model.TransitionRecord
+	versions    []model.RuleVersionRecord
+}
+
+func (s *fakeRecordStore) GetSilences(context.Context) ([]model.SilenceRecord, error) {
+	return s.silences, nil
+}
+
+func (s *fakeRecordStore) SaveSilence(_ context.Context, silence model.SilenceRecord) error {
+	s.silences = append(s.silences, silence)
+
+	return nil
+}
+
+func (s *fakeRecordStore) DeleteSilence(context.Context, string) error {
+	return nil
+}
+
+func (s *fakeRecordStore) GetActiveAlerts(context.Context) ([]model.AlertRecord, error) {
+	return s.alerts, nil
+}
+
+func (s *fakeRecordStore) SaveTransitions(_ context.Context, transitions []model.TransitionRecord) error {
+	s.transitions = append(s.transitions, transitions...)
+
+	return nil
+}
+
+func (s *fakeRecordStore) GetAlertHistory(context.Context, int, int) ([]model.TransitionRecord, int, error) {
+	return s.transitions, len(s.transitions), nil
+}
+
+func (s *fakeRecordStore) GetRuleVersions(context.Context) ([]model.RuleVersionRecord, error) {
+	return s.versions, nil
+}
+
+func (s *fakeRecordStore) SaveRuleVersion(_ context.Context, version model.RuleVersionRecord) error {
+	for _, v := range s.versions {
+		if v.Name == version.Name && v.Number == version.Number {
+			return repositories.ErrConflict
+		}
+	}
+
+	s.versions = append(s.versions, version)
+
+	return nil
+}
+
+func TestRecords_RoundTrip(t *testing.T) {
+	store := &fakeRecordStore{}
+	records := NewRecords(store)
+	ctx := context.Background()
+	at := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	silence := Silence{ID: "s1", Matchers: []Matcher{{Name: "rule", Value: "cpu"}}, CreatedBy: "ops", EndsAt: at}
+	require.NoError(t, records.SaveSilence(ctx, silence))
+
+	silences, err := records.GetSilences(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []Silence{silence}, silences)
+
+	alert := Alert{Rule: "cpu", Metric: "cpu", MType: "gauge", State: StateResolved, Value: 95}
+	require.NoError(t, records.SaveTransitions(ctx, []Transition{{At: at, From: StateFiring, To: StateResolved, Alert: alert}}))
+	assert.Equal(t, "cpu/gauge/cpu", store.transitions[0].Key)
+	assert.Equal(t, "cpu", store.transitions[0].Rule)
+	assert.True(t, store.transitions[0].Resolved)
+
+	history, total, err := records.GetAlertHistory(ctx, 0, 10)
+	require.NoError(t, err)
+	assert.Equal(t, 1, total)
+	assert.Equal(t, []Transition{{At: at, From: StateFiring, To: StateResolved, Alert: alert}}, history)
+
+	version := RuleVersion{Rule: Rule{Name: "cpu", Kind: KindThreshold}, Version: 1, UpdatedAt: at}
+	require.NoError(t, records.SaveRuleVersion(ctx, version))
+
+	versions, err := records.GetRuleVersions(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []RuleVersion{version}, versions)
+
+	// повторное сохранение того же номера версии сообщается ошибкой движка
+	assert.ErrorIs(t, records.SaveRuleVersion(ctx, version), ErrConflict)
+}
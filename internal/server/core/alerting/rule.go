@@ -0,0 +1,257 @@
+// Package alerting реализует правила оповещений и жизненный цикл оповещений.
+//
+// Правило периодически вычисляется по сохраненным метрикам. Для каждой метрики, подходящей
+// под шаблон правила, создается экземпляр оповещения, который проходит состояния
+// pending -> firing -> resolved. Условие срабатывания зависит от вида правила:
+// порог для threshold, отклонение от базовой линии для anomaly, отсутствие обновлений
+// метрики или отчетов агента для absence.
+package alerting
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"path"
+	"strings"
+	"time"
+)
+
+// Виды правил.
+const (
+	KindThreshold = "threshold" // значение метрики сравнивается с порогом
+	KindAnomaly   = "anomaly"   // значение метрики сравнивается с базовой линией по недавним значениям
+	KindAbsence   = "absence"   // метрика не обновляется или агент не присылает отчеты дольше ожидаемого
+)
+
+// Методы построения базовой линии для правил anomaly.
+const (
+	MethodEWMA   = "ewma"   // экспоненциально взвешенное скользящее среднее и дисперсия
+	MethodZScore = "zscore" // среднее и стандартное отклонение по окну последних значений
+)
+
+// Значения параметров anomaly по умолчанию.
+const (
+	defaultAlpha       = 0.3
+	defaultWindow      = 30
+	defaultSensitivity = 3
+	defaultMultiple    = 3
+)
+
+// Объявление ошибок.
+var (
+	ErrInvalidRule = errors.New("invalid rule")
+	ErrNotFound    = errors.New("not found")
+	ErrConflict    = errors.New("conflict")
+)
+
+// Duration длительность, которая в JSON записывается в формате time.ParseDuration, например "5m".
+type Duration time.Duration
+
+// MarshalJSON записывает длительность строкой.
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String()) //nolint:wrapcheck // ошибка сериализации строки невозможна
+}
+
+// UnmarshalJSON читает длительность из строки.
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return fmt.Errorf("duration must be a string: %w", err)
+	}
+
+	value, err := time.ParseDuration(s)
+	if err != nil {
+		return fmt.Errorf("invalid duration %q: %w", s, err)
+	}
+
+	*d = Duration(value)
+
+	return nil
+}
+
+// Anomaly параметры правила anomaly. Нулевые значения заменяются значениями по умолчанию.
+//
+// Значение считается аномальным, если оно отклоняется от среднего больше чем на Sensitivity
+// стандартных отклонений. Пока метрика наблюдается меньше WarmUp, базовая линия только
+// накапливается и оповещения не создаются.
+type Anomaly struct {
+	Method      string   `json:"method"`
+	Alpha       float64  `json:"alpha,omitempty"`  // вес нового значения для ewma, от 0 до 1 не включая 1
+	Window      int      `json:"window,omitempty"` // количество последних значений для zscore
+	Sensitivity float64  `json:"sensitivity,omitempty"`
+	WarmUp      Duration `json:"warm_up,omitempty"`
+}
+
+// Rule правило оповещения. Metric задает имя метрики или шаблон в синтаксисе path.Match,
+// MType ограничивает тип метрики. Условие должно выполняться в течение For, прежде чем
+// оповещение перейдет из pending в firing.
+//
+// Правило absence срабатывает, если метрика, подходящая под Metric, или агент, подходящий
+// под Agent, молчит дольше Multiple ожидаемых интервалов отчета Interval. Задается ровно одно
+// из полей Metric и Agent.
+type Rule struct {
+	Labels    map[string]string `json:"labels,omitempty"`
+	Anomaly   *Anomaly          `json:"anomaly,omitempty"`
+	Name      string            `json:"name"`
+	Kind      string            `json:"kind"`
+	Metric    string            `json:"metric,omitempty"`
+	Agent     string            `json:"agent,omitempty"`
+	MType     string            `json:"type,omitempty"`
+	Op        string            `json:"op,omitempty"` // оператор сравнения для threshold: > >= < <= == !=
+	Threshold float64           `json:"threshold,omitempty"`
+	Multiple  float64           `json:"multiple,omitempty"`
+	Interval  Duration          `json:"interval,omitempty"`
+	For       Duration          `json:"for,omitempty"`
+}
+
+// Validate проверяет правило. Ошибка оборачивает ErrInvalidRule.
+func (r Rule) Validate() error {
+	if err := r.validate(); err != nil {
+		return fmt.Errorf("rule %q: %w: %w", r.Name, ErrInvalidRule, err)
+	}
+
+	return nil
+}
+
+func (r Rule) validate() error {
+	if strings.TrimSpace(r.Name) == "" {
+		return errors.New("empty name")
+	}
+
+	if r.Kind == KindAbsence {
+		if (r.Metric == "") == (r.Agent == "") {
+			return errors.New("exactly one of metric or agent required")
+		}
+	} else if r.Metric == "" {
+		return errors.New("empty metric")
+	}
+
+	for _, pattern := range []string{r.Metric, r.Agent} {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid pattern %q", pattern)
+		}
+	}
+
+	if r.MType != "" && r.MType != "gauge" && r.MType != "counter" {
+		return fmt.Errorf("unknown metric type %q", r.MType)
+	}
+
+	if r.For < 0 {
+		return errors.New("negative for")
+	}
+
+	switch r.Kind {
+	case KindThreshold:
+		if _, ok := operators[r.Op]; !ok {
+			return fmt.Errorf("unknown operator %q", r.Op)
+		}
+
+		if math.IsNaN(r.Threshold) || math.IsInf(r.Threshold, 0) {
+			return errors.New("threshold must be finite")
+		}
+	case KindAnomaly:
+		if r.Anomaly == nil {
+			return errors.New("anomaly parameters required")
+		}
+
+		return r.Anomaly.validate()
+	case KindAbsence:
+		if r.Interval <= 0 {
+			return errors.New("absence requires a positive interval")
+		}
+
+		if r.Multiple < 0 || math.IsNaN(r.Multiple) || math.IsInf(r.Multiple, 0) {
+			return fmt.Errorf("invalid multiple %g", r.Multiple)
+		}
+	default:
+		return fmt.Errorf("unknown kind %q", r.Kind)
+	}
+
+	return nil
+}
+
+func (a Anomaly) validate() error {
+	switch a.Method {
+	case MethodEWMA:
+		// при alpha = 1 базовая линия состоит из одного последнего значения и дисперсия всегда нулевая
+		if a.Alpha < 0 || a.Alpha >= 1 || math.IsNaN(a.Alpha) {
+			return fmt.Errorf("alpha must be at least 0 and less than 1, got %g", a.Alpha)
+		}
+	case MethodZScore:
+		if a.Window < 0 || a.Window == 1 {
+			return fmt.Errorf("window must be at least 2, got %d", a.Window)
+		}
+	default:
+		return fmt.Errorf("unknown anomaly method %q", a.Method)
+	}
+
+	if a.Sensitivity < 0 || math.IsNaN(a.Sensitivity) {
+		return fmt.Errorf("negative sensitivity %g", a.Sensitivity)
+	}
+
+	if a.WarmUp < 0 {
+		return errors.New("negative warm-up")
+	}
+
+	return nil
+}
+
+// withDefaults возвращает параметры с подставленными значениями по умолчанию.
+func (a Anomaly) withDefaults() Anomaly {
+	if a.Alpha == 0 {
+		a.Alpha = defaultAlpha
+	}
+
+	if a.Window == 0 {
+		a.Window = defaultWindow
+	}
+
+	if a.Sensitivity == 0 {
+		a.Sensitivity = defaultSensitivity
+	}
+
+	return a
+}
+
+// operators операторы сравнения для правил threshold.
+var operators = map[string]func(value, threshold float64) bool{
+	">":  func(v, t float64) bool { return v > t },
+	">=": func(v, t float64) bool { return v >= t },
+	"<":  func(v, t float64) bool { return v < t },
+	"<=": func(v, t float64) bool { return v <= t },
+	"==": func(v, t float64) bool { return v == t },
+	"!=": func(v, t float64) bool { return v != t },
+}
+
+// matches сообщает, что метрика подходит под шаблон и тип правила.
+func (r Rule) matches(name, mType string) bool {
+	if r.Metric == "" || (r.MType != "" && r.MType != mType) {
+		return false
+	}
+
+	ok, _ := path.Match(r.Metric, name)
+
+	return ok
+}
+
+// matchesAgent сообщает, что агент подходит под шаблон правила absence.
+func (r Rule) matchesAgent(agent string) bool {
+	if r.Agent == "" {
+		return false
+	}
+
+	ok, _ := path.Match(r.Agent, agent)
+
+	return ok
+}
+
+// silenceLimit возвращает срок, после которого метрика или агент считаются отсутствующими.
+func (r Rule) silenceLimit() time.Duration {
+	multiple := r.Multiple
+	if multiple == 0 {
+		multiple = defaultMultiple
+	}
+
+	return time.Duration(float64(r.Interval) * multiple)
+}
@@ -0,0 +1,68 @@
+package alerting
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDuration_JSON(t *testing.T) {
+	var rule Rule
+	require.NoError(t, json.Unmarshal([]byte(`{"name":"a","for":"5m","anomaly":{"method":"ewma","warm_up":"1h"}}`),
+		&rule))
+	assert.Equal(t, Duration(5*time.Minute), rule.For)
+	assert.Equal(t, Duration(time.Hour), rule.Anomaly.WarmUp)
+
+	data, err := json.Marshal(Duration(90 * time.Second))
+	require.NoError(t, err)
+	assert.JSONEq(t, `"1m30s"`, string(data))
+
+	assert.Error(t, json.Unmarshal([]byte(`{"for":300}`), &rule))
+	assert.Error(t, json.Unmarshal([]byte(`{"for":"5 minutes"}`), &rule))
+}
+
+func TestRule_Validate(t *testing.T) {
+	valid := []Rule{
+		{Name: "high_cpu", Kind: KindThreshold, Metric: "cpu_*", Op: ">", Threshold: 90},
+		{Name: "gc", Kind: KindAnomaly, Metric: "GCCPUFraction", Anomaly: &Anomaly{Method: MethodEWMA}},
+		{Name: "gc_window", Kind: KindAnomaly, Metric: "GC*", MType: "gauge",
+			Anomaly: &Anomaly{Method: MethodZScore, Window: 10, Sensitivity: 2, WarmUp: Duration(time.Minute)}},
+		{Name: "stale", Kind: KindAbsence, Metric: "Alloc", Interval: Duration(10 * time.Second)},
+		{Name: "agent_down", Kind: KindAbsence, Agent: "ip:*", Interval: Duration(time.Minute), Multiple: 1.5},
+	}
+
+	for _, rule := range valid {
+		assert.NoError(t, rule.Validate(), "rule %s", rule.Name)
+	}
+
+	invalid := []Rule{
+		{Kind: KindThreshold, Metric: "cpu", Op: ">"},
+		{Name: "a", Kind: KindThreshold, Op: ">"},
+		{Name: "a", Kind: KindThreshold, Metric: "[", Op: ">"},
+		{Name: "a", Kind: KindThreshold, Metric: "cpu", MType: "histogram", Op: ">"},
+		{Name: "a", Kind: KindThreshold, Metric: "cpu", Op: "=>"},
+		{Name: "a", Kind: KindThreshold, Metric: "cpu", Op: ">", For: Duration(-time.Second)},
+		{Name: "a", Kind: "forecast", Metric: "cpu"},
+		{Name: "a", Kind: KindAnomaly, Metric: "cpu"},
+		{Name: "a", Kind: KindAnomaly, Metric: "cpu", Anomaly: &Anomaly{Method: "median"}},
+		{Name: "a", Kind: KindAnomaly, Metric: "cpu", Anomaly: &Anomaly{Method: MethodEWMA, Alpha: 1.5}},
+		{Name: "a", Kind: KindAnomaly, Metric: "cpu", Anomaly: &Anomaly{Method: MethodEWMA, Alpha: 1}},
+		{Name: "a", Kind: KindAnomaly, Metric: "cpu", Anomaly: &Anomaly{Method: MethodZScore, Window: 1}},
+		{Name: "a", Kind: KindAnomaly, Metric: "cpu", Anomaly: &Anomaly{Method: MethodEWMA, Sensitivity: -1}},
+		{Name: "a", Kind: KindAbsence, Interval: Duration(time.Second)},
+		{Name: "a", Kind: KindAbsence, Metric: "cpu", Agent: "ip:*", Interval: Duration(time.Second)},
+		{Name: "a", Kind: KindAbsence, Agent: "[", Interval: Duration(time.Second)},
+		{Name: "a", Kind: KindAbsence, Metric: "cpu"},
+		{Name: "a", Kind: KindAbsence, Metric: "cpu", Interval: Duration(time.Second), Multiple: -1},
+		{Name: "a", Kind: KindThreshold, Agent: "ip:*", Op: ">"},
+	}
+
+	for _, rule := range invalid {
+		assert.ErrorIs(t, rule.Validate(), ErrInvalidRule, "rule %+v", rule)
+	}
+
+	assert.ErrorIs(t, ValidateRules([]Rule{valid[0], valid[0]}), ErrInvalidRule)
+}
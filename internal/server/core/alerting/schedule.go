@@ -0,0 +1,156 @@
+package alerting
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// schedule расписание в формате cron из пяти полей: минута, час, день месяца, месяц, день недели.
+// Поле задается звездочкой, числом, диапазоном a-b и шагом */n или a-b/n, значения перечисляются
+// через запятую. День недели 0 и 7 означают воскресенье. Как и в cron, если заданы и день месяца,
+// и день недели, достаточно совпадения любого из них.
+type schedule struct {
+	minute, hour, dom, month, dow uint64
+	domAny, dowAny                bool
+}
+
+// scheduleField допустимый диапазон значений поля расписания.
+type scheduleField struct {
+	name     string
+	min, max int
+}
+
+var scheduleFields = [5]scheduleField{
+	{name: "minute", min: 0, max: 59},
+	{name: "hour", min: 0, max: 23},
+	{name: "day of month", min: 1, max: 31},
+	{name: "month", min: 1, max: 12},
+	{name: "day of week", min: 0, max: 7},
+}
+
+// parseSchedule разбирает расписание в формате cron.
+func parseSchedule(spec string) (schedule, error) {
+	fields := strings.Fields(spec)
+	if len(fields) != len(scheduleFields) {
+		return schedule{}, fmt.Errorf("schedule %q: expected %d fields, got %d", spec, len(scheduleFields), len(fields))
+	}
+
+	var bits [5]uint64
+
+	for i, field := range fields {
+		value, err := parseScheduleField(field, scheduleFields[i])
+		if err != nil {
+			return schedule{}, fmt.Errorf("schedule %q: %s: %w", spec, scheduleFields[i].name, err)
+		}
+
+		bits[i] = value
+	}
+
+	// воскресенье можно задать как 0 или 7
+	if bits[4]&(1<<7) != 0 {
+		bits[4] |= 1
+	}
+
+	return schedule{
+		minute: bits[0],
+		hour:   bits[1],
+		dom:    bits[2],
+		month:  bits[3],
+		dow:    bits[4],
+		domAny: fields[2] == "*",
+		dowAny: fields[4] == "*",
+	}, nil
+}
+
+func parseScheduleField(field string, limits scheduleField) (uint64, error) {
+	var bits uint64
+
+	for _, part := range strings.Split(field, ",") {
+		low, high, step := limits.min, limits.max, 1
+
+		rangePart, stepPart, hasStep := strings.Cut(part, "/")
+		if hasStep {
+			var err error
+			if step, err = strconv.Atoi(stepPart); err != nil || step <= 0 {
+				return 0, fmt.Errorf("invalid step %q", stepPart)
+			}
+		}
+
+		if rangePart != "*" {
+			from, to, isRange := strings.Cut(rangePart, "-")
+
+			var err error
+			if low, err = parseScheduleValue(from, limits); err != nil {
+				return 0, err
+			}
+
+			high = low
+			if isRange {
+				if high, err = parseScheduleValue(to, limits); err != nil {
+					return 0, err
+				}
+			} else if hasStep {
+				high = limits.max
+			}
+
+			if low > high {
+				return 0, fmt.Errorf("invalid range %q", rangePart)
+			}
+		}
+
+		for v := low; v <= high; v += step {
+			bits |= 1 << v
+		}
+	}
+
+	return bits, nil
+}
+
+func parseScheduleValue(s string, limits scheduleField) (int, error) {
+	value, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid value %q", s)
+	}
+
+	if value < limits.min || value > limits.max {
+		return 0, fmt.Errorf("value %d out of range %d-%d", value, limits.min, limits.max)
+	}
+
+	return value, nil
+}
+
+// matches сообщает, что расписание срабатывает в минуту t.
+func (s schedule) matches(t time.Time) bool {
+	if s.minute&(1<<t.Minute()) == 0 || s.hour&(1<<t.Hour()) == 0 || s.month&(1<<int(t.Month())) == 0 {
+		return false
+	}
+
+	domMatch := s.dom&(1<<t.Day()) != 0
+	dowMatch := s.dow&(1<<int(t.Weekday())) != 0
+
+	switch {
+	case s.domAny || s.dowAny:
+		return domMatch && dowMatch
+	default:
+		return domMatch || dowMatch
+	}
+}
+
+// maxWindow ограничивает длительность окна обслуживания: окно проверяется перебором минут.
+const maxWindow = 7 * 24 * time.Hour
+
+var errWindowTooLong = errors.New("maintenance window longer than 7 days")
+
+// activeAt сообщает, что момент t попадает в окно длительностью d, начавшееся по расписанию.
+func (s schedule) activeAt(t time.Time, d time.Duration) bool {
+	for start := t.Truncate(time.Minute); t.Sub(start) < d; start = start.Add(-time.Minute) {
+		if s.matches(start) {
+			return true
+		}
+	}
+
+	return false
+}
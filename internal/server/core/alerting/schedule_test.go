@@ -0,0 +1,62 @@
+package alerting
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseSchedule(t *testing.T) {
+	// суббота, 6 января 2024
+	saturday := time.Date(2024, 1, 6, 2, 30, 0, 0, time.UTC)
+
+	tests := []struct {
+		spec string
+		at   time.Time
+		want bool
+	}{
+		{spec: "* * * * *", at: saturday, want: true},
+		{spec: "30 2 * * *", at: saturday, want: true},
+		{spec: "0 2 * * *", at: saturday, want: false},
+		{spec: "*/15 * * * *", at: saturday, want: true},
+		{spec: "10-40/10 * * * *", at: saturday, want: true},
+		{spec: "5/10 * * * *", at: saturday, want: false},
+		{spec: "30 1,2,3 * * 6", at: saturday, want: true},
+		{spec: "30 2 * * 1-5", at: saturday, want: false},
+		{spec: "30 2 * 2 *", at: saturday, want: false},
+		// заданы день месяца и день недели: достаточно совпадения одного из них
+		{spec: "30 2 1 * 6", at: saturday, want: true},
+		{spec: "30 2 6 * 0", at: saturday, want: true},
+		{spec: "30 2 1 * 0", at: saturday, want: false},
+		// воскресенье как 7
+		{spec: "30 2 * * 7", at: saturday.AddDate(0, 0, 1), want: true},
+	}
+
+	for _, tt := range tests {
+		sched, err := parseSchedule(tt.spec)
+		require.NoError(t, err, tt.spec)
+		assert.Equal(t, tt.want, sched.matches(tt.at), tt.spec)
+	}
+
+	for _, spec := range []string{"", "* * * *", "60 * * * *", "* 24 * * *", "* * 0 * *", "* * * 13 *",
+		"* * * * 8", "5-1 * * * *", "*/0 * * * *", "a * * * *", "1-b * * * *"} {
+		_, err := parseSchedule(spec)
+		assert.Error(t, err, spec)
+	}
+}
+
+func TestSchedule_ActiveAt(t *testing.T) {
+	sched, err := parseSchedule("0 2 * * *")
+	require.NoError(t, err)
+
+	day := time.Date(2024, 1, 6, 0, 0, 0, 0, time.UTC)
+
+	assert.False(t, sched.activeAt(day.Add(time.Hour+59*time.Minute), time.Hour))
+	assert.True(t, sched.activeAt(day.Add(2*time.Hour), time.Hour))
+	assert.True(t, sched.activeAt(day.Add(2*time.Hour+59*time.Minute+59*time.Second), time.Hour))
+	assert.False(t, sched.activeAt(day.Add(3*time.Hour), time.Hour))
+	// окно, начавшееся накануне, продолжается после полуночи
+	assert.True(t, sched.activeAt(day.Add(time.Hour), 24*time.Hour))
+}
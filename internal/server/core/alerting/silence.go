@@ -0,0 +1,379 @@
+package alerting
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ErrInvalidSilence ошибка проверки заглушки.
+var ErrInvalidSilence = errors.New("invalid silence")
+
+// Имена полей оповещения для условий заглушки и группировки. Остальные имена сравниваются
+// с метками правила.
+const (
+	MatchRule   = "rule"
+	MatchMetric = "metric"
+	MatchAgent  = "agent"
+)
+
+// field возвращает значение поля оповещения rule, metric, agent или, для остальных имен,
+// значение метки правила. Отсутствующая метка считается пустой строкой.
+func (a *Alert) field(name string) string {
+	switch name {
+	case MatchRule:
+		return a.Rule
+	case MatchMetric:
+		return a.Metric
+	case MatchAgent:
+		return a.Agent
+	default:
+		return a.Labels[name]
+	}
+}
+
+// Matcher условие заглушки: значение поля оповещения или метки Name подходит под шаблон Value
+// в синтаксисе path.Match. Отсутствующая метка считается пустой строкой.
+type Matcher struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// Silence заглушка оповещений. Заглушенные оповещения проходят обычный жизненный цикл,
+// но помечаются идентификаторами заглушек, и по ним не отправляются уведомления.
+// Оповещение заглушено, если выполнены все условия Matchers.
+//
+// Разовая заглушка действует с StartsAt до EndsAt. Заглушка с расписанием Schedule в формате cron
+// задает повторяющееся окно обслуживания: каждое окно начинается по расписанию в часовом поясе
+// Timezone (по умолчанию UTC) и длится Duration. StartsAt и EndsAt ограничивают период действия
+// окон, нулевой EndsAt означает бессрочное расписание.
+type Silence struct {
+	StartsAt  time.Time `json:"starts_at,omitzero"`
+	EndsAt    time.Time `json:"ends_at,omitzero"`
+	CreatedAt time.Time `json:"created_at,omitzero"`
+	Matchers  []Matcher `json:"matchers"`
+	ID        string    `json:"id"`
+	CreatedBy string    `json:"created_by"`
+	Comment   string    `json:"comment,omitempty"`
+	Schedule  string    `json:"schedule,omitempty"`
+	Timezone  string    `json:"timezone,omitempty"`
+	Duration  Duration  `json:"duration,omitempty"`
+}
+
+// Validate проверяет заглушку. Ошибка оборачивает ErrInvalidSilence.
+func (s Silence) Validate() error {
+	if err := s.validate(); err != nil {
+		return fmt.Errorf("silence %q: %w: %w", s.ID, ErrInvalidSilence, err)
+	}
+
+	return nil
+}
+
+func (s Silence) validate() error {
+	if len(s.Matchers) == 0 {
+		return errors.New("at least one matcher required")
+	}
+
+	for _, m := range s.Matchers {
+		if strings.TrimSpace(m.Name) == "" {
+			return errors.New("empty matcher name")
+		}
+
+		if _, err := path.Match(m.Value, ""); err != nil {
+			return fmt.Errorf("invalid pattern %q", m.Value)
+		}
+	}
+
+	if strings.TrimSpace(s.CreatedBy) == "" {
+		return errors.New("empty creator")
+	}
+
+	if !s.EndsAt.IsZero() && !s.EndsAt.After(s.StartsAt) {
+		return errors.New("end must be after start")
+	}
+
+	if s.Schedule == "" {
+		switch {
+		case s.EndsAt.IsZero():
+			return errors.New("end required")
+		case s.Duration != 0 || s.Timezone != "":
+			return errors.New("duration and timezone require a schedule")
+		}
+
+		return nil
+	}
+
+	if _, err := parseSchedule(s.Schedule); err != nil {
+		return err
+	}
+
+	if _, err := time.LoadLocation(s.Timezone); err != nil {
+		return fmt.Errorf("unknown timezone %q", s.Timezone)
+	}
+
+	switch {
+	case s.Duration <= 0:
+		return errors.New("schedule requires a positive duration")
+	case time.Duration(s.Duration) > maxWindow:
+		return errWindowTooLong
+	}
+
+	return nil
+}
+
+// activeAt сообщает, что заглушка действует в момент t. Заглушка должна быть проверена Validate.
+func (s Silence) activeAt(t time.Time) bool {
+	if t.Before(s.StartsAt) || (!s.EndsAt.IsZero() && !t.Before(s.EndsAt)) {
+		return false
+	}
+
+	if s.Schedule == "" {
+		return true
+	}
+
+	sched, err := parseSchedule(s.Schedule)
+	if err != nil {
+		return false
+	}
+
+	loc, err := time.LoadLocation(s.Timezone)
+	if err != nil {
+		return false
+	}
+
+	return sched.activeAt(t.In(loc), time.Duration(s.Duration))
+}
+
+// matches сообщает, что оповещение подходит под все условия заглушки.
+func (s Silence) matches(alert *Alert) bool {
+	for _, m := range s.Matchers {
+		if ok, _ := path.Match(m.Value, alert.field(m.Name)); !ok {
+			return false
+		}
+	}
+
+	return true
+}
+
+// SilenceStore хранилище заглушек, в котором они переживают перезапуск сервера.
+type SilenceStore interface {
+	GetSilences(ctx context.Context) ([]Silence, error)
+	SaveSilence(ctx context.Context, silence Silence) error
+	DeleteSilence(ctx context.Context, id string) error
+}
+
+// loadSilences загружает заглушки из хранилища при первом обращении. Вызывается под silenceMu.
+func (e *Engine) loadSilences(ctx context.Context) error {
+	if e.silenceByID != nil {
+		return nil
+	}
+
+	silences := make(map[string]Silence)
+
+	if e.silenceStore != nil {
+		stored, err := e.silenceStore.GetSilences(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to load silences: %w", err)
+		}
+
+		for _, s := range stored {
+			silences[s.ID] = s
+		}
+	}
+
+	e.silenceByID = silences
+
+	return nil
+}
+
+// activeSilences возвращает заглушки, действующие в момент now.
+func (e *Engine) activeSilences(ctx context.Context, now time.Time) ([]Silence, error) {
+	e.silenceMu.Lock()
+	defer e.silenceMu.Unlock()
+
+	if err := e.loadSilences(ctx); err != nil {
+		return nil, err
+	}
+
+	var active []Silence
+
+	for _, id := range sortedKeys(e.silenceByID) {
+		if s := e.silenceByID[id]; s.activeAt(now) {
+			active = append(active, s)
+		}
+	}
+
+	return active, nil
+}
+
+// silencedBy возвращает идентификаторы заглушек, под которые подходит оповещение.
+func silencedBy(silences []Silence, alert *Alert) []string {
+	var ids []string
+
+	for _, s := range silences {
+		if s.matches(alert) {
+			ids = append(ids, s.ID)
+		}
+	}
+
+	return ids
+}
+
+// Silences возвращает все заглушки, отсортированные по времени создания.
+func (e *Engine) Silences(ctx context.Context) ([]Silence, error) {
+	e.silenceMu.Lock()
+	defer e.silenceMu.Unlock()
+
+	if err := e.loadSilences(ctx); err != nil {
+		return nil, err
+	}
+
+	silences := make([]Silence, 0, len(e.silenceByID))
+	for _, s := range e.silenceByID {
+		silences = append(silences, s)
+	}
+
+	sort.Slice(silences, func(i, j int) bool {
+		if !silences[i].CreatedAt.Equal(silences[j].CreatedAt) {
+			return silences[i].CreatedAt.Before(silences[j].CreatedAt)
+		}
+
+		return silences[i].ID < silences[j].ID
+	})
+
+	return silences, nil
+}
+
+// Silence возвращает заглушку по идентификатору или ошибку ErrNotFound.
+func (e *Engine) Silence(ctx context.Context, id string) (Silence, error) {
+	e.silenceMu.Lock()
+	defer e.silenceMu.Unlock()
+
+	if err := e.loadSilences(ctx); err != nil {
+		return Silence{}, err
+	}
+
+	s, ok := e.silenceByID[id]
+	if !ok {
+		return Silence{}, fmt.Errorf("silence %q: %w", id, ErrNotFound)
+	}
+
+	return s, nil
+}
+
+// CreateSilence проверяет и сохраняет новую заглушку. Идентификатор и время создания
+// назначаются сервером, нулевое время начала заменяется текущим.
+func (e *Engine) CreateSilence(ctx context.Context, s Silence) (Silence, error) {
+	id, err := newSilenceID()
+	if err != nil {
+		return Silence{}, err
+	}
+
+	s.ID = id
+	s.CreatedAt = e.now()
+
+	if s.StartsAt.IsZero() {
+		s.StartsAt = s.CreatedAt
+	}
+
+	if err := e.saveSilence(ctx, s, false); err != nil {
+		return Silence{}, err
+	}
+
+	return s, nil
+}
+
+// UpdateSilence заменяет существующую заглушку, сохраняя ее автора и время создания,
+// если они не заданы. Если заглушки нет, возвращается ErrNotFound.
+func (e *Engine) UpdateSilence(ctx context.Context, s Silence) (Silence, error) {
+	current, err := e.Silence(ctx, s.ID)
+	if err != nil {
+		return Silence{}, err
+	}
+
+	s.CreatedAt = current.CreatedAt
+
+	if s.StartsAt.IsZero() {
+		s.StartsAt = current.StartsAt
+	}
+
+	if s.CreatedBy == "" {
+		s.CreatedBy = current.CreatedBy
+	}
+
+	if err := e.saveSilence(ctx, s, true); err != nil {
+		return Silence{}, err
+	}
+
+	return s, nil
+}
+
+// saveSilence сохраняет заглушку. Для exists заглушка должна существовать: она могла быть
+// удалена после проверки в UpdateSilence.
+func (e *Engine) saveSilence(ctx context.Context, s Silence, exists bool) error {
+	if err := s.Validate(); err != nil {
+		return err
+	}
+
+	e.silenceMu.Lock()
+	defer e.silenceMu.Unlock()
+
+	if err := e.loadSilences(ctx); err != nil {
+		return err
+	}
+
+	if _, ok := e.silenceByID[s.ID]; exists && !ok {
+		return fmt.Errorf("silence %q: %w", s.ID, ErrNotFound)
+	}
+
+	if e.silenceStore != nil {
+		if err := e.silenceStore.SaveSilence(ctx, s); err != nil {
+			return fmt.Errorf("failed to save silence: %w", err)
+		}
+	}
+
+	e.silenceByID[s.ID] = s
+
+	return nil
+}
+
+// DeleteSilence удаляет заглушку. Если заглушки нет, возвращается ErrNotFound.
+func (e *Engine) DeleteSilence(ctx context.Context, id string) error {
+	e.silenceMu.Lock()
+	defer e.silenceMu.Unlock()
+
+	if err := e.loadSilences(ctx); err != nil {
+		return err
+	}
+
+	if _, ok := e.silenceByID[id]; !ok {
+		return fmt.Errorf("silence %q: %w", id, ErrNotFound)
+	}
+
+	if e.silenceStore != nil {
+		if err := e.silenceStore.DeleteSilence(ctx, id); err != nil {
+			return fmt.Errorf("failed to delete silence: %w", err)
+		}
+	}
+
+	delete(e.silenceByID, id)
+
+	return nil
+}
+
+func newSilenceID() (string, error) {
+	const size = 8
+
+	b := make([]byte, size)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate silence id: %w", err)
+	}
+
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,187 @@
+//nolint:wrapcheck,nolintlint,errcheck
+package alerting
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeSilenceStore хранилище заглушек в памяти.
+type fakeSilenceStore struct {
+	err      error
+	silences map[string]Silence
+}
+
+func (s *fakeSilenceStore) GetSilences(context.Context) ([]Silence, error) {
+	silences := make([]Silence, 0, len(s.silences))
+	for _, silence := range s.silences {
+		silences = append(silences, silence)
+	}
+
+	return silences, s.err
+}
+
+func (s *fakeSilenceStore) SaveSilence(_ context.Context, silence Silence) error {
+	if s.err != nil {
+		return s.err
+	}
+
+	s.silences[silence.ID] = silence
+
+	return nil
+}
+
+func (s *fakeSilenceStore) DeleteSilence(_ context.Context, id string) error {
+	if s.err != nil {
+		return s.err
+	}
+
+	delete(s.silences, id)
+
+	return nil
+}
+
+func TestSilence_Validate(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	matchers := []Matcher{{Name: MatchRule, Value: "high_*"}}
+
+	valid := []Silence{
+		{Matchers: matchers, CreatedBy: "ops", StartsAt: start, EndsAt: start.Add(time.Hour)},
+		{Matchers: matchers, CreatedBy: "ops", Schedule: "0 2 * * 6", Duration: Duration(2 * time.Hour)},
+		{Matchers: matchers, CreatedBy: "ops", Schedule: "0 2 * * *", Duration: Duration(time.Hour),
+			Timezone: "UTC", StartsAt: start, EndsAt: start.AddDate(0, 1, 0)},
+	}
+
+	for _, s := range valid {
+		assert.NoError(t, s.Validate(), "silence %+v", s)
+	}
+
+	invalid := []Silence{
+		{CreatedBy: "ops", StartsAt: start, EndsAt: start.Add(time.Hour)},
+		{Matchers: []Matcher{{Value: "a"}}, CreatedBy: "ops", StartsAt: start, EndsAt: start.Add(time.Hour)},
+		{Matchers: []Matcher{{Name: "rule", Value: "["}}, CreatedBy: "ops", StartsAt: start, EndsAt: start.Add(time.Hour)},
+		{Matchers: matchers, StartsAt: start, EndsAt: start.Add(time.Hour)},
+		{Matchers: matchers, CreatedBy: "ops", StartsAt: start},
+		{Matchers: matchers, CreatedBy: "ops", StartsAt: start, EndsAt: start},
+		{Matchers: matchers, CreatedBy: "ops", StartsAt: start, EndsAt: start.Add(time.Hour), Duration: Duration(time.Hour)},
+		{Matchers: matchers, CreatedBy: "ops", Schedule: "0 2 * *", Duration: Duration(time.Hour)},
+		{Matchers: matchers, CreatedBy: "ops", Schedule: "0 2 * * *"},
+		{Matchers: matchers, CreatedBy: "ops", Schedule: "0 2 * * *", Duration: Duration(8 * 24 * time.Hour)},
+		{Matchers: matchers, CreatedBy: "ops", Schedule: "0 2 * * *", Duration: Duration(time.Hour), Timezone: "Mars/Base"},
+	}
+
+	for _, s := range invalid {
+		assert.ErrorIs(t, s.Validate(), ErrInvalidSilence, "silence %+v", s)
+	}
+}
+
+func TestSilence_Matches(t *testing.T) {
+	alert := &Alert{Rule: "high_cpu", Metric: "cpu_1", MType: "gauge", Labels: map[string]string{"team": "infra"}}
+
+	tests := []struct {
+		matchers []Matcher
+		want     bool
+	}{
+		{matchers: []Matcher{{Name: MatchRule, Value: "high_*"}}, want: true},
+		{matchers: []Matcher{{Name: MatchRule, Value: "high_*"}, {Name: MatchMetric, Value: "cpu_2"}}, want: false},
+		{matchers: []Matcher{{Name: "team", Value: "infra"}, {Name: MatchMetric, Value: "cpu_?"}}, want: true},
+		{matchers: []Matcher{{Name: "severity", Value: "page"}}, want: false},
+		{matchers: []Matcher{{Name: "severity", Value: ""}}, want: true},
+		{matchers: []Matcher{{Name: MatchAgent, Value: "*"}}, want: true},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, Silence{Matchers: tt.matchers}.matches(alert), "matchers %+v", tt.matchers)
+	}
+}
+
+func TestEngine_Silences(t *testing.T) {
+	store := &fakeSilenceStore{silences: map[string]Silence{}}
+	source := &fakeSource{gauges: map[string]float64{"cpu_1": 95, "db_load": 95}}
+
+	engine, clock := newTestEngine(source, Rule{Name: "high", Kind: KindThreshold, Metric: "*", Op: ">", Threshold: 90})
+	engine.silenceStore = store
+	ctx := context.Background()
+
+	silence, err := engine.CreateSilence(ctx, Silence{
+		Matchers:  []Matcher{{Name: MatchMetric, Value: "cpu_*"}},
+		CreatedBy: "ops",
+		EndsAt:    clock.now.Add(time.Hour),
+	})
+	require.NoError(t, err)
+	assert.NotEmpty(t, silence.ID)
+	assert.Equal(t, clock.now, silence.StartsAt)
+	assert.Equal(t, silence, store.silences[silence.ID])
+
+	window, err := engine.CreateSilence(ctx, Silence{
+		Matchers:  []Matcher{{Name: MatchMetric, Value: "db_*"}},
+		CreatedBy: "ops",
+		Schedule:  "0 2 * * *",
+		Duration:  Duration(time.Hour),
+	})
+	require.NoError(t, err)
+
+	transitions, err := engine.Evaluate(ctx)
+	require.NoError(t, err)
+	require.Len(t, transitions, 4)
+	assert.Equal(t, []string{silence.ID}, transitions[0].Alert.SilencedBy)
+	assert.Empty(t, transitions[2].Alert.SilencedBy)
+
+	// окно обслуживания открывается в 02:00, разовая заглушка к этому времени истекла
+	clock.advance(2 * time.Hour)
+	_, err = engine.Evaluate(ctx)
+	require.NoError(t, err)
+
+	alerts, err := engine.Alerts(ctx)
+	require.NoError(t, err)
+	require.Len(t, alerts, 2)
+	assert.Empty(t, alerts[0].SilencedBy)
+	assert.Equal(t, []string{window.ID}, alerts[1].SilencedBy)
+
+	// заглушки загружаются из хранилища после перезапуска
+	restarted, _ := newTestEngine(source)
+	restarted.silenceStore = store
+
+	silences, err := restarted.Silences(ctx)
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []Silence{silence, window}, silences)
+
+	updated, err := restarted.UpdateSilence(ctx, Silence{
+		ID: silence.ID, Matchers: silence.Matchers, EndsAt: silence.EndsAt.Add(time.Hour), Comment: "extended",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "ops", updated.CreatedBy)
+	assert.Equal(t, silence.CreatedAt, updated.CreatedAt)
+	assert.Equal(t, "extended", store.silences[silence.ID].Comment)
+
+	_, err = restarted.UpdateSilence(ctx, Silence{ID: "missing"})
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	_, err = restarted.CreateSilence(ctx, Silence{CreatedBy: "ops"})
+	assert.ErrorIs(t, err, ErrInvalidSilence)
+
+	require.NoError(t, restarted.DeleteSilence(ctx, window.ID))
+	assert.NotContains(t, store.silences, window.ID)
+	assert.ErrorIs(t, restarted.DeleteSilence(ctx, window.ID), ErrNotFound)
+
+	_, err = restarted.Silence(ctx, window.ID)
+	assert.ErrorIs(t, err, ErrNotFound)
+}
+
+func TestEngine_SilenceStoreError(t *testing.T) {
+	store := &fakeSilenceStore{silences: map[string]Silence{}, err: errors.New("store unavailable")}
+
+	engine, _ := newTestEngine(&fakeSource{})
+	engine.silenceStore = store
+
+	_, err := engine.Evaluate(context.Background())
+	assert.ErrorIs(t, err, store.err)
+
+	_, err = engine.Silences(context.Background())
+	assert.ErrorIs(t, err, store.err)
+}
@@ -0,0 +1,102 @@
+package alerting
+
+import (
+	"context"
+	"fmt"
+
+	"go.uber.org/zap"
+)
+
+// maxUnsavedTransitions ограничивает очередь переходов, ожидающих сохранения в StateStore.
+const maxUnsavedTransitions = 10000
+
+// StateStore хранилище активных оповещений и журнала их переходов. Активные оповещения
+// восстанавливаются после перезапуска сервера, журнал хранит каждый переход для аудита.
+type StateStore interface {
+	GetActiveAlerts(ctx context.Context) ([]Alert, error)
+	// SaveTransitions добавляет переходы в журнал и обновляет по ним активные оповещения:
+	// разрешенные удаляются, остальные добавляются или заменяются по Alert.Key.
+	SaveTransitions(ctx context.Context, transitions []Transition) error
+	// GetAlertHistory возвращает страницу журнала от новых переходов к старым и общее число переходов.
+	GetAlertHistory(ctx context.Context, offset, limit int) ([]Transition, int, error)
+}
+
+// History страница журнала переходов оповещений.
+type History struct {
+	Transitions []Transition `json:"transitions"`
+	Total       int          `json:"total"`
+	Offset      int          `json:"offset"`
+	Limit       int          `json:"limit"`
+}
+
+// restore загружает активные оповещения из хранилища при первом обращении. Вызывается под mu.
+func (e *Engine) restore(ctx context.Context) error {
+	if e.restored {
+		return nil
+	}
+
+	if e.stateStore != nil {
+		alerts, err := e.stateStore.GetActiveAlerts(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to load alerts: %w", err)
+		}
+
+		for _, alert := range alerts {
+			e.alerts[alert.Key()] = &alert
+		}
+	}
+
+	e.restored = true
+	e.restoredAt = e.now()
+
+	return nil
+}
+
+// save сохраняет переходы в хранилище. Вызывается под mu, чтобы переходы записывались по порядку.
+// Переходы, которые не удалось сохранить, остаются в очереди и сохраняются при следующем вызове
+// вместе с новыми, чтобы журнал не терял переходы, уже примененные к активным оповещениям.
+func (e *Engine) save(ctx context.Context, transitions []Transition) error {
+	if e.stateStore == nil {
+		return nil
+	}
+
+	e.unsaved = append(e.unsaved, transitions...)
+	if len(e.unsaved) == 0 {
+		return nil
+	}
+
+	if dropped := len(e.unsaved) - maxUnsavedTransitions; dropped > 0 {
+		zap.L().Warn("dropping unsaved alert transitions", zap.Int("count", dropped))
+		e.unsaved = e.unsaved[dropped:]
+	}
+
+	if err := e.stateStore.SaveTransitions(ctx, e.unsaved); err != nil {
+		return fmt.Errorf("failed to save alert transitions (%d queued): %w", len(e.unsaved), err)
+	}
+
+	e.unsaved = nil
+
+	return nil
+}
+
+// History возвращает страницу журнала переходов от новых к старым. Без хранилища журнал пуст.
+func (e *Engine) History(ctx context.Context, offset, limit int) (History, error) {
+	history := History{Transitions: []Transition{}, Offset: offset, Limit: limit}
+
+	if e.stateStore == nil {
+		return history, nil
+	}
+
+	transitions, total, err := e.stateStore.GetAlertHistory(ctx, offset, limit)
+	if err != nil {
+		return history, fmt.Errorf("failed to get alert history: %w", err)
+	}
+
+	if transitions != nil {
+		history.Transitions = transitions
+	}
+
+	history.Total = total
+
+	return history, nil
+}
@@ -0,0 +1,180 @@
+//nolint:wrapcheck,nolintlint,errcheck
+package alerting
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeStateStore хранилище состояния оповещений в памяти.
+type fakeStateStore struct {
+	err     error
+	alerts  map[string]Alert
+	history []Transition
+}
+
+func newFakeStateStore() *fakeStateStore {
+	return &fakeStateStore{alerts: make(map[string]Alert)}
+}
+
+func (s *fakeStateStore) GetActiveAlerts(context.Context) ([]Alert, error) {
+	alerts := make([]Alert, 0, len(s.alerts))
+	for _, key := range sortedKeys(s.alerts) {
+		alerts = append(alerts, s.alerts[key])
+	}
+
+	return alerts, s.err
+}
+
+func (s *fakeStateStore) SaveTransitions(_ context.Context, transitions []Transition) error {
+	if s.err != nil {
+		return s.err
+	}
+
+	for _, t := range transitions {
+		if t.To == StateResolved {
+			delete(s.alerts, t.Alert.Key())
+		} else {
+			s.alerts[t.Alert.Key()] = t.Alert
+		}
+	}
+
+	s.history = append(s.history, transitions...)
+
+	return nil
+}
+
+func (s *fakeStateStore) GetAlertHistory(_ context.Context, offset, limit int) ([]Transition, int, error) {
+	var page []Transition
+	for i := len(s.history) - 1 - offset; i >= 0 && len(page) < limit; i-- {
+		page = append(page, s.history[i])
+	}
+
+	return page, len(s.history), s.err
+}
+
+func TestEngine_StatePersistence(t *testing.T) {
+	store := newFakeStateStore()
+	source := &fakeSource{gauges: map[string]float64{"cpu": 95}}
+	rule := Rule{Name: "high_cpu", Kind: KindThreshold, Metric: "cpu", Op: ">", Threshold: 90, For: Duration(time.Minute)}
+
+	engine, clock := newTestEngine(source, rule)
+	engine.stateStore = store
+	ctx := context.Background()
+
+	_, err := engine.Evaluate(ctx)
+	require.NoError(t, err)
+	require.Contains(t, store.alerts, "high_cpu/gauge/cpu")
+	assert.Equal(t, StatePending, store.alerts["high_cpu/gauge/cpu"].State)
+
+	// после перезапуска оповещение продолжает ожидание с прежнего момента активации
+	restarted, restartedClock := newTestEngine(source, rule)
+	restarted.stateStore = store
+	restartedClock.now = clock.now.Add(time.Minute)
+
+	alerts, err := restarted.Alerts(ctx)
+	require.NoError(t, err)
+	require.Len(t, alerts, 1)
+	assert.Equal(t, clock.now, alerts[0].ActiveAt)
+
+	transitions, err := restarted.Evaluate(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"cpu:pending->firing"}, states(transitions))
+
+	source.gauges["cpu"] = 10
+	_, err = restarted.Evaluate(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, store.alerts)
+
+	history, err := restarted.History(ctx, 0, 2)
+	require.NoError(t, err)
+	assert.Equal(t, 3, history.Total)
+	assert.Equal(t, []string{"cpu:firing->resolved", "cpu:pending->firing"}, states(history.Transitions))
+
+	history, err = restarted.History(ctx, 2, 2)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"cpu:inactive->pending"}, states(history.Transitions))
+}
+
+func TestEngine_StateStoreErrors(t *testing.T) {
+	store := newFakeStateStore()
+	source := &fakeSource{gauges: map[string]float64{"cpu": 95}}
+
+	engine, _ := newTestEngine(source, Rule{Name: "high_cpu", Kind: KindThreshold, Metric: "cpu", Op: ">", Threshold: 90})
+	engine.stateStore = store
+	ctx := context.Background()
+
+	store.err = errors.New("store unavailable")
+
+	_, err := engine.Evaluate(ctx)
+	assert.ErrorIs(t, err, store.err)
+
+	_, err = engine.History(ctx, 0, 10)
+	assert.ErrorIs(t, err, store.err)
+
+	// ошибка сохранения не отменяет переходы
+	store.err = nil
+	_, err = engine.Alerts(ctx)
+	require.NoError(t, err)
+
+	store.err = errors.New("write failed")
+	transitions, err := engine.Evaluate(ctx)
+	assert.ErrorIs(t, err, store.err)
+	assert.Equal(t, []string{"cpu:inactive->pending", "cpu:pending->firing"}, states(transitions))
+	assert.Empty(t, store.history)
+
+	// несохраненные переходы сохраняются при следующем вычислении
+	store.err = nil
+	transitions, err = engine.Evaluate(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, transitions)
+	assert.Equal(t, []string{"cpu:inactive->pending", "cpu:pending->firing"}, states(store.history))
+	assert.Contains(t, store.alerts, "high_cpu/gauge/cpu")
+}
+
+func TestEngine_AnomalyRestored(t *testing.T) {
+	store := newFakeStateStore()
+	source := &fakeSource{gauges: map[string]float64{"gc": 5}}
+	rule := Rule{
+		Name: "gc", Kind: KindAnomaly, Metric: "gc",
+		Anomaly: &Anomaly{Method: MethodEWMA, WarmUp: Duration(5 * time.Minute)},
+	}
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	store.alerts["gc/gauge/gc"] = Alert{
+		Rule: "gc", Metric: "gc", MType: "gauge", State: StateFiring, ActiveAt: start, FiredAt: start,
+	}
+
+	engine, clock := newTestEngine(source, rule)
+	engine.stateStore = store
+	ctx := context.Background()
+
+	// пока базовая линия прогревается, восстановленное оповещение не разрешается
+	for range 5 {
+		transitions, err := engine.Evaluate(ctx)
+		require.NoError(t, err)
+		assert.Empty(t, transitions)
+		clock.advance(time.Minute)
+	}
+
+	alerts, err := engine.Alerts(ctx)
+	require.NoError(t, err)
+	require.Len(t, alerts, 1)
+	assert.Equal(t, StateFiring, alerts[0].State)
+
+	transitions, err := engine.Evaluate(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"gc:firing->resolved"}, states(transitions))
+}
+
+func TestEngine_HistoryWithoutStore(t *testing.T) {
+	engine, _ := newTestEngine(&fakeSource{})
+
+	history, err := engine.History(context.Background(), 0, 10)
+	require.NoError(t, err)
+	assert.Equal(t, History{Transitions: []Transition{}, Limit: 10}, history)
+}
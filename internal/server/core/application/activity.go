@@ -0,0 +1,50 @@
+package application
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// touch отмечает отчет агента из контекста. Отчетом считается любой запрос на запись метрик,
+// даже если метрики в нем отклонены: агент при этом остается на связи. Запросы без агента
+// не учитываются. Время отчета сохраняется в хранилище, чтобы после перезапуска сервера
+// агенты, замолчавшие до него, тоже считались молчащими; ошибка сохранения только логируется.
+func (a *Application) touch(ctx context.Context) {
+	client, ok := ClientFromContext(ctx)
+	if !ok || client.Agent == "" {
+		return
+	}
+
+	if err := a.repo.SaveAgentActivity(ctx, client.Agent, a.now()); err != nil {
+		zap.L().Warn("failed to save agent activity", zap.String("agent", client.Agent), zap.Error(err))
+	}
+}
+
+// AgentActivity возвращает время последнего отчета каждого агента.
+func (a *Application) AgentActivity(ctx context.Context) (map[string]time.Time, error) {
+	agents, err := a.repo.GetAgentActivity(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get agent activity: %w", err)
+	}
+
+	return agents, nil
+}
+
+// ExpireAgents забывает агентов, не присылавших отчетов дольше AgentExpiry, и возвращает их.
+// Нулевой срок отключает удаление. Забытый агент пропадает из списка агентов, но его оповещения
+// absence не разрешаются, пока он снова не пришлет отчет.
+func (a *Application) ExpireAgents(ctx context.Context) ([]string, error) {
+	if a.agentExpiry <= 0 {
+		return nil, nil
+	}
+
+	agents, err := a.repo.ExpireAgents(ctx, a.now().Add(-a.agentExpiry))
+	if err != nil {
+		return nil, fmt.Errorf("failed to delete agent activity: %w", err)
+	}
+
+	return agents, nil
+}
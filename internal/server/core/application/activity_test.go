@@ -0,0 +1,72 @@
+//nolint:wrapcheck,nolintlint,errcheck
+package application
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"metricalert/internal/server/core/model"
+)
+
+func TestApplication_AgentActivity(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	seen := map[string]time.Time{"ip:10.0.0.1": now}
+
+	repo := new(mockRepo)
+	repo.On("UpdateGauge", mock.Anything, "a", 1.0).Return(nil)
+	repo.On("UpdateGauges", mock.Anything, map[string]float64{"b": 2}).Return(errors.New("store unavailable"))
+	repo.On("SaveAgentActivity", mock.Anything, "ip:10.0.0.1", now).Return(nil).Once()
+	repo.On("SaveAgentActivity", mock.Anything, "ip:10.0.0.2", now.Add(time.Minute)).
+		Return(errors.New("store unavailable")).Once()
+	repo.On("GetAgentActivity", mock.Anything).Return(seen, nil)
+
+	app := newTestApplication(repo, Config{})
+	app.now = func() time.Time { return now }
+
+	ctx := context.Background()
+	require.NoError(t, app.UpdateMetric(ctx, model.MetricRequest{ID: "a", MType: "gauge", Value: ptr(1.0)}))
+
+	agent1 := WithClient(ctx, model.Client{Agent: "ip:10.0.0.1"})
+	require.NoError(t, app.UpdateMetric(agent1, model.MetricRequest{ID: "a", MType: "gauge", Value: ptr(1.0)}))
+
+	// отчет учитывается, даже если метрики в нем не записаны;
+	// ошибка сохранения времени отчета не мешает записи метрик
+	now = now.Add(time.Minute)
+	agent2 := WithClient(ctx, model.Client{Agent: "ip:10.0.0.2"})
+	_, err := app.UpdateMetrics(agent2, []model.MetricRequest{{ID: "b", MType: "gauge", Value: ptr(2.0)}},
+		model.BatchOptions{})
+	assert.ErrorContains(t, err, "store unavailable")
+
+	activity, err := app.AgentActivity(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, seen, activity)
+
+	repo.AssertExpectations(t)
+}
+
+func TestApplication_ExpireAgents(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	repo := new(mockRepo)
+	repo.On("ExpireAgents", mock.Anything, now.Add(-time.Hour)).Return([]string{"ip:10.0.0.1"}, nil).Once()
+
+	app := newTestApplication(repo, Config{AgentExpiry: time.Hour})
+	app.now = func() time.Time { return now }
+
+	agents, err := app.ExpireAgents(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, []string{"ip:10.0.0.1"}, agents)
+
+	// без срока агенты не удаляются
+	agents, err = newTestApplication(repo, Config{}).ExpireAgents(context.Background())
+	require.NoError(t, err)
+	assert.Empty(t, agents)
+
+	repo.AssertExpectations(t)
+}
@@ -0,0 +1,238 @@
+package application
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+
+	"metricalert/internal/server/core/model"
+	"metricalert/internal/server/core/repositories"
+)
+
+// DeleteMetrics удаляет метрики, выбранные по имени или шаблону, и возвращает удаленные метрики.
+// Если метрика выбрана по имени и не найдена, возвращается ErrNotFound.
+func (a *Application) DeleteMetrics(ctx context.Context, sel model.MetricSelector) ([]model.MetricRef, error) {
+	gauges, counters, err := a.selectMetrics(ctx, sel)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(gauges) > 0 {
+		if err = a.repo.DeleteGauges(ctx, gauges); err != nil {
+			return nil, fmt.Errorf("failed to delete gauges: %w", err)
+		}
+
+		a.cardinality.forget(gaugeType, gauges)
+	}
+
+	if len(counters) > 0 {
+		if err = a.repo.DeleteCounters(ctx, counters); err != nil {
+			return nil, fmt.Errorf("failed to delete counters: %w", err)
+		}
+
+		a.cardinality.forget(counterType, counters)
+	}
+
+	return metricRefs(gauges, counters), nil
+}
+
+// ResetCounters обнуляет счетчики, выбранные по имени или шаблону, и возвращает обнуленные метрики.
+// Если счетчик выбран по имени и не найден, возвращается ErrNotFound.
+func (a *Application) ResetCounters(ctx context.Context, sel model.MetricSelector) ([]model.MetricRef, error) {
+	if sel.MType == "" {
+		sel.MType = string(counterType)
+	}
+
+	if metricType(sel.MType) != counterType {
+		return nil, newError(ErrBadRequest, CodeUnknownType, "only counters can be reset, type: "+sel.MType)
+	}
+
+	_, counters, err := a.selectMetrics(ctx, sel)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(counters) > 0 {
+		if err = a.repo.ResetCounters(ctx, counters); err != nil {
+			return nil, fmt.Errorf("failed to reset counters: %w", err)
+		}
+	}
+
+	return metricRefs(nil, counters), nil
+}
+
+// RenameMetric переименовывает метрику. Новое имя должно соответствовать политике именования.
+// Если метрика с новым именем уже существует, возвращается ErrConflict. Значение записывается
+// под новым именем, после чего старая метрика удаляется, поэтому обновления, пришедшие между
+// этими шагами, теряются.
+func (a *Application) RenameMetric(ctx context.Context, mType, from, to string) error {
+	if strings.TrimSpace(from) == "" || strings.TrimSpace(to) == "" {
+		return newError(ErrBadRequest, CodeEmptyName, "empty metric name")
+	}
+
+	if from == to {
+		return newError(ErrBadRequest, CodeBadSelector, "new metric name matches the old one")
+	}
+
+	// новое имя проверяется без нормализации, чтобы метрика не получила неожиданное имя
+	if err := a.naming.check(to); err != nil {
+		return err
+	}
+
+	switch metricType(mType) {
+	case gaugeType:
+		return a.renameGauge(ctx, from, to)
+	case counterType:
+		return a.renameCounter(ctx, from, to)
+	default:
+		return newError(ErrBadRequest, CodeUnknownType, "unknown metric type, value: "+mType)
+	}
+}
+
+func (a *Application) renameGauge(ctx context.Context, from, to string) error {
+	value, err := a.repo.GetGauge(ctx, from)
+	if err != nil {
+		return notFound(err, "failed to get gauge")
+	}
+
+	_, err = a.repo.GetGauge(ctx, to)
+	if err = exists(err, to); err != nil {
+		return err
+	}
+
+	if err = a.repo.UpdateGauge(ctx, to, value); err != nil {
+		return fmt.Errorf("failed to update gauge: %w", err)
+	}
+
+	if err = a.repo.DeleteGauges(ctx, []string{from}); err != nil {
+		return fmt.Errorf("failed to delete gauge: %w", err)
+	}
+
+	a.cardinality.rename(gaugeType, from, to)
+
+	return nil
+}
+
+func (a *Application) renameCounter(ctx context.Context, from, to string) error {
+	value, err := a.repo.GetCounter(ctx, from)
+	if err != nil {
+		return notFound(err, "failed to get counter")
+	}
+
+	_, err = a.repo.GetCounter(ctx, to)
+	if err = exists(err, to); err != nil {
+		return err
+	}
+
+	if err = a.repo.UpdateCounter(ctx, to, value); err != nil {
+		return fmt.Errorf("failed to update counter: %w", err)
+	}
+
+	if err = a.repo.DeleteCounters(ctx, []string{from}); err != nil {
+		return fmt.Errorf("failed to delete counter: %w", err)
+	}
+
+	a.cardinality.rename(counterType, from, to)
+
+	return nil
+}
+
+// notFound преобразует ошибку поиска метрики в хранилище в ошибку приложения.
+func notFound(err error, msg string) error {
+	if errors.Is(err, repositories.ErrNotFound) {
+		return fmt.Errorf("metric not found: %w", ErrNotFound)
+	}
+
+	return fmt.Errorf("%s: %w", msg, err)
+}
+
+// exists возвращает ErrConflict, если поиск метрики name завершился успешно,
+// и nil, если метрика не найдена.
+func exists(err error, name string) error {
+	switch {
+	case err == nil:
+		return newError(ErrConflict, CodeMetricExists, "metric "+name+" already exists")
+	case errors.Is(err, repositories.ErrNotFound):
+		return nil
+	default:
+		return fmt.Errorf("failed to check metric %s: %w", name, err)
+	}
+}
+
+// selectMetrics возвращает отсортированные имена gauge и counter, подходящие под селектор.
+func (a *Application) selectMetrics(ctx context.Context, sel model.MetricSelector) ([]string, []string, error) {
+	if (sel.Name == "") == (sel.Pattern == "") {
+		return nil, nil, newError(ErrBadRequest, CodeBadSelector, "exactly one of name or pattern is required")
+	}
+
+	if _, err := path.Match(sel.Pattern, ""); err != nil {
+		return nil, nil, newError(ErrBadRequest, CodeBadSelector, "invalid pattern: "+sel.Pattern)
+	}
+
+	if sel.MType != "" && metricType(sel.MType) != gaugeType && metricType(sel.MType) != counterType {
+		return nil, nil, newError(ErrBadRequest, CodeUnknownType, "unknown metric type, value: "+sel.MType)
+	}
+
+	match := func(name string) bool {
+		if sel.Name != "" {
+			return name == sel.Name
+		}
+
+		ok, _ := path.Match(sel.Pattern, name)
+
+		return ok
+	}
+
+	var gauges, counters []string
+
+	if sel.MType == "" || metricType(sel.MType) == gaugeType {
+		list, err := a.repo.GetGaugeList(ctx)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to get gauge list: %w", err)
+		}
+
+		for name := range list {
+			if match(name) {
+				gauges = append(gauges, name)
+			}
+		}
+	}
+
+	if sel.MType == "" || metricType(sel.MType) == counterType {
+		list, err := a.repo.GetCounterList(ctx)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to get counter list: %w", err)
+		}
+
+		for name := range list {
+			if match(name) {
+				counters = append(counters, name)
+			}
+		}
+	}
+
+	if sel.Name != "" && len(gauges)+len(counters) == 0 {
+		return nil, nil, fmt.Errorf("metric not found: %w", ErrNotFound)
+	}
+
+	sort.Strings(gauges)
+	sort.Strings(counters)
+
+	return gauges, counters, nil
+}
+
+func metricRefs(gauges, counters []string) []model.MetricRef {
+	refs := make([]model.MetricRef, 0, len(gauges)+len(counters))
+	for _, name := range gauges {
+		refs = append(refs, model.MetricRef{ID: name, MType: string(gaugeType)})
+	}
+
+	for _, name := range counters {
+		refs = append(refs, model.MetricRef{ID: name, MType: string(counterType)})
+	}
+
+	return refs
+}
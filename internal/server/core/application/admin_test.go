@@ -0,0 +1,189 @@
+//nolint:wrapcheck,nolintlint,gocritic,errcheck,dupl,forcetypeassert
+package application
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"metricalert/internal/server/core/model"
+	"metricalert/internal/server/core/repositories"
+)
+
+func newAdminRepo() *mockRepo {
+	repo := new(mockRepo)
+	repo.On("GetGaugeList", mock.Anything).
+		Return(map[string]float64{"cpu_user": 1, "cpu_system": 2, "mem_free": 3}, nil)
+	repo.On("GetCounterList", mock.Anything).
+		Return(map[string]int64{"cpu_ticks": 10, "requests": 20}, nil)
+
+	return repo
+}
+
+func TestApplication_DeleteMetrics(t *testing.T) {
+	t.Run("by pattern", func(t *testing.T) {
+		repo := newAdminRepo()
+		repo.On("DeleteGauges", mock.Anything, []string{"cpu_system", "cpu_user"}).Return(nil)
+		repo.On("DeleteCounters", mock.Anything, []string{"cpu_ticks"}).Return(nil)
+
+		app := newTestApplication(repo, Config{})
+
+		deleted, err := app.DeleteMetrics(context.Background(), model.MetricSelector{Pattern: "cpu_*"})
+		require.NoError(t, err)
+		assert.Equal(t, []model.MetricRef{
+			{ID: "cpu_system", MType: "gauge"},
+			{ID: "cpu_user", MType: "gauge"},
+			{ID: "cpu_ticks", MType: "counter"},
+		}, deleted)
+
+		repo.AssertExpectations(t)
+	})
+
+	t.Run("by name and type", func(t *testing.T) {
+		repo := newAdminRepo()
+		repo.On("DeleteCounters", mock.Anything, []string{"requests"}).Return(nil)
+
+		app := newTestApplication(repo, Config{})
+
+		deleted, err := app.DeleteMetrics(context.Background(), model.MetricSelector{Name: "requests", MType: "counter"})
+		require.NoError(t, err)
+		assert.Equal(t, []model.MetricRef{{ID: "requests", MType: "counter"}}, deleted)
+
+		repo.AssertNotCalled(t, "GetGaugeList", mock.Anything)
+		repo.AssertNotCalled(t, "DeleteGauges", mock.Anything, mock.Anything)
+	})
+
+	t.Run("pattern without matches", func(t *testing.T) {
+		app := newTestApplication(newAdminRepo(), Config{})
+
+		deleted, err := app.DeleteMetrics(context.Background(), model.MetricSelector{Pattern: "disk_*"})
+		require.NoError(t, err)
+		assert.Empty(t, deleted)
+	})
+
+	t.Run("name not found", func(t *testing.T) {
+		app := newTestApplication(newAdminRepo(), Config{})
+
+		_, err := app.DeleteMetrics(context.Background(), model.MetricSelector{Name: "missing"})
+		assert.ErrorIs(t, err, ErrNotFound)
+	})
+
+	t.Run("invalid selector", func(t *testing.T) {
+		app := newTestApplication(new(mockRepo), Config{})
+
+		for _, sel := range []model.MetricSelector{
+			{},
+			{Name: "a", Pattern: "a*"},
+			{Pattern: "[a"},
+			{Name: "a", MType: "histogram"},
+		} {
+			_, err := app.DeleteMetrics(context.Background(), sel)
+			assert.ErrorIs(t, err, ErrBadRequest, "selector %+v", sel)
+		}
+	})
+
+	t.Run("store error", func(t *testing.T) {
+		repo := newAdminRepo()
+		repo.On("DeleteGauges", mock.Anything, mock.Anything).Return(errors.New("store error"))
+
+		app := newTestApplication(repo, Config{})
+
+		_, err := app.DeleteMetrics(context.Background(), model.MetricSelector{Pattern: "*"})
+		assert.Error(t, err)
+		repo.AssertNotCalled(t, "DeleteCounters", mock.Anything, mock.Anything)
+	})
+}
+
+func TestApplication_ResetCounters(t *testing.T) {
+	t.Run("by pattern", func(t *testing.T) {
+		repo := newAdminRepo()
+		repo.On("ResetCounters", mock.Anything, []string{"cpu_ticks", "requests"}).Return(nil)
+
+		app := newTestApplication(repo, Config{})
+
+		reset, err := app.ResetCounters(context.Background(), model.MetricSelector{Pattern: "*"})
+		require.NoError(t, err)
+		assert.Equal(t, []model.MetricRef{
+			{ID: "cpu_ticks", MType: "counter"},
+			{ID: "requests", MType: "counter"},
+		}, reset)
+
+		repo.AssertNotCalled(t, "GetGaugeList", mock.Anything)
+	})
+
+	t.Run("gauge type", func(t *testing.T) {
+		app := newTestApplication(new(mockRepo), Config{})
+
+		_, err := app.ResetCounters(context.Background(), model.MetricSelector{Name: "cpu_user", MType: "gauge"})
+		assert.ErrorIs(t, err, ErrBadRequest)
+	})
+
+	t.Run("name not found", func(t *testing.T) {
+		app := newTestApplication(newAdminRepo(), Config{})
+
+		_, err := app.ResetCounters(context.Background(), model.MetricSelector{Name: "cpu_user"})
+		assert.ErrorIs(t, err, ErrNotFound)
+	})
+}
+
+func TestApplication_RenameMetric(t *testing.T) {
+	t.Run("gauge", func(t *testing.T) {
+		repo := new(mockRepo)
+		repo.On("GetGauge", mock.Anything, "old").Return(1.5, nil)
+		repo.On("GetGauge", mock.Anything, "new").Return(0.0, repositories.ErrNotFound)
+		repo.On("UpdateGauge", mock.Anything, "new", 1.5).Return(nil)
+		repo.On("DeleteGauges", mock.Anything, []string{"old"}).Return(nil)
+
+		app := newTestApplication(repo, Config{})
+
+		require.NoError(t, app.RenameMetric(context.Background(), "gauge", "old", "new"))
+		repo.AssertExpectations(t)
+	})
+
+	t.Run("counter", func(t *testing.T) {
+		repo := new(mockRepo)
+		repo.On("GetCounter", mock.Anything, "old").Return(int64(7), nil)
+		repo.On("GetCounter", mock.Anything, "new").Return(int64(0), repositories.ErrNotFound)
+		repo.On("UpdateCounter", mock.Anything, "new", int64(7)).Return(nil)
+		repo.On("DeleteCounters", mock.Anything, []string{"old"}).Return(nil)
+
+		app := newTestApplication(repo, Config{})
+
+		require.NoError(t, app.RenameMetric(context.Background(), "counter", "old", "new"))
+		repo.AssertExpectations(t)
+	})
+
+	t.Run("target exists", func(t *testing.T) {
+		repo := new(mockRepo)
+		repo.On("GetGauge", mock.Anything, mock.Anything).Return(1.5, nil)
+
+		app := newTestApplication(repo, Config{})
+
+		err := app.RenameMetric(context.Background(), "gauge", "old", "new")
+		assert.ErrorIs(t, err, ErrConflict)
+		assert.Equal(t, CodeMetricExists, ErrorCode(err))
+		repo.AssertNotCalled(t, "UpdateGauge", mock.Anything, mock.Anything, mock.Anything)
+	})
+
+	t.Run("source not found", func(t *testing.T) {
+		repo := new(mockRepo)
+		repo.On("GetCounter", mock.Anything, "old").Return(int64(0), repositories.ErrNotFound)
+
+		app := newTestApplication(repo, Config{})
+
+		err := app.RenameMetric(context.Background(), "counter", "old", "new")
+		assert.ErrorIs(t, err, ErrNotFound)
+	})
+
+	t.Run("invalid request", func(t *testing.T) {
+		app := newTestApplication(new(mockRepo), Config{})
+
+		assert.ErrorIs(t, app.RenameMetric(context.Background(), "gauge", "", "new"), ErrBadRequest)
+		assert.ErrorIs(t, app.RenameMetric(context.Background(), "gauge", "old", "old"), ErrBadRequest)
+		assert.ErrorIs(t, app.RenameMetric(context.Background(), "histogram", "old", "new"), ErrBadRequest)
+	})
+}
@@ -5,10 +5,15 @@ package application
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"strconv"
 	"strings"
+	"sync"
+	"time"
 
 	"go.uber.org/zap"
 
@@ -26,21 +31,92 @@ type Repo interface {
 	GetCounterList(ctx context.Context) (map[string]int64, error)
 	GetGauge(ctx context.Context, name string) (float64, error)
 	GetCounter(ctx context.Context, name string) (int64, error)
+	DeleteGauges(ctx context.Context, names []string) error
+	DeleteCounters(ctx context.Context, names []string) error
+	ExpireGauges(ctx context.Context, cutoffs map[string]time.Time) ([]string, error)
+	ExpireCounters(ctx context.Context, cutoffs map[string]time.Time) ([]string, error)
+	ResetCounters(ctx context.Context, names []string) error
+	GetUpdateTimes(ctx context.Context) (model.UpdateTimes, error)
+	GetAgentActivity(ctx context.Context) (map[string]time.Time, error)
+	SaveAgentActivity(ctx context.Context, agent string, at time.Time) error
+	ExpireAgents(ctx context.Context, cutoff time.Time) ([]string, error)
+	GetBatchResult(ctx context.Context, key string) (model.BatchResult, error)
+	SaveBatchResult(ctx context.Context, key string, result model.BatchResult, expiresAt time.Time) error
 	Close() error
 	Ping(ctx context.Context) error
 	Sync(ctx context.Context)
 }
 
+// Config параметры приложения.
+// IdempotencyWindow задает время хранения ключей идемпотентности пакетов метрик,
+// нулевое значение отключает проверку ключей.
+// Staleness задает правила устаревания метрик, применяется первое правило с подходящим шаблоном.
+// AgentExpiry задает срок, после которого молчащий агент забывается, нулевое значение хранит агентов всегда.
+// Оповещения absence по забытому агенту продолжают срабатывать, пока он снова не пришлет отчет.
+// Metadata задает начальные метаданные метрик, которые затем можно изменять через SetMetadata.
+// Naming задает политику именования метрик.
+// Cardinality ограничивает количество различных метрик в целом, от агента и от арендатора.
+// Relabel задает правила преобразования метрик перед записью;
+// RelabelSource используется для перезагрузки правил через ReloadRelabelRules.
+// Recording задает правила записи.
+type Config struct {
+	Naming            NamingPolicy
+	RelabelSource     RelabelSource
+	Relabel           []model.RelabelRule
+	Cardinality       model.CardinalityLimits
+	Staleness         []StalenessRule
+	Recording         []RecordingRule
+	Metadata          []model.MetricMeta
+	IdempotencyWindow time.Duration
+	AgentExpiry       time.Duration
+}
+
 // Application структура принимает репозиторий и реализует методы для работы с метриками.
 type Application struct {
-	repo Repo
+	repo              Repo
+	batchLocks        *keyLocks
+	metadata          *metadataRegistry
+	naming            *namer
+	relabel           *relabeler
+	cardinality       *cardinality
+	now               func() time.Time
+	staleness         []StalenessRule
+	recording         []recordingRule
+	idempotencyWindow time.Duration
+	agentExpiry       time.Duration
 }
 
 // NewApplication создает новый экземпляр Application.
-func NewApplication(repo Repo) *Application {
-	return &Application{
-		repo: repo,
+// Некорректная политика именования, правила преобразования или записи возвращают ошибку.
+func NewApplication(repo Repo, conf Config) (*Application, error) {
+	naming, err := newNamer(conf.Naming)
+	if err != nil {
+		return nil, fmt.Errorf("invalid naming policy: %w", err)
+	}
+
+	relabel, err := newRelabeler(conf.Relabel, conf.RelabelSource)
+	if err != nil {
+		return nil, fmt.Errorf("invalid relabel rules: %w", err)
+	}
+
+	recording, err := newRecordingRules(conf.Recording, naming)
+	if err != nil {
+		return nil, fmt.Errorf("invalid recording rules: %w", err)
 	}
+
+	return &Application{
+		repo:              repo,
+		batchLocks:        newKeyLocks(),
+		metadata:          newMetadataRegistry(conf.Metadata),
+		naming:            naming,
+		relabel:           relabel,
+		cardinality:       newCardinality(conf.Cardinality),
+		now:               time.Now,
+		staleness:         conf.Staleness,
+		recording:         recording,
+		idempotencyWindow: conf.IdempotencyWindow,
+		agentExpiry:       conf.AgentExpiry,
+	}, nil
 }
 
 type metricType string
@@ -52,30 +128,97 @@ const (
 
 // UpdateMetric обновляет метрику.
 // Принимает тип метрики counter или gauge.
+// Новая метрика сверх лимита кардинальности отклоняется с ошибкой ErrLimitExceeded,
+// а в режиме отбрасывания не записывается без ошибки. Метрика, отброшенная правилом
+// преобразования, также не записывается без ошибки.
 func (a *Application) UpdateMetric(ctx context.Context, metric model.MetricRequest) error {
-	if strings.TrimSpace(metric.ID) == "" {
-		return fmt.Errorf("empty metric name, error: %w", ErrNotFound)
+	a.touch(ctx)
+
+	metric, err := a.prepareMetric(metric)
+	if err != nil {
+		if a.isDropped(err) {
+			return nil
+		}
+
+		return err
 	}
 
-	switch metricType(metric.MType) {
-	case counterType:
-		if metric.Delta == nil {
-			return fmt.Errorf("delta is nil on counter metric, error: %w", ErrBadRequest)
+	reserved, err := a.admitMetric(ctx, metric)
+	if err != nil {
+		if a.isDropped(err) {
+			return nil
 		}
 
+		return err
+	}
+
+	switch metricType(metric.MType) {
+	case counterType:
 		if err := a.repo.UpdateCounter(ctx, metric.ID, *metric.Delta); err != nil {
+			a.cardinality.release(reserved)
 			return fmt.Errorf("failed to update counter: %w", err)
 		}
 	case gaugeType:
-		if metric.Value == nil {
-			return fmt.Errorf("value is nil on gauge metric, error: %w", ErrBadRequest)
-		}
-
 		if err := a.repo.UpdateGauge(ctx, metric.ID, *metric.Value); err != nil {
+			a.cardinality.release(reserved)
 			return fmt.Errorf("failed to update gauge: %w", err)
 		}
+	}
+
+	return nil
+}
+
+// isDropped сообщает, что метрика отброшена правилом преобразования или отбрасывается
+// без ошибки сверх лимита кардинальности.
+func (a *Application) isDropped(err error) bool {
+	return errors.Is(err, errDropped) || (a.cardinality.limits.Drop && errors.Is(err, ErrLimitExceeded))
+}
+
+// prepareMetric проверяет запрос на обновление метрики, применяет к нему правила преобразования,
+// к имени — политику именования и проверяет метрику по ее метаданным.
+// Возвращает запрос с итоговыми именем, типом и значением метрики.
+func (a *Application) prepareMetric(metric model.MetricRequest) (model.MetricRequest, error) {
+	if err := ValidateMetric(metric); err != nil {
+		return metric, err
+	}
+
+	metric, err := a.relabel.apply(metric)
+	if err != nil {
+		return metric, err
+	}
+
+	name, err := a.naming.apply(metric.ID)
+	if err != nil {
+		return metric, err
+	}
+
+	metric.ID = name
+
+	if err = a.checkMetadata(metric); err != nil {
+		return metric, err
+	}
+
+	return metric, nil
+}
+
+// ValidateMetric проверяет запрос на обновление метрики.
+// Возвращает *Error с кодом ошибки, если запрос некорректен.
+func ValidateMetric(metric model.MetricRequest) error {
+	if strings.TrimSpace(metric.ID) == "" {
+		return newError(ErrNotFound, CodeEmptyName, "empty metric name")
+	}
+
+	switch metricType(metric.MType) {
+	case counterType:
+		if metric.Delta == nil {
+			return newError(ErrBadRequest, CodeMissingValue, "delta is nil on counter metric")
+		}
+	case gaugeType:
+		if metric.Value == nil {
+			return newError(ErrBadRequest, CodeMissingValue, "value is nil on gauge metric")
+		}
 	default:
-		return fmt.Errorf("unknown metric type, value: %s, error: %w", metric.MType, ErrBadRequest)
+		return newError(ErrBadRequest, CodeUnknownType, "unknown metric type, value: "+metric.MType)
 	}
 
 	return nil
@@ -85,11 +228,16 @@ func (a *Application) UpdateMetric(ctx context.Context, metric model.MetricReque
 var (
 	ErrBadRequest = errors.New("bad request")
 	ErrNotFound   = errors.New("not found")
+	ErrConflict   = errors.New("conflict")
+	// ErrLimitExceeded новая метрика не принята из-за лимита кардинальности.
+	ErrLimitExceeded = errors.New("limit exceeded")
 )
 
 // GetMetric возвращает значение метрики.
-// Принимает тип метрики counter или gauge.
+// Принимает тип метрики counter или gauge. Имя приводится к политике именования, как при записи.
 func (a *Application) GetMetric(ctx context.Context, metricName, metricType string) (string, error) {
+	metricName = a.naming.lookup(metricName)
+
 	switch metricType {
 	case "gauge":
 		gauge, err := a.repo.GetGauge(ctx, metricName)
@@ -112,22 +260,51 @@ func (a *Application) GetMetric(ctx context.Context, metricName, metricType stri
 
 		return strconv.Itoa(int(counter)), nil
 	default:
-		return "", fmt.Errorf("unknown metric type, value: %s, error: %w", metricType, ErrBadRequest)
+		return "", newError(ErrBadRequest, CodeUnknownType, "unknown metric type, value: "+metricType)
 	}
 }
 
-// GetMetrics возвращает список метрик.
+// GetMetrics возвращает список метрик gauge и counter с признаком устаревания.
 func (a *Application) GetMetrics(ctx context.Context) ([]model.MetricData, error) {
 	gaugeList, err := a.repo.GetGaugeList(ctx)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get gauge list: %w", err)
 	}
 
-	var metrics = make([]model.MetricData, 0, len(gaugeList))
+	counterList, err := a.repo.GetCounterList(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get counter list: %w", err)
+	}
+
+	times, err := a.updateTimes(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	now := a.now()
+
+	var metrics = make([]model.MetricData, 0, len(gaugeList)+len(counterList))
 	for name, value := range gaugeList {
+		meta, _ := a.metadata.get(name)
+
 		metrics = append(metrics, model.MetricData{
 			Name:  name,
 			Value: strconv.FormatFloat(value, 'g', -1, 64),
+			Unit:  meta.Unit,
+			Help:  meta.Help,
+			Stale: a.isStale(name, times.Gauges, now),
+		})
+	}
+
+	for name, delta := range counterList {
+		meta, _ := a.metadata.get(name)
+
+		metrics = append(metrics, model.MetricData{
+			Name:  name,
+			Value: strconv.FormatInt(delta, 10),
+			Unit:  meta.Unit,
+			Help:  meta.Help,
+			Stale: a.isStale(name, times.Counters, now),
 		})
 	}
 
@@ -144,48 +321,244 @@ func (a *Application) Ping(ctx context.Context) error {
 	return nil
 }
 
-// UpdateMetrics обновляет метрики.
-// Принимает тип метрики counter или gauge.
-func (a *Application) UpdateMetrics(ctx context.Context, metrics []model.MetricRequest) error {
+// UpdateMetrics обновляет метрики пакета и возвращает результат обработки каждой из них.
+// Некорректные метрики отклоняются, остальные записываются. Повторные значения gauge
+// с одним именем перезаписывают предыдущие, значения counter суммируются.
+// В строгом режиме пакет с некорректной метрикой отклоняется целиком с ошибкой ErrBadRequest.
+func (a *Application) UpdateMetrics(ctx context.Context, metrics []model.MetricRequest,
+	opts model.BatchOptions) (model.BatchResult, error) {
+	a.touch(ctx)
+
+	if opts.IdempotencyKey == "" || a.idempotencyWindow <= 0 {
+		return a.updateMetrics(ctx, metrics, opts)
+	}
+
+	// ключ действует в пределах клиента, чтобы ключи разных агентов не пересекались
+	key := opts.IdempotencyKey
+	if client, ok := ClientFromContext(ctx); ok {
+		key = client.Tenant + "/" + client.Agent + "/" + key
+	}
+
+	hash, err := payloadHash(metrics, opts)
+	if err != nil {
+		return model.BatchResult{}, err
+	}
+
+	// пакеты с одним ключом обрабатываются последовательно, чтобы повтор не применился параллельно с оригиналом
+	unlock := a.batchLocks.lock(key)
+	defer unlock()
+
+	saved, err := a.repo.GetBatchResult(ctx, key)
+	switch {
+	case err == nil:
+		if saved.PayloadHash != hash {
+			return model.BatchResult{}, newError(ErrConflict, CodeIdempotencyKeyReused,
+				"idempotency key "+opts.IdempotencyKey+" was already used for a different batch")
+		}
+
+		saved.PayloadHash = ""
+		saved.Replayed = true
+
+		return saved, nil
+	case !errors.Is(err, repositories.ErrNotFound):
+		return model.BatchResult{}, fmt.Errorf("failed to get batch result: %w", err)
+	}
+
+	result, err := a.updateMetrics(ctx, metrics, opts)
+	if err != nil {
+		return result, err
+	}
+
+	// метрики уже записаны, поэтому ошибка сохранения ключа не возвращается клиенту:
+	// иначе повтор пакета применит счетчики второй раз
+	record := result
+	record.PayloadHash = hash
+
+	err = a.repo.SaveBatchResult(ctx, key, record, a.now().Add(a.idempotencyWindow))
+	if err != nil {
+		zap.L().Error("failed to save batch result", zap.String("key", opts.IdempotencyKey), zap.Error(err))
+	}
+
+	return result, nil
+}
+
+// payloadHash возвращает хеш содержимого пакета, с которым сохраняется ключ идемпотентности.
+func payloadHash(metrics []model.MetricRequest, opts model.BatchOptions) (string, error) {
+	data, err := json.Marshal(struct {
+		Metrics []model.MetricRequest `json:"metrics"`
+		Strict  bool                  `json:"strict"`
+	}{metrics, opts.Strict})
+	if err != nil {
+		return "", fmt.Errorf("failed to hash batch: %w", err)
+	}
+
+	sum := sha256.Sum256(data)
+
+	return hex.EncodeToString(sum[:]), nil
+}
+
+func (a *Application) updateMetrics(ctx context.Context, metrics []model.MetricRequest,
+	opts model.BatchOptions) (model.BatchResult, error) {
 	var (
 		gaugeMetricList   = map[string]float64{}
 		counterMetricList = map[string]int64{}
+		gaugeIndex        = map[string]int{}
+		items             = make([]model.ItemResult, len(metrics))
+		gaugesReserved    []series
+		countersReserved  []series
+		invalid           int
 	)
 
-	for _, r := range metrics {
-		switch metricType(r.MType) {
-		case counterType:
-			if r.Delta == nil {
-				zap.L().Warn("delta is nil on counter metric", zap.String("id", r.ID))
+	for i, request := range metrics {
+		items[i] = model.ItemResult{Index: i, ID: request.ID, Status: model.ItemAccepted}
+
+		r, err := a.prepareMetric(request)
+		if err != nil {
+			items[i].Code = ErrorCode(err)
+			items[i].Message = ErrorMessage(err)
+
+			if a.isDropped(err) {
+				items[i].Status = model.ItemDropped
 				continue
 			}
 
+			items[i].Status = model.ItemRejected
+			invalid++
+
+			continue
+		}
+
+		if r.ID != items[i].ID {
+			items[i].Message = "metric name normalized to " + r.ID
+		}
+
+		reserved, err := a.admitMetric(ctx, r)
+		if err != nil {
+			if !errors.Is(err, ErrLimitExceeded) {
+				a.cardinality.release(append(gaugesReserved, countersReserved...))
+				return model.BatchResult{}, err
+			}
+
+			items[i].Status = model.ItemRejected
+			items[i].Code = ErrorCode(err)
+			items[i].Message = ErrorMessage(err)
+
+			if a.isDropped(err) {
+				items[i].Status = model.ItemDropped
+			} else {
+				invalid++
+			}
+
+			continue
+		}
+
+		switch metricType(r.MType) {
+		case counterType:
+			countersReserved = append(countersReserved, reserved...)
 			counterMetricList[r.ID] += *r.Delta
 		case gaugeType:
-			if r.Value == nil {
-				zap.L().Warn("value is nil on gauge metric", zap.String("id", r.ID))
-				continue
+			if prev, ok := gaugeIndex[r.ID]; ok {
+				items[prev].Status = model.ItemDeduplicated
+				items[prev].Message = fmt.Sprintf("overridden by item %d", i)
 			}
 
+			gaugesReserved = append(gaugesReserved, reserved...)
+			gaugeIndex[r.ID] = i
 			gaugeMetricList[r.ID] = *r.Value
+		}
+	}
 
-		default:
-			zap.L().Warn("unknown metric type", zap.String("type", r.MType))
-			continue
+	if opts.Strict && invalid > 0 {
+		a.cardinality.release(append(gaugesReserved, countersReserved...))
+
+		for i := range items {
+			if items[i].Status != model.ItemRejected {
+				items[i].Status = model.ItemRejected
+				items[i].Code = CodeBatchRejected
+				items[i].Message = "batch rejected in strict mode"
+			}
 		}
+
+		return summarize(items), newError(ErrBadRequest, CodeBatchRejected,
+			fmt.Sprintf("batch contains %d invalid metrics", invalid))
 	}
 
 	if len(gaugeMetricList) > 0 {
 		if err := a.repo.UpdateGauges(ctx, gaugeMetricList); err != nil {
-			return fmt.Errorf("failed to update gauges: %w", err)
+			a.cardinality.release(append(gaugesReserved, countersReserved...))
+			return model.BatchResult{}, fmt.Errorf("failed to update gauges: %w", err)
 		}
 	}
 
 	if len(counterMetricList) > 0 {
 		if err := a.repo.UpdateCounters(ctx, counterMetricList); err != nil {
-			return fmt.Errorf("failed to update counters: %w", err)
+			a.cardinality.release(countersReserved)
+			return model.BatchResult{}, fmt.Errorf("failed to update counters: %w", err)
 		}
 	}
 
-	return nil
+	return summarize(items), nil
+}
+
+// summarize подсчитывает количество метрик пакета по статусам.
+func summarize(items []model.ItemResult) model.BatchResult {
+	result := model.BatchResult{Items: items}
+	for _, item := range items {
+		switch item.Status {
+		case model.ItemAccepted:
+			result.Accepted++
+		case model.ItemRejected:
+			result.Rejected++
+		case model.ItemDeduplicated:
+			result.Deduplicated++
+		case model.ItemDropped:
+			result.Dropped++
+		}
+	}
+
+	return result
+}
+
+// keyLocks набор мьютексов по ключам. Мьютекс удаляется, когда его никто не ожидает.
+type keyLocks struct {
+	mu    *sync.Mutex
+	locks map[string]*keyLock
+}
+
+type keyLock struct {
+	mu   *sync.Mutex
+	refs int
+}
+
+func newKeyLocks() *keyLocks {
+	return &keyLocks{
+		mu:    &sync.Mutex{},
+		locks: make(map[string]*keyLock),
+	}
+}
+
+// lock захватывает мьютекс ключа и возвращает функцию для его освобождения.
+func (k *keyLocks) lock(key string) func() {
+	k.mu.Lock()
+	l, ok := k.locks[key]
+	if !ok {
+		l = &keyLock{mu: &sync.Mutex{}}
+		k.locks[key] = l
+	}
+	l.refs++
+	k.mu.Unlock()
+
+	l.mu.Lock()
+
+	return func() {
+		l.mu.Unlock()
+
+		k.mu.Lock()
+		defer k.mu.Unlock()
+
+		l.refs--
+		if l.refs == 0 {
+			delete(k.locks, key)
+		}
+	}
 }
@@ -4,6 +4,7 @@ package application
 import (
 	"context"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
@@ -13,6 +14,16 @@ import (
 	"metricalert/internal/server/core/repositories"
 )
 
+// newTestApplication создает Application с заведомо корректной конфигурацией.
+func newTestApplication(repo Repo, conf Config) *Application {
+	app, err := NewApplication(repo, conf)
+	if err != nil {
+		panic(err)
+	}
+
+	return app
+}
+
 type mockRepo struct {
 	mock.Mock
 }
@@ -57,6 +68,61 @@ func (m *mockRepo) GetCounter(ctx context.Context, name string) (int64, error) {
 	return args.Get(0).(int64), args.Error(1)
 }
 
+func (m *mockRepo) DeleteGauges(ctx context.Context, names []string) error {
+	args := m.Called(ctx, names)
+	return args.Error(0)
+}
+
+func (m *mockRepo) DeleteCounters(ctx context.Context, names []string) error {
+	args := m.Called(ctx, names)
+	return args.Error(0)
+}
+
+func (m *mockRepo) ExpireGauges(ctx context.Context, cutoffs map[string]time.Time) ([]string, error) {
+	args := m.Called(ctx, cutoffs)
+	return args.Get(0).([]string), args.Error(1)
+}
+
+func (m *mockRepo) ExpireCounters(ctx context.Context, cutoffs map[string]time.Time) ([]string, error) {
+	args := m.Called(ctx, cutoffs)
+	return args.Get(0).([]string), args.Error(1)
+}
+
+func (m *mockRepo) ResetCounters(ctx context.Context, names []string) error {
+	args := m.Called(ctx, names)
+	return args.Error(0)
+}
+
+func (m *mockRepo) GetUpdateTimes(ctx context.Context) (model.UpdateTimes, error) {
+	args := m.Called(ctx)
+	return args.Get(0).(model.UpdateTimes), args.Error(1)
+}
+
+func (m *mockRepo) GetAgentActivity(ctx context.Context) (map[string]time.Time, error) {
+	args := m.Called(ctx)
+	return args.Get(0).(map[string]time.Time), args.Error(1)
+}
+
+func (m *mockRepo) SaveAgentActivity(ctx context.Context, agent string, at time.Time) error {
+	args := m.Called(ctx, agent, at)
+	return args.Error(0)
+}
+
+func (m *mockRepo) ExpireAgents(ctx context.Context, cutoff time.Time) ([]string, error) {
+	args := m.Called(ctx, cutoff)
+	return args.Get(0).([]string), args.Error(1)
+}
+
+func (m *mockRepo) GetBatchResult(ctx context.Context, key string) (model.BatchResult, error) {
+	args := m.Called(ctx, key)
+	return args.Get(0).(model.BatchResult), args.Error(1)
+}
+
+func (m *mockRepo) SaveBatchResult(ctx context.Context, key string, result model.BatchResult, expiresAt time.Time) error {
+	args := m.Called(ctx, key, result, expiresAt)
+	return args.Error(0)
+}
+
 func (m *mockRepo) Close() error {
 	args := m.Called()
 	return args.Error(0)
@@ -74,7 +140,7 @@ func (m *mockRepo) Sync(ctx context.Context) {
 
 func TestApplication_NewApplication(t *testing.T) {
 	repo := new(mockRepo)
-	app := NewApplication(repo)
+	app := newTestApplication(repo, Config{})
 
 	assert.NotNil(t, app)
 	assert.Equal(t, repo, app.repo)
@@ -83,7 +149,7 @@ func TestApplication_NewApplication(t *testing.T) {
 func TestApplication_UpdateMetric(t *testing.T) {
 	t.Run("id is empty", func(t *testing.T) {
 		repo := new(mockRepo)
-		app := NewApplication(repo)
+		app := newTestApplication(repo, Config{})
 
 		err := app.UpdateMetric(context.Background(), model.MetricRequest{})
 		assert.Error(t, err)
@@ -92,7 +158,7 @@ func TestApplication_UpdateMetric(t *testing.T) {
 
 	t.Run("unknown metric type", func(t *testing.T) {
 		repo := new(mockRepo)
-		app := NewApplication(repo)
+		app := newTestApplication(repo, Config{})
 
 		err := app.UpdateMetric(context.Background(), model.MetricRequest{ID: "test", MType: "unknown"})
 		assert.Error(t, err)
@@ -101,7 +167,7 @@ func TestApplication_UpdateMetric(t *testing.T) {
 
 	t.Run("counter metric, delta is nil", func(t *testing.T) {
 		repo := new(mockRepo)
-		app := NewApplication(repo)
+		app := newTestApplication(repo, Config{})
 
 		err := app.UpdateMetric(context.Background(), model.MetricRequest{ID: "test", MType: "counter"})
 		assert.Error(t, err)
@@ -110,7 +176,7 @@ func TestApplication_UpdateMetric(t *testing.T) {
 
 	t.Run("gauge metric, value is nil", func(t *testing.T) {
 		repo := new(mockRepo)
-		app := NewApplication(repo)
+		app := newTestApplication(repo, Config{})
 
 		err := app.UpdateMetric(context.Background(), model.MetricRequest{ID: "test", MType: "gauge"})
 		assert.Error(t, err)
@@ -119,7 +185,7 @@ func TestApplication_UpdateMetric(t *testing.T) {
 
 	t.Run("update counter", func(t *testing.T) {
 		repo := new(mockRepo)
-		app := NewApplication(repo)
+		app := newTestApplication(repo, Config{})
 
 		repo.On("UpdateCounter", mock.Anything, mock.Anything, mock.Anything).Return(nil)
 
@@ -129,7 +195,7 @@ func TestApplication_UpdateMetric(t *testing.T) {
 
 	t.Run("update counter, with err", func(t *testing.T) {
 		repo := new(mockRepo)
-		app := NewApplication(repo)
+		app := newTestApplication(repo, Config{})
 
 		repo.On("UpdateCounter", mock.Anything, mock.Anything, mock.Anything).Return(assert.AnError)
 
@@ -139,7 +205,7 @@ func TestApplication_UpdateMetric(t *testing.T) {
 
 	t.Run("update gauge", func(t *testing.T) {
 		repo := new(mockRepo)
-		app := NewApplication(repo)
+		app := newTestApplication(repo, Config{})
 
 		repo.On("UpdateGauge", mock.Anything, mock.Anything, mock.Anything).Return(nil)
 
@@ -149,7 +215,7 @@ func TestApplication_UpdateMetric(t *testing.T) {
 
 	t.Run("update gauge, with err", func(t *testing.T) {
 		repo := new(mockRepo)
-		app := NewApplication(repo)
+		app := newTestApplication(repo, Config{})
 
 		repo.On("UpdateGauge", mock.Anything, mock.Anything, mock.Anything).Return(assert.AnError)
 
@@ -161,7 +227,7 @@ func TestApplication_UpdateMetric(t *testing.T) {
 func TestApplication_GetMetric(t *testing.T) {
 	t.Run("unknown metric type", func(t *testing.T) {
 		repo := new(mockRepo)
-		app := NewApplication(repo)
+		app := newTestApplication(repo, Config{})
 
 		_, err := app.GetMetric(context.Background(), "test", "unknown")
 		assert.Error(t, err)
@@ -170,7 +236,7 @@ func TestApplication_GetMetric(t *testing.T) {
 
 	t.Run("get counter", func(t *testing.T) {
 		repo := new(mockRepo)
-		app := NewApplication(repo)
+		app := newTestApplication(repo, Config{})
 
 		repo.On("GetCounter", mock.Anything, mock.Anything).Return(int64(0), nil)
 
@@ -181,7 +247,7 @@ func TestApplication_GetMetric(t *testing.T) {
 
 	t.Run("get counter, with err", func(t *testing.T) {
 		repo := new(mockRepo)
-		app := NewApplication(repo)
+		app := newTestApplication(repo, Config{})
 
 		repo.On("GetCounter", mock.Anything, mock.Anything).Return(int64(0), assert.AnError)
 
@@ -191,7 +257,7 @@ func TestApplication_GetMetric(t *testing.T) {
 
 	t.Run("get counter, with err not found", func(t *testing.T) {
 		repo := new(mockRepo)
-		app := NewApplication(repo)
+		app := newTestApplication(repo, Config{})
 
 		repo.On("GetCounter", mock.Anything, mock.Anything).Return(int64(0), repositories.ErrNotFound)
 
@@ -202,7 +268,7 @@ func TestApplication_GetMetric(t *testing.T) {
 
 	t.Run("get gauge", func(t *testing.T) {
 		repo := new(mockRepo)
-		app := NewApplication(repo)
+		app := newTestApplication(repo, Config{})
 
 		repo.On("GetGauge", mock.Anything, mock.Anything).Return(1.2, nil)
 
@@ -213,7 +279,7 @@ func TestApplication_GetMetric(t *testing.T) {
 
 	t.Run("get gauge, with err", func(t *testing.T) {
 		repo := new(mockRepo)
-		app := NewApplication(repo)
+		app := newTestApplication(repo, Config{})
 
 		repo.On("GetGauge", mock.Anything, mock.Anything).Return(0.0, assert.AnError)
 
@@ -223,7 +289,7 @@ func TestApplication_GetMetric(t *testing.T) {
 
 	t.Run("get gauge, with err not found", func(t *testing.T) {
 		repo := new(mockRepo)
-		app := NewApplication(repo)
+		app := newTestApplication(repo, Config{})
 
 		repo.On("GetGauge", mock.Anything, mock.Anything).Return(0.0, repositories.ErrNotFound)
 
@@ -233,10 +299,24 @@ func TestApplication_GetMetric(t *testing.T) {
 	})
 }
 
+func TestNewApplication_InvalidConfig(t *testing.T) {
+	for name, conf := range map[string]Config{
+		"naming":  {Naming: NamingPolicy{Charset: "a-z]|.*"}},
+		"relabel": {Relabel: []model.RelabelRule{{Match: "(", Action: model.RelabelDrop}}},
+		"recording": {
+			Naming:    NamingPolicy{Prefixes: []string{"app_"}},
+			Recording: []RecordingRule{{Name: "FleetAlloc", Expr: "1"}},
+		},
+	} {
+		_, err := NewApplication(new(mockRepo), conf)
+		assert.ErrorContains(t, err, "invalid "+name, name)
+	}
+}
+
 func TestApplication_GetMetrics(t *testing.T) {
 	t.Run("with err", func(t *testing.T) {
 		repo := new(mockRepo)
-		app := NewApplication(repo)
+		app := newTestApplication(repo, Config{})
 
 		repo.On("GetGaugeList", mock.Anything).Return(map[string]float64{}, assert.AnError)
 
@@ -246,14 +326,172 @@ func TestApplication_GetMetrics(t *testing.T) {
 
 	t.Run("without err", func(t *testing.T) {
 		repo := new(mockRepo)
-		app := NewApplication(repo)
+		app := newTestApplication(repo, Config{})
 
 		repo.On("GetGaugeList", mock.Anything).Return(map[string]float64{"test": 1.2}, nil)
+		repo.On("GetCounterList", mock.Anything).Return(map[string]int64{"polls": 3}, nil)
 
 		metrics, err := app.GetMetrics(context.Background())
 		assert.NoError(t, err)
-		assert.Len(t, metrics, 1)
-		assert.Equal(t, "test", metrics[0].Name)
-		assert.Equal(t, "1.2", metrics[0].Value)
+		assert.Equal(t, []model.MetricData{{Name: "test", Value: "1.2"}, {Name: "polls", Value: "3"}}, metrics)
+	})
+}
+
+func TestApplication_UpdateMetrics(t *testing.T) {
+	value1, value2, delta := 1.5, 2.5, int64(3)
+
+	batch := []model.MetricRequest{
+		{ID: "gauge", MType: "gauge", Value: &value1},
+		{ID: "counter", MType: "counter", Delta: &delta},
+		{ID: "gauge", MType: "gauge", Value: &value2},
+		{ID: "counter", MType: "counter", Delta: &delta},
+		{ID: "broken", MType: "gauge"},
+		{ID: "other", MType: "histogram"},
+	}
+
+	t.Run("partial", func(t *testing.T) {
+		repo := new(mockRepo)
+		repo.On("UpdateGauges", mock.Anything, map[string]float64{"gauge": value2}).Return(nil)
+		repo.On("UpdateCounters", mock.Anything, map[string]int64{"counter": 2 * delta}).Return(nil)
+
+		result, err := newTestApplication(repo, Config{}).UpdateMetrics(context.Background(), batch, model.BatchOptions{})
+		require.NoError(t, err)
+
+		assert.Equal(t, 3, result.Accepted)
+		assert.Equal(t, 2, result.Rejected)
+		assert.Equal(t, 1, result.Deduplicated)
+
+		require.Len(t, result.Items, len(batch))
+		assert.Equal(t, model.ItemDeduplicated, result.Items[0].Status)
+		assert.Equal(t, model.ItemAccepted, result.Items[2].Status)
+		assert.Equal(t, model.ItemResult{
+			Index: 4, ID: "broken", Status: model.ItemRejected,
+			Code: CodeMissingValue, Message: "value is nil on gauge metric",
+		}, result.Items[4])
+		assert.Equal(t, CodeUnknownType, result.Items[5].Code)
+
+		repo.AssertExpectations(t)
+	})
+
+	t.Run("strict", func(t *testing.T) {
+		repo := new(mockRepo)
+
+		result, err := newTestApplication(repo, Config{}).UpdateMetrics(context.Background(), batch, model.BatchOptions{Strict: true})
+		require.ErrorIs(t, err, ErrBadRequest)
+		assert.Equal(t, CodeBatchRejected, ErrorCode(err))
+
+		assert.Equal(t, len(batch), result.Rejected)
+		assert.Equal(t, CodeBatchRejected, result.Items[0].Code)
+		assert.Equal(t, CodeMissingValue, result.Items[4].Code)
+
+		repo.AssertNotCalled(t, "UpdateGauges", mock.Anything, mock.Anything)
+		repo.AssertNotCalled(t, "UpdateCounters", mock.Anything, mock.Anything)
+	})
+
+	t.Run("store error", func(t *testing.T) {
+		repo := new(mockRepo)
+		repo.On("UpdateGauges", mock.Anything, mock.Anything).Return(assert.AnError)
+
+		_, err := newTestApplication(repo, Config{}).UpdateMetrics(context.Background(), batch[:1], model.BatchOptions{})
+		require.ErrorIs(t, err, assert.AnError)
+	})
+}
+
+func TestApplication_UpdateMetricsIdempotency(t *testing.T) {
+	delta := int64(5)
+	batch := []model.MetricRequest{{ID: "counter", MType: "counter", Delta: &delta}}
+	opts := model.BatchOptions{IdempotencyKey: "batch-1"}
+
+	t.Run("first attempt", func(t *testing.T) {
+		repo := new(mockRepo)
+		repo.On("GetBatchResult", mock.Anything, "batch-1").Return(model.BatchResult{}, repositories.ErrNotFound)
+		repo.On("UpdateCounters", mock.Anything, map[string]int64{"counter": delta}).Return(nil)
+		now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+		repo.On("SaveBatchResult", mock.Anything, "batch-1", mock.Anything, now.Add(time.Hour)).Return(nil)
+
+		app := newTestApplication(repo, Config{IdempotencyWindow: time.Hour})
+		app.now = func() time.Time { return now }
+
+		result, err := app.UpdateMetrics(context.Background(), batch, opts)
+		require.NoError(t, err)
+		assert.Equal(t, 1, result.Accepted)
+		assert.False(t, result.Replayed)
+
+		repo.AssertExpectations(t)
+	})
+
+	hash, err := payloadHash(batch, opts)
+	require.NoError(t, err)
+
+	t.Run("replay", func(t *testing.T) {
+		saved := model.BatchResult{
+			Items:       []model.ItemResult{{ID: "counter", Status: model.ItemAccepted}},
+			Accepted:    1,
+			PayloadHash: hash,
+		}
+
+		repo := new(mockRepo)
+		repo.On("GetBatchResult", mock.Anything, "batch-1").Return(saved, nil)
+
+		app := newTestApplication(repo, Config{IdempotencyWindow: time.Hour})
+
+		result, err := app.UpdateMetrics(context.Background(), batch, opts)
+		require.NoError(t, err)
+		assert.True(t, result.Replayed)
+		assert.Equal(t, saved.Items, result.Items)
+		assert.Empty(t, result.PayloadHash)
+
+		repo.AssertNotCalled(t, "UpdateCounters", mock.Anything, mock.Anything)
+	})
+
+	t.Run("key reused for another batch", func(t *testing.T) {
+		repo := new(mockRepo)
+		repo.On("GetBatchResult", mock.Anything, "batch-1").Return(model.BatchResult{PayloadHash: hash}, nil)
+
+		other := int64(7)
+		_, err := newTestApplication(repo, Config{IdempotencyWindow: time.Hour}).UpdateMetrics(context.Background(),
+			[]model.MetricRequest{{ID: "counter", MType: "counter", Delta: &other}}, opts)
+		require.ErrorIs(t, err, ErrConflict)
+		assert.Equal(t, CodeIdempotencyKeyReused, ErrorCode(err))
+
+		repo.AssertNotCalled(t, "UpdateCounters", mock.Anything, mock.Anything)
+	})
+
+	t.Run("key scoped by client", func(t *testing.T) {
+		repo := new(mockRepo)
+		repo.On("GetBatchResult", mock.Anything, "acme/token:agent-1/batch-1").
+			Return(model.BatchResult{}, repositories.ErrNotFound)
+		repo.On("UpdateCounters", mock.Anything, mock.Anything).Return(nil)
+		repo.On("SaveBatchResult", mock.Anything, "acme/token:agent-1/batch-1", mock.MatchedBy(
+			func(result model.BatchResult) bool { return result.PayloadHash == hash }), mock.Anything).Return(nil)
+		repo.On("SaveAgentActivity", mock.Anything, "token:agent-1", mock.Anything).Return(nil)
+
+		ctx := WithClient(context.Background(), model.Client{Agent: "token:agent-1", Tenant: "acme"})
+
+		result, err := newTestApplication(repo, Config{IdempotencyWindow: time.Hour}).UpdateMetrics(ctx, batch, opts)
+		require.NoError(t, err)
+		assert.Empty(t, result.PayloadHash)
+
+		repo.AssertExpectations(t)
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		repo := new(mockRepo)
+		repo.On("UpdateCounters", mock.Anything, mock.Anything).Return(nil)
+
+		_, err := newTestApplication(repo, Config{}).UpdateMetrics(context.Background(), batch, opts)
+		require.NoError(t, err)
+
+		repo.AssertNotCalled(t, "GetBatchResult", mock.Anything, mock.Anything)
+	})
+
+	t.Run("lookup error", func(t *testing.T) {
+		repo := new(mockRepo)
+		repo.On("GetBatchResult", mock.Anything, "batch-1").Return(model.BatchResult{}, assert.AnError)
+
+		_, err := newTestApplication(repo, Config{IdempotencyWindow: time.Hour}).UpdateMetrics(context.Background(), batch, opts)
+		require.ErrorIs(t, err, assert.AnError)
+
+		repo.AssertNotCalled(t, "UpdateCounters", mock.Anything, mock.Anything)
 	})
 }
@@ -0,0 +1,297 @@
+package application
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"sync"
+
+	"metricalert/internal/server/core/model"
+)
+
+type clientKey struct{}
+
+// WithClient сохраняет в контексте источник записи метрик, по которому учитываются лимиты кардинальности.
+func WithClient(ctx context.Context, client model.Client) context.Context {
+	return context.WithValue(ctx, clientKey{}, client)
+}
+
+// ClientFromContext возвращает источник записи метрик из контекста.
+func ClientFromContext(ctx context.Context) (model.Client, bool) {
+	client, ok := ctx.Value(clientKey{}).(model.Client)
+	return client, ok
+}
+
+// maxAgentIDLength максимальная длина идентификатора агента.
+const maxAgentIDLength = 128
+
+// AgentName возвращает имя агента для учета лимитов кардинальности по идентификатору,
+// который агент передает в запросе. Несколько агентов с общим токеном или адресом различаются
+// по идентификатору. Идентификатор действует в пределах токена token, пустого для клиентов
+// без аутентификации, поэтому агент не может занять лимит агента с другим токеном.
+func AgentName(token, agentID string) (string, error) {
+	if len(agentID) > maxAgentIDLength {
+		return "", newError(ErrBadRequest, CodeInvalidAgentID,
+			fmt.Sprintf("agent id is longer than %d characters", maxAgentIDLength))
+	}
+
+	for _, r := range agentID {
+		if r <= ' ' || r > '~' || r == '/' {
+			return "", newError(ErrBadRequest, CodeInvalidAgentID,
+				fmt.Sprintf("agent id %q contains invalid character %q", agentID, r))
+		}
+	}
+
+	if token == "" {
+		return "agent:" + agentID, nil
+	}
+
+	return "token:" + token + "/agent:" + agentID, nil
+}
+
+// ValidateCardinalityLimits проверяет лимиты кардинальности.
+func ValidateCardinalityLimits(limits model.CardinalityLimits) error {
+	if limits.PerAgent < 0 || limits.PerTenant < 0 || limits.Total < 0 {
+		return fmt.Errorf("negative cardinality limit: %+v", limits)
+	}
+
+	return nil
+}
+
+// series метрика, учитываемая в лимитах кардинальности.
+type series struct {
+	mType metricType
+	name  string
+}
+
+// cardinality учитывает различные метрики и их источники. Метрика закрепляется за клиентом,
+// который ее создал; метрики, существовавшие до запуска сервера, не закреплены ни за кем
+// и учитываются только в общем количестве. Запись в уже существующую метрику не ограничивается.
+type cardinality struct {
+	mu       *sync.Mutex
+	owners   map[series]model.Client
+	agents   map[string]int
+	tenants  map[string]int
+	limits   model.CardinalityLimits
+	loaded   bool
+	dropped  int64
+	rejected int64
+}
+
+func newCardinality(limits model.CardinalityLimits) *cardinality {
+	return &cardinality{
+		mu:      &sync.Mutex{},
+		owners:  make(map[series]model.Client),
+		agents:  make(map[string]int),
+		tenants: make(map[string]int),
+		limits:  limits,
+	}
+}
+
+// enabled сообщает, что задан хотя бы один лимит. Без лимитов метрики не учитываются.
+func (c *cardinality) enabled() bool {
+	return c.limits.PerAgent > 0 || c.limits.PerTenant > 0 || c.limits.Total > 0
+}
+
+// load при первом обращении загружает существующие метрики из хранилища. Вызывается под мьютексом.
+func (c *cardinality) load(ctx context.Context, repo Repo) error {
+	if c.loaded {
+		return nil
+	}
+
+	gauges, err := repo.GetGaugeList(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get gauge list: %w", err)
+	}
+
+	counters, err := repo.GetCounterList(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get counter list: %w", err)
+	}
+
+	for name := range gauges {
+		c.owners[series{mType: gaugeType, name: name}] = model.Client{}
+	}
+
+	for name := range counters {
+		c.owners[series{mType: counterType, name: name}] = model.Client{}
+	}
+
+	c.loaded = true
+
+	return nil
+}
+
+// admit проверяет лимиты для записи метрики клиентом. Новая метрика резервируется за клиентом
+// и возвращается true; если запись не состоится, резерв следует снять release.
+// Превышение лимита возвращает ошибку ErrLimitExceeded.
+func (c *cardinality) admit(ctx context.Context, repo Repo, client model.Client, s series) (bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if err := c.load(ctx, repo); err != nil {
+		return false, err
+	}
+
+	if _, ok := c.owners[s]; ok {
+		return false, nil
+	}
+
+	var reason string
+
+	switch {
+	case c.limits.Total > 0 && len(c.owners) >= c.limits.Total:
+		reason = fmt.Sprintf("total limit %d reached", c.limits.Total)
+	case c.limits.PerTenant > 0 && client.Tenant != "" && c.tenants[client.Tenant] >= c.limits.PerTenant:
+		reason = fmt.Sprintf("limit %d reached for tenant %s", c.limits.PerTenant, client.Tenant)
+	case c.limits.PerAgent > 0 && client.Agent != "" && c.agents[client.Agent] >= c.limits.PerAgent:
+		reason = fmt.Sprintf("limit %d reached for agent %s", c.limits.PerAgent, client.Agent)
+	}
+
+	if reason != "" {
+		if c.limits.Drop {
+			c.dropped++
+		} else {
+			c.rejected++
+		}
+
+		return false, newError(ErrLimitExceeded, CodeCardinalityLimit,
+			fmt.Sprintf("new %s metric %s not accepted: cardinality %s", s.mType, s.name, reason))
+	}
+
+	c.add(s, client)
+
+	return true, nil
+}
+
+// release снимает резерв с метрик, запись которых не состоялась.
+func (c *cardinality) release(list []series) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, s := range list {
+		c.remove(s)
+	}
+}
+
+// forget перестает учитывать удаленные метрики.
+func (c *cardinality) forget(mType metricType, names []string) {
+	if !c.enabled() {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, name := range names {
+		c.remove(series{mType: mType, name: name})
+	}
+}
+
+// rename закрепляет переименованную метрику за владельцем исходной.
+func (c *cardinality) rename(mType metricType, from, to string) {
+	if !c.enabled() {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if !c.loaded {
+		return
+	}
+
+	client := c.owners[series{mType: mType, name: from}]
+	c.remove(series{mType: mType, name: from})
+	c.remove(series{mType: mType, name: to})
+	c.add(series{mType: mType, name: to}, client)
+}
+
+func (c *cardinality) add(s series, client model.Client) {
+	c.owners[s] = client
+
+	if client.Agent != "" {
+		c.agents[client.Agent]++
+	}
+
+	if client.Tenant != "" {
+		c.tenants[client.Tenant]++
+	}
+}
+
+func (c *cardinality) remove(s series) {
+	client, ok := c.owners[s]
+	if !ok {
+		return
+	}
+
+	delete(c.owners, s)
+	decrement(c.agents, client.Agent)
+	decrement(c.tenants, client.Tenant)
+}
+
+func decrement(counts map[string]int, key string) {
+	if key == "" {
+		return
+	}
+
+	if counts[key]--; counts[key] <= 0 {
+		delete(counts, key)
+	}
+}
+
+// admitMetric проверяет лимиты кардинальности для записи метрики клиентом из контекста.
+// Возвращает зарезервированную новую метрику, если она есть.
+func (a *Application) admitMetric(ctx context.Context, metric model.MetricRequest) ([]series, error) {
+	if !a.cardinality.enabled() {
+		return nil, nil
+	}
+
+	client, _ := ClientFromContext(ctx)
+	s := series{mType: metricType(metric.MType), name: metric.ID}
+
+	reserved, err := a.cardinality.admit(ctx, a.repo, client, s)
+	if err != nil || !reserved {
+		return nil, err
+	}
+
+	return []series{s}, nil
+}
+
+// CardinalityState возвращает количество различных метрик в целом, по агентам и по арендаторам.
+// Без заданных лимитов метрики по источникам не учитываются и возвращается только общее количество.
+func (a *Application) CardinalityState(ctx context.Context) (model.CardinalityState, error) {
+	c := a.cardinality
+	state := model.CardinalityState{Limits: c.limits, Agents: map[string]int{}, Tenants: map[string]int{}}
+
+	if !c.enabled() {
+		gauges, err := a.repo.GetGaugeList(ctx)
+		if err != nil {
+			return state, fmt.Errorf("failed to get gauge list: %w", err)
+		}
+
+		counters, err := a.repo.GetCounterList(ctx)
+		if err != nil {
+			return state, fmt.Errorf("failed to get counter list: %w", err)
+		}
+
+		state.Total = len(gauges) + len(counters)
+
+		return state, nil
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if err := c.load(ctx, a.repo); err != nil {
+		return state, err
+	}
+
+	state.Total = len(c.owners)
+	state.Agents = maps.Clone(c.agents)
+	state.Tenants = maps.Clone(c.tenants)
+	state.Dropped = c.dropped
+	state.Rejected = c.rejected
+
+	return state, nil
+}
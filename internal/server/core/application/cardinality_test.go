@@ -0,0 +1,193 @@
+//nolint:wrapcheck,nolintlint,gocritic,errcheck,dupl,forcetypeassert
+package application
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"metricalert/internal/server/core/model"
+)
+
+func newCardinalityRepo(gauges map[string]float64) *mockRepo {
+	repo := new(mockRepo)
+	repo.On("GetGaugeList", mock.Anything).Return(gauges, nil)
+	repo.On("GetCounterList", mock.Anything).Return(map[string]int64{}, nil)
+	repo.On("UpdateGauge", mock.Anything, mock.Anything, mock.Anything).Return(nil)
+	repo.On("UpdateGauges", mock.Anything, mock.Anything).Return(nil)
+	repo.On("SaveAgentActivity", mock.Anything, mock.Anything, mock.Anything).Return(nil)
+
+	return repo
+}
+
+func clientContext(agent, tenant string) context.Context {
+	return WithClient(context.Background(), model.Client{Agent: agent, Tenant: tenant})
+}
+
+func gauge(name string) model.MetricRequest {
+	return model.MetricRequest{ID: name, MType: "gauge", Value: ptr(1.0)}
+}
+
+func TestValidateCardinalityLimits(t *testing.T) {
+	assert.NoError(t, ValidateCardinalityLimits(model.CardinalityLimits{}))
+	assert.NoError(t, ValidateCardinalityLimits(model.CardinalityLimits{PerAgent: 1, Total: 10}))
+	assert.Error(t, ValidateCardinalityLimits(model.CardinalityLimits{PerTenant: -1}))
+}
+
+func TestAgentName(t *testing.T) {
+	agent, err := AgentName("", "host-1")
+	require.NoError(t, err)
+	assert.Equal(t, "agent:host-1", agent)
+
+	// идентификатор действует в пределах токена
+	agent, err = AgentName("collector", "host-1")
+	require.NoError(t, err)
+	assert.Equal(t, "token:collector/agent:host-1", agent)
+
+	for _, id := range []string{"host 1", "a/b", "хост", string(make([]byte, maxAgentIDLength+1))} {
+		_, err = AgentName("", id)
+		assert.ErrorIs(t, err, ErrBadRequest, "id %q", id)
+		assert.Equal(t, CodeInvalidAgentID, ErrorCode(err))
+	}
+}
+
+func TestApplication_CardinalityLimits(t *testing.T) {
+	t.Run("per agent", func(t *testing.T) {
+		repo := newCardinalityRepo(map[string]float64{"existing": 1})
+		app := newTestApplication(repo, Config{Cardinality: model.CardinalityLimits{PerAgent: 2}})
+		agent1 := clientContext("token:agent1", "")
+
+		require.NoError(t, app.UpdateMetric(agent1, gauge("a")))
+		require.NoError(t, app.UpdateMetric(agent1, gauge("b")))
+
+		err := app.UpdateMetric(agent1, gauge("c"))
+		assert.ErrorIs(t, err, ErrLimitExceeded)
+		assert.Equal(t, CodeCardinalityLimit, ErrorCode(err))
+		repo.AssertNotCalled(t, "UpdateGauge", mock.Anything, "c", mock.Anything)
+
+		// обновление существующих метрик не ограничивается
+		require.NoError(t, app.UpdateMetric(agent1, gauge("a")))
+		require.NoError(t, app.UpdateMetric(agent1, gauge("existing")))
+
+		// лимит учитывается для каждого агента отдельно
+		require.NoError(t, app.UpdateMetric(clientContext("token:agent2", ""), gauge("c")))
+	})
+
+	t.Run("per tenant and total", func(t *testing.T) {
+		repo := newCardinalityRepo(map[string]float64{})
+		app := newTestApplication(repo, Config{Cardinality: model.CardinalityLimits{PerTenant: 1, Total: 2}})
+
+		require.NoError(t, app.UpdateMetric(clientContext("token:a", "team1"), gauge("a")))
+		assert.ErrorIs(t, app.UpdateMetric(clientContext("token:b", "team1"), gauge("b")), ErrLimitExceeded)
+		require.NoError(t, app.UpdateMetric(clientContext("token:c", "team2"), gauge("c")))
+		assert.ErrorIs(t, app.UpdateMetric(clientContext("token:d", "team3"), gauge("d")), ErrLimitExceeded)
+	})
+
+	t.Run("drop", func(t *testing.T) {
+		repo := newCardinalityRepo(map[string]float64{})
+		app := newTestApplication(repo, Config{Cardinality: model.CardinalityLimits{Total: 1, Drop: true}})
+
+		require.NoError(t, app.UpdateMetric(context.Background(), gauge("a")))
+		require.NoError(t, app.UpdateMetric(context.Background(), gauge("b")))
+
+		repo.AssertNotCalled(t, "UpdateGauge", mock.Anything, "b", mock.Anything)
+
+		state, err := app.CardinalityState(context.Background())
+		require.NoError(t, err)
+		assert.Equal(t, 1, state.Total)
+		assert.Equal(t, int64(1), state.Dropped)
+	})
+
+	t.Run("failed write releases metric", func(t *testing.T) {
+		repo := new(mockRepo)
+		repo.On("GetGaugeList", mock.Anything).Return(map[string]float64{}, nil)
+		repo.On("GetCounterList", mock.Anything).Return(map[string]int64{}, nil)
+		repo.On("UpdateGauge", mock.Anything, "a", 1.0).Return(errors.New("db is down")).Once()
+		repo.On("UpdateGauge", mock.Anything, "b", 1.0).Return(nil)
+		repo.On("SaveAgentActivity", mock.Anything, mock.Anything, mock.Anything).Return(nil)
+
+		app := newTestApplication(repo, Config{Cardinality: model.CardinalityLimits{Total: 1}})
+
+		assert.Error(t, app.UpdateMetric(context.Background(), gauge("a")))
+		require.NoError(t, app.UpdateMetric(context.Background(), gauge("b")))
+	})
+}
+
+func TestApplication_UpdateMetricsCardinality(t *testing.T) {
+	batch := []model.MetricRequest{gauge("a"), gauge("b"), gauge("a"), gauge("c")}
+
+	t.Run("reject", func(t *testing.T) {
+		repo := newCardinalityRepo(map[string]float64{})
+		app := newTestApplication(repo, Config{Cardinality: model.CardinalityLimits{PerAgent: 2}})
+
+		result, err := app.UpdateMetrics(clientContext("token:agent", ""), batch, model.BatchOptions{})
+		require.NoError(t, err)
+		assert.Equal(t, 2, result.Accepted)
+		assert.Equal(t, 1, result.Deduplicated)
+		assert.Equal(t, 1, result.Rejected)
+		assert.Equal(t, model.ItemRejected, result.Items[3].Status)
+		assert.Equal(t, CodeCardinalityLimit, result.Items[3].Code)
+
+		repo.AssertCalled(t, "UpdateGauges", mock.Anything, map[string]float64{"a": 1, "b": 1})
+	})
+
+	t.Run("drop", func(t *testing.T) {
+		repo := newCardinalityRepo(map[string]float64{})
+		app := newTestApplication(repo, Config{Cardinality: model.CardinalityLimits{PerAgent: 2, Drop: true}})
+
+		result, err := app.UpdateMetrics(clientContext("token:agent", ""), batch, model.BatchOptions{})
+		require.NoError(t, err)
+		assert.Equal(t, 0, result.Rejected)
+		assert.Equal(t, 1, result.Dropped)
+		assert.Equal(t, model.ItemDropped, result.Items[3].Status)
+	})
+
+	t.Run("strict releases metrics", func(t *testing.T) {
+		repo := newCardinalityRepo(map[string]float64{})
+		app := newTestApplication(repo, Config{Cardinality: model.CardinalityLimits{PerAgent: 2}})
+		ctx := clientContext("token:agent", "")
+
+		_, err := app.UpdateMetrics(ctx, batch, model.BatchOptions{Strict: true})
+		assert.ErrorIs(t, err, ErrBadRequest)
+
+		state, err := app.CardinalityState(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, 0, state.Total)
+		assert.Empty(t, state.Agents)
+	})
+}
+
+func TestApplication_CardinalityState(t *testing.T) {
+	repo := newCardinalityRepo(map[string]float64{"existing": 1, "old": 2})
+	repo.On("DeleteGauges", mock.Anything, []string{"old"}).Return(nil)
+
+	app := newTestApplication(repo, Config{Cardinality: model.CardinalityLimits{Total: 10}})
+	ctx := context.Background()
+
+	require.NoError(t, app.UpdateMetric(clientContext("token:a", "team"), gauge("a")))
+	require.NoError(t, app.UpdateMetric(clientContext("token:b", "team"), gauge("b")))
+	assert.ErrorIs(t, app.UpdateMetric(clientContext("token:b", "team"), gauge("")), ErrNotFound)
+
+	_, err := app.DeleteMetrics(ctx, model.MetricSelector{Name: "old"})
+	require.NoError(t, err)
+
+	state, err := app.CardinalityState(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, model.CardinalityState{
+		Limits:  model.CardinalityLimits{Total: 10},
+		Total:   3,
+		Agents:  map[string]int{"token:a": 1, "token:b": 1},
+		Tenants: map[string]int{"team": 2},
+	}, state)
+
+	t.Run("without limits", func(t *testing.T) {
+		state, err := newTestApplication(repo, Config{}).CardinalityState(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, 2, state.Total)
+		assert.Empty(t, state.Agents)
+	})
+}
@@ -0,0 +1,68 @@
+package application
+
+import "errors"
+
+// Коды ошибок, которые передаются клиентам API.
+const (
+	CodeEmptyName        = "empty_name"
+	CodeUnknownType      = "unknown_type"
+	CodeMissingValue     = "missing_value"
+	CodeBatchRejected    = "batch_rejected"
+	CodeBadSelector      = "bad_selector"
+	CodeMetricExists     = "metric_exists"
+	CodeTypeMismatch     = "type_mismatch"
+	CodeOutOfRange       = "out_of_range"
+	CodeBadMetadata      = "bad_metadata"
+	CodeInvalidName      = "invalid_name"
+	CodeNameTooLong      = "name_too_long"
+	CodeMissingPrefix    = "missing_prefix"
+	CodeReservedName     = "reserved_name"
+	CodeCardinalityLimit = "cardinality_limit"
+	CodeBadRelabel       = "bad_relabel"
+	CodeRelabelDropped   = "relabel_dropped"
+	CodeInvalidAgentID   = "invalid_agent_id"
+
+	// ключ идемпотентности уже использован для пакета с другим содержимым
+	CodeIdempotencyKeyReused = "idempotency_key_reused"
+)
+
+// Error ошибка приложения с машиночитаемым кодом.
+// Kind определяет класс ошибки (ErrBadRequest, ErrNotFound, ErrConflict, ErrLimitExceeded)
+// и доступен через errors.Is.
+type Error struct {
+	Kind    error
+	Code    string
+	Message string
+}
+
+func newError(kind error, code, message string) *Error {
+	return &Error{Kind: kind, Code: code, Message: message}
+}
+
+func (e *Error) Error() string {
+	return e.Message + ", error: " + e.Kind.Error()
+}
+
+func (e *Error) Unwrap() error {
+	return e.Kind
+}
+
+// ErrorCode возвращает код ошибки приложения или пустую строку, если ошибка не содержит кода.
+func ErrorCode(err error) string {
+	var appErr *Error
+	if errors.As(err, &appErr) {
+		return appErr.Code
+	}
+
+	return ""
+}
+
+// ErrorMessage возвращает описание ошибки приложения без класса ошибки.
+func ErrorMessage(err error) string {
+	var appErr *Error
+	if errors.As(err, &appErr) {
+		return appErr.Message
+	}
+
+	return err.Error()
+}
@@ -0,0 +1,373 @@
+package application
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"path"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Выражения правил записи поддерживают числа, ссылки на метрики по имени, арифметику + - * /,
+// скобки и агрегаты sum, avg, min, max, count по шаблону имени в синтаксисе path.Match:
+//
+//	HeapInuse / HeapSys * 100
+//	sum(Alloc*) / count(Alloc*)
+//
+// Имя метрики состоит из букв, цифр и символов _ . :, имя с другими символами берется в кавычки:
+// "cpu-load" * 2.
+
+// exprValues значения метрик, по которым вычисляется выражение.
+type exprValues map[string]float64
+
+// exprNode узел разобранного выражения.
+type exprNode interface {
+	eval(values exprValues) (float64, error)
+	// uses сообщает, что выражение зависит от метрики name напрямую или через шаблон агрегата.
+	uses(name string) bool
+}
+
+type numberNode float64
+
+func (n numberNode) eval(exprValues) (float64, error) {
+	return float64(n), nil
+}
+
+func (n numberNode) uses(string) bool {
+	return false
+}
+
+type metricNode string
+
+func (n metricNode) uses(name string) bool {
+	return string(n) == name
+}
+
+func (n metricNode) eval(values exprValues) (float64, error) {
+	value, ok := values[string(n)]
+	if !ok {
+		return 0, fmt.Errorf("metric %s not found", string(n))
+	}
+
+	return value, nil
+}
+
+type negNode struct {
+	operand exprNode
+}
+
+func (n negNode) eval(values exprValues) (float64, error) {
+	value, err := n.operand.eval(values)
+	return -value, err
+}
+
+func (n negNode) uses(name string) bool {
+	return n.operand.uses(name)
+}
+
+type binaryNode struct {
+	left, right exprNode
+	op          byte
+}
+
+func (n binaryNode) uses(name string) bool {
+	return n.left.uses(name) || n.right.uses(name)
+}
+
+func (n binaryNode) eval(values exprValues) (float64, error) {
+	left, err := n.left.eval(values)
+	if err != nil {
+		return 0, err
+	}
+
+	right, err := n.right.eval(values)
+	if err != nil {
+		return 0, err
+	}
+
+	switch n.op {
+	case '+':
+		return left + right, nil
+	case '-':
+		return left - right, nil
+	case '*':
+		return left * right, nil
+	default:
+		if right == 0 {
+			return 0, errors.New("division by zero")
+		}
+
+		return left / right, nil
+	}
+}
+
+// aggregateNode агрегат по метрикам, имена которых подходят под шаблон.
+type aggregateNode struct {
+	fn      string
+	pattern string
+}
+
+func (n aggregateNode) uses(name string) bool {
+	ok, _ := path.Match(n.pattern, name)
+	return ok
+}
+
+func (n aggregateNode) eval(values exprValues) (float64, error) {
+	var (
+		count     int
+		sum       float64
+		low, high = math.Inf(1), math.Inf(-1)
+	)
+
+	for name, value := range values {
+		if ok, _ := path.Match(n.pattern, name); !ok {
+			continue
+		}
+
+		count++
+		sum += value
+		low = math.Min(low, value)
+		high = math.Max(high, value)
+	}
+
+	if n.fn == "count" {
+		return float64(count), nil
+	}
+
+	if count == 0 && n.fn != "sum" {
+		return 0, fmt.Errorf("no metrics match %s(%s)", n.fn, n.pattern)
+	}
+
+	switch n.fn {
+	case "sum":
+		return sum, nil
+	case "avg":
+		return sum / float64(count), nil
+	case "min":
+		return low, nil
+	default:
+		return high, nil
+	}
+}
+
+// exprParser разбирает выражение методом рекурсивного спуска.
+type exprParser struct {
+	input string
+	pos   int
+}
+
+// parseExpr разбирает выражение правила записи.
+func parseExpr(input string) (exprNode, error) {
+	p := &exprParser{input: input}
+
+	node, err := p.parseSum()
+	if err != nil {
+		return nil, err
+	}
+
+	if p.skipSpaces(); p.pos < len(p.input) {
+		return nil, p.errorf("unexpected %q", p.input[p.pos])
+	}
+
+	return node, nil
+}
+
+func (p *exprParser) errorf(format string, args ...any) error {
+	return fmt.Errorf("position %d: %s", p.pos+1, fmt.Sprintf(format, args...))
+}
+
+func (p *exprParser) skipSpaces() {
+	for p.pos < len(p.input) && unicode.IsSpace(rune(p.input[p.pos])) {
+		p.pos++
+	}
+}
+
+// peek возвращает следующий значимый символ или 0 в конце выражения.
+func (p *exprParser) peek() byte {
+	p.skipSpaces()
+
+	if p.pos >= len(p.input) {
+		return 0
+	}
+
+	return p.input[p.pos]
+}
+
+// parseSum разбирает сумму и разность: term (('+' | '-') term)*.
+func (p *exprParser) parseSum() (exprNode, error) {
+	left, err := p.parseProduct()
+	if err != nil {
+		return nil, err
+	}
+
+	for op := p.peek(); op == '+' || op == '-'; op = p.peek() {
+		p.pos++
+
+		right, err := p.parseProduct()
+		if err != nil {
+			return nil, err
+		}
+
+		left = binaryNode{left: left, right: right, op: op}
+	}
+
+	return left, nil
+}
+
+// parseProduct разбирает произведение и частное: unary (('*' | '/') unary)*.
+func (p *exprParser) parseProduct() (exprNode, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+
+	for op := p.peek(); op == '*' || op == '/'; op = p.peek() {
+		p.pos++
+
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+
+		left = binaryNode{left: left, right: right, op: op}
+	}
+
+	return left, nil
+}
+
+func (p *exprParser) parseUnary() (exprNode, error) {
+	if p.peek() != '-' {
+		return p.parsePrimary()
+	}
+
+	p.pos++
+
+	operand, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+
+	return negNode{operand: operand}, nil
+}
+
+// parsePrimary разбирает число, имя метрики, агрегат или выражение в скобках.
+func (p *exprParser) parsePrimary() (exprNode, error) {
+	switch c := p.peek(); {
+	case c == 0:
+		return nil, p.errorf("unexpected end of expression")
+	case c == '(':
+		p.pos++
+
+		node, err := p.parseSum()
+		if err != nil {
+			return nil, err
+		}
+
+		if p.peek() != ')' {
+			return nil, p.errorf("missing closing parenthesis")
+		}
+
+		p.pos++
+
+		return node, nil
+	case c == '"':
+		name, err := p.parseQuoted()
+		if err != nil {
+			return nil, err
+		}
+
+		return metricNode(name), nil
+	case c >= '0' && c <= '9' || c == '.':
+		return p.parseNumber()
+	case isNameChar(c):
+		name := p.parseName()
+		if p.peek() != '(' {
+			return metricNode(name), nil
+		}
+
+		return p.parseAggregate(name)
+	default:
+		return nil, p.errorf("unexpected %q", c)
+	}
+}
+
+func (p *exprParser) parseNumber() (exprNode, error) {
+	start := p.pos
+	for p.pos < len(p.input) && (isDigit(p.input[p.pos]) || p.input[p.pos] == '.') {
+		p.pos++
+	}
+
+	text := p.input[start:p.pos]
+
+	value, err := strconv.ParseFloat(text, 64)
+	if err != nil {
+		p.pos = start
+		return nil, p.errorf("invalid number %q", text)
+	}
+
+	return numberNode(value), nil
+}
+
+func (p *exprParser) parseName() string {
+	start := p.pos
+	for p.pos < len(p.input) && isNameChar(p.input[p.pos]) {
+		p.pos++
+	}
+
+	return p.input[start:p.pos]
+}
+
+func (p *exprParser) parseQuoted() (string, error) {
+	end := strings.IndexByte(p.input[p.pos+1:], '"')
+	if end < 0 {
+		return "", p.errorf("unterminated quoted name")
+	}
+
+	name := p.input[p.pos+1 : p.pos+1+end]
+	p.pos += end + 2
+
+	if name == "" {
+		return "", p.errorf("empty quoted name")
+	}
+
+	return name, nil
+}
+
+// parseAggregate разбирает агрегат fn(pattern). Шаблон записывается без кавычек до закрывающей скобки.
+func (p *exprParser) parseAggregate(fn string) (exprNode, error) {
+	switch fn {
+	case "sum", "avg", "min", "max", "count":
+	default:
+		return nil, p.errorf("unknown function %s", fn)
+	}
+
+	p.pos++
+
+	end := strings.IndexByte(p.input[p.pos:], ')')
+	if end < 0 {
+		return nil, p.errorf("missing closing parenthesis in %s", fn)
+	}
+
+	pattern := strings.TrimSpace(p.input[p.pos : p.pos+end])
+	if pattern == "" {
+		return nil, p.errorf("empty pattern in %s", fn)
+	}
+
+	if _, err := path.Match(pattern, ""); err != nil {
+		return nil, p.errorf("invalid pattern %q in %s", pattern, fn)
+	}
+
+	p.pos += end + 1
+
+	return aggregateNode{fn: fn, pattern: pattern}, nil
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func isNameChar(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || isDigit(c) || c == '_' || c == '.' || c == ':'
+}
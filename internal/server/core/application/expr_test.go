@@ -0,0 +1,81 @@
+//nolint:wrapcheck,nolintlint,gocritic,errcheck,dupl,forcetypeassert
+package application
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseExpr(t *testing.T) {
+	values := exprValues{
+		"HeapInuse":    50,
+		"HeapSys":      200,
+		"agent1.Alloc": 10,
+		"agent2.Alloc": 30,
+		"cpu-load":     0.5,
+	}
+
+	tests := []struct {
+		expr string
+		want float64
+	}{
+		{expr: "HeapInuse / HeapSys", want: 0.25},
+		{expr: "HeapInuse / HeapSys * 100", want: 25},
+		{expr: "1 + 2 * 3", want: 7},
+		{expr: "(1 + 2) * 3", want: 9},
+		{expr: "10 - 4 - 3", want: 3},
+		{expr: "-HeapInuse + --1.5", want: -48.5},
+		{expr: `"cpu-load" * 2`, want: 1},
+		{expr: "sum(*.Alloc)", want: 40},
+		{expr: "avg( *.Alloc )", want: 20},
+		{expr: "min(*.Alloc)", want: 10},
+		{expr: "max(*.Alloc)", want: 30},
+		{expr: "count(*.Alloc)", want: 2},
+		{expr: "count(missing*)", want: 0},
+		{expr: "sum(missing*)", want: 0},
+		{expr: "sum(*.Alloc) / count(*.Alloc)", want: 20},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			node, err := parseExpr(tt.expr)
+			require.NoError(t, err)
+
+			got, err := node.eval(values)
+			require.NoError(t, err)
+			assert.InDelta(t, tt.want, got, 1e-9)
+		})
+	}
+}
+
+func TestParseExprErrors(t *testing.T) {
+	for _, expr := range []string{
+		"",
+		"HeapInuse /",
+		"(1 + 2",
+		"1 2",
+		"1..2",
+		"median(*)",
+		"sum()",
+		"sum([a)",
+		"sum(*",
+		`"unterminated`,
+		`""`,
+		"HeapInuse % 2",
+	} {
+		_, err := parseExpr(expr)
+		assert.Error(t, err, "expression %q", expr)
+	}
+}
+
+func TestExprEvalErrors(t *testing.T) {
+	for _, expr := range []string{"missing + 1", "1 / zero", "avg(missing*)", "max(missing*)"} {
+		node, err := parseExpr(expr)
+		require.NoError(t, err)
+
+		_, err = node.eval(exprValues{"zero": 0})
+		assert.Error(t, err, "expression %q", expr)
+	}
+}
@@ -0,0 +1,160 @@
+package application
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"metricalert/internal/server/core/model"
+)
+
+// metadataRegistry метаданные метрик по имени.
+type metadataRegistry struct {
+	mu   *sync.RWMutex
+	meta map[string]model.MetricMeta
+}
+
+func newMetadataRegistry(list []model.MetricMeta) *metadataRegistry {
+	r := &metadataRegistry{
+		mu:   &sync.RWMutex{},
+		meta: make(map[string]model.MetricMeta, len(list)),
+	}
+
+	for _, meta := range list {
+		r.meta[meta.Name] = meta
+	}
+
+	return r
+}
+
+func (r *metadataRegistry) get(name string) (model.MetricMeta, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	meta, ok := r.meta[name]
+
+	return meta, ok
+}
+
+// help возвращает описание метрики из метаданных.
+func (a *Application) help(name string) string {
+	meta, _ := a.metadata.get(name)
+
+	return meta.Help
+}
+
+// ValidateMetadata проверяет метаданные метрики: имя, тип и границы значений.
+func ValidateMetadata(meta model.MetricMeta) error {
+	if strings.TrimSpace(meta.Name) == "" {
+		return newError(ErrBadRequest, CodeEmptyName, "empty metric name")
+	}
+
+	if meta.MType != "" && metricType(meta.MType) != gaugeType && metricType(meta.MType) != counterType {
+		return newError(ErrBadRequest, CodeUnknownType, "unknown metric type, value: "+meta.MType)
+	}
+
+	if meta.Min != nil && meta.Max != nil && *meta.Min > *meta.Max {
+		return newError(ErrBadRequest, CodeBadMetadata,
+			fmt.Sprintf("min %g is greater than max %g for metric %s", *meta.Min, *meta.Max, meta.Name))
+	}
+
+	return nil
+}
+
+// checkMetadata проверяет запрос на обновление метрики по ее метаданным.
+// Несовпадение типа возвращает ErrConflict, значение вне диапазона — ErrBadRequest.
+func (a *Application) checkMetadata(metric model.MetricRequest) error {
+	meta, ok := a.metadata.get(metric.ID)
+	if !ok {
+		return nil
+	}
+
+	if meta.MType != "" && meta.MType != metric.MType {
+		return newError(ErrConflict, CodeTypeMismatch,
+			fmt.Sprintf("metric %s is registered as %s, got %s", metric.ID, meta.MType, metric.MType))
+	}
+
+	var value float64
+
+	switch metricType(metric.MType) {
+	case gaugeType:
+		value = *metric.Value
+	case counterType:
+		value = float64(*metric.Delta)
+	}
+
+	if !inRange(value, meta.Min, meta.Max) {
+		return newError(ErrBadRequest, CodeOutOfRange,
+			fmt.Sprintf("value %s of metric %s is out of range [%s, %s]",
+				strconv.FormatFloat(value, 'g', -1, 64), metric.ID, bound(meta.Min, "-inf"), bound(meta.Max, "+inf")))
+	}
+
+	return nil
+}
+
+// inRange сообщает, что значение лежит в границах. Без границ подходит любое значение,
+// с границами NaN не подходит.
+func inRange(value float64, low, high *float64) bool {
+	if low == nil && high == nil {
+		return true
+	}
+
+	return !math.IsNaN(value) && (low == nil || value >= *low) && (high == nil || value <= *high)
+}
+
+func bound(value *float64, inf string) string {
+	if value == nil {
+		return inf
+	}
+
+	return strconv.FormatFloat(*value, 'g', -1, 64)
+}
+
+// SetMetadata регистрирует или заменяет метаданные метрики.
+func (a *Application) SetMetadata(_ context.Context, meta model.MetricMeta) error {
+	if err := ValidateMetadata(meta); err != nil {
+		return err
+	}
+
+	a.metadata.mu.Lock()
+	defer a.metadata.mu.Unlock()
+
+	a.metadata.meta[meta.Name] = meta
+
+	return nil
+}
+
+// DeleteMetadata удаляет метаданные метрики. Если метаданные не найдены, возвращается ErrNotFound.
+func (a *Application) DeleteMetadata(_ context.Context, name string) error {
+	a.metadata.mu.Lock()
+	defer a.metadata.mu.Unlock()
+
+	if _, ok := a.metadata.meta[name]; !ok {
+		return fmt.Errorf("metadata not found: %w", ErrNotFound)
+	}
+
+	delete(a.metadata.meta, name)
+
+	return nil
+}
+
+// ListMetadata возвращает метаданные всех зарегистрированных метрик, отсортированные по имени.
+func (a *Application) ListMetadata(_ context.Context) ([]model.MetricMeta, error) {
+	a.metadata.mu.RLock()
+	defer a.metadata.mu.RUnlock()
+
+	list := make([]model.MetricMeta, 0, len(a.metadata.meta))
+	for _, meta := range a.metadata.meta {
+		list = append(list, meta)
+	}
+
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Name < list[j].Name
+	})
+
+	return list, nil
+}
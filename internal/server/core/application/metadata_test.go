@@ -0,0 +1,158 @@
+//nolint:wrapcheck,nolintlint,gocritic,errcheck,dupl,forcetypeassert
+package application
+
+import (
+	"context"
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"metricalert/internal/server/core/model"
+)
+
+func ptr[T any](v T) *T {
+	return &v
+}
+
+func newMetadataApp(repo *mockRepo) *Application {
+	return newTestApplication(repo, Config{Metadata: []model.MetricMeta{
+		{Name: "PollCount", MType: "counter", Unit: "polls", Help: "Number of polls", Min: ptr(0.0)},
+		{Name: "CPUutilization", MType: "gauge", Unit: "%", Min: ptr(0.0), Max: ptr(100.0)},
+		{Name: "Alloc", Unit: "bytes"},
+	}})
+}
+
+func TestValidateMetadata(t *testing.T) {
+	assert.NoError(t, ValidateMetadata(model.MetricMeta{Name: "Alloc"}))
+	assert.NoError(t, ValidateMetadata(model.MetricMeta{Name: "Alloc", MType: "gauge", Min: ptr(1.0), Max: ptr(1.0)}))
+
+	for _, meta := range []model.MetricMeta{
+		{Name: " "},
+		{Name: "Alloc", MType: "histogram"},
+		{Name: "Alloc", Min: ptr(2.0), Max: ptr(1.0)},
+	} {
+		assert.ErrorIs(t, ValidateMetadata(meta), ErrBadRequest, "metadata %+v", meta)
+	}
+}
+
+func TestApplication_UpdateMetricMetadata(t *testing.T) {
+	t.Run("type mismatch", func(t *testing.T) {
+		repo := new(mockRepo)
+		app := newMetadataApp(repo)
+
+		err := app.UpdateMetric(context.Background(), model.MetricRequest{ID: "PollCount", MType: "gauge", Value: ptr(1.0)})
+		assert.ErrorIs(t, err, ErrConflict)
+		assert.Equal(t, CodeTypeMismatch, ErrorCode(err))
+
+		repo.AssertNotCalled(t, "UpdateGauge", mock.Anything, mock.Anything, mock.Anything)
+	})
+
+	t.Run("out of range", func(t *testing.T) {
+		app := newMetadataApp(new(mockRepo))
+
+		for _, metric := range []model.MetricRequest{
+			{ID: "CPUutilization", MType: "gauge", Value: ptr(101.0)},
+			{ID: "CPUutilization", MType: "gauge", Value: ptr(math.NaN())},
+			{ID: "PollCount", MType: "counter", Delta: ptr(int64(-1))},
+		} {
+			err := app.UpdateMetric(context.Background(), metric)
+			assert.ErrorIs(t, err, ErrBadRequest, "metric %s", metric.ID)
+			assert.Equal(t, CodeOutOfRange, ErrorCode(err))
+		}
+	})
+
+	t.Run("valid", func(t *testing.T) {
+		repo := new(mockRepo)
+		repo.On("UpdateGauge", mock.Anything, "CPUutilization", 100.0).Return(nil)
+		repo.On("UpdateGauge", mock.Anything, "Alloc", math.Inf(1)).Return(nil)
+
+		app := newMetadataApp(repo)
+
+		require.NoError(t, app.UpdateMetric(context.Background(),
+			model.MetricRequest{ID: "CPUutilization", MType: "gauge", Value: ptr(100.0)}))
+		// без ограничений диапазона и типа подходит любое значение
+		require.NoError(t, app.UpdateMetric(context.Background(),
+			model.MetricRequest{ID: "Alloc", MType: "gauge", Value: ptr(math.Inf(1))}))
+
+		repo.AssertExpectations(t)
+	})
+}
+
+func TestApplication_UpdateMetricsMetadata(t *testing.T) {
+	batch := []model.MetricRequest{
+		{ID: "PollCount", MType: "gauge", Value: ptr(1.0)},
+		{ID: "CPUutilization", MType: "gauge", Value: ptr(-1.0)},
+		{ID: "CPUutilization", MType: "gauge", Value: ptr(50.0)},
+	}
+
+	t.Run("partial", func(t *testing.T) {
+		repo := new(mockRepo)
+		repo.On("UpdateGauges", mock.Anything, map[string]float64{"CPUutilization": 50}).Return(nil)
+
+		result, err := newMetadataApp(repo).UpdateMetrics(context.Background(), batch, model.BatchOptions{})
+		require.NoError(t, err)
+		assert.Equal(t, 1, result.Accepted)
+		assert.Equal(t, 2, result.Rejected)
+		assert.Equal(t, CodeTypeMismatch, result.Items[0].Code)
+		assert.Equal(t, CodeOutOfRange, result.Items[1].Code)
+	})
+
+	t.Run("strict", func(t *testing.T) {
+		repo := new(mockRepo)
+
+		_, err := newMetadataApp(repo).UpdateMetrics(context.Background(), batch, model.BatchOptions{Strict: true})
+		assert.ErrorIs(t, err, ErrBadRequest)
+
+		repo.AssertNotCalled(t, "UpdateGauges", mock.Anything, mock.Anything)
+	})
+}
+
+func TestApplication_MetadataCRUD(t *testing.T) {
+	app := newMetadataApp(new(mockRepo))
+	ctx := context.Background()
+
+	require.NoError(t, app.SetMetadata(ctx, model.MetricMeta{Name: "Alloc", MType: "gauge", Unit: "bytes"}))
+	assert.ErrorIs(t, app.SetMetadata(ctx, model.MetricMeta{Name: "Alloc", MType: "summary"}), ErrBadRequest)
+
+	require.NoError(t, app.DeleteMetadata(ctx, "PollCount"))
+	assert.ErrorIs(t, app.DeleteMetadata(ctx, "PollCount"), ErrNotFound)
+
+	list, err := app.ListMetadata(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []model.MetricMeta{
+		{Name: "Alloc", MType: "gauge", Unit: "bytes"},
+		{Name: "CPUutilization", MType: "gauge", Unit: "%", Min: ptr(0.0), Max: ptr(100.0)},
+	}, list)
+
+	// метрика без метаданных может снова записываться с любым типом
+	repo := new(mockRepo)
+	repo.On("UpdateGauge", mock.Anything, "PollCount", 1.0).Return(nil)
+	app.repo = repo
+
+	assert.NoError(t, app.UpdateMetric(ctx, model.MetricRequest{ID: "PollCount", MType: "gauge", Value: ptr(1.0)}))
+}
+
+func TestApplication_MetadataInListings(t *testing.T) {
+	repo := new(mockRepo)
+	repo.On("GetGaugeList", mock.Anything).Return(map[string]float64{"Alloc": 1}, nil)
+	repo.On("GetCounterList", mock.Anything).Return(map[string]int64{"PollCount": 2}, nil)
+
+	app := newMetadataApp(repo)
+
+	metrics, err := app.GetMetrics(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, []model.MetricData{
+		{Name: "Alloc", Value: "1", Unit: "bytes"},
+		{Name: "PollCount", Value: "2", Unit: "polls", Help: "Number of polls"},
+	}, metrics)
+
+	states, err := app.ExportMetrics(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, []model.MetricState{
+		{ID: "Alloc", MType: "gauge", Value: 1},
+		{ID: "PollCount", MType: "counter", Delta: 2, Help: "Number of polls"},
+	}, states)
+}
@@ -0,0 +1,184 @@
+package application
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"regexp/syntax"
+	"slices"
+	"strings"
+	"unicode/utf8"
+)
+
+// NamingPolicy правила именования метрик. Пустые поля не накладывают ограничений.
+//
+// Charset задает допустимые символы в синтаксисе содержимого класса регулярного выражения,
+// например "a-zA-Z0-9_.". Имя должно начинаться с одного из Prefixes, если они заданы,
+// и не должно совпадать с именами из Reserved.
+//
+// При Normalize имя не отклоняется, а приводится к политике: недопустимые символы заменяются
+// на подчеркивание, при отсутствии префикса добавляется первый из Prefixes, слишком длинное имя
+// обрезается. Зарезервированные имена отклоняются и в этом режиме.
+type NamingPolicy struct {
+	Charset   string   `json:"charset"`
+	Prefixes  []string `json:"prefixes"`
+	Reserved  []string `json:"reserved"`
+	MaxLength int      `json:"max_length"`
+	Normalize bool     `json:"normalize"`
+}
+
+// ValidateNamingPolicy проверяет политику именования.
+func ValidateNamingPolicy(policy NamingPolicy) error {
+	if policy.MaxLength < 0 {
+		return fmt.Errorf("negative max length: %d", policy.MaxLength)
+	}
+
+	invalid, err := invalidChars(policy.Charset)
+	if err != nil {
+		return err
+	}
+
+	if policy.Normalize && invalid != nil && invalid.MatchString("_") {
+		return errors.New("charset must include the underscore used for normalization")
+	}
+
+	for _, prefix := range policy.Prefixes {
+		if prefix == "" {
+			return errors.New("empty prefix")
+		}
+
+		if invalid != nil && invalid.MatchString(prefix) {
+			return fmt.Errorf("prefix %q contains characters outside the charset", prefix)
+		}
+
+		if policy.MaxLength > 0 && utf8.RuneCountInString(prefix) >= policy.MaxLength {
+			return fmt.Errorf("prefix %q does not fit into max length %d", prefix, policy.MaxLength)
+		}
+	}
+
+	return nil
+}
+
+// invalidChars возвращает выражение, совпадающее с символом вне charset, nil для пустого charset.
+// Charset подставляется в класс [^...], поэтому проверяется, что результат разбора — именно
+// один класс символов: иначе charset вида "a-z]|.*" превратил бы выражение в альтернативу.
+func invalidChars(charset string) (*regexp.Regexp, error) {
+	if charset == "" {
+		return nil, nil //nolint:nilnil // пустой charset не ограничивает символы
+	}
+
+	expr := "[^" + charset + "]"
+
+	parsed, err := syntax.Parse(expr, syntax.Perl)
+	if err != nil {
+		return nil, fmt.Errorf("invalid charset %q: %w", charset, err)
+	}
+
+	if parsed.Op != syntax.OpCharClass && parsed.Op != syntax.OpLiteral {
+		return nil, fmt.Errorf("invalid charset %q: must be the contents of a character class", charset)
+	}
+
+	invalid, err := regexp.Compile(expr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid charset %q: %w", charset, err)
+	}
+
+	return invalid, nil
+}
+
+// namer применяет политику именования к именам метрик.
+type namer struct {
+	invalid *regexp.Regexp // символ вне допустимого набора
+	policy  NamingPolicy
+}
+
+// newNamer создает namer для политики. Некорректная политика возвращает ошибку.
+func newNamer(policy NamingPolicy) (*namer, error) {
+	if err := ValidateNamingPolicy(policy); err != nil {
+		return nil, err
+	}
+
+	invalid, err := invalidChars(policy.Charset)
+	if err != nil {
+		return nil, err
+	}
+
+	return &namer{policy: policy, invalid: invalid}, nil
+}
+
+// apply возвращает имя метрики, соответствующее политике. В режиме нормализации имя
+// приводится к политике, иначе нарушение политики возвращает ErrBadRequest.
+func (n *namer) apply(name string) (string, error) {
+	if n.policy.Normalize {
+		name = n.normalize(name)
+	}
+
+	if err := n.check(name); err != nil {
+		return "", err
+	}
+
+	return name, nil
+}
+
+// lookup возвращает имя, под которым метрика записана. В режиме нормализации запрошенное имя
+// приводится к политике так же, как при записи, иначе возвращается без изменений.
+func (n *namer) lookup(name string) string {
+	if n.policy.Normalize {
+		return n.normalize(name)
+	}
+
+	return name
+}
+
+// check проверяет имя метрики на соответствие политике.
+func (n *namer) check(name string) error {
+	if slices.Contains(n.policy.Reserved, name) {
+		return newError(ErrBadRequest, CodeReservedName, "metric name is reserved: "+name)
+	}
+
+	if n.invalid != nil {
+		if loc := n.invalid.FindStringIndex(name); loc != nil {
+			return newError(ErrBadRequest, CodeInvalidName, fmt.Sprintf("metric name %q contains invalid character %q",
+				name, name[loc[0]:loc[1]]))
+		}
+	}
+
+	if n.policy.MaxLength > 0 && utf8.RuneCountInString(name) > n.policy.MaxLength {
+		return newError(ErrBadRequest, CodeNameTooLong, fmt.Sprintf("metric name %q is longer than %d characters",
+			name, n.policy.MaxLength))
+	}
+
+	if len(n.policy.Prefixes) > 0 && !n.hasPrefix(name) {
+		return newError(ErrBadRequest, CodeMissingPrefix, fmt.Sprintf("metric name %q must start with one of: %s",
+			name, strings.Join(n.policy.Prefixes, ", ")))
+	}
+
+	return nil
+}
+
+func (n *namer) hasPrefix(name string) bool {
+	for _, prefix := range n.policy.Prefixes {
+		if strings.HasPrefix(name, prefix) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// normalize приводит имя к политике: заменяет недопустимые символы, добавляет префикс и обрезает длину.
+func (n *namer) normalize(name string) string {
+	if n.invalid != nil {
+		name = n.invalid.ReplaceAllString(name, "_")
+	}
+
+	if len(n.policy.Prefixes) > 0 && !n.hasPrefix(name) {
+		name = n.policy.Prefixes[0] + name
+	}
+
+	if n.policy.MaxLength > 0 && utf8.RuneCountInString(name) > n.policy.MaxLength {
+		name = string([]rune(name)[:n.policy.MaxLength])
+	}
+
+	return name
+}
@@ -0,0 +1,180 @@
+//nolint:wrapcheck,nolintlint,gocritic,errcheck,dupl,forcetypeassert
+package application
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"metricalert/internal/server/core/model"
+)
+
+var testNamingPolicy = NamingPolicy{
+	Charset:   "a-zA-Z0-9_.",
+	Prefixes:  []string{"app.", "sys."},
+	Reserved:  []string{"app.up", "sys.up"},
+	MaxLength: 16,
+}
+
+func TestValidateNamingPolicy(t *testing.T) {
+	assert.NoError(t, ValidateNamingPolicy(NamingPolicy{}))
+	assert.NoError(t, ValidateNamingPolicy(testNamingPolicy))
+
+	for _, policy := range []NamingPolicy{
+		{MaxLength: -1},
+		{Charset: "z-a"},
+		{Charset: "[:bogus:]"},
+		{Prefixes: []string{""}},
+		{Charset: "a-z", Prefixes: []string{"app."}},
+		{Prefixes: []string{"application."}, MaxLength: 12},
+		{Charset: "a-z", Normalize: true},
+		{Charset: "a-z]|.*"},
+		{Charset: "a-z][0-9"},
+	} {
+		assert.Error(t, ValidateNamingPolicy(policy), "policy %+v", policy)
+	}
+}
+
+func TestNamer(t *testing.T) {
+	tests := []struct {
+		name      string
+		input     string
+		want      string
+		code      string
+		normalize bool
+	}{
+		{name: "valid", input: "app.requests", want: "app.requests"},
+		{name: "invalid character", input: "app.cpu load", code: CodeInvalidName},
+		{name: "unicode", input: "app.загрузка", code: CodeInvalidName},
+		{name: "slash", input: "app.a/b", code: CodeInvalidName},
+		{name: "too long", input: "app.requests_total", code: CodeNameTooLong},
+		{name: "missing prefix", input: "requests", code: CodeMissingPrefix},
+		{name: "reserved", input: "app.up", code: CodeReservedName},
+		{name: "normalize characters", input: "sys.cpu load/1", want: "sys.cpu_load_1", normalize: true},
+		{name: "normalize prefix", input: "requests", want: "app.requests", normalize: true},
+		{name: "normalize length", input: "app.requests_total", want: "app.requests_tot", normalize: true},
+		{name: "normalize unicode", input: "загрузка", want: "app.________", normalize: true},
+		{name: "normalized reserved", input: "up", code: CodeReservedName, normalize: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			policy := testNamingPolicy
+			policy.Normalize = tt.normalize
+
+			n, err := newNamer(policy)
+			require.NoError(t, err)
+
+			got, err := n.apply(tt.input)
+			if tt.code != "" {
+				assert.ErrorIs(t, err, ErrBadRequest)
+				assert.Equal(t, tt.code, ErrorCode(err))
+
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+
+	t.Run("no policy", func(t *testing.T) {
+		n, err := newNamer(NamingPolicy{})
+		require.NoError(t, err)
+
+		got, err := n.apply("любое имя/с пробелами")
+		require.NoError(t, err)
+		assert.Equal(t, "любое имя/с пробелами", got)
+	})
+}
+
+func TestApplication_UpdateMetricNaming(t *testing.T) {
+	value := 1.5
+
+	t.Run("rejected", func(t *testing.T) {
+		repo := new(mockRepo)
+		app := newTestApplication(repo, Config{Naming: testNamingPolicy})
+
+		err := app.UpdateMetric(context.Background(), model.MetricRequest{ID: "cpu load", MType: "gauge", Value: &value})
+		assert.ErrorIs(t, err, ErrBadRequest)
+		assert.Equal(t, CodeInvalidName, ErrorCode(err))
+
+		repo.AssertNotCalled(t, "UpdateGauge", mock.Anything, mock.Anything, mock.Anything)
+	})
+
+	t.Run("normalized", func(t *testing.T) {
+		policy := testNamingPolicy
+		policy.Normalize = true
+
+		repo := new(mockRepo)
+		repo.On("UpdateGauge", mock.Anything, "app.cpu_load", value).Return(nil)
+
+		app := newTestApplication(repo, Config{Naming: policy})
+
+		require.NoError(t, app.UpdateMetric(context.Background(),
+			model.MetricRequest{ID: "cpu load", MType: "gauge", Value: &value}))
+		repo.AssertExpectations(t)
+	})
+}
+
+func TestApplication_UpdateMetricsNaming(t *testing.T) {
+	value, delta := 1.5, int64(2)
+
+	batch := []model.MetricRequest{
+		{ID: "app.ok", MType: "gauge", Value: &value},
+		{ID: "cpu load", MType: "gauge", Value: &value},
+		{ID: "app.up", MType: "counter", Delta: &delta},
+	}
+
+	t.Run("rejected", func(t *testing.T) {
+		repo := new(mockRepo)
+		repo.On("UpdateGauges", mock.Anything, map[string]float64{"app.ok": value}).Return(nil)
+
+		result, err := newTestApplication(repo, Config{Naming: testNamingPolicy}).
+			UpdateMetrics(context.Background(), batch, model.BatchOptions{})
+		require.NoError(t, err)
+		assert.Equal(t, 1, result.Accepted)
+		assert.Equal(t, CodeInvalidName, result.Items[1].Code)
+		assert.Equal(t, CodeReservedName, result.Items[2].Code)
+	})
+
+	t.Run("normalized", func(t *testing.T) {
+		policy := testNamingPolicy
+		policy.Normalize = true
+
+		repo := new(mockRepo)
+		repo.On("UpdateGauges", mock.Anything, map[string]float64{"app.ok": value, "app.cpu_load": value}).Return(nil)
+
+		result, err := newTestApplication(repo, Config{Naming: policy}).
+			UpdateMetrics(context.Background(), batch, model.BatchOptions{})
+		require.NoError(t, err)
+		assert.Equal(t, 2, result.Accepted)
+		assert.Equal(t, "cpu load", result.Items[1].ID)
+		assert.Equal(t, "metric name normalized to app.cpu_load", result.Items[1].Message)
+		assert.Equal(t, CodeReservedName, result.Items[2].Code)
+	})
+}
+
+func TestApplication_GetMetricNaming(t *testing.T) {
+	policy := testNamingPolicy
+	policy.Normalize = true
+
+	repo := new(mockRepo)
+	repo.On("GetGauge", mock.Anything, "app.cpu_load").Return(1.5, nil)
+
+	// значение, записанное под нормализованным именем, читается по исходному
+	value, err := newTestApplication(repo, Config{Naming: policy}).GetMetric(context.Background(), "cpu load", "gauge")
+	require.NoError(t, err)
+	assert.Equal(t, "1.5", value)
+}
+
+func TestApplication_RenameMetricNaming(t *testing.T) {
+	app := newTestApplication(new(mockRepo), Config{Naming: testNamingPolicy})
+
+	err := app.RenameMetric(context.Background(), "gauge", "app.old", "new name")
+	assert.ErrorIs(t, err, ErrBadRequest)
+	assert.Equal(t, CodeInvalidName, ErrorCode(err))
+}
@@ -0,0 +1,206 @@
+package application
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+
+	"metricalert/internal/server/core/model"
+)
+
+// RecordingRule правило записи: значение выражения Expr по сохраненным метрикам периодически
+// записывается в gauge с именем Name. Синтаксис выражений описан в expr.go.
+type RecordingRule struct {
+	Name string `json:"name"`
+	Expr string `json:"expr"`
+}
+
+// ValidateRecordingRules проверяет имена и выражения правил записи.
+func ValidateRecordingRules(rules []RecordingRule) error {
+	names := make(map[string]bool, len(rules))
+
+	for i, rule := range rules {
+		if strings.TrimSpace(rule.Name) == "" {
+			return fmt.Errorf("recording rule %d: empty name", i)
+		}
+
+		if names[rule.Name] {
+			return fmt.Errorf("recording rule %d: duplicate name %s", i, rule.Name)
+		}
+
+		names[rule.Name] = true
+
+		expr, err := parseExpr(rule.Expr)
+		if err != nil {
+			return fmt.Errorf("recording rule %s: invalid expression %q: %w", rule.Name, rule.Expr, err)
+		}
+
+		// правило, читающее собственный результат, накапливало бы его от вычисления к вычислению
+		if expr.uses(rule.Name) {
+			return fmt.Errorf("recording rule %s: expression %q refers to the rule's own result", rule.Name, rule.Expr)
+		}
+	}
+
+	return nil
+}
+
+type recordingRule struct {
+	expr exprNode
+	RecordingRule
+}
+
+// newRecordingRules проверяет правила и разбирает их выражения. Имена правил должны
+// соответствовать политике именования без нормализации: результат записывается под именем правила.
+func newRecordingRules(rules []RecordingRule, naming *namer) ([]recordingRule, error) {
+	if err := ValidateRecordingRules(rules); err != nil {
+		return nil, err
+	}
+
+	compiled := make([]recordingRule, 0, len(rules))
+
+	for _, rule := range rules {
+		if err := naming.check(rule.Name); err != nil {
+			return nil, fmt.Errorf("recording rule %s: %s", rule.Name, ErrorMessage(err))
+		}
+
+		expr, err := parseExpr(rule.Expr)
+		if err != nil {
+			return nil, fmt.Errorf("recording rule %s: %w", rule.Name, err)
+		}
+
+		compiled = append(compiled, recordingRule{RecordingRule: rule, expr: expr})
+	}
+
+	return compiled, nil
+}
+
+// EvaluateRecordingRules вычисляет правила записи и записывает результаты как gauge.
+// Правила вычисляются по порядку, поэтому правило может ссылаться на результат предыдущего.
+// Если правило не удалось вычислить, например из-за отсутствующей метрики или деления на ноль,
+// его метрика не обновляется, а ошибка возвращается в списке ошибок вместе с остальными результатами.
+// Результаты проходят те же проверки метаданных и лимитов кардинальности, что и метрики клиентов.
+func (a *Application) EvaluateRecordingRules(ctx context.Context) (map[string]float64, []error, error) {
+	if len(a.recording) == 0 {
+		return map[string]float64{}, nil, nil
+	}
+
+	values, err := a.metricValues(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var (
+		results  = make(map[string]float64, len(a.recording))
+		reserved []series
+		errs     []error
+	)
+
+	for _, rule := range a.recording {
+		value, err := rule.expr.eval(values)
+		if err == nil && (math.IsNaN(value) || math.IsInf(value, 0)) {
+			err = fmt.Errorf("result is %g", value)
+		}
+
+		if err == nil {
+			var admitted []series
+			if admitted, err = a.admitRecorded(ctx, rule.Name, value); err != nil && !isRejected(err) {
+				a.cardinality.release(reserved)
+				return nil, errs, err
+			}
+
+			reserved = append(reserved, admitted...)
+		}
+
+		if err != nil {
+			errs = append(errs, fmt.Errorf("recording rule %s: %w", rule.Name, err))
+			continue
+		}
+
+		results[rule.Name] = value
+		values[rule.Name] = value
+	}
+
+	if len(results) > 0 {
+		if err = a.repo.UpdateGauges(ctx, results); err != nil {
+			a.cardinality.release(reserved)
+			return nil, errs, fmt.Errorf("failed to update gauges: %w", err)
+		}
+	}
+
+	return results, errs, nil
+}
+
+// admitRecorded проверяет результат правила записи по метаданным и лимитам кардинальности.
+func (a *Application) admitRecorded(ctx context.Context, name string, value float64) ([]series, error) {
+	metric := model.MetricRequest{ID: name, MType: string(gaugeType), Value: &value}
+
+	if err := a.checkMetadata(metric); err != nil {
+		return nil, err
+	}
+
+	return a.admitMetric(ctx, metric)
+}
+
+// isRejected сообщает, что метрика отклонена проверками, а не из-за сбоя хранилища.
+func isRejected(err error) bool {
+	return errors.Is(err, ErrBadRequest) || errors.Is(err, ErrConflict) || errors.Is(err, ErrLimitExceeded)
+}
+
+// metricValues возвращает значения всех метрик, кроме результатов правил записи, по имени.
+// Если gauge и counter называются одинаково, используется значение gauge.
+func (a *Application) metricValues(ctx context.Context) (exprValues, error) {
+	gauges, err := a.repo.GetGaugeList(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get gauge list: %w", err)
+	}
+
+	counters, err := a.repo.GetCounterList(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get counter list: %w", err)
+	}
+
+	values := make(exprValues, len(gauges)+len(counters))
+	for name, delta := range counters {
+		values[name] = float64(delta)
+	}
+
+	for name, value := range gauges {
+		values[name] = value
+	}
+
+	// сохраненные результаты правил не участвуют в вычислении: правило с агрегатом по шаблону
+	// иначе учитывало бы результат другого правила прошлого вычисления
+	for _, rule := range a.recording {
+		delete(values, rule.Name)
+	}
+
+	return values, nil
+}
+
+// RunRecording периодически вычисляет правила записи, пока не отменен контекст.
+func (a *Application) RunRecording(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			_, errs, err := a.EvaluateRecordingRules(ctx)
+			if err != nil {
+				zap.L().Error("failed to evaluate recording rules", zap.Error(err))
+				continue
+			}
+
+			for _, err := range errs {
+				zap.L().Warn("recording rule skipped", zap.Error(err))
+			}
+		}
+	}
+}
@@ -0,0 +1,160 @@
+//nolint:wrapcheck,nolintlint,gocritic,errcheck,dupl,forcetypeassert
+package application
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"metricalert/internal/server/core/model"
+	"metricalert/internal/server/infra/store/memory"
+)
+
+func TestValidateRecordingRules(t *testing.T) {
+	assert.NoError(t, ValidateRecordingRules(nil))
+	assert.NoError(t, ValidateRecordingRules([]RecordingRule{{Name: "HeapUtilization", Expr: "HeapInuse / HeapSys"}}))
+	assert.Error(t, ValidateRecordingRules([]RecordingRule{{Expr: "1"}}))
+	assert.Error(t, ValidateRecordingRules([]RecordingRule{{Name: "a", Expr: "1"}, {Name: "a", Expr: "2"}}))
+	assert.Error(t, ValidateRecordingRules([]RecordingRule{{Name: "a", Expr: "1 +"}}))
+	assert.Error(t, ValidateRecordingRules([]RecordingRule{{Name: "a", Expr: "a + 1"}}))
+	assert.Error(t, ValidateRecordingRules([]RecordingRule{{Name: "FleetAlloc", Expr: "sum(*Alloc)"}}))
+}
+
+func TestApplication_EvaluateRecordingRules(t *testing.T) {
+	repo := new(mockRepo)
+	repo.On("GetGaugeList", mock.Anything).
+		Return(map[string]float64{"HeapInuse": 50, "HeapSys": 200, "a1.Alloc": 10, "a2.Alloc": 30}, nil)
+	repo.On("GetCounterList", mock.Anything).Return(map[string]int64{"PollCount": 4}, nil)
+	repo.On("UpdateGauges", mock.Anything, map[string]float64{
+		"HeapUtilization": 0.25,
+		"FleetAlloc":      40,
+		"AllocPerPoll":    10,
+	}).Return(nil)
+
+	app := newTestApplication(repo, Config{Recording: []RecordingRule{
+		{Name: "HeapUtilization", Expr: "HeapInuse / HeapSys"},
+		{Name: "FleetAlloc", Expr: "sum(*.Alloc)"},
+		{Name: "AllocPerPoll", Expr: "FleetAlloc / PollCount"},
+		{Name: "Broken", Expr: "Missing * 2"},
+		{Name: "Infinite", Expr: "HeapSys / (HeapInuse - 50)"},
+	}})
+
+	results, errs, err := app.EvaluateRecordingRules(context.Background())
+	require.NoError(t, err)
+	assert.Len(t, results, 3)
+	assert.Len(t, errs, 2)
+
+	repo.AssertExpectations(t)
+}
+
+func TestApplication_EvaluateRecordingRulesErrors(t *testing.T) {
+	t.Run("no rules", func(t *testing.T) {
+		repo := new(mockRepo)
+
+		results, errs, err := newTestApplication(repo, Config{}).EvaluateRecordingRules(context.Background())
+		require.NoError(t, err)
+		assert.Empty(t, results)
+		assert.Empty(t, errs)
+
+		repo.AssertNotCalled(t, "GetGaugeList", mock.Anything)
+	})
+
+	t.Run("stored results are not inputs", func(t *testing.T) {
+		repo := new(mockRepo)
+		repo.On("GetGaugeList", mock.Anything).
+			Return(map[string]float64{"a1.Alloc": 10, "FleetAlloc": 10, "Fleet.Alloc": 100}, nil)
+		repo.On("GetCounterList", mock.Anything).Return(map[string]int64{}, nil)
+		repo.On("UpdateGauges", mock.Anything, map[string]float64{"FleetAlloc": 10, "Fleet.Alloc": 10}).Return(nil)
+
+		app := newTestApplication(repo, Config{Recording: []RecordingRule{
+			{Name: "FleetAlloc", Expr: "sum(*.Alloc)"},
+			{Name: "Fleet.Alloc", Expr: "FleetAlloc"},
+		}})
+
+		_, errs, err := app.EvaluateRecordingRules(context.Background())
+		require.NoError(t, err)
+		assert.Empty(t, errs)
+
+		repo.AssertExpectations(t)
+	})
+
+	t.Run("metadata and cardinality", func(t *testing.T) {
+		repo := new(mockRepo)
+		repo.On("GetGaugeList", mock.Anything).Return(map[string]float64{"Existing": 1}, nil)
+		repo.On("GetCounterList", mock.Anything).Return(map[string]int64{}, nil)
+		repo.On("UpdateGauges", mock.Anything, map[string]float64{"Existing": 1}).Return(nil)
+
+		app := newTestApplication(repo, Config{
+			Metadata:    []model.MetricMeta{{Name: "Counted", MType: "counter"}},
+			Cardinality: model.CardinalityLimits{Total: 1},
+			Recording: []RecordingRule{
+				{Name: "Counted", Expr: "1"},
+				{Name: "Fresh", Expr: "1"},
+				{Name: "Existing", Expr: "1"},
+			},
+		})
+
+		results, errs, err := app.EvaluateRecordingRules(context.Background())
+		require.NoError(t, err)
+		assert.Equal(t, map[string]float64{"Existing": 1}, results)
+		require.Len(t, errs, 2)
+		assert.ErrorIs(t, errs[0], ErrConflict)
+		assert.ErrorIs(t, errs[1], ErrLimitExceeded)
+
+		repo.AssertExpectations(t)
+	})
+
+	t.Run("write error", func(t *testing.T) {
+		repo := new(mockRepo)
+		repo.On("GetGaugeList", mock.Anything).Return(map[string]float64{}, nil)
+		repo.On("GetCounterList", mock.Anything).Return(map[string]int64{}, nil)
+		repo.On("UpdateGauges", mock.Anything, mock.Anything).Return(errors.New("db is down"))
+
+		_, _, err := newTestApplication(repo, Config{Recording: []RecordingRule{{Name: "one", Expr: "1"}}}).
+			EvaluateRecordingRules(context.Background())
+		assert.Error(t, err)
+	})
+}
+
+func TestApplication_RunRecordingConcurrentWrites(t *testing.T) {
+	// правила записи и учет кардинальности читают списки метрик хранилища, пока агенты пишут;
+	// запускается с -race, чтобы гонка обнаруживалась детектором
+	repo := memory.NewStore(&memory.Config{})
+	app := newTestApplication(repo, Config{
+		Recording:   []RecordingRule{{Name: "FleetAlloc", Expr: "sum(*.Alloc)"}},
+		Cardinality: model.CardinalityLimits{Total: 1000},
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+
+	go func() {
+		app.RunRecording(ctx, time.Millisecond)
+		close(done)
+	}()
+
+	for i := range 200 {
+		value := float64(i)
+		_, err := app.UpdateMetrics(ctx, []model.MetricRequest{
+			{ID: fmt.Sprintf("a%d.Alloc", i%20), MType: "gauge", Value: &value},
+		}, model.BatchOptions{})
+		require.NoError(t, err)
+
+		_, err = app.CardinalityState(ctx)
+		require.NoError(t, err)
+	}
+
+	require.Eventually(t, func() bool {
+		_, err := repo.GetGauge(ctx, "FleetAlloc")
+		return err == nil
+	}, time.Second, time.Millisecond)
+
+	cancel()
+	<-done
+}
@@ -0,0 +1,229 @@
+package application
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"regexp"
+	"strings"
+	"sync"
+
+	"metricalert/internal/server/core/model"
+)
+
+// RelabelSource загружает правила преобразования метрик, например из файла.
+// Используется для перезагрузки правил во время работы сервера.
+type RelabelSource func() ([]model.RelabelRule, error)
+
+// errDropped метрика отброшена правилом преобразования.
+var errDropped = errors.New("dropped")
+
+// ValidateRelabelRules проверяет правила преобразования метрик.
+func ValidateRelabelRules(rules []model.RelabelRule) error {
+	_, err := compileRelabelRules(rules)
+	return err
+}
+
+type relabelRule struct {
+	re   *regexp.Regexp
+	rule model.RelabelRule
+}
+
+func compileRelabelRules(rules []model.RelabelRule) ([]relabelRule, error) {
+	compiled := make([]relabelRule, 0, len(rules))
+
+	for i, rule := range rules {
+		if err := validateRelabelRule(rule); err != nil {
+			return nil, newError(ErrBadRequest, CodeBadRelabel, fmt.Sprintf("relabel rule %d: %v", i, err))
+		}
+
+		re, err := regexp.Compile("^(?:" + rule.Match + ")$")
+		if err != nil {
+			return nil, newError(ErrBadRequest, CodeBadRelabel, fmt.Sprintf("relabel rule %d: invalid match %q: %v",
+				i, rule.Match, err))
+		}
+
+		compiled = append(compiled, relabelRule{re: re, rule: rule})
+	}
+
+	return compiled, nil
+}
+
+func validateRelabelRule(rule model.RelabelRule) error {
+	if rule.Match == "" {
+		return errors.New("empty match")
+	}
+
+	if rule.MType != "" && metricType(rule.MType) != gaugeType && metricType(rule.MType) != counterType {
+		return fmt.Errorf("unknown metric type %q", rule.MType)
+	}
+
+	switch rule.Action {
+	case model.RelabelRename:
+		if rule.Replacement == "" {
+			return errors.New("rename action requires a replacement")
+		}
+	case model.RelabelPrefix:
+		if rule.Prefix == "" {
+			return errors.New("prefix action requires a prefix")
+		}
+	case model.RelabelScale:
+		// отрицательный коэффициент превратил бы приращение счетчика в уменьшение
+		if rule.Factor <= 0 || math.IsNaN(rule.Factor) || math.IsInf(rule.Factor, 0) {
+			return fmt.Errorf("scale requires a finite positive factor, got %g", rule.Factor)
+		}
+	case model.RelabelDrop, model.RelabelToCounter:
+	case "label", "labels":
+		return fmt.Errorf("action %q is not supported: metrics are identified by name only, use prefix", rule.Action)
+	default:
+		return fmt.Errorf("unknown action %q", rule.Action)
+	}
+
+	return nil
+}
+
+// relabeler применяет правила преобразования к метрикам перед записью. Правила можно заменить
+// во время работы, метрики, обрабатываемые в этот момент, преобразуются прежними правилами.
+type relabeler struct {
+	mu     *sync.RWMutex
+	source RelabelSource
+	rules  []relabelRule
+}
+
+// newRelabeler создает relabeler. Некорректное правило возвращает ошибку.
+func newRelabeler(rules []model.RelabelRule, source RelabelSource) (*relabeler, error) {
+	compiled, err := compileRelabelRules(rules)
+	if err != nil {
+		return nil, err
+	}
+
+	return &relabeler{mu: &sync.RWMutex{}, source: source, rules: compiled}, nil
+}
+
+// apply последовательно применяет к метрике подходящие правила. Если метрика отброшена,
+// возвращается ошибка, которую распознает isDropped.
+func (r *relabeler) apply(metric model.MetricRequest) (model.MetricRequest, error) {
+	r.mu.RLock()
+	rules := r.rules
+	r.mu.RUnlock()
+
+	for i, rule := range rules {
+		if rule.rule.MType != "" && rule.rule.MType != metric.MType {
+			continue
+		}
+
+		if !rule.re.MatchString(metric.ID) {
+			continue
+		}
+
+		switch rule.rule.Action {
+		case model.RelabelDrop:
+			return metric, newError(errDropped, CodeRelabelDropped,
+				fmt.Sprintf("metric %s dropped by relabel rule %d", metric.ID, i))
+		case model.RelabelRename:
+			metric.ID = rule.re.ReplaceAllString(metric.ID, rule.rule.Replacement)
+		case model.RelabelPrefix:
+			metric.ID = rule.rule.Prefix + metric.ID
+		case model.RelabelScale:
+			var err error
+			if metric, err = scale(metric, rule.rule.Factor); err != nil {
+				return metric, err
+			}
+		case model.RelabelToCounter:
+			var err error
+			if metric, err = toCounter(metric); err != nil {
+				return metric, err
+			}
+		}
+	}
+
+	if strings.TrimSpace(metric.ID) == "" {
+		return metric, newError(ErrBadRequest, CodeEmptyName, "metric name is empty after relabeling")
+	}
+
+	return metric, nil
+}
+
+// scale умножает значение метрики на коэффициент. Значения копируются, чтобы не изменять запрос клиента.
+func scale(metric model.MetricRequest, factor float64) (model.MetricRequest, error) {
+	switch metricType(metric.MType) {
+	case gaugeType:
+		value := *metric.Value * factor
+		metric.Value = &value
+	case counterType:
+		delta, err := toDelta(metric.ID, float64(*metric.Delta)*factor)
+		if err != nil {
+			return metric, err
+		}
+
+		metric.Delta = &delta
+	}
+
+	return metric, nil
+}
+
+// toCounter превращает gauge в counter с приращением, равным округленному значению gauge.
+func toCounter(metric model.MetricRequest) (model.MetricRequest, error) {
+	if metricType(metric.MType) != gaugeType {
+		return metric, nil
+	}
+
+	delta, err := toDelta(metric.ID, *metric.Value)
+	if err != nil {
+		return metric, err
+	}
+
+	metric.MType = string(counterType)
+	metric.Delta = &delta
+	metric.Value = nil
+
+	return metric, nil
+}
+
+func toDelta(name string, value float64) (int64, error) {
+	rounded := math.Round(value)
+	if math.IsNaN(rounded) || rounded < math.MinInt64 || rounded >= math.MaxInt64 {
+		return 0, newError(ErrBadRequest, CodeOutOfRange,
+			fmt.Sprintf("value %g of metric %s does not fit into a counter after relabeling", value, name))
+	}
+
+	return int64(rounded), nil
+}
+
+// RelabelRules возвращает действующие правила преобразования метрик.
+func (a *Application) RelabelRules(_ context.Context) ([]model.RelabelRule, error) {
+	a.relabel.mu.RLock()
+	defer a.relabel.mu.RUnlock()
+
+	rules := make([]model.RelabelRule, 0, len(a.relabel.rules))
+	for _, rule := range a.relabel.rules {
+		rules = append(rules, rule.rule)
+	}
+
+	return rules, nil
+}
+
+// ReloadRelabelRules загружает правила преобразования из источника и заменяет ими действующие.
+// При некорректных правилах возвращается ErrBadRequest, действующие правила не меняются.
+func (a *Application) ReloadRelabelRules(ctx context.Context) ([]model.RelabelRule, error) {
+	if a.relabel.source == nil {
+		return nil, newError(ErrBadRequest, CodeBadRelabel, "relabel rules source is not configured")
+	}
+
+	rules, err := a.relabel.source()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load relabel rules: %w", err)
+	}
+
+	compiled, err := compileRelabelRules(rules)
+	if err != nil {
+		return nil, err
+	}
+
+	a.relabel.mu.Lock()
+	a.relabel.rules = compiled
+	a.relabel.mu.Unlock()
+
+	return a.RelabelRules(ctx)
+}
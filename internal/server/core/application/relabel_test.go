@@ -0,0 +1,129 @@
+//nolint:wrapcheck,nolintlint,gocritic,errcheck,dupl,forcetypeassert
+package application
+
+import (
+	"context"
+	"errors"
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"metricalert/internal/server/core/model"
+)
+
+var testRelabelRules = []model.RelabelRule{
+	{Match: "debug_.*", Action: model.RelabelDrop},
+	{Match: "(.*)_bytes", MType: "gauge", Action: model.RelabelScale, Factor: 1.0 / (1 << 20)},
+	{Match: "(.*)_bytes", MType: "gauge", Action: model.RelabelRename, Replacement: "${1}_mib"},
+	{Match: "requests_total", Action: model.RelabelToCounter},
+	{Match: "cpu.*", Action: model.RelabelPrefix, Prefix: "host_"},
+}
+
+func TestValidateRelabelRules(t *testing.T) {
+	assert.NoError(t, ValidateRelabelRules(nil))
+	assert.NoError(t, ValidateRelabelRules(testRelabelRules))
+
+	for _, rule := range []model.RelabelRule{
+		{Action: model.RelabelDrop},
+		{Match: "(", Action: model.RelabelDrop},
+		{Match: "a", Action: "label"},
+		{Match: "a", MType: "histogram", Action: model.RelabelDrop},
+		{Match: "a", Action: model.RelabelRename},
+		{Match: "a", Action: model.RelabelPrefix},
+		{Match: "a", Action: model.RelabelScale},
+		{Match: "a", Action: model.RelabelScale, Factor: math.Inf(1)},
+		{Match: "a", Action: model.RelabelScale, Factor: -1},
+	} {
+		err := ValidateRelabelRules([]model.RelabelRule{rule})
+		assert.ErrorIs(t, err, ErrBadRequest, "rule %+v", rule)
+		assert.Equal(t, CodeBadRelabel, ErrorCode(err))
+	}
+}
+
+func TestApplication_UpdateMetricRelabel(t *testing.T) {
+	repo := new(mockRepo)
+	repo.On("UpdateGauge", mock.Anything, "heap_mib", 2.0).Return(nil)
+	repo.On("UpdateCounter", mock.Anything, "requests_total", int64(4)).Return(nil)
+	repo.On("UpdateGauge", mock.Anything, "host_cpu", 0.5).Return(nil)
+
+	app := newTestApplication(repo, Config{Relabel: testRelabelRules})
+	ctx := context.Background()
+
+	value := float64(2 << 20)
+	require.NoError(t, app.UpdateMetric(ctx, model.MetricRequest{ID: "heap_bytes", MType: "gauge", Value: &value}))
+	// значение в запросе клиента не меняется
+	assert.Equal(t, float64(2<<20), value)
+
+	require.NoError(t, app.UpdateMetric(ctx, model.MetricRequest{ID: "requests_total", MType: "gauge", Value: ptr(3.6)}))
+	require.NoError(t, app.UpdateMetric(ctx, model.MetricRequest{ID: "cpu", MType: "gauge", Value: ptr(0.5)}))
+	require.NoError(t, app.UpdateMetric(ctx, model.MetricRequest{ID: "debug_x", MType: "gauge", Value: ptr(1.0)}))
+
+	err := app.UpdateMetric(ctx, model.MetricRequest{ID: "requests_total", MType: "gauge", Value: ptr(math.NaN())})
+	assert.ErrorIs(t, err, ErrBadRequest)
+	assert.Equal(t, CodeOutOfRange, ErrorCode(err))
+
+	repo.AssertExpectations(t)
+	repo.AssertNumberOfCalls(t, "UpdateGauge", 2)
+}
+
+func TestApplication_UpdateMetricsRelabel(t *testing.T) {
+	repo := new(mockRepo)
+	repo.On("UpdateGauges", mock.Anything, map[string]float64{"heap_mib": 1}).Return(nil)
+	repo.On("UpdateCounters", mock.Anything, map[string]int64{"requests_total": 2}).Return(nil)
+
+	result, err := newTestApplication(repo, Config{Relabel: testRelabelRules}).UpdateMetrics(context.Background(),
+		[]model.MetricRequest{
+			{ID: "heap_bytes", MType: "gauge", Value: ptr(float64(1 << 20))},
+			{ID: "debug_x", MType: "counter", Delta: ptr(int64(1))},
+			{ID: "requests_total", MType: "gauge", Value: ptr(2.0)},
+		}, model.BatchOptions{})
+	require.NoError(t, err)
+
+	assert.Equal(t, 2, result.Accepted)
+	assert.Equal(t, 1, result.Dropped)
+	assert.Equal(t, 0, result.Rejected)
+	assert.Equal(t, "metric name normalized to heap_mib", result.Items[0].Message)
+	assert.Equal(t, model.ItemDropped, result.Items[1].Status)
+	assert.Equal(t, CodeRelabelDropped, result.Items[1].Code)
+
+	repo.AssertExpectations(t)
+}
+
+func TestApplication_ReloadRelabelRules(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("not configured", func(t *testing.T) {
+		_, err := newTestApplication(new(mockRepo), Config{}).ReloadRelabelRules(ctx)
+		assert.ErrorIs(t, err, ErrBadRequest)
+	})
+
+	var (
+		rules   = []model.RelabelRule{{Match: "a", Action: model.RelabelDrop}}
+		loadErr error
+	)
+
+	app := newTestApplication(new(mockRepo), Config{
+		Relabel:       testRelabelRules,
+		RelabelSource: func() ([]model.RelabelRule, error) { return rules, loadErr },
+	})
+
+	reloaded, err := app.ReloadRelabelRules(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, rules, reloaded)
+
+	// некорректные правила и ошибка загрузки не заменяют действующие правила
+	rules = []model.RelabelRule{{Match: "(", Action: model.RelabelDrop}}
+	_, err = app.ReloadRelabelRules(ctx)
+	assert.ErrorIs(t, err, ErrBadRequest)
+
+	loadErr = errors.New("file not found")
+	_, err = app.ReloadRelabelRules(ctx)
+	assert.ErrorIs(t, err, loadErr)
+
+	current, err := app.RelabelRules(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []model.RelabelRule{{Match: "a", Action: model.RelabelDrop}}, current)
+}
@@ -0,0 +1,219 @@
+package application
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"sort"
+	"time"
+
+	"go.uber.org/zap"
+
+	"metricalert/internal/server/core/model"
+)
+
+// StalenessRule задает сроки устаревания метрик, имена которых подходят под шаблон.
+// Метрика, не обновлявшаяся дольше StaleAfter, помечается устаревшей, дольше DeleteAfter — удаляется.
+// Нулевой срок отключает соответствующее действие.
+type StalenessRule struct {
+	Pattern     string // шаблон имени в синтаксисе path.Match: *, ?, [a-z]
+	StaleAfter  time.Duration
+	DeleteAfter time.Duration
+}
+
+// ValidateStalenessRules проверяет шаблоны и сроки правил устаревания.
+func ValidateStalenessRules(rules []StalenessRule) error {
+	for i, rule := range rules {
+		if rule.Pattern == "" {
+			return fmt.Errorf("staleness rule %d: empty pattern", i)
+		}
+
+		if _, err := path.Match(rule.Pattern, ""); err != nil {
+			return fmt.Errorf("staleness rule %d: invalid pattern %q: %w", i, rule.Pattern, err)
+		}
+
+		if rule.StaleAfter < 0 || rule.DeleteAfter < 0 {
+			return fmt.Errorf("staleness rule %d: negative ttl", i)
+		}
+	}
+
+	return nil
+}
+
+// stalenessRule возвращает первое правило, под шаблон которого подходит имя метрики.
+func (a *Application) stalenessRule(name string) (StalenessRule, bool) {
+	for _, rule := range a.staleness {
+		if ok, _ := path.Match(rule.Pattern, name); ok {
+			return rule, true
+		}
+	}
+
+	return StalenessRule{}, false
+}
+
+// isStale сообщает, что метрика не обновлялась дольше срока устаревания или удаления.
+// Метрики без времени обновления устаревшими не считаются.
+func (a *Application) isStale(name string, times map[string]time.Time, now time.Time) bool {
+	updatedAt, ok := times[name]
+	if !ok {
+		return false
+	}
+
+	rule, ok := a.stalenessRule(name)
+	if !ok {
+		return false
+	}
+
+	age := now.Sub(updatedAt)
+
+	return (rule.StaleAfter > 0 && age >= rule.StaleAfter) || (rule.DeleteAfter > 0 && age >= rule.DeleteAfter)
+}
+
+// expiryCutoffs возвращает метрики, не обновлявшиеся дольше срока удаления, с моментом отсечения:
+// метрика удаляется, только если ее последнее обновление раньше этого момента.
+func (a *Application) expiryCutoffs(times map[string]time.Time, now time.Time) map[string]time.Time {
+	cutoffs := make(map[string]time.Time)
+
+	for name, updatedAt := range times {
+		rule, ok := a.stalenessRule(name)
+		if !ok || rule.DeleteAfter <= 0 {
+			continue
+		}
+
+		if cutoff := now.Add(-rule.DeleteAfter); updatedAt.Before(cutoff) {
+			cutoffs[name] = cutoff
+		}
+	}
+
+	return cutoffs
+}
+
+// updateTimes возвращает время обновления метрик. Без правил устаревания хранилище не запрашивается.
+func (a *Application) updateTimes(ctx context.Context) (model.UpdateTimes, error) {
+	if len(a.staleness) == 0 {
+		return model.UpdateTimes{}, nil
+	}
+
+	times, err := a.repo.GetUpdateTimes(ctx)
+	if err != nil {
+		return model.UpdateTimes{}, fmt.Errorf("failed to get update times: %w", err)
+	}
+
+	return times, nil
+}
+
+// ExportMetrics возвращает все метрики, отсортированные по типу и имени, с признаком устаревания.
+func (a *Application) ExportMetrics(ctx context.Context) ([]model.MetricState, error) {
+	gauges, err := a.repo.GetGaugeList(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get gauge list: %w", err)
+	}
+
+	counters, err := a.repo.GetCounterList(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get counter list: %w", err)
+	}
+
+	times, err := a.updateTimes(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	now := a.now()
+
+	metrics := make([]model.MetricState, 0, len(gauges)+len(counters))
+	for name, value := range gauges {
+		metrics = append(metrics, model.MetricState{
+			ID:    name,
+			MType: string(gaugeType),
+			Value: value,
+			Help:  a.help(name),
+			Stale: a.isStale(name, times.Gauges, now),
+		})
+	}
+
+	for name, delta := range counters {
+		metrics = append(metrics, model.MetricState{
+			ID:    name,
+			MType: string(counterType),
+			Delta: delta,
+			Help:  a.help(name),
+			Stale: a.isStale(name, times.Counters, now),
+		})
+	}
+
+	sort.Slice(metrics, func(i, j int) bool {
+		if metrics[i].MType != metrics[j].MType {
+			return metrics[i].MType > metrics[j].MType
+		}
+
+		return metrics[i].ID < metrics[j].ID
+	})
+
+	return metrics, nil
+}
+
+// ExpireMetrics удаляет метрики, которые не обновлялись дольше срока удаления, и возвращает их.
+// Хранилище повторно проверяет время обновления при удалении, поэтому метрика, обновленная
+// между чтением времени обновления и удалением, сохраняется.
+func (a *Application) ExpireMetrics(ctx context.Context) ([]model.MetricRef, error) {
+	times, err := a.updateTimes(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	now := a.now()
+
+	var gauges, counters []string
+
+	if cutoffs := a.expiryCutoffs(times.Gauges, now); len(cutoffs) > 0 {
+		if gauges, err = a.repo.ExpireGauges(ctx, cutoffs); err != nil {
+			return nil, fmt.Errorf("failed to delete gauges: %w", err)
+		}
+
+		a.cardinality.forget(gaugeType, gauges)
+	}
+
+	if cutoffs := a.expiryCutoffs(times.Counters, now); len(cutoffs) > 0 {
+		if counters, err = a.repo.ExpireCounters(ctx, cutoffs); err != nil {
+			return nil, fmt.Errorf("failed to delete counters: %w", err)
+		}
+
+		a.cardinality.forget(counterType, counters)
+	}
+
+	return metricRefs(gauges, counters), nil
+}
+
+// RunExpiry периодически удаляет устаревшие метрики и давно молчащих агентов, пока не отменен контекст.
+func (a *Application) RunExpiry(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			expired, err := a.ExpireMetrics(ctx)
+			if err != nil {
+				zap.L().Error("failed to expire metrics", zap.Error(err))
+				continue
+			}
+
+			if len(expired) > 0 {
+				zap.L().Info("stale metrics deleted", zap.Any("metrics", expired))
+			}
+
+			agents, err := a.ExpireAgents(ctx)
+			if err != nil {
+				zap.L().Error("failed to expire agents", zap.Error(err))
+				continue
+			}
+
+			if len(agents) > 0 {
+				zap.L().Info("silent agents forgotten", zap.Strings("agents", agents))
+			}
+		}
+	}
+}
@@ -0,0 +1,184 @@
+//nolint:wrapcheck,nolintlint,gocritic,errcheck,dupl,forcetypeassert
+package application
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"metricalert/internal/server/core/model"
+)
+
+func newStalenessApp(repo *mockRepo, now time.Time) *Application {
+	app := newTestApplication(repo, Config{Staleness: []StalenessRule{
+		{Pattern: "agent1_*", StaleAfter: time.Minute, DeleteAfter: time.Hour},
+		{Pattern: "*", StaleAfter: 10 * time.Minute},
+	}})
+	app.now = func() time.Time { return now }
+
+	return app
+}
+
+func TestValidateStalenessRules(t *testing.T) {
+	assert.NoError(t, ValidateStalenessRules(nil))
+	assert.NoError(t, ValidateStalenessRules([]StalenessRule{{Pattern: "cpu_*", StaleAfter: time.Minute}}))
+	assert.Error(t, ValidateStalenessRules([]StalenessRule{{StaleAfter: time.Minute}}))
+	assert.Error(t, ValidateStalenessRules([]StalenessRule{{Pattern: "[a"}}))
+	assert.Error(t, ValidateStalenessRules([]StalenessRule{{Pattern: "*", DeleteAfter: -time.Second}}))
+}
+
+func TestApplication_GetMetricsStale(t *testing.T) {
+	now := time.Now()
+
+	repo := new(mockRepo)
+	repo.On("GetGaugeList", mock.Anything).
+		Return(map[string]float64{"agent1_cpu": 1, "agent2_cpu": 2, "fresh": 3, "unknown": 4}, nil)
+	repo.On("GetCounterList", mock.Anything).Return(map[string]int64{"agent1_polls": 5}, nil)
+	repo.On("GetUpdateTimes", mock.Anything).Return(model.UpdateTimes{
+		Gauges: map[string]time.Time{
+			"agent1_cpu": now.Add(-2 * time.Minute),
+			"agent2_cpu": now.Add(-2 * time.Minute),
+			"fresh":      now,
+		},
+		Counters: map[string]time.Time{"agent1_polls": now.Add(-2 * time.Minute)},
+	}, nil)
+
+	metrics, err := newStalenessApp(repo, now).GetMetrics(context.Background())
+	require.NoError(t, err)
+
+	stale := make(map[string]bool, len(metrics))
+	for _, metric := range metrics {
+		stale[metric.Name] = metric.Stale
+	}
+
+	// agent2_cpu подпадает под общее правило со сроком 10 минут, у unknown нет времени обновления
+	assert.Equal(t, map[string]bool{
+		"agent1_cpu": true, "agent2_cpu": false, "fresh": false, "unknown": false, "agent1_polls": true,
+	}, stale)
+}
+
+func TestApplication_GetMetricsWithoutRules(t *testing.T) {
+	repo := new(mockRepo)
+	repo.On("GetGaugeList", mock.Anything).Return(map[string]float64{"test": 1}, nil)
+	repo.On("GetCounterList", mock.Anything).Return(map[string]int64{}, nil)
+
+	metrics, err := newTestApplication(repo, Config{}).GetMetrics(context.Background())
+	require.NoError(t, err)
+	require.Len(t, metrics, 1)
+	assert.False(t, metrics[0].Stale)
+
+	repo.AssertNotCalled(t, "GetUpdateTimes", mock.Anything)
+}
+
+func TestApplication_ExportMetrics(t *testing.T) {
+	now := time.Now()
+
+	t.Run("sorted with stale flag", func(t *testing.T) {
+		repo := new(mockRepo)
+		repo.On("GetGaugeList", mock.Anything).Return(map[string]float64{"b": 2, "a": 1}, nil)
+		repo.On("GetCounterList", mock.Anything).Return(map[string]int64{"agent1_polls": 5}, nil)
+		repo.On("GetUpdateTimes", mock.Anything).Return(model.UpdateTimes{
+			Gauges:   map[string]time.Time{"a": now.Add(-time.Hour), "b": now},
+			Counters: map[string]time.Time{"agent1_polls": now.Add(-time.Hour)},
+		}, nil)
+
+		metrics, err := newStalenessApp(repo, now).ExportMetrics(context.Background())
+		require.NoError(t, err)
+		assert.Equal(t, []model.MetricState{
+			{ID: "a", MType: "gauge", Value: 1, Stale: true},
+			{ID: "b", MType: "gauge", Value: 2},
+			{ID: "agent1_polls", MType: "counter", Delta: 5, Stale: true},
+		}, metrics)
+	})
+
+	t.Run("update times error", func(t *testing.T) {
+		repo := new(mockRepo)
+		repo.On("GetGaugeList", mock.Anything).Return(map[string]float64{}, nil)
+		repo.On("GetCounterList", mock.Anything).Return(map[string]int64{}, nil)
+		repo.On("GetUpdateTimes", mock.Anything).Return(model.UpdateTimes{}, assert.AnError)
+
+		_, err := newStalenessApp(repo, now).ExportMetrics(context.Background())
+		assert.ErrorIs(t, err, assert.AnError)
+	})
+}
+
+func TestApplication_ExpireMetrics(t *testing.T) {
+	now := time.Now()
+
+	t.Run("deletes expired", func(t *testing.T) {
+		repo := new(mockRepo)
+		repo.On("GetUpdateTimes", mock.Anything).Return(model.UpdateTimes{
+			Gauges: map[string]time.Time{
+				"agent1_cpu": now.Add(-2 * time.Hour),
+				"agent1_mem": now.Add(-time.Minute),
+				"agent2_cpu": now.Add(-48 * time.Hour),
+			},
+			Counters: map[string]time.Time{"agent1_polls": now.Add(-90 * time.Minute)},
+		}, nil)
+		cutoff := now.Add(-time.Hour)
+		repo.On("ExpireGauges", mock.Anything, map[string]time.Time{"agent1_cpu": cutoff}).
+			Return([]string{"agent1_cpu"}, nil)
+		repo.On("ExpireCounters", mock.Anything, map[string]time.Time{"agent1_polls": cutoff}).
+			Return([]string{"agent1_polls"}, nil)
+
+		expired, err := newStalenessApp(repo, now).ExpireMetrics(context.Background())
+		require.NoError(t, err)
+		assert.Equal(t, []model.MetricRef{
+			{ID: "agent1_cpu", MType: "gauge"},
+			{ID: "agent1_polls", MType: "counter"},
+		}, expired)
+
+		repo.AssertExpectations(t)
+	})
+
+	t.Run("nothing expired", func(t *testing.T) {
+		repo := new(mockRepo)
+		repo.On("GetUpdateTimes", mock.Anything).Return(model.UpdateTimes{
+			Gauges: map[string]time.Time{"agent1_cpu": now},
+		}, nil)
+
+		expired, err := newStalenessApp(repo, now).ExpireMetrics(context.Background())
+		require.NoError(t, err)
+		assert.Empty(t, expired)
+
+		repo.AssertNotCalled(t, "ExpireGauges", mock.Anything, mock.Anything)
+	})
+
+	t.Run("updated before delete", func(t *testing.T) {
+		// хранилище не удалило метрику, обновленную после чтения времени обновления
+		repo := new(mockRepo)
+		repo.On("GetUpdateTimes", mock.Anything).Return(model.UpdateTimes{
+			Gauges: map[string]time.Time{"agent1_cpu": now.Add(-2 * time.Hour)},
+		}, nil)
+		repo.On("ExpireGauges", mock.Anything, mock.Anything).Return([]string{}, nil)
+
+		expired, err := newStalenessApp(repo, now).ExpireMetrics(context.Background())
+		require.NoError(t, err)
+		assert.Empty(t, expired)
+	})
+
+	t.Run("without rules", func(t *testing.T) {
+		repo := new(mockRepo)
+
+		expired, err := newTestApplication(repo, Config{}).ExpireMetrics(context.Background())
+		require.NoError(t, err)
+		assert.Empty(t, expired)
+
+		repo.AssertNotCalled(t, "GetUpdateTimes", mock.Anything)
+	})
+
+	t.Run("delete error", func(t *testing.T) {
+		repo := new(mockRepo)
+		repo.On("GetUpdateTimes", mock.Anything).Return(model.UpdateTimes{
+			Gauges: map[string]time.Time{"agent1_cpu": now.Add(-2 * time.Hour)},
+		}, nil)
+		repo.On("ExpireGauges", mock.Anything, mock.Anything).Return([]string(nil), assert.AnError)
+
+		_, err := newStalenessApp(repo, now).ExpireMetrics(context.Background())
+		assert.ErrorIs(t, err, assert.AnError)
+	})
+}
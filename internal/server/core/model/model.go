@@ -1,5 +1,10 @@
 package model
 
+import (
+	"encoding/json"
+	"time"
+)
+
 // Metric структура для хранения метрик.
 type Metric struct {
 	Name  string
@@ -11,6 +16,9 @@ type Metric struct {
 type MetricData struct {
 	Name  string
 	Value string
+	Unit  string
+	Help  string
+	Stale bool // метрика не обновлялась дольше заданного для нее срока
 }
 
 // MetricRequest структура для хранения запроса метрик.
@@ -20,3 +28,160 @@ type MetricRequest struct {
 	ID    string   `json:"id"`              // имя метрики
 	MType string   `json:"type"`            // параметр, принимающий значение gauge или counter
 }
+
+// Статусы обработки метрики из пакета.
+const (
+	ItemAccepted     = "accepted"     // метрика записана
+	ItemRejected     = "rejected"     // метрика отклонена, причина указана в Code и Message
+	ItemDeduplicated = "deduplicated" // значение gauge перезаписано следующей метрикой пакета
+	ItemDropped      = "dropped"      // метрика отброшена без ошибки, причина указана в Code и Message
+)
+
+// BatchOptions параметры обработки пакета метрик.
+type BatchOptions struct {
+	IdempotencyKey string // ключ пакета, повторный пакет с тем же ключом не применяется
+	Strict         bool   // отклонить весь пакет, если в нем есть хотя бы одна некорректная метрика
+}
+
+// ItemResult результат обработки метрики из пакета.
+type ItemResult struct {
+	ID      string `json:"id"`
+	Status  string `json:"status"`
+	Code    string `json:"code,omitempty"`
+	Message string `json:"message,omitempty"`
+	Index   int    `json:"index"`
+}
+
+// BatchResult результат обработки пакета метрик.
+type BatchResult struct {
+	Items        []ItemResult `json:"items"`
+	Accepted     int          `json:"accepted"`
+	Rejected     int          `json:"rejected"`
+	Deduplicated int          `json:"deduplicated"`
+	Dropped      int          `json:"dropped,omitempty"`
+	Replayed     bool         `json:"replayed,omitempty"` // пакет с тем же ключом уже был применен
+	// PayloadHash хеш содержимого пакета, сохраняется вместе с ключом идемпотентности
+	// и не передается клиентам
+	PayloadHash string `json:"payload_hash,omitempty"`
+}
+
+// MetricSelector выбирает метрики по точному имени или по шаблону имени.
+type MetricSelector struct {
+	Name    string // точное имя метрики
+	Pattern string // шаблон имени в синтаксисе path.Match: *, ?, [a-z]
+	MType   string // тип метрики, пустое значение выбирает оба типа
+}
+
+// MetricRef ссылка на метрику по имени и типу.
+type MetricRef struct {
+	ID    string `json:"id"`
+	MType string `json:"type"`
+}
+
+// UpdateTimes время последнего обновления метрик по имени.
+type UpdateTimes struct {
+	Gauges   map[string]time.Time `json:"gauges"`
+	Counters map[string]time.Time `json:"counters"`
+}
+
+// MetricState текущее значение метрики для экспорта.
+type MetricState struct {
+	ID    string
+	MType string
+	Value float64 // значение gauge
+	Delta int64   // значение counter
+	Help  string  // описание метрики из метаданных
+	Stale bool    // метрика не обновлялась дольше заданного для нее срока
+}
+
+// MetricMeta метаданные метрики, зарегистрированные по ее имени.
+// Если задан тип, запись метрики другого типа отклоняется; Min и Max ограничивают
+// записываемое значение gauge или приращение counter.
+type MetricMeta struct {
+	Min   *float64 `json:"min,omitempty"`
+	Max   *float64 `json:"max,omitempty"`
+	Name  string   `json:"name"`
+	Unit  string   `json:"unit,omitempty"`
+	Help  string   `json:"help,omitempty"`
+	MType string   `json:"type,omitempty"`
+}
+
+// Client источник записи метрик: агент и арендатор, которому он принадлежит.
+type Client struct {
+	Agent  string // идентификатор агента, если он передан, иначе имя токена агента или его адрес
+	Tenant string // арендатор из конфигурации токена, пустой для клиентов без арендатора
+}
+
+// CardinalityLimits ограничения на количество различных метрик. Нулевое значение снимает ограничение.
+// Drop отбрасывает новые метрики сверх лимита без ошибки вместо их отклонения.
+type CardinalityLimits struct {
+	PerAgent  int  `json:"per_agent"`
+	PerTenant int  `json:"per_tenant"`
+	Total     int  `json:"total"`
+	Drop      bool `json:"drop"`
+}
+
+// CardinalityState текущее количество различных метрик в целом, по агентам и по арендаторам.
+type CardinalityState struct {
+	Agents   map[string]int    `json:"agents"`
+	Tenants  map[string]int    `json:"tenants"`
+	Limits   CardinalityLimits `json:"limits"`
+	Total    int               `json:"total"`
+	Dropped  int64             `json:"dropped"`  // метрик отброшено с момента запуска
+	Rejected int64             `json:"rejected"` // метрик отклонено с момента запуска
+}
+
+// Действия правил преобразования метрик.
+const (
+	RelabelRename    = "rename"     // переименовать по регулярному выражению, Replacement может ссылаться на группы $1
+	RelabelDrop      = "drop"       // отбросить метрику
+	RelabelPrefix    = "prefix"     // добавить к имени префикс Prefix
+	RelabelScale     = "scale"      // умножить значение на Factor
+	RelabelToCounter = "to_counter" // записать gauge как counter с приращением, равным округленному значению
+)
+
+// RelabelRule правило преобразования метрики при записи. Правило применяется к метрикам,
+// имя которых целиком совпадает с регулярным выражением Match, а тип — с MType, если он задан.
+// Метрики хранятся без меток, поэтому статических меток правила не добавляют: для группировки
+// метрик используется действие prefix.
+type RelabelRule struct {
+	Match       string  `json:"match"`
+	MType       string  `json:"type,omitempty"`
+	Action      string  `json:"action"`
+	Replacement string  `json:"replacement,omitempty"`
+	Prefix      string  `json:"prefix,omitempty"`
+	Factor      float64 `json:"factor,omitempty"`
+}
+
+// SilenceRecord заглушка оповещений в хранилище. Silence содержит заглушку в JSON,
+// хранилище разбирает только ее идентификатор.
+type SilenceRecord struct {
+	ID      string          `json:"id"`
+	Silence json.RawMessage `json:"silence"`
+}
+
+// AlertRecord активное оповещение в хранилище. Key уникален среди активных оповещений,
+// Alert содержит оповещение в JSON.
+type AlertRecord struct {
+	Key   string          `json:"key"`
+	Alert json.RawMessage `json:"alert"`
+}
+
+// TransitionRecord переход оповещения в хранилище. Alert содержит оповещение после перехода в JSON.
+// Если Resolved, оповещение с ключом Key больше не активно, иначе оно добавляется или заменяется.
+type TransitionRecord struct {
+	At       time.Time       `json:"at"`
+	Key      string          `json:"key,omitempty"`
+	Rule     string          `json:"rule,omitempty"`
+	From     string          `json:"from"`
+	To       string          `json:"to"`
+	Alert    json.RawMessage `json:"alert"`
+	Resolved bool            `json:"resolved,omitempty"`
+}
+
+// RuleVersionRecord версия правила оповещений в хранилище. Version содержит версию в JSON.
+type RuleVersionRecord struct {
+	Name    string          `json:"name"`
+	Number  int             `json:"number"`
+	Version json.RawMessage `json:"version"`
+}
@@ -4,3 +4,6 @@ import "errors"
 
 // ErrNotFound используется, когда сущность не найдена в хранилище.
 var ErrNotFound = errors.New("not found")
+
+// ErrConflict используется, когда сущность с тем же ключом уже сохранена.
+var ErrConflict = errors.New("conflict")
@@ -0,0 +1,86 @@
+package rest
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"metricalert/internal/server/core/model"
+)
+
+// renameRequest тело запроса на переименование метрики.
+type renameRequest struct {
+	MType string `json:"type"`
+	From  string `json:"from"`
+	To    string `json:"to"`
+}
+
+// metricSelector разбирает выбор метрик из параметров запроса name, pattern и type.
+func metricSelector(ginCtx *gin.Context) model.MetricSelector {
+	return model.MetricSelector{
+		Name:    ginCtx.Query("name"),
+		Pattern: ginCtx.Query("pattern"),
+		MType:   ginCtx.Query("type"),
+	}
+}
+
+// deleteMetrics удаляет метрики по имени или шаблону имени.
+func (h *handler) deleteMetrics(ginCtx *gin.Context) {
+	sel := metricSelector(ginCtx)
+
+	deleted, err := h.server.DeleteMetrics(ginCtx.Request.Context(), sel)
+	if err != nil {
+		h.writeError(ginCtx, "failed to delete metrics", err)
+		return
+	}
+
+	h.logger.Infof("metrics deleted, selector: %+v, count: %d", sel, len(deleted))
+
+	ginCtx.JSON(http.StatusOK, gin.H{"deleted": deleted})
+}
+
+// resetCounters обнуляет счетчики по имени или шаблону имени.
+func (h *handler) resetCounters(ginCtx *gin.Context) {
+	sel := metricSelector(ginCtx)
+
+	reset, err := h.server.ResetCounters(ginCtx.Request.Context(), sel)
+	if err != nil {
+		h.writeError(ginCtx, "failed to reset counters", err)
+		return
+	}
+
+	h.logger.Infof("counters reset, selector: %+v, count: %d", sel, len(reset))
+
+	ginCtx.JSON(http.StatusOK, gin.H{"reset": reset})
+}
+
+// renameMetric переименовывает метрику.
+func (h *handler) renameMetric(ginCtx *gin.Context) {
+	var request renameRequest
+	if err := ginCtx.ShouldBindJSON(&request); err != nil {
+		h.logger.Errorf("failed to bind json: %v", err)
+		h.invalidBody(ginCtx, err)
+		return
+	}
+
+	err := h.server.RenameMetric(ginCtx.Request.Context(), request.MType, request.From, request.To)
+	if err != nil {
+		h.writeError(ginCtx, "failed to rename metric", err)
+		return
+	}
+
+	h.logger.Infof("metric renamed, type: %s, from: %s, to: %s", request.MType, request.From, request.To)
+
+	ginCtx.JSON(http.StatusOK, model.MetricRef{ID: request.To, MType: request.MType})
+}
+
+// cardinalityState возвращает количество различных метрик в целом, по агентам и по арендаторам.
+func (h *handler) cardinalityState(ginCtx *gin.Context) {
+	state, err := h.server.CardinalityState(ginCtx.Request.Context())
+	if err != nil {
+		h.writeError(ginCtx, "failed to get cardinality state", err)
+		return
+	}
+
+	ginCtx.JSON(http.StatusOK, state)
+}
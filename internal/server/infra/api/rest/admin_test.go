@@ -0,0 +1,185 @@
+//nolint:wrapcheck,nolintlint,errcheck,forcetypeassert
+package rest
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"go.uber.org/zap"
+
+	"metricalert/internal/server/core/application"
+	"metricalert/internal/server/core/model"
+)
+
+func newAdminRouter(server ServerService) *gin.Engine {
+	h := &handler{server: server, logger: *zap.NewNop().Sugar()}
+
+	router := gin.New()
+	router.Use(h.mwJSONErrors())
+	router.DELETE("/admin/metrics", h.deleteMetrics)
+	router.POST("/admin/metrics/reset", h.resetCounters)
+	router.POST("/admin/metrics/rename", h.renameMetric)
+	router.GET("/admin/cardinality", h.cardinalityState)
+	router.GET("/admin/relabel", h.relabelRules)
+	router.POST("/admin/relabel/reload", h.reloadRelabelRules)
+
+	return router
+}
+
+func TestServerAPI_AdminMetrics(t *testing.T) {
+	tests := []struct {
+		setup  func(m *MockServerService)
+		name   string
+		method string
+		path   string
+		body   string
+		want   string
+		status int
+	}{
+		{
+			name:   "delete by pattern",
+			method: http.MethodDelete,
+			path:   "/admin/metrics?pattern=cpu_*",
+			setup: func(m *MockServerService) {
+				m.On("DeleteMetrics", mock.Anything, model.MetricSelector{Pattern: "cpu_*"}).
+					Return([]model.MetricRef{{ID: "cpu_user", MType: "gauge"}}, nil)
+			},
+			status: http.StatusOK,
+			want:   `{"deleted":[{"id":"cpu_user","type":"gauge"}]}`,
+		},
+		{
+			name:   "delete by name not found",
+			method: http.MethodDelete,
+			path:   "/admin/metrics?name=missing&type=gauge",
+			setup: func(m *MockServerService) {
+				m.On("DeleteMetrics", mock.Anything, model.MetricSelector{Name: "missing", MType: "gauge"}).
+					Return([]model.MetricRef(nil), application.ErrNotFound)
+			},
+			status: http.StatusNotFound,
+		},
+		{
+			name:   "reset counters",
+			method: http.MethodPost,
+			path:   "/admin/metrics/reset?name=requests",
+			setup: func(m *MockServerService) {
+				m.On("ResetCounters", mock.Anything, model.MetricSelector{Name: "requests"}).
+					Return([]model.MetricRef{{ID: "requests", MType: "counter"}}, nil)
+			},
+			status: http.StatusOK,
+			want:   `{"reset":[{"id":"requests","type":"counter"}]}`,
+		},
+		{
+			name:   "reset invalid selector",
+			method: http.MethodPost,
+			path:   "/admin/metrics/reset",
+			setup: func(m *MockServerService) {
+				m.On("ResetCounters", mock.Anything, model.MetricSelector{}).
+					Return([]model.MetricRef(nil), application.ErrBadRequest)
+			},
+			status: http.StatusBadRequest,
+		},
+		{
+			name:   "rename",
+			method: http.MethodPost,
+			path:   "/admin/metrics/rename",
+			body:   `{"type":"gauge","from":"old","to":"new"}`,
+			setup: func(m *MockServerService) {
+				m.On("RenameMetric", mock.Anything, "gauge", "old", "new").Return(nil)
+			},
+			status: http.StatusOK,
+			want:   `{"id":"new","type":"gauge"}`,
+		},
+		{
+			name:   "rename conflict",
+			method: http.MethodPost,
+			path:   "/admin/metrics/rename",
+			body:   `{"type":"gauge","from":"old","to":"new"}`,
+			setup: func(m *MockServerService) {
+				m.On("RenameMetric", mock.Anything, "gauge", "old", "new").Return(application.ErrConflict)
+			},
+			status: http.StatusConflict,
+		},
+		{
+			name:   "cardinality",
+			method: http.MethodGet,
+			path:   "/admin/cardinality",
+			setup: func(m *MockServerService) {
+				m.On("CardinalityState", mock.Anything).Return(model.CardinalityState{
+					Limits:  model.CardinalityLimits{PerAgent: 10},
+					Total:   3,
+					Agents:  map[string]int{"token:agent": 2},
+					Tenants: map[string]int{},
+					Dropped: 1,
+				}, nil)
+			},
+			status: http.StatusOK,
+			want: `{"limits":{"per_agent":10,"per_tenant":0,"total":0,"drop":false},"total":3,
+				"agents":{"token:agent":2},"tenants":{},"dropped":1,"rejected":0}`,
+		},
+		{
+			name:   "relabel rules",
+			method: http.MethodGet,
+			path:   "/admin/relabel",
+			setup: func(m *MockServerService) {
+				m.On("RelabelRules", mock.Anything).
+					Return([]model.RelabelRule{{Match: "debug_.*", Action: model.RelabelDrop}}, nil)
+			},
+			status: http.StatusOK,
+			want:   `{"rules":[{"match":"debug_.*","action":"drop"}]}`,
+		},
+		{
+			name:   "relabel reload",
+			method: http.MethodPost,
+			path:   "/admin/relabel/reload",
+			setup: func(m *MockServerService) {
+				m.On("ReloadRelabelRules", mock.Anything).
+					Return([]model.RelabelRule{{Match: ".*_bytes", Action: model.RelabelScale, Factor: 0.5}}, nil)
+			},
+			status: http.StatusOK,
+			want:   `{"rules":[{"match":".*_bytes","action":"scale","factor":0.5}]}`,
+		},
+		{
+			name:   "relabel reload invalid rules",
+			method: http.MethodPost,
+			path:   "/admin/relabel/reload",
+			setup: func(m *MockServerService) {
+				m.On("ReloadRelabelRules", mock.Anything).Return([]model.RelabelRule(nil), &application.Error{
+					Kind: application.ErrBadRequest, Code: application.CodeBadRelabel, Message: "relabel rule 0: empty match",
+				})
+			},
+			status: http.StatusBadRequest,
+		},
+		{
+			name:   "rename invalid body",
+			method: http.MethodPost,
+			path:   "/admin/metrics/rename",
+			body:   `{`,
+			setup:  func(*MockServerService) {},
+			status: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockServerService := new(MockServerService)
+			tt.setup(mockServerService)
+
+			recorder := httptest.NewRecorder()
+			newAdminRouter(mockServerService).ServeHTTP(recorder,
+				httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body)))
+
+			assert.Equal(t, tt.status, recorder.Code)
+
+			if tt.want != "" {
+				assert.JSONEq(t, tt.want, recorder.Body.String())
+			}
+
+			mockServerService.AssertExpectations(t)
+		})
+	}
+}
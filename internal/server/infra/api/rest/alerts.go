@@ -0,0 +1,287 @@
+package rest
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"metricalert/internal/server/core/alerting"
+	"metricalert/internal/server/infra/auth"
+)
+
+// Размер страницы журнала оповещений.
+const (
+	defaultHistoryLimit = 50
+	maxHistoryLimit     = 500
+)
+
+// AlertService интерфейс для работы с оповещениями.
+type AlertService interface {
+	Alerts(ctx context.Context) ([]alerting.Alert, error)
+	History(ctx context.Context, offset, limit int) (alerting.History, error)
+	Agents(ctx context.Context, silent bool) ([]alerting.AgentStatus, error)
+	Silences(ctx context.Context) ([]alerting.Silence, error)
+	Silence(ctx context.Context, id string) (alerting.Silence, error)
+	CreateSilence(ctx context.Context, silence alerting.Silence) (alerting.Silence, error)
+	UpdateSilence(ctx context.Context, silence alerting.Silence) (alerting.Silence, error)
+	DeleteSilence(ctx context.Context, id string) error
+	Groups(ctx context.Context) ([]alerting.Group, error)
+	Acknowledge(ctx context.Context, id, by string) (alerting.Group, error)
+	Rules(ctx context.Context) ([]alerting.RuleVersion, error)
+	Rule(ctx context.Context, name string) (alerting.RuleVersion, error)
+	RuleVersions(ctx context.Context, name string) ([]alerting.RuleVersion, error)
+	CreateRule(ctx context.Context, rule alerting.Rule, by string) (alerting.RuleVersion, error)
+	UpdateRule(ctx context.Context, rule alerting.Rule, version int, by string) (alerting.RuleVersion, error)
+	DeleteRule(ctx context.Context, name string, version int, by string) error
+	EvaluateRule(ctx context.Context, rule alerting.Rule) ([]alerting.RuleResult, error)
+}
+
+// acknowledgeRequest необязательное тело запроса подтверждения группы оповещений.
+type acknowledgeRequest struct {
+	AcknowledgedBy string `json:"acknowledged_by"`
+}
+
+// requireAlerts проверяет, что оповещения настроены. Иначе отправляет ответ 503 и возвращает false.
+func (h *handler) requireAlerts(ginCtx *gin.Context) bool {
+	if h.alerts == nil {
+		h.abort(ginCtx, http.StatusServiceUnavailable, codeUnavailable, "alerting is not configured")
+		return false
+	}
+
+	return true
+}
+
+// listAlerts возвращает активные оповещения и страницу журнала переходов от новых к старым.
+// Страница задается параметрами offset и limit.
+func (h *handler) listAlerts(ginCtx *gin.Context) {
+	offset, err := queryInt(ginCtx, "offset", 0)
+	if err != nil || offset < 0 {
+		h.abort(ginCtx, http.StatusBadRequest, codeInvalidValue, "invalid offset parameter")
+		return
+	}
+
+	limit, err := queryInt(ginCtx, "limit", defaultHistoryLimit)
+	if err != nil || limit <= 0 || limit > maxHistoryLimit {
+		h.abort(ginCtx, http.StatusBadRequest, codeInvalidValue,
+			"limit must be between 1 and "+strconv.Itoa(maxHistoryLimit))
+
+		return
+	}
+
+	var (
+		ctx     = ginCtx.Request.Context()
+		active  = []alerting.Alert{}
+		history = alerting.History{Transitions: []alerting.Transition{}, Offset: offset, Limit: limit}
+	)
+
+	if h.alerts != nil {
+		if active, err = h.alerts.Alerts(ctx); err != nil {
+			h.writeError(ginCtx, "failed to get alerts", err)
+			return
+		}
+
+		if history, err = h.alerts.History(ctx, offset, limit); err != nil {
+			h.writeError(ginCtx, "failed to get alert history", err)
+			return
+		}
+	}
+
+	ginCtx.JSON(http.StatusOK, gin.H{"active": active, "history": history})
+}
+
+func queryInt(ginCtx *gin.Context, name string, fallback int) (int, error) {
+	value := ginCtx.Query(name)
+	if value == "" {
+		return fallback, nil
+	}
+
+	return strconv.Atoi(value) //nolint:wrapcheck // ошибка заменяется ответом 400
+}
+
+// agents возвращает время последнего отчета агентов. С параметром silent=true возвращаются
+// только агенты, по которым активно оповещение об отсутствии отчетов.
+func (h *handler) agents(ginCtx *gin.Context) {
+	var silent bool
+	if value := ginCtx.Query("silent"); value != "" {
+		var err error
+		if silent, err = strconv.ParseBool(value); err != nil {
+			h.abort(ginCtx, http.StatusBadRequest, codeInvalidValue, "invalid silent parameter")
+			return
+		}
+	}
+
+	agents := []alerting.AgentStatus{}
+	if h.alerts != nil {
+		var err error
+		if agents, err = h.alerts.Agents(ginCtx.Request.Context(), silent); err != nil {
+			h.writeError(ginCtx, "failed to get agents", err)
+			return
+		}
+	}
+
+	ginCtx.JSON(http.StatusOK, gin.H{"agents": agents})
+}
+
+// listSilences возвращает заглушки оповещений и окна обслуживания.
+func (h *handler) listSilences(ginCtx *gin.Context) {
+	silences := []alerting.Silence{}
+	if h.alerts != nil {
+		var err error
+		if silences, err = h.alerts.Silences(ginCtx.Request.Context()); err != nil {
+			h.writeError(ginCtx, "failed to get silences", err)
+			return
+		}
+	}
+
+	ginCtx.JSON(http.StatusOK, gin.H{"silences": silences})
+}
+
+// getSilence возвращает заглушку по идентификатору.
+func (h *handler) getSilence(ginCtx *gin.Context) {
+	if !h.requireAlerts(ginCtx) {
+		return
+	}
+
+	silence, err := h.alerts.Silence(ginCtx.Request.Context(), ginCtx.Param("id"))
+	if err != nil {
+		h.writeError(ginCtx, "failed to get silence", err)
+		return
+	}
+
+	ginCtx.JSON(http.StatusOK, silence)
+}
+
+// createSilence создает заглушку. При включенной аутентификации автором всегда становится
+// владелец токена, а не указанный в теле запроса.
+func (h *handler) createSilence(ginCtx *gin.Context) {
+	if !h.requireAlerts(ginCtx) {
+		return
+	}
+
+	silence, ok := h.bindSilence(ginCtx)
+	if !ok {
+		return
+	}
+
+	if identity, ok := auth.IdentityFromContext(ginCtx.Request.Context()); ok {
+		silence.CreatedBy = identity.Name
+	}
+
+	silence, err := h.alerts.CreateSilence(ginCtx.Request.Context(), silence)
+	if err != nil {
+		h.writeError(ginCtx, "failed to create silence", err)
+		return
+	}
+
+	h.logger.Infof("silence created, id: %s, by: %s", silence.ID, silence.CreatedBy)
+
+	ginCtx.JSON(http.StatusCreated, silence)
+}
+
+// updateSilence заменяет заглушку, например чтобы продлить или досрочно завершить ее.
+// При включенной аутентификации автор заглушки не меняется.
+func (h *handler) updateSilence(ginCtx *gin.Context) {
+	if !h.requireAlerts(ginCtx) {
+		return
+	}
+
+	silence, ok := h.bindSilence(ginCtx)
+	if !ok {
+		return
+	}
+
+	silence.ID = ginCtx.Param("id")
+
+	if _, ok := auth.IdentityFromContext(ginCtx.Request.Context()); ok {
+		silence.CreatedBy = ""
+	}
+
+	silence, err := h.alerts.UpdateSilence(ginCtx.Request.Context(), silence)
+	if err != nil {
+		h.writeError(ginCtx, "failed to update silence", err)
+		return
+	}
+
+	h.logger.Infof("silence updated, id: %s", silence.ID)
+
+	ginCtx.JSON(http.StatusOK, silence)
+}
+
+// deleteSilence удаляет заглушку.
+func (h *handler) deleteSilence(ginCtx *gin.Context) {
+	if !h.requireAlerts(ginCtx) {
+		return
+	}
+
+	id := ginCtx.Param("id")
+
+	if err := h.alerts.DeleteSilence(ginCtx.Request.Context(), id); err != nil {
+		h.writeError(ginCtx, "failed to delete silence", err)
+		return
+	}
+
+	h.logger.Infof("silence deleted, id: %s", id)
+
+	ginCtx.Status(http.StatusNoContent)
+}
+
+// listGroups возвращает группы срабатывающих оповещений, по которым отправляются уведомления.
+func (h *handler) listGroups(ginCtx *gin.Context) {
+	groups := []alerting.Group{}
+	if h.alerts != nil {
+		var err error
+		if groups, err = h.alerts.Groups(ginCtx.Request.Context()); err != nil {
+			h.writeError(ginCtx, "failed to get alert groups", err)
+			return
+		}
+	}
+
+	ginCtx.JSON(http.StatusOK, gin.H{"groups": groups})
+}
+
+// acknowledgeGroup подтверждает группу оповещений, останавливая повторы и эскалацию уведомлений.
+// При включенной аутентификации автором всегда становится владелец токена, а не указанный
+// в теле запроса.
+func (h *handler) acknowledgeGroup(ginCtx *gin.Context) {
+	if !h.requireAlerts(ginCtx) {
+		return
+	}
+
+	var request acknowledgeRequest
+	if ginCtx.Request.ContentLength != 0 {
+		if err := ginCtx.ShouldBindJSON(&request); err != nil {
+			h.logger.Errorf("failed to bind json: %v", err)
+			h.invalidBody(ginCtx, err)
+
+			return
+		}
+	}
+
+	if identity, ok := auth.IdentityFromContext(ginCtx.Request.Context()); ok {
+		request.AcknowledgedBy = identity.Name
+	}
+
+	group, err := h.alerts.Acknowledge(ginCtx.Request.Context(), ginCtx.Param("id"), request.AcknowledgedBy)
+	if err != nil {
+		h.writeError(ginCtx, "failed to acknowledge alert group", err)
+		return
+	}
+
+	h.logger.Infof("alert group acknowledged, id: %s, by: %s", group.ID, group.AcknowledgedBy)
+
+	ginCtx.JSON(http.StatusOK, group)
+}
+
+func (h *handler) bindSilence(ginCtx *gin.Context) (alerting.Silence, bool) {
+	var silence alerting.Silence
+	if err := ginCtx.ShouldBindJSON(&silence); err != nil {
+		h.logger.Errorf("failed to bind json: %v", err)
+		h.invalidBody(ginCtx, err)
+
+		return silence, false
+	}
+
+	return silence, true
+}
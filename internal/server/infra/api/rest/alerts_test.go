@@ -0,0 +1,478 @@
+//nolint:wrapcheck,nolintlint,errcheck,forcetypeassert
+package rest
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"go.uber.org/zap"
+
+	"metricalert/internal/server/core/alerting"
+	"metricalert/internal/server/infra/auth"
+)
+
+type MockAlertService struct {
+	mock.Mock
+}
+
+func (m *MockAlertService) Alerts(ctx context.Context) ([]alerting.Alert, error) {
+	args := m.Called(ctx)
+	return args.Get(0).([]alerting.Alert), args.Error(1)
+}
+
+func (m *MockAlertService) History(ctx context.Context, offset, limit int) (alerting.History, error) {
+	args := m.Called(ctx, offset, limit)
+	return args.Get(0).(alerting.History), args.Error(1)
+}
+
+func (m *MockAlertService) Agents(ctx context.Context, silent bool) ([]alerting.AgentStatus, error) {
+	args := m.Called(ctx, silent)
+	return args.Get(0).([]alerting.AgentStatus), args.Error(1)
+}
+
+func (m *MockAlertService) Silences(ctx context.Context) ([]alerting.Silence, error) {
+	args := m.Called(ctx)
+	return args.Get(0).([]alerting.Silence), args.Error(1)
+}
+
+func (m *MockAlertService) Silence(ctx context.Context, id string) (alerting.Silence, error) {
+	args := m.Called(ctx, id)
+	return args.Get(0).(alerting.Silence), args.Error(1)
+}
+
+func (m *MockAlertService) CreateSilence(ctx context.Context, silence alerting.Silence) (alerting.Silence, error) {
+	args := m.Called(ctx, silence)
+	return args.Get(0).(alerting.Silence), args.Error(1)
+}
+
+func (m *MockAlertService) UpdateSilence(ctx context.Context, silence alerting.Silence) (alerting.Silence, error) {
+	args := m.Called(ctx, silence)
+	return args.Get(0).(alerting.Silence), args.Error(1)
+}
+
+func (m *MockAlertService) DeleteSilence(ctx context.Context, id string) error {
+	return m.Called(ctx, id).Error(0)
+}
+
+func (m *MockAlertService) Groups(ctx context.Context) ([]alerting.Group, error) {
+	args := m.Called(ctx)
+	return args.Get(0).([]alerting.Group), args.Error(1)
+}
+
+func (m *MockAlertService) Acknowledge(ctx context.Context, id, by string) (alerting.Group, error) {
+	args := m.Called(ctx, id, by)
+	return args.Get(0).(alerting.Group), args.Error(1)
+}
+
+func (m *MockAlertService) Rules(ctx context.Context) ([]alerting.RuleVersion, error) {
+	args := m.Called(ctx)
+	return args.Get(0).([]alerting.RuleVersion), args.Error(1)
+}
+
+func (m *MockAlertService) Rule(ctx context.Context, name string) (alerting.RuleVersion, error) {
+	args := m.Called(ctx, name)
+	return args.Get(0).(alerting.RuleVersion), args.Error(1)
+}
+
+func (m *MockAlertService) RuleVersions(ctx context.Context, name string) ([]alerting.RuleVersion, error) {
+	args := m.Called(ctx, name)
+	return args.Get(0).([]alerting.RuleVersion), args.Error(1)
+}
+
+func (m *MockAlertService) CreateRule(ctx context.Context, rule alerting.Rule, by string) (alerting.RuleVersion, error) {
+	args := m.Called(ctx, rule, by)
+	return args.Get(0).(alerting.RuleVersion), args.Error(1)
+}
+
+func (m *MockAlertService) UpdateRule(ctx context.Context, rule alerting.Rule, version int,
+	by string) (alerting.RuleVersion, error) {
+	args := m.Called(ctx, rule, version, by)
+	return args.Get(0).(alerting.RuleVersion), args.Error(1)
+}
+
+func (m *MockAlertService) DeleteRule(ctx context.Context, name string, version int, by string) error {
+	return m.Called(ctx, name, version, by).Error(0)
+}
+
+func (m *MockAlertService) EvaluateRule(ctx context.Context, rule alerting.Rule) ([]alerting.RuleResult, error) {
+	args := m.Called(ctx, rule)
+	return args.Get(0).([]alerting.RuleResult), args.Error(1)
+}
+
+func TestServerAPI_SilenceAuthor(t *testing.T) {
+	matchers := []alerting.Matcher{{Name: "rule", Value: "high_cpu"}}
+
+	alerts := new(MockAlertService)
+	alerts.On("CreateSilence", mock.Anything, alerting.Silence{Matchers: matchers, CreatedBy: "ci"}).
+		Return(alerting.Silence{ID: "a1", Matchers: matchers, CreatedBy: "ci"}, nil)
+	alerts.On("UpdateSilence", mock.Anything, alerting.Silence{ID: "a1", Matchers: matchers}).
+		Return(alerting.Silence{ID: "a1", Matchers: matchers, CreatedBy: "ci"}, nil)
+
+	ctx := auth.WithIdentity(context.Background(), &auth.Identity{Name: "ci"})
+	body := `{"matchers":[{"name":"rule","value":"high_cpu"}],"created_by":"someone-else"}`
+
+	// автор из тела запроса заменяется владельцем токена
+	req := httptest.NewRequest(http.MethodPost, "/alerts/silences", strings.NewReader(body)).WithContext(ctx)
+	recorder := httptest.NewRecorder()
+	newAlertsRouter(alerts).ServeHTTP(recorder, req)
+	assert.Equal(t, http.StatusCreated, recorder.Code)
+
+	// при замене заглушки автор сохраняется прежним
+	req = httptest.NewRequest(http.MethodPut, "/alerts/silences/a1", strings.NewReader(body)).WithContext(ctx)
+	recorder = httptest.NewRecorder()
+	newAlertsRouter(alerts).ServeHTTP(recorder, req)
+	assert.Equal(t, http.StatusOK, recorder.Code)
+
+	alerts.AssertExpectations(t)
+}
+
+func TestServerAPI_AcknowledgeAuthor(t *testing.T) {
+	alerts := new(MockAlertService)
+	alerts.On("Acknowledge", mock.Anything, "9f1c", "ci").
+		Return(alerting.Group{ID: "9f1c", AcknowledgedBy: "ci", Alerts: []alerting.Alert{}}, nil)
+
+	req := httptest.NewRequest(http.MethodPost, "/alerts/groups/9f1c/ack",
+		strings.NewReader(`{"acknowledged_by":"someone-else"}`))
+	req = req.WithContext(auth.WithIdentity(context.Background(), &auth.Identity{Name: "ci"}))
+
+	recorder := httptest.NewRecorder()
+	newAlertsRouter(alerts).ServeHTTP(recorder, req)
+
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	alerts.AssertExpectations(t)
+}
+
+func newAlertsRouter(alerts AlertService) *gin.Engine {
+	h := &handler{alerts: alerts, logger: *zap.NewNop().Sugar()}
+
+	router := gin.New()
+	router.Use(h.mwJSONErrors())
+	router.GET("/alerts", h.listAlerts)
+	router.GET("/agents", h.agents)
+	router.GET("/alerts/silences", h.listSilences)
+	router.GET("/alerts/silences/:id", h.getSilence)
+	router.POST("/alerts/silences", h.createSilence)
+	router.PUT("/alerts/silences/:id", h.updateSilence)
+	router.DELETE("/alerts/silences/:id", h.deleteSilence)
+	router.GET("/alerts/groups", h.listGroups)
+	router.POST("/alerts/groups/:id/ack", h.acknowledgeGroup)
+	router.GET("/alerts/rules", h.listRules)
+	router.GET("/alerts/rules/:name", h.getRule)
+	router.GET("/alerts/rules/:name/versions", h.ruleVersions)
+	router.POST("/alerts/rules", h.createRule)
+	router.PUT("/alerts/rules/:name", h.updateRule)
+	router.DELETE("/alerts/rules/:name", h.deleteRule)
+	router.POST("/alerts/rules/evaluate", h.evaluateRule)
+	router.GET("/alerts/ui", h.rulesUI)
+
+	return router
+}
+
+func TestServerAPI_Alerts(t *testing.T) {
+	lastSeen := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		setup  func(m *MockAlertService)
+		name   string
+		method string
+		path   string
+		body   string
+		want   string
+		status int
+	}{
+		{
+			name:   "alerts",
+			method: http.MethodGet,
+			path:   "/alerts?offset=1&limit=1",
+			setup: func(m *MockAlertService) {
+				alert := alerting.Alert{
+					Rule: "high_cpu", Metric: "cpu", MType: "gauge", State: alerting.StateFiring, Value: 95,
+					ActiveAt: lastSeen, FiredAt: lastSeen,
+				}
+				m.On("Alerts", mock.Anything).Return([]alerting.Alert{alert}, nil)
+				m.On("History", mock.Anything, 1, 1).Return(alerting.History{
+					Transitions: []alerting.Transition{
+						{At: lastSeen, From: alerting.StateInactive, To: alerting.StatePending, Alert: alert},
+					},
+					Total: 2, Offset: 1, Limit: 1,
+				}, nil)
+			},
+			status: http.StatusOK,
+			want: `{"active":[{"rule":"high_cpu","metric":"cpu","type":"gauge","state":"firing","value":95,
+				"active_at":"2024-01-01T00:00:00Z","fired_at":"2024-01-01T00:00:00Z"}],
+				"history":{"transitions":[{"at":"2024-01-01T00:00:00Z","from":"inactive","to":"pending",
+				"alert":{"rule":"high_cpu","metric":"cpu","type":"gauge","state":"firing","value":95,
+				"active_at":"2024-01-01T00:00:00Z","fired_at":"2024-01-01T00:00:00Z"}}],
+				"total":2,"offset":1,"limit":1}}`,
+		},
+		{
+			name:   "alerts default page",
+			method: http.MethodGet,
+			path:   "/alerts",
+			setup: func(m *MockAlertService) {
+				m.On("Alerts", mock.Anything).Return([]alerting.Alert{}, nil)
+				m.On("History", mock.Anything, 0, 50).Return(alerting.History{Transitions: []alerting.Transition{}, Limit: 50}, nil)
+			},
+			status: http.StatusOK,
+			want:   `{"active":[],"history":{"transitions":[],"total":0,"offset":0,"limit":50}}`,
+		},
+		{
+			name:   "alerts invalid limit",
+			method: http.MethodGet,
+			path:   "/alerts?limit=1000",
+			setup:  func(*MockAlertService) {},
+			status: http.StatusBadRequest,
+		},
+		{
+			name:   "alerts invalid offset",
+			method: http.MethodGet,
+			path:   "/alerts?offset=-1",
+			setup:  func(*MockAlertService) {},
+			status: http.StatusBadRequest,
+		},
+		{
+			name:   "alerts history error",
+			method: http.MethodGet,
+			path:   "/alerts",
+			setup: func(m *MockAlertService) {
+				m.On("Alerts", mock.Anything).Return([]alerting.Alert{}, nil)
+				m.On("History", mock.Anything, 0, 50).Return(alerting.History{}, errors.New("boom"))
+			},
+			status: http.StatusInternalServerError,
+		},
+		{
+			name:   "agents",
+			method: http.MethodGet,
+			path:   "/agents",
+			setup: func(m *MockAlertService) {
+				m.On("Agents", mock.Anything, false).Return([]alerting.AgentStatus{
+					{Agent: "ip:10.0.0.1", LastSeen: lastSeen},
+				}, nil)
+			},
+			status: http.StatusOK,
+			want:   `{"agents":[{"agent":"ip:10.0.0.1","last_seen":"2024-01-01T00:00:00Z","silent":false}]}`,
+		},
+		{
+			name:   "silent agents",
+			method: http.MethodGet,
+			path:   "/agents?silent=true",
+			setup: func(m *MockAlertService) {
+				m.On("Agents", mock.Anything, true).Return([]alerting.AgentStatus{
+					{Agent: "ip:10.0.0.2", LastSeen: lastSeen, Rules: []string{"agent_down"}, Silent: true},
+				}, nil)
+			},
+			status: http.StatusOK,
+			want: `{"agents":[{"agent":"ip:10.0.0.2","last_seen":"2024-01-01T00:00:00Z",
+				"rules":["agent_down"],"silent":true}]}`,
+		},
+		{
+			name:   "invalid silent",
+			method: http.MethodGet,
+			path:   "/agents?silent=maybe",
+			setup:  func(*MockAlertService) {},
+			status: http.StatusBadRequest,
+		},
+		{
+			name:   "agents error",
+			method: http.MethodGet,
+			path:   "/agents",
+			setup: func(m *MockAlertService) {
+				m.On("Agents", mock.Anything, false).Return([]alerting.AgentStatus(nil), errors.New("boom"))
+			},
+			status: http.StatusInternalServerError,
+		},
+		{
+			name:   "list silences",
+			method: http.MethodGet,
+			path:   "/alerts/silences",
+			setup: func(m *MockAlertService) {
+				m.On("Silences", mock.Anything).Return([]alerting.Silence{{
+					ID: "a1", Matchers: []alerting.Matcher{{Name: "rule", Value: "high_cpu"}}, CreatedBy: "ops",
+					StartsAt: lastSeen, EndsAt: lastSeen.Add(time.Hour), CreatedAt: lastSeen,
+				}}, nil)
+			},
+			status: http.StatusOK,
+			want: `{"silences":[{"id":"a1","matchers":[{"name":"rule","value":"high_cpu"}],"created_by":"ops",
+				"starts_at":"2024-01-01T00:00:00Z","ends_at":"2024-01-01T01:00:00Z","created_at":"2024-01-01T00:00:00Z"}]}`,
+		},
+		{
+			name:   "create maintenance window",
+			method: http.MethodPost,
+			path:   "/alerts/silences",
+			body: `{"matchers":[{"name":"metric","value":"db_*"}],"created_by":"ops","comment":"nightly backup",
+				"schedule":"0 2 * * *","duration":"1h"}`,
+			setup: func(m *MockAlertService) {
+				silence := alerting.Silence{
+					Matchers: []alerting.Matcher{{Name: "metric", Value: "db_*"}}, CreatedBy: "ops",
+					Comment: "nightly backup", Schedule: "0 2 * * *", Duration: alerting.Duration(time.Hour),
+				}
+				created := silence
+				created.ID = "b2"
+				m.On("CreateSilence", mock.Anything, silence).Return(created, nil)
+			},
+			status: http.StatusCreated,
+			want: `{"id":"b2","matchers":[{"name":"metric","value":"db_*"}],"created_by":"ops",
+				"comment":"nightly backup","schedule":"0 2 * * *","duration":"1h0m0s"}`,
+		},
+		{
+			name:   "create invalid silence",
+			method: http.MethodPost,
+			path:   "/alerts/silences",
+			body:   `{"matchers":[],"created_by":"ops"}`,
+			setup: func(m *MockAlertService) {
+				m.On("CreateSilence", mock.Anything, mock.Anything).Return(alerting.Silence{}, alerting.ErrInvalidSilence)
+			},
+			status: http.StatusBadRequest,
+		},
+		{
+			name:   "create invalid body",
+			method: http.MethodPost,
+			path:   "/alerts/silences",
+			body:   `{"duration":5}`,
+			setup:  func(*MockAlertService) {},
+			status: http.StatusBadRequest,
+		},
+		{
+			name:   "update silence",
+			method: http.MethodPut,
+			path:   "/alerts/silences/a1",
+			body:   `{"matchers":[{"name":"rule","value":"*"}],"ends_at":"2024-01-01T02:00:00Z"}`,
+			setup: func(m *MockAlertService) {
+				silence := alerting.Silence{
+					ID: "a1", Matchers: []alerting.Matcher{{Name: "rule", Value: "*"}}, EndsAt: lastSeen.Add(2 * time.Hour),
+				}
+				m.On("UpdateSilence", mock.Anything, silence).Return(silence, nil)
+			},
+			status: http.StatusOK,
+			want:   `{"id":"a1","matchers":[{"name":"rule","value":"*"}],"created_by":"","ends_at":"2024-01-01T02:00:00Z"}`,
+		},
+		{
+			name:   "get missing silence",
+			method: http.MethodGet,
+			path:   "/alerts/silences/x",
+			setup: func(m *MockAlertService) {
+				m.On("Silence", mock.Anything, "x").Return(alerting.Silence{}, alerting.ErrNotFound)
+			},
+			status: http.StatusNotFound,
+		},
+		{
+			name:   "delete silence",
+			method: http.MethodDelete,
+			path:   "/alerts/silences/a1",
+			setup: func(m *MockAlertService) {
+				m.On("DeleteSilence", mock.Anything, "a1").Return(nil)
+			},
+			status: http.StatusNoContent,
+		},
+		{
+			name:   "list groups",
+			method: http.MethodGet,
+			path:   "/alerts/groups",
+			setup: func(m *MockAlertService) {
+				m.On("Groups", mock.Anything).Return([]alerting.Group{{
+					ID: "9f1c", Labels: map[string]string{"rule": "high_cpu"}, FiringSince: lastSeen, NotifiedAt: lastSeen,
+					Alerts: []alerting.Alert{{Rule: "high_cpu", Metric: "cpu", State: alerting.StateFiring, ActiveAt: lastSeen}},
+					Tiers:  1,
+				}}, nil)
+			},
+			status: http.StatusOK,
+			want: `{"groups":[{"id":"9f1c","labels":{"rule":"high_cpu"},"firing_since":"2024-01-01T00:00:00Z",
+				"notified_at":"2024-01-01T00:00:00Z","tiers":1,
+				"alerts":[{"rule":"high_cpu","metric":"cpu","state":"firing","value":0,"active_at":"2024-01-01T00:00:00Z"}]}]}`,
+		},
+		{
+			name:   "acknowledge group",
+			method: http.MethodPost,
+			path:   "/alerts/groups/9f1c/ack",
+			body:   `{"acknowledged_by":"alice"}`,
+			setup: func(m *MockAlertService) {
+				m.On("Acknowledge", mock.Anything, "9f1c", "alice").Return(alerting.Group{
+					ID: "9f1c", Labels: map[string]string{"rule": "high_cpu"}, FiringSince: lastSeen,
+					AcknowledgedAt: lastSeen, AcknowledgedBy: "alice", Alerts: []alerting.Alert{},
+				}, nil)
+			},
+			status: http.StatusOK,
+			want: `{"id":"9f1c","labels":{"rule":"high_cpu"},"firing_since":"2024-01-01T00:00:00Z",
+				"acknowledged_at":"2024-01-01T00:00:00Z","acknowledged_by":"alice","tiers":0,"alerts":[]}`,
+		},
+		{
+			name:   "acknowledge without body",
+			method: http.MethodPost,
+			path:   "/alerts/groups/9f1c/ack",
+			setup: func(m *MockAlertService) {
+				m.On("Acknowledge", mock.Anything, "9f1c", "").Return(alerting.Group{ID: "9f1c"}, nil)
+			},
+			status: http.StatusOK,
+		},
+		{
+			name:   "acknowledge missing group",
+			method: http.MethodPost,
+			path:   "/alerts/groups/x/ack",
+			setup: func(m *MockAlertService) {
+				m.On("Acknowledge", mock.Anything, "x", "").Return(alerting.Group{}, alerting.ErrNotFound)
+			},
+			status: http.StatusNotFound,
+		},
+		{
+			name:   "acknowledge invalid body",
+			method: http.MethodPost,
+			path:   "/alerts/groups/9f1c/ack",
+			body:   `{"acknowledged_by":1}`,
+			setup:  func(*MockAlertService) {},
+			status: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			alerts := new(MockAlertService)
+			tt.setup(alerts)
+
+			recorder := httptest.NewRecorder()
+			newAlertsRouter(alerts).ServeHTTP(recorder,
+				httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body)))
+
+			assert.Equal(t, tt.status, recorder.Code)
+
+			if tt.want != "" {
+				assert.JSONEq(t, tt.want, recorder.Body.String())
+			}
+
+			alerts.AssertExpectations(t)
+		})
+	}
+}
+
+func TestServerAPI_AlertsNotConfigured(t *testing.T) {
+	recorder := httptest.NewRecorder()
+	newAlertsRouter(nil).ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/agents", nil))
+
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.JSONEq(t, `{"agents":[]}`, recorder.Body.String())
+
+	recorder = httptest.NewRecorder()
+	newAlertsRouter(nil).ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/alerts", nil))
+
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.JSONEq(t, `{"active":[],"history":{"transitions":[],"total":0,"offset":0,"limit":50}}`,
+		recorder.Body.String())
+
+	recorder = httptest.NewRecorder()
+	newAlertsRouter(nil).ServeHTTP(recorder, httptest.NewRequest(http.MethodDelete, "/alerts/silences/a1", nil))
+
+	assert.Equal(t, http.StatusServiceUnavailable, recorder.Code)
+
+	recorder = httptest.NewRecorder()
+	newAlertsRouter(nil).ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/alerts/groups", nil))
+
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.JSONEq(t, `{"groups":[]}`, recorder.Body.String())
+}
@@ -0,0 +1,107 @@
+package rest
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"metricalert/internal/server/core/model"
+)
+
+// defaultBatchChunkSize размер части пакета по умолчанию.
+const defaultBatchChunkSize = 1000
+
+// chunkSize возвращает размер части пакета или потока метрик.
+func (h *handler) chunkSize() int {
+	if h.batchChunkSize <= 0 {
+		return defaultBatchChunkSize
+	}
+
+	return h.batchChunkSize
+}
+
+// batchDecoder потоково читает JSON-массив метрик частями,
+// не загружая весь пакет в память.
+type batchDecoder struct {
+	dec     *json.Decoder
+	read    int
+	started bool
+	done    bool
+}
+
+func newBatchDecoder(r io.Reader) *batchDecoder {
+	return &batchDecoder{dec: json.NewDecoder(r)}
+}
+
+// next читает очередную часть пакета размером не больше size, size <= 0 означает весь пакет.
+// После чтения последней части поле done становится равным true.
+func (d *batchDecoder) next(size int) ([]model.MetricRequest, error) {
+	if !d.started {
+		d.started = true
+
+		token, err := d.dec.Token()
+		if err != nil {
+			return nil, fmt.Errorf("can't read batch start: %w", err)
+		}
+
+		// null равнозначен пустому пакету
+		if token == nil {
+			d.done = true
+			return []model.MetricRequest{}, nil
+		}
+
+		if delim, ok := token.(json.Delim); !ok || delim != '[' {
+			return nil, fmt.Errorf("batch must be a json array, got %v", token)
+		}
+	}
+
+	chunk := make([]model.MetricRequest, 0, max(size, 0))
+	for size <= 0 || len(chunk) < size {
+		if !d.dec.More() {
+			if _, err := d.dec.Token(); err != nil {
+				return nil, fmt.Errorf("can't read batch end: %w", err)
+			}
+
+			d.done = true
+
+			break
+		}
+
+		var metric model.MetricRequest
+		if err := d.dec.Decode(&metric); err != nil {
+			return nil, fmt.Errorf("can't decode metric %d: %w", d.read, err)
+		}
+
+		chunk = append(chunk, metric)
+		d.read++
+	}
+
+	return chunk, nil
+}
+
+// chunkOptions возвращает параметры обработки части пакета.
+// Каждая часть получает собственный ключ идемпотентности, поэтому при повторе
+// пакета, прерванного на середине, уже примененные части не применяются второй раз.
+func chunkOptions(opts model.BatchOptions, chunk int) model.BatchOptions {
+	if opts.IdempotencyKey != "" && chunk > 0 {
+		opts.IdempotencyKey = fmt.Sprintf("%s:%d", opts.IdempotencyKey, chunk)
+	}
+
+	return opts
+}
+
+// mergeResult добавляет результат обработки части пакета к общему результату.
+func mergeResult(total *model.BatchResult, chunk model.BatchResult, offset, chunkIndex int) {
+	for _, item := range chunk.Items {
+		item.Index += offset
+		total.Items = append(total.Items, item)
+	}
+
+	total.Accepted += chunk.Accepted
+	total.Rejected += chunk.Rejected
+	total.Deduplicated += chunk.Deduplicated
+	total.Dropped += chunk.Dropped
+
+	// пакет считается повтором, только если повтором оказались все его части
+	total.Replayed = chunk.Replayed && (chunkIndex == 0 || total.Replayed)
+}
@@ -0,0 +1,27 @@
+package rest
+
+import (
+	_ "embed"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// openAPISpec спецификация OpenAPI 3 всех маршрутов сервера.
+// При добавлении маршрута его нужно описать в openapi.json, иначе упадет тест TestOpenAPI_AllRoutesDocumented.
+//
+//go:embed openapi.json
+var openAPISpec []byte
+
+// docsPage страница интерактивной документации, строится по openapi.json.
+//
+//go:embed docs.html
+var docsPage []byte
+
+func (h *handler) openAPI(ginCtx *gin.Context) {
+	ginCtx.Data(http.StatusOK, "application/json", openAPISpec)
+}
+
+func (h *handler) docs(ginCtx *gin.Context) {
+	ginCtx.Data(http.StatusOK, "text/html; charset=utf-8", docsPage)
+}
@@ -0,0 +1,130 @@
+//nolint:wrapcheck,nolintlint,errcheck,forcetypeassert
+package rest
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+type openAPIDocument struct {
+	Paths      map[string]map[string]json.RawMessage `json:"paths"`
+	Components struct {
+		Schemas map[string]json.RawMessage `json:"schemas"`
+	} `json:"components"`
+}
+
+// undocumentedPrefixes маршруты, не входящие в API: профилировщик pprof.
+var undocumentedPrefixes = []string{"/debug/pprof"}
+
+var ginParam = regexp.MustCompile(`:(\w+)`)
+
+func loadOpenAPI(t *testing.T) openAPIDocument {
+	t.Helper()
+
+	var doc openAPIDocument
+	require.NoError(t, json.Unmarshal(openAPISpec, &doc))
+
+	return doc
+}
+
+func registeredRoutes(t *testing.T) gin.RoutesInfo {
+	t.Helper()
+
+	api := NewServerAPI(&Config{
+		Server: new(MockServerService),
+		Logger: *zap.NewNop().Sugar(),
+	})
+
+	router, ok := api.srv.Handler.(*gin.Engine)
+	require.True(t, ok)
+
+	var routes gin.RoutesInfo
+
+	for _, route := range router.Routes() {
+		documented := true
+		for _, prefix := range undocumentedPrefixes {
+			if strings.HasPrefix(route.Path, prefix) {
+				documented = false
+			}
+		}
+
+		if documented {
+			routes = append(routes, route)
+		}
+	}
+
+	return routes
+}
+
+func TestOpenAPI_AllRoutesDocumented(t *testing.T) {
+	doc := loadOpenAPI(t)
+
+	for _, route := range registeredRoutes(t) {
+		path := ginParam.ReplaceAllString(route.Path, "{$1}")
+
+		operations, ok := doc.Paths[path]
+		if !assert.True(t, ok, "route %s %s is missing from openapi.json", route.Method, route.Path) {
+			continue
+		}
+
+		_, ok = operations[strings.ToLower(route.Method)]
+		assert.True(t, ok, "route %s %s is missing from openapi.json", route.Method, route.Path)
+	}
+}
+
+func TestOpenAPI_NoStaleOperations(t *testing.T) {
+	doc := loadOpenAPI(t)
+
+	registered := make(map[string]bool)
+	for _, route := range registeredRoutes(t) {
+		registered[strings.ToLower(route.Method)+" "+ginParam.ReplaceAllString(route.Path, "{$1}")] = true
+	}
+
+	for path, operations := range doc.Paths {
+		for method := range operations {
+			assert.True(t, registered[method+" "+path], "openapi.json describes unknown route %s %s", method, path)
+		}
+	}
+}
+
+func TestOpenAPI_RefsResolve(t *testing.T) {
+	doc := loadOpenAPI(t)
+
+	refs := regexp.MustCompile(`"\$ref":\s*"#/components/schemas/(\w+)"`).FindAllSubmatch(openAPISpec, -1)
+	require.NotEmpty(t, refs)
+
+	for _, ref := range refs {
+		_, ok := doc.Components.Schemas[string(ref[1])]
+		assert.True(t, ok, "schema %s is not defined", ref[1])
+	}
+}
+
+func TestServerAPI_Docs(t *testing.T) {
+	h := &handler{logger: *zap.NewNop().Sugar()}
+
+	router := gin.New()
+	router.GET("/openapi.json", h.openAPI)
+	router.GET("/docs", h.docs)
+
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/openapi.json", nil))
+
+	require.Equal(t, http.StatusOK, recorder.Code)
+	assert.Equal(t, "application/json", recorder.Header().Get("Content-Type"))
+	assert.True(t, json.Valid(recorder.Body.Bytes()))
+
+	recorder = httptest.NewRecorder()
+	router.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/docs", nil))
+
+	require.Equal(t, http.StatusOK, recorder.Code)
+	assert.Contains(t, recorder.Body.String(), "/openapi.json")
+}
@@ -0,0 +1,151 @@
+package rest
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"metricalert/internal/server/core/alerting"
+	"metricalert/internal/server/core/application"
+	"metricalert/internal/server/core/model"
+)
+
+// apiV1Prefix префикс версионированного API.
+// Маршруты с этим префиксом возвращают ошибки в формате JSON,
+// старые маршруты для совместимости возвращают только код ответа.
+const apiV1Prefix = "/api/v1/"
+
+// jsonErrorsKey ключ контекста запроса, включающий ошибки в формате JSON вне /api/v1/.
+const jsonErrorsKey = "rest.jsonErrors"
+
+// Коды ошибок транспортного уровня.
+const (
+	codeInvalidBody  = "invalid_body"
+	codeInvalidValue = "invalid_value"
+	codeInvalidBatch = "invalid_batch"
+	codeUnauthorized = "unauthorized"
+	codeForbidden    = "forbidden"
+	codeRateLimited  = "rate_limited"
+	codeTimeout      = "timeout"
+	codeUnavailable  = "unavailable"
+	codeInternal     = "internal"
+)
+
+// errorDetail описывает ошибку отдельного элемента пакета метрик.
+type errorDetail struct {
+	ID      string `json:"id,omitempty"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+	Index   int    `json:"index"`
+}
+
+type errorBody struct {
+	Code    string        `json:"code"`
+	Message string        `json:"message"`
+	Details []errorDetail `json:"details,omitempty"`
+}
+
+// errorResponse тело ответа с ошибкой.
+type errorResponse struct {
+	Error errorBody `json:"error"`
+}
+
+// jsonErrors сообщает, нужно ли писать ошибку запроса в тело ответа.
+func jsonErrors(c *gin.Context) bool {
+	if c.GetBool(jsonErrorsKey) {
+		return true
+	}
+
+	return c.Request != nil && c.Request.URL != nil && strings.HasPrefix(c.Request.URL.Path, apiV1Prefix)
+}
+
+// mwJSONErrors middleware для маршрутов без старого формата ответа:
+// ошибки на них возвращаются в формате JSON, как и на маршрутах /api/v1/.
+func (h *handler) mwJSONErrors() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Set(jsonErrorsKey, true)
+		c.Next()
+	}
+}
+
+// abort прерывает обработку запроса с ошибкой.
+// Для маршрутов /api/v1/ и маршрутов с mwJSONErrors в тело ответа пишется JSON
+// с кодом, описанием и деталями ошибки.
+func (h *handler) abort(c *gin.Context, status int, code, message string, details ...errorDetail) {
+	if !jsonErrors(c) {
+		c.Writer.WriteHeader(status)
+		c.Abort()
+
+		return
+	}
+
+	c.AbortWithStatusJSON(status, errorResponse{
+		Error: errorBody{
+			Code:    code,
+			Message: message,
+			Details: details,
+		},
+	})
+}
+
+// writeError отправляет ответ, соответствующий ошибке приложения.
+func (h *handler) writeError(ginCtx *gin.Context, msg string, err error) {
+	status, code := http.StatusInternalServerError, codeInternal
+
+	switch {
+	case errors.Is(err, application.ErrBadRequest), errors.Is(err, alerting.ErrInvalidRule),
+		errors.Is(err, alerting.ErrInvalidSilence):
+		status, code = http.StatusBadRequest, "bad_request"
+	case errors.Is(err, application.ErrNotFound), errors.Is(err, alerting.ErrNotFound):
+		status, code = http.StatusNotFound, "not_found"
+	case errors.Is(err, application.ErrConflict), errors.Is(err, alerting.ErrConflict):
+		status, code = http.StatusConflict, "conflict"
+	case errors.Is(err, application.ErrLimitExceeded):
+		status, code = http.StatusUnprocessableEntity, "limit_exceeded"
+	case errors.Is(err, context.DeadlineExceeded):
+		h.logger.Warnf("%s: request timed out: %v", msg, err)
+		h.abort(ginCtx, http.StatusGatewayTimeout, codeTimeout, "request timed out")
+
+		return
+	case errors.Is(err, context.Canceled):
+		h.logger.Warnf("%s: request canceled: %v", msg, err)
+		h.abort(ginCtx, http.StatusServiceUnavailable, codeUnavailable, "request canceled")
+
+		return
+	default:
+		h.logger.Errorf("%s: %v", msg, err)
+		h.abort(ginCtx, status, code, "internal server error")
+
+		return
+	}
+
+	if appCode := application.ErrorCode(err); appCode != "" {
+		code = appCode
+	}
+
+	h.abort(ginCtx, status, code, application.ErrorMessage(err))
+}
+
+// rejectedDetails возвращает описание некорректных метрик пакета.
+// Метрики, отклоненные только из-за строгого режима, не включаются.
+func rejectedDetails(result model.BatchResult) []errorDetail {
+	var details []errorDetail
+
+	for _, item := range result.Items {
+		if item.Status != model.ItemRejected || item.Code == application.CodeBatchRejected {
+			continue
+		}
+
+		details = append(details, errorDetail{
+			Index:   item.Index,
+			ID:      item.ID,
+			Code:    item.Code,
+			Message: item.Message,
+		})
+	}
+
+	return details
+}
@@ -0,0 +1,276 @@
+//nolint:wrapcheck,nolintlint,errcheck,forcetypeassert
+package rest
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"metricalert/internal/server/core/application"
+	"metricalert/internal/server/core/model"
+)
+
+func newV1Router(h *handler) *gin.Engine {
+	router := gin.New()
+	h.registerMetricRoutes(&router.RouterGroup)
+	h.registerMetricRoutes(router.Group("/api/v1"))
+
+	return router
+}
+
+func TestServerAPI_V1Errors(t *testing.T) {
+	tests := []struct {
+		setup  func(m *MockServerService)
+		name   string
+		method string
+		path   string
+		body   string
+		code   string
+		status int
+	}{
+		{
+			name:   "invalid counter value",
+			method: http.MethodPost,
+			path:   "/api/v1/update/counter/test/abc",
+			status: http.StatusBadRequest,
+			code:   codeInvalidValue,
+		},
+		{
+			name:   "unknown type",
+			method: http.MethodPost,
+			path:   "/api/v1/update/histogram/test/1",
+			status: http.StatusBadRequest,
+			code:   application.CodeUnknownType,
+		},
+		{
+			name:   "invalid body",
+			method: http.MethodPost,
+			path:   "/api/v1/update/",
+			body:   "{",
+			status: http.StatusBadRequest,
+			code:   codeInvalidBody,
+		},
+		{
+			name:   "not found",
+			method: http.MethodGet,
+			path:   "/api/v1/value/gauge/missing",
+			status: http.StatusNotFound,
+			code:   "not_found",
+			setup: func(m *MockServerService) {
+				m.On("GetMetric", mock.Anything, "missing", "gauge").
+					Return("", fmt.Errorf("metric not found: %w", application.ErrNotFound))
+			},
+		},
+		{
+			name:   "cardinality limit",
+			method: http.MethodPost,
+			path:   "/api/v1/update/gauge/new_metric/1",
+			status: http.StatusUnprocessableEntity,
+			code:   application.CodeCardinalityLimit,
+			setup: func(m *MockServerService) {
+				m.On("UpdateMetric", mock.Anything, mock.Anything).Return(&application.Error{
+					Kind: application.ErrLimitExceeded, Code: application.CodeCardinalityLimit, Message: "limit reached",
+				})
+			},
+		},
+		{
+			name:   "validation error",
+			method: http.MethodPost,
+			path:   "/api/v1/update/",
+			body:   `{"id":"test","type":"gauge"}`,
+			status: http.StatusBadRequest,
+			code:   application.CodeMissingValue,
+			setup: func(m *MockServerService) {
+				m.On("UpdateMetric", mock.Anything, mock.Anything).
+					Return(application.ValidateMetric(model.MetricRequest{ID: "test", MType: "gauge"}))
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockServerService := new(MockServerService)
+			if tt.setup != nil {
+				tt.setup(mockServerService)
+			}
+
+			h := &handler{
+				server: mockServerService,
+				logger: *zap.NewNop().Sugar(),
+			}
+			router := newV1Router(h)
+
+			recorder := httptest.NewRecorder()
+			router.ServeHTTP(recorder, httptest.NewRequest(tt.method, tt.path, bytes.NewBufferString(tt.body)))
+
+			require.Equal(t, tt.status, recorder.Code)
+
+			var resp errorResponse
+			require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &resp))
+			assert.Equal(t, tt.code, resp.Error.Code)
+			assert.NotEmpty(t, resp.Error.Message)
+
+			mockServerService.AssertExpectations(t)
+		})
+	}
+}
+
+func TestServerAPI_LegacyErrors(t *testing.T) {
+	mockServerService := new(MockServerService)
+	mockServerService.On("GetMetric", mock.Anything, "missing", "gauge").
+		Return("", fmt.Errorf("metric not found: %w", application.ErrNotFound))
+
+	h := &handler{
+		server: mockServerService,
+		logger: *zap.NewNop().Sugar(),
+	}
+	router := newV1Router(h)
+
+	for path, status := range map[string]int{
+		"/update/counter/test/abc": http.StatusBadRequest,
+		"/value/gauge/missing":     http.StatusNotFound,
+	} {
+		method := http.MethodPost
+		if status == http.StatusNotFound {
+			method = http.MethodGet
+		}
+
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, httptest.NewRequest(method, path, nil))
+
+		assert.Equal(t, status, recorder.Code, path)
+		assert.Empty(t, recorder.Body.String(), path)
+	}
+}
+
+func TestServerAPI_AlertRouteErrors(t *testing.T) {
+	handler := NewServerAPI(&Config{
+		Server: new(MockServerService),
+		Alerts: new(MockAlertService),
+		Logger: *zap.NewNop().Sugar(),
+	}).srv.Handler
+
+	for _, path := range []string{"/alerts/rules", "/alerts/silences"} {
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, path, bytes.NewBufferString(`{"name":1`)))
+
+		require.Equal(t, http.StatusBadRequest, recorder.Code, path)
+
+		var resp errorResponse
+		require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &resp), path)
+		assert.Equal(t, codeInvalidBody, resp.Error.Code, path)
+		assert.Equal(t, "invalid json body", resp.Error.Message, path)
+	}
+}
+
+func TestServerAPI_BatchResults(t *testing.T) {
+	const body = `[{"id":"ok","type":"gauge","value":1},{"id":"bad","type":"gauge"}]`
+
+	items := []model.ItemResult{
+		{Index: 0, ID: "ok", Status: model.ItemAccepted},
+		{Index: 1, ID: "bad", Status: model.ItemRejected, Code: application.CodeMissingValue,
+			Message: "value is nil on gauge metric"},
+	}
+
+	t.Run("partial", func(t *testing.T) {
+		mockServerService := new(MockServerService)
+		mockServerService.On("UpdateMetrics", mock.Anything, mock.Anything, model.BatchOptions{}).
+			Return(model.BatchResult{Items: items, Accepted: 1, Rejected: 1}, nil)
+
+		router := newV1Router(&handler{server: mockServerService, logger: *zap.NewNop().Sugar()})
+
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/api/v1/updates/", bytes.NewBufferString(body)))
+
+		require.Equal(t, http.StatusOK, recorder.Code)
+
+		var result model.BatchResult
+		require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &result))
+		assert.Equal(t, model.BatchResult{Items: items, Accepted: 1, Rejected: 1}, result)
+	})
+
+	t.Run("strict", func(t *testing.T) {
+		strictItems := append([]model.ItemResult(nil), items...)
+		strictItems[0].Status = model.ItemRejected
+		strictItems[0].Code = application.CodeBatchRejected
+
+		mockServerService := new(MockServerService)
+		mockServerService.On("UpdateMetrics", mock.Anything, mock.Anything, model.BatchOptions{Strict: true}).
+			Return(model.BatchResult{Items: strictItems, Rejected: 2},
+				application.ValidateMetric(model.MetricRequest{ID: "bad", MType: "gauge"}))
+
+		router := newV1Router(&handler{server: mockServerService, logger: *zap.NewNop().Sugar()})
+
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/api/v1/updates/?strict=true",
+			bytes.NewBufferString(body)))
+
+		require.Equal(t, http.StatusBadRequest, recorder.Code)
+
+		var resp errorResponse
+		require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &resp))
+
+		assert.Equal(t, codeInvalidBatch, resp.Error.Code)
+		assert.Equal(t, []errorDetail{
+			{Index: 1, ID: "bad", Code: application.CodeMissingValue, Message: "value is nil on gauge metric"},
+		}, resp.Error.Details)
+	})
+
+	t.Run("idempotency key", func(t *testing.T) {
+		mockServerService := new(MockServerService)
+		mockServerService.On("UpdateMetrics", mock.Anything, mock.Anything, model.BatchOptions{IdempotencyKey: "batch-1"}).
+			Return(model.BatchResult{Items: items[:1], Accepted: 1, Replayed: true}, nil)
+
+		router := newV1Router(&handler{server: mockServerService, logger: *zap.NewNop().Sugar()})
+
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/updates/", bytes.NewBufferString(body))
+		req.Header.Set("Idempotency-Key", "batch-1")
+
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, req)
+
+		require.Equal(t, http.StatusOK, recorder.Code)
+
+		var result model.BatchResult
+		require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &result))
+		assert.True(t, result.Replayed)
+
+		mockServerService.AssertExpectations(t)
+	})
+
+	t.Run("idempotency key too long", func(t *testing.T) {
+		mockServerService := new(MockServerService)
+		router := newV1Router(&handler{server: mockServerService, logger: *zap.NewNop().Sugar()})
+
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/updates/", bytes.NewBufferString(body))
+		req.Header.Set("Idempotency-Key", strings.Repeat("k", maxIdempotencyKeyLength+1))
+
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, req)
+
+		assert.Equal(t, http.StatusBadRequest, recorder.Code)
+		mockServerService.AssertNotCalled(t, "UpdateMetrics", mock.Anything, mock.Anything, mock.Anything)
+	})
+
+	t.Run("invalid strict", func(t *testing.T) {
+		mockServerService := new(MockServerService)
+		router := newV1Router(&handler{server: mockServerService, logger: *zap.NewNop().Sugar()})
+
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/api/v1/updates/?strict=maybe",
+			bytes.NewBufferString(body)))
+
+		assert.Equal(t, http.StatusBadRequest, recorder.Code)
+		mockServerService.AssertNotCalled(t, "UpdateMetrics", mock.Anything, mock.Anything, mock.Anything)
+	})
+}
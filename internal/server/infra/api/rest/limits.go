@@ -0,0 +1,100 @@
+package rest
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// codeBodyTooLarge код ошибки превышения размера тела запроса.
+const codeBodyTooLarge = "body_too_large"
+
+// isBodyTooLarge проверяет, вызвана ли ошибка превышением допустимого размера тела запроса.
+func isBodyTooLarge(err error) bool {
+	var maxBytesErr *http.MaxBytesError
+	return errors.As(err, &maxBytesErr)
+}
+
+// bodyTooLarge прерывает обработку запроса с кодом 413.
+func (h *handler) bodyTooLarge(c *gin.Context, err error) {
+	var maxBytesErr *http.MaxBytesError
+	if !errors.As(err, &maxBytesErr) {
+		maxBytesErr = &http.MaxBytesError{Limit: h.maxBodySize}
+	}
+
+	h.logger.Warnf("request body too large, uri: %s, limit: %d", c.Request.RequestURI, maxBytesErr.Limit)
+	h.abort(c, http.StatusRequestEntityTooLarge, codeBodyTooLarge,
+		fmt.Sprintf("request body exceeds %d bytes", maxBytesErr.Limit))
+}
+
+// invalidBody прерывает обработку запроса, тело которого не удалось прочитать:
+// с кодом 413 при превышении размера, иначе с кодом 400.
+func (h *handler) invalidBody(c *gin.Context, err error) {
+	if isBodyTooLarge(err) {
+		h.bodyTooLarge(c, err)
+		return
+	}
+
+	h.abort(c, http.StatusBadRequest, codeInvalidBody, "invalid json body")
+}
+
+// mwBodyLimit middleware для ограничения размера тела запроса в том виде, в котором оно передано по сети.
+// Запрос с заведомо большим Content-Length отклоняется сразу, остальные прерываются при чтении.
+func (h *handler) mwBodyLimit() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if h.maxBodySize <= 0 || c.Request.Body == nil || h.unboundedBody(c) {
+			c.Next()
+			return
+		}
+
+		if c.Request.ContentLength > h.maxBodySize {
+			h.bodyTooLarge(c, &http.MaxBytesError{Limit: h.maxBodySize})
+			return
+		}
+
+		c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, h.maxBodySize)
+
+		c.Next()
+	}
+}
+
+// limitReader ограничивает объем данных после распаковки.
+// При превышении лимита возвращает *http.MaxBytesError, как и http.MaxBytesReader.
+type limitReader struct {
+	r         io.Reader
+	limit     int64
+	remaining int64
+}
+
+func newLimitReader(r io.Reader, limit int64) io.Reader {
+	if limit <= 0 {
+		return r
+	}
+
+	return &limitReader{r: r, limit: limit, remaining: limit}
+}
+
+func (l *limitReader) Read(p []byte) (int, error) {
+	if l.remaining < 0 {
+		return 0, &http.MaxBytesError{Limit: l.limit}
+	}
+
+	// читаем на байт больше лимита, чтобы отличить тело ровно по лимиту от превышающего его
+	if int64(len(p)) > l.remaining+1 {
+		p = p[:l.remaining+1]
+	}
+
+	n, err := l.r.Read(p)
+	if int64(n) <= l.remaining {
+		l.remaining -= int64(n)
+		return n, err //nolint:wrapcheck // ошибка читателя передается без изменений, как в io.LimitReader
+	}
+
+	n = int(l.remaining)
+	l.remaining = -1
+
+	return n, &http.MaxBytesError{Limit: l.limit}
+}
@@ -0,0 +1,215 @@
+//nolint:wrapcheck,nolintlint,errcheck,forcetypeassert
+package rest
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"metricalert/internal/server/core/model"
+)
+
+func newLimitRouter(h *handler) *gin.Engine {
+	router := gin.New()
+	router.Use(h.mwBodyLimit(), h.mwDecompress())
+	h.registerMetricRoutes(&router.RouterGroup)
+	h.registerMetricRoutes(router.Group("/api/v1"))
+
+	return router
+}
+
+func gzipBody(t *testing.T, data []byte) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+
+	gz := gzip.NewWriter(&buf)
+	_, err := gz.Write(data)
+	require.NoError(t, err)
+	require.NoError(t, gz.Close())
+
+	return buf.Bytes()
+}
+
+func TestServerAPI_BodyLimit(t *testing.T) {
+	batch := `[` + strings.Repeat(`{"id":"test","type":"gauge","value":1},`, 100) + `{"id":"test","type":"gauge","value":1}]`
+
+	t.Run("content length", func(t *testing.T) {
+		mockServerService := new(MockServerService)
+		router := newLimitRouter(&handler{server: mockServerService, logger: *zap.NewNop().Sugar(), maxBodySize: 100})
+
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/api/v1/updates/", strings.NewReader(batch)))
+
+		require.Equal(t, http.StatusRequestEntityTooLarge, recorder.Code)
+
+		var resp errorResponse
+		require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &resp))
+		assert.Equal(t, codeBodyTooLarge, resp.Error.Code)
+		assert.Equal(t, "request body exceeds 100 bytes", resp.Error.Message)
+
+		mockServerService.AssertNotCalled(t, "UpdateMetrics", mock.Anything, mock.Anything, mock.Anything)
+	})
+
+	t.Run("unknown length", func(t *testing.T) {
+		mockServerService := new(MockServerService)
+		router := newLimitRouter(&handler{server: mockServerService, logger: *zap.NewNop().Sugar(), maxBodySize: 100})
+
+		req := httptest.NewRequest(http.MethodPost, "/update/", io.MultiReader(strings.NewReader(batch)))
+		req.ContentLength = -1
+
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, req)
+
+		assert.Equal(t, http.StatusRequestEntityTooLarge, recorder.Code)
+	})
+
+	t.Run("gzip bomb", func(t *testing.T) {
+		mockServerService := new(MockServerService)
+		router := newLimitRouter(&handler{
+			server:       mockServerService,
+			logger:       *zap.NewNop().Sugar(),
+			maxBodySize:  10 << 10,
+			maxUnzipSize: 1 << 10,
+		})
+
+		body := gzipBody(t, append([]byte(`[{"id":"`), bytes.Repeat([]byte("a"), 1<<20)...))
+		require.Less(t, len(body), 10<<10)
+
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/updates/", bytes.NewReader(body))
+		req.Header.Set("Content-Encoding", "gzip")
+
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, req)
+
+		assert.Equal(t, http.StatusRequestEntityTooLarge, recorder.Code)
+		mockServerService.AssertNotCalled(t, "UpdateMetrics", mock.Anything, mock.Anything, mock.Anything)
+	})
+
+	t.Run("within limits", func(t *testing.T) {
+		mockServerService := new(MockServerService)
+		mockServerService.On("UpdateMetrics", mock.Anything, mock.Anything, mock.Anything).
+			Return(model.BatchResult{}, nil)
+
+		router := newLimitRouter(&handler{
+			server:       mockServerService,
+			logger:       *zap.NewNop().Sugar(),
+			maxBodySize:  10 << 10,
+			maxUnzipSize: int64(len(batch)),
+		})
+
+		req := httptest.NewRequest(http.MethodPost, "/updates/", bytes.NewReader(gzipBody(t, []byte(batch))))
+		req.Header.Set("Content-Encoding", "gzip")
+
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, req)
+
+		assert.Equal(t, http.StatusOK, recorder.Code)
+	})
+}
+
+func TestServerAPI_BatchChunks(t *testing.T) {
+	const body = `[
+		{"id":"a","type":"gauge","value":1},
+		{"id":"b","type":"gauge","value":2},
+		{"id":"c","type":"gauge","value":3},
+		{"id":"d","type":"gauge"},
+		{"id":"e","type":"gauge","value":5}
+	]`
+
+	chunkResult := func(n int, replayed bool) model.BatchResult {
+		result := model.BatchResult{Replayed: replayed}
+		for i := range n {
+			result.Items = append(result.Items, model.ItemResult{Index: i, Status: model.ItemAccepted})
+			result.Accepted++
+		}
+
+		return result
+	}
+
+	mockServerService := new(MockServerService)
+	mockServerService.On("UpdateMetrics", mock.Anything, mock.Anything, model.BatchOptions{IdempotencyKey: "key"}).
+		Return(chunkResult(2, true), nil).Once()
+	mockServerService.On("UpdateMetrics", mock.Anything, mock.Anything, model.BatchOptions{IdempotencyKey: "key:1"}).
+		Return(chunkResult(2, false), nil).Once()
+	mockServerService.On("UpdateMetrics", mock.Anything, mock.Anything, model.BatchOptions{IdempotencyKey: "key:2"}).
+		Return(chunkResult(1, false), nil).Once()
+
+	router := newV1Router(&handler{server: mockServerService, logger: *zap.NewNop().Sugar(), batchChunkSize: 2})
+
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/updates/", strings.NewReader(body))
+	req.Header.Set("Idempotency-Key", "key")
+
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, req)
+
+	require.Equal(t, http.StatusOK, recorder.Code)
+
+	var result model.BatchResult
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &result))
+
+	assert.Equal(t, 5, result.Accepted)
+	assert.False(t, result.Replayed)
+	require.Len(t, result.Items, 5)
+
+	for i, item := range result.Items {
+		assert.Equal(t, i, item.Index)
+	}
+
+	calls := mockServerService.Calls
+	require.Len(t, calls, 3)
+	assert.Equal(t, "a", calls[0].Arguments.Get(1).([]model.MetricRequest)[0].ID)
+	assert.Equal(t, "e", calls[2].Arguments.Get(1).([]model.MetricRequest)[0].ID)
+}
+
+func TestServerAPI_BatchDecodeError(t *testing.T) {
+	mockServerService := new(MockServerService)
+	mockServerService.On("UpdateMetrics", mock.Anything, mock.Anything, mock.Anything).
+		Return(model.BatchResult{}, nil)
+
+	router := newV1Router(&handler{server: mockServerService, logger: *zap.NewNop().Sugar(), batchChunkSize: 1})
+
+	for name, body := range map[string]string{
+		"not an array": `{"id":"a"}`,
+		"empty body":   ``,
+		"broken item":  `[{"id":"a","type":"gauge","value":1},{"id":`,
+	} {
+		t.Run(name, func(t *testing.T) {
+			recorder := httptest.NewRecorder()
+			router.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/api/v1/updates/", strings.NewReader(body)))
+
+			require.Equal(t, http.StatusBadRequest, recorder.Code)
+
+			var resp errorResponse
+			require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &resp))
+			assert.Equal(t, codeInvalidBody, resp.Error.Code)
+		})
+	}
+
+	// первая метрика успела примениться до ошибки разбора
+	mockServerService.AssertNumberOfCalls(t, "UpdateMetrics", 1)
+}
+
+func TestLimitReader(t *testing.T) {
+	data, err := io.ReadAll(newLimitReader(strings.NewReader("12345"), 5))
+	require.NoError(t, err)
+	assert.Equal(t, "12345", string(data))
+
+	_, err = io.ReadAll(newLimitReader(strings.NewReader("123456"), 5))
+	assert.True(t, isBodyTooLarge(err))
+
+	data, err = io.ReadAll(newLimitReader(strings.NewReader("123456"), 0))
+	require.NoError(t, err)
+	assert.Equal(t, "123456", string(data))
+}
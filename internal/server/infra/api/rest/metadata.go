@@ -0,0 +1,55 @@
+package rest
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"metricalert/internal/server/core/model"
+)
+
+// listMetadata возвращает метаданные всех зарегистрированных метрик.
+func (h *handler) listMetadata(ginCtx *gin.Context) {
+	list, err := h.server.ListMetadata(ginCtx.Request.Context())
+	if err != nil {
+		h.writeError(ginCtx, "failed to list metadata", err)
+		return
+	}
+
+	ginCtx.JSON(http.StatusOK, list)
+}
+
+// setMetadata регистрирует или заменяет метаданные метрики, имя берется из пути запроса.
+func (h *handler) setMetadata(ginCtx *gin.Context) {
+	var meta model.MetricMeta
+	if err := ginCtx.ShouldBindJSON(&meta); err != nil {
+		h.logger.Errorf("failed to bind json: %v", err)
+		h.invalidBody(ginCtx, err)
+		return
+	}
+
+	meta.Name = ginCtx.Param("name")
+
+	if err := h.server.SetMetadata(ginCtx.Request.Context(), meta); err != nil {
+		h.writeError(ginCtx, "failed to set metadata", err)
+		return
+	}
+
+	h.logger.Infof("metadata set, metric: %s, type: %s, unit: %s", meta.Name, meta.MType, meta.Unit)
+
+	ginCtx.JSON(http.StatusOK, meta)
+}
+
+// deleteMetadata удаляет метаданные метрики.
+func (h *handler) deleteMetadata(ginCtx *gin.Context) {
+	name := ginCtx.Param("name")
+
+	if err := h.server.DeleteMetadata(ginCtx.Request.Context(), name); err != nil {
+		h.writeError(ginCtx, "failed to delete metadata", err)
+		return
+	}
+
+	h.logger.Infof("metadata deleted, metric: %s", name)
+
+	ginCtx.Status(http.StatusNoContent)
+}
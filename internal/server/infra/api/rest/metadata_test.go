@@ -0,0 +1,134 @@
+//nolint:wrapcheck,nolintlint,errcheck,forcetypeassert
+package rest
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"go.uber.org/zap"
+
+	"metricalert/internal/server/core/application"
+	"metricalert/internal/server/core/model"
+)
+
+func TestServerAPI_Metadata(t *testing.T) {
+	newRouter := func(server ServerService) *gin.Engine {
+		h := &handler{server: server, logger: *zap.NewNop().Sugar()}
+
+		router := gin.New()
+		h.registerMetricRoutes(router.Group("/api/v1"))
+		router.PUT("/admin/metadata/:name", h.setMetadata)
+		router.DELETE("/admin/metadata/:name", h.deleteMetadata)
+
+		return router
+	}
+
+	maxValue := 100.0
+
+	tests := []struct {
+		setup  func(m *MockServerService)
+		name   string
+		method string
+		path   string
+		body   string
+		want   string
+		status int
+	}{
+		{
+			name:   "list",
+			method: http.MethodGet,
+			path:   "/api/v1/metadata/",
+			setup: func(m *MockServerService) {
+				m.On("ListMetadata", mock.Anything).Return([]model.MetricMeta{
+					{Name: "CPUutilization", MType: "gauge", Unit: "%", Max: &maxValue},
+				}, nil)
+			},
+			status: http.StatusOK,
+			want:   `[{"name":"CPUutilization","type":"gauge","unit":"%","max":100}]`,
+		},
+		{
+			name:   "set uses name from path",
+			method: http.MethodPut,
+			path:   "/admin/metadata/PollCount",
+			body:   `{"name":"ignored","type":"counter","help":"Number of polls"}`,
+			setup: func(m *MockServerService) {
+				m.On("SetMetadata", mock.Anything,
+					model.MetricMeta{Name: "PollCount", MType: "counter", Help: "Number of polls"}).Return(nil)
+			},
+			status: http.StatusOK,
+			want:   `{"name":"PollCount","type":"counter","help":"Number of polls"}`,
+		},
+		{
+			name:   "set invalid metadata",
+			method: http.MethodPut,
+			path:   "/admin/metadata/PollCount",
+			body:   `{"type":"histogram"}`,
+			setup: func(m *MockServerService) {
+				m.On("SetMetadata", mock.Anything, mock.Anything).Return(application.ErrBadRequest)
+			},
+			status: http.StatusBadRequest,
+		},
+		{
+			name:   "set invalid body",
+			method: http.MethodPut,
+			path:   "/admin/metadata/PollCount",
+			body:   `[`,
+			setup:  func(*MockServerService) {},
+			status: http.StatusBadRequest,
+		},
+		{
+			name:   "delete",
+			method: http.MethodDelete,
+			path:   "/admin/metadata/PollCount",
+			setup: func(m *MockServerService) {
+				m.On("DeleteMetadata", mock.Anything, "PollCount").Return(nil)
+			},
+			status: http.StatusNoContent,
+		},
+		{
+			name:   "delete not found",
+			method: http.MethodDelete,
+			path:   "/admin/metadata/PollCount",
+			setup: func(m *MockServerService) {
+				m.On("DeleteMetadata", mock.Anything, "PollCount").Return(application.ErrNotFound)
+			},
+			status: http.StatusNotFound,
+		},
+		{
+			name:   "update with registered type mismatch",
+			method: http.MethodPost,
+			path:   "/api/v1/update/gauge/PollCount/1",
+			setup: func(m *MockServerService) {
+				m.On("UpdateMetric", mock.Anything, mock.Anything).Return(&application.Error{
+					Kind: application.ErrConflict, Code: application.CodeTypeMismatch, Message: "type mismatch",
+				})
+			},
+			status: http.StatusConflict,
+			want:   `{"error":{"code":"type_mismatch","message":"type mismatch"}}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockServerService := new(MockServerService)
+			tt.setup(mockServerService)
+
+			recorder := httptest.NewRecorder()
+			newRouter(mockServerService).ServeHTTP(recorder,
+				httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body)))
+
+			assert.Equal(t, tt.status, recorder.Code)
+
+			if tt.want != "" {
+				assert.JSONEq(t, tt.want, recorder.Body.String())
+			}
+
+			mockServerService.AssertExpectations(t)
+		})
+	}
+}
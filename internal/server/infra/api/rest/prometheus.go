@@ -0,0 +1,109 @@
+package rest
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"metricalert/internal/server/core/model"
+)
+
+const (
+	// prometheusContentType тип содержимого текстового формата экспозиции Prometheus.
+	prometheusContentType = "text/plain; version=0.0.4; charset=utf-8"
+	// staleMetricName служебная метрика, которой помечаются устаревшие метрики.
+	staleMetricName = "metricalert_metric_stale"
+)
+
+// prometheusMetrics отдает все метрики в текстовом формате Prometheus. Описание метрики из метаданных
+// выводится в строке # HELP. Устаревшие метрики остаются в выводе и дополнительно помечаются
+// служебной метрикой metricalert_metric_stale.
+func (h *handler) prometheusMetrics(ginCtx *gin.Context) {
+	metrics, err := h.server.ExportMetrics(ginCtx.Request.Context())
+	if err != nil {
+		h.writeError(ginCtx, "failed to export metrics", err)
+		return
+	}
+
+	ginCtx.Data(http.StatusOK, prometheusContentType, h.writePrometheus(metrics))
+}
+
+// writePrometheus формирует вывод в текстовом формате Prometheus. Имена метрик приводятся
+// к допустимому виду; если после этого имя совпадает с уже выведенным, метрика пропускается.
+func (h *handler) writePrometheus(metrics []model.MetricState) []byte {
+	var (
+		buf   bytes.Buffer
+		seen  = make(map[string]bool, len(metrics))
+		stale []model.MetricState
+	)
+
+	for _, metric := range metrics {
+		name := prometheusName(metric.ID)
+		if seen[name] {
+			h.logger.Warnf("prometheus name collision, metric: %s, type: %s, name: %s", metric.ID, metric.MType, name)
+			continue
+		}
+
+		seen[name] = true
+
+		value := strconv.FormatFloat(metric.Value, 'g', -1, 64)
+		if metric.MType == counterType {
+			value = strconv.FormatInt(metric.Delta, 10)
+		}
+
+		if metric.Help != "" {
+			fmt.Fprintf(&buf, "# HELP %s %s\n", name, helpEscaper.Replace(metric.Help))
+		}
+
+		fmt.Fprintf(&buf, "# TYPE %s %s\n%s %s\n", name, metric.MType, name, value)
+
+		if metric.Stale {
+			stale = append(stale, metric)
+		}
+	}
+
+	if len(stale) == 0 {
+		return buf.Bytes()
+	}
+
+	fmt.Fprintf(&buf, "# HELP %s Metric has not been updated within its staleness TTL.\n", staleMetricName)
+	fmt.Fprintf(&buf, "# TYPE %s gauge\n", staleMetricName)
+
+	for _, metric := range stale {
+		fmt.Fprintf(&buf, "%s{name=\"%s\",type=\"%s\"} 1\n",
+			staleMetricName, labelEscaper.Replace(metric.ID), metric.MType)
+	}
+
+	return buf.Bytes()
+}
+
+var (
+	labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+	helpEscaper  = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+)
+
+// prometheusName заменяет недопустимые в имени метрики Prometheus символы на подчеркивание.
+func prometheusName(name string) string {
+	var b strings.Builder
+
+	for i, r := range name {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r == '_', r == ':':
+			b.WriteRune(r)
+		case r >= '0' && r <= '9':
+			if i == 0 {
+				b.WriteByte('_')
+			}
+
+			b.WriteRune(r)
+		default:
+			b.WriteByte('_')
+		}
+	}
+
+	return b.String()
+}
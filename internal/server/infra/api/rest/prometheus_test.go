@@ -0,0 +1,110 @@
+//nolint:wrapcheck,nolintlint,errcheck,forcetypeassert
+package rest
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"metricalert/internal/server/core/model"
+)
+
+func TestServerAPI_PrometheusMetrics(t *testing.T) {
+	newRouter := func(server ServerService) *gin.Engine {
+		h := &handler{server: server, logger: *zap.NewNop().Sugar()}
+
+		router := gin.New()
+		router.GET("/metrics", h.prometheusMetrics)
+
+		return router
+	}
+
+	t.Run("exposition", func(t *testing.T) {
+		mockServerService := new(MockServerService)
+		mockServerService.On("ExportMetrics", mock.Anything).Return([]model.MetricState{
+			{ID: "Alloc", MType: gaugeType, Value: 1.5},
+			{ID: "agent-1.cpu", MType: gaugeType, Value: 0.25, Stale: true},
+			{ID: "PollCount", MType: counterType, Delta: 7},
+		}, nil)
+
+		recorder := httptest.NewRecorder()
+		newRouter(mockServerService).ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+		require.Equal(t, http.StatusOK, recorder.Code)
+		assert.Equal(t, prometheusContentType, recorder.Header().Get("Content-Type"))
+		assert.Equal(t, `# TYPE Alloc gauge
+Alloc 1.5
+# TYPE agent_1_cpu gauge
+agent_1_cpu 0.25
+# TYPE PollCount counter
+PollCount 7
+# HELP metricalert_metric_stale Metric has not been updated within its staleness TTL.
+# TYPE metricalert_metric_stale gauge
+metricalert_metric_stale{name="agent-1.cpu",type="gauge"} 1
+`, recorder.Body.String())
+	})
+
+	t.Run("help from metadata", func(t *testing.T) {
+		mockServerService := new(MockServerService)
+		mockServerService.On("ExportMetrics", mock.Anything).Return([]model.MetricState{
+			{ID: "Alloc", MType: gaugeType, Value: 1, Help: "Allocated heap\\objects\nin bytes"},
+		}, nil)
+
+		recorder := httptest.NewRecorder()
+		newRouter(mockServerService).ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+		require.Equal(t, http.StatusOK, recorder.Code)
+		assert.Equal(t, `# HELP Alloc Allocated heap\\objects\nin bytes
+# TYPE Alloc gauge
+Alloc 1
+`, recorder.Body.String())
+	})
+
+	t.Run("name collision", func(t *testing.T) {
+		mockServerService := new(MockServerService)
+		mockServerService.On("ExportMetrics", mock.Anything).Return([]model.MetricState{
+			{ID: "requests", MType: gaugeType, Value: 1},
+			{ID: "requests", MType: counterType, Delta: 2},
+		}, nil)
+
+		recorder := httptest.NewRecorder()
+		newRouter(mockServerService).ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+		require.Equal(t, http.StatusOK, recorder.Code)
+		assert.Equal(t, "# TYPE requests gauge\nrequests 1\n", recorder.Body.String())
+	})
+
+	t.Run("export error", func(t *testing.T) {
+		mockServerService := new(MockServerService)
+		mockServerService.On("ExportMetrics", mock.Anything).
+			Return([]model.MetricState(nil), errors.New("store error"))
+
+		recorder := httptest.NewRecorder()
+		newRouter(mockServerService).ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+		assert.Equal(t, http.StatusInternalServerError, recorder.Code)
+	})
+}
+
+func TestPrometheusName(t *testing.T) {
+	tests := map[string]string{
+		"Alloc":           "Alloc",
+		"http:requests":   "http:requests",
+		"agent-1.cpu":     "agent_1_cpu",
+		"1st_metric":      "_1st_metric",
+		"загрузка_cpu":    "_________cpu",
+		"with space 2":    "with_space_2",
+		"label\"quoted\"": "label_quoted_",
+	}
+
+	for name, want := range tests {
+		assert.Equal(t, want, prometheusName(name), name)
+	}
+}
@@ -0,0 +1,32 @@
+package rest
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// relabelRules возвращает действующие правила преобразования метрик.
+func (h *handler) relabelRules(ginCtx *gin.Context) {
+	rules, err := h.server.RelabelRules(ginCtx.Request.Context())
+	if err != nil {
+		h.writeError(ginCtx, "failed to get relabel rules", err)
+		return
+	}
+
+	ginCtx.JSON(http.StatusOK, gin.H{"rules": rules})
+}
+
+// reloadRelabelRules перечитывает правила преобразования метрик из файла конфигурации.
+// При ошибке в правилах продолжают действовать прежние правила.
+func (h *handler) reloadRelabelRules(ginCtx *gin.Context) {
+	rules, err := h.server.ReloadRelabelRules(ginCtx.Request.Context())
+	if err != nil {
+		h.writeError(ginCtx, "failed to reload relabel rules", err)
+		return
+	}
+
+	h.logger.Infof("relabel rules reloaded, count: %d", len(rules))
+
+	ginCtx.JSON(http.StatusOK, gin.H{"rules": rules})
+}
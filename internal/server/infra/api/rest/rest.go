@@ -14,12 +14,12 @@ import (
 	"crypto/x509"
 	"encoding/base64"
 	"encoding/hex"
-	"encoding/json"
 	"encoding/pem"
 	"errors"
 	"fmt"
 	"html/template"
 	"io"
+	"math"
 	"net"
 	"net/http"
 	"os"
@@ -34,15 +34,28 @@ import (
 
 	"metricalert/internal/server/core/application"
 	"metricalert/internal/server/core/model"
+	"metricalert/internal/server/infra/auth"
+	"metricalert/internal/server/infra/ipfilter"
+	"metricalert/internal/server/infra/ratelimit"
 )
 
 // ServerService интерфейс для работы с сервером.
 type ServerService interface {
 	UpdateMetric(ctx context.Context, request model.MetricRequest) error
-	UpdateMetrics(ctx context.Context, request []model.MetricRequest) error
+	UpdateMetrics(ctx context.Context, request []model.MetricRequest, opts model.BatchOptions) (model.BatchResult, error)
 	GetMetric(ctx context.Context, metricName, metricType string) (string, error)
 	GetMetrics(ctx context.Context) ([]model.MetricData, error)
+	ExportMetrics(ctx context.Context) ([]model.MetricState, error)
 	Ping(ctx context.Context) error
+	DeleteMetrics(ctx context.Context, sel model.MetricSelector) ([]model.MetricRef, error)
+	ResetCounters(ctx context.Context, sel model.MetricSelector) ([]model.MetricRef, error)
+	RenameMetric(ctx context.Context, mType, from, to string) error
+	SetMetadata(ctx context.Context, meta model.MetricMeta) error
+	DeleteMetadata(ctx context.Context, name string) error
+	ListMetadata(ctx context.Context) ([]model.MetricMeta, error)
+	CardinalityState(ctx context.Context) (model.CardinalityState, error)
+	RelabelRules(ctx context.Context) ([]model.RelabelRule, error)
+	ReloadRelabelRules(ctx context.Context) ([]model.RelabelRule, error)
 }
 
 // API структура для работы с сервером.
@@ -51,22 +64,45 @@ type API struct {
 }
 
 // Config структура конфигурации сервера.
+// RouteTimeouts задает таймауты обработки запросов по шаблонам маршрутов (например, "/updates/"),
+// для остальных маршрутов используется RequestTimeout. Нулевой таймаут означает его отсутствие.
+// Alerts предоставляет состояние оповещений, без него маршруты оповещений возвращают пустые списки.
 type Config struct {
-	Server        ServerService
-	Logger        zap.SugaredLogger
-	HashKey       string
-	CryptoKey     string
-	TrustedSubnet string
-	Port          int64
+	Server         ServerService
+	Alerts         AlertService
+	Auth           *auth.Authenticator
+	IPFilter       *ipfilter.Filter
+	Limiter        *ratelimit.Limiter
+	RouteTimeouts  map[string]time.Duration
+	Logger         zap.SugaredLogger
+	HashKey        string
+	CryptoKey      string
+	Port           int64
+	RequestTimeout time.Duration
+
+	// MaxBodySize ограничивает размер тела запроса до распаковки, MaxDecompressedSize — после.
+	// Нулевое значение снимает ограничение.
+	MaxBodySize         int64
+	MaxDecompressedSize int64
+	// BatchChunkSize задает размер частей, которыми применяется пакет или поток метрик.
+	BatchChunkSize int
 }
 
 // NewServerAPI создает новый сервер.
 func NewServerAPI(conf *Config) *API {
 	h := handler{
-		server:        conf.Server,
-		logger:        conf.Logger,
-		hashKey:       conf.HashKey,
-		trustedSubnet: conf.TrustedSubnet,
+		server:         conf.Server,
+		alerts:         conf.Alerts,
+		auth:           conf.Auth,
+		ipFilter:       conf.IPFilter,
+		limiter:        conf.Limiter,
+		logger:         conf.Logger,
+		hashKey:        conf.HashKey,
+		routeTimeouts:  conf.RouteTimeouts,
+		requestTimeout: conf.RequestTimeout,
+		maxBodySize:    conf.MaxBodySize,
+		maxUnzipSize:   conf.MaxDecompressedSize,
+		batchChunkSize: conf.BatchChunkSize,
 	}
 
 	if conf.CryptoKey != "" {
@@ -80,29 +116,89 @@ func NewServerAPI(conf *Config) *API {
 
 	router := gin.New()
 
-	pprof.Register(router)
-
 	router.Use(gin.Recovery())
 	router.Use(h.mwLog())
+	router.Use(h.mwTimeout())
+	router.Use(h.mwIPFilter())
+	router.Use(h.mwBodyLimit())
 	router.Use(h.mwEncrypt())
 	router.Use(h.mwDecompress())
-	router.Use(h.mwIPFilter())
 	router.Use(h.responseGzipMiddleware())
 	router.Use(h.encryptionMiddleware())
 
-	router.POST("/update/:type/:name/:value", h.update)
+	// Старые маршруты сохранены для совместимости, версионированные возвращают ошибки в формате JSON.
+	h.registerMetricRoutes(&router.RouterGroup)
+	h.registerMetricRoutes(router.Group(strings.TrimSuffix(apiV1Prefix, "/")))
+
+	router.GET("/", h.mwAuth(auth.ScopeMetricsRead), h.mwRateLimit(), h.metrics)
+
+	router.GET("/metrics", h.mwAuth(auth.ScopeMetricsRead), h.mwRateLimit(), h.prometheusMetrics)
+
+	router.GET("/agents", h.mwAuth(auth.ScopeMetricsRead), h.mwRateLimit(), h.agents)
+
+	// Маршруты алертов и администрирования появились вместе с JSON-ошибками, поэтому
+	// возвращают их и без префикса /api/v1.
+	alerts := router.Group("", h.mwJSONErrors())
+
+	alerts.GET("/alerts", h.mwAuth(auth.ScopeMetricsRead), h.mwRateLimit(), h.listAlerts)
+
+	alerts.GET("/alerts/silences", h.mwAuth(auth.ScopeMetricsRead), h.mwRateLimit(), h.listSilences)
+
+	alerts.GET("/alerts/silences/:id", h.mwAuth(auth.ScopeMetricsRead), h.mwRateLimit(), h.getSilence)
+
+	alerts.GET("/alerts/groups", h.mwAuth(auth.ScopeMetricsRead), h.mwRateLimit(), h.listGroups)
+
+	alerts.GET("/alerts/rules", h.mwAuth(auth.ScopeMetricsRead), h.mwRateLimit(), h.listRules)
+
+	alerts.GET("/alerts/rules/:name", h.mwAuth(auth.ScopeMetricsRead), h.mwRateLimit(), h.getRule)
+
+	alerts.GET("/alerts/rules/:name/versions", h.mwAuth(auth.ScopeMetricsRead), h.mwRateLimit(), h.ruleVersions)
+
+	router.GET("/alerts/ui", h.rulesUI)
+
+	router.GET("/openapi.json", h.openAPI)
+
+	router.GET("/docs", h.docs)
+
+	admin := router.Group("", h.mwJSONErrors(), h.mwAuth(auth.ScopeAdmin))
+
+	pprof.RouteRegister(admin)
+
+	admin.GET("/admin/ipfilter", h.ipFilterState)
+
+	admin.GET("/admin/ratelimit", h.rateLimitState)
+
+	admin.GET("/admin/cardinality", h.cardinalityState)
+
+	admin.DELETE("/admin/metrics", h.deleteMetrics)
+
+	admin.POST("/admin/metrics/reset", h.resetCounters)
+
+	admin.POST("/admin/metrics/rename", h.renameMetric)
+
+	admin.PUT("/admin/metadata/:name", h.setMetadata)
+
+	admin.DELETE("/admin/metadata/:name", h.deleteMetadata)
+
+	admin.GET("/admin/relabel", h.relabelRules)
 
-	router.POST("/update/", h.updateWithBody)
+	admin.POST("/admin/relabel/reload", h.reloadRelabelRules)
 
-	router.POST("/updates/", h.batchUpdate)
+	admin.POST("/alerts/silences", h.createSilence)
 
-	router.GET("/value/:type/:name", h.get)
+	admin.PUT("/alerts/silences/:id", h.updateSilence)
 
-	router.POST("/value/", h.getMetricValue)
+	admin.DELETE("/alerts/silences/:id", h.deleteSilence)
 
-	router.GET("/ping", h.dbPing)
+	admin.POST("/alerts/groups/:id/ack", h.acknowledgeGroup)
 
-	router.GET("/", h.metrics)
+	admin.POST("/alerts/rules", h.createRule)
+
+	admin.PUT("/alerts/rules/:name", h.updateRule)
+
+	admin.DELETE("/alerts/rules/:name", h.deleteRule)
+
+	admin.POST("/alerts/rules/evaluate", h.evaluateRule)
 
 	h.logger.Infof("server started on port: %d", conf.Port)
 
@@ -114,6 +210,31 @@ func NewServerAPI(conf *Config) *API {
 	}
 }
 
+// registerMetricRoutes регистрирует маршруты для работы с метриками в группе.
+func (h *handler) registerMetricRoutes(group *gin.RouterGroup) {
+	write := group.Group("", h.mwAuth(auth.ScopeMetricsWrite), h.mwRateLimit(), h.mwClient())
+
+	write.POST("/update/:type/:name/:value", h.update)
+
+	write.POST("/update/", h.updateWithBody)
+
+	write.POST("/updates/", h.batchUpdate)
+
+	write.POST(streamRoute, h.streamUpdate)
+
+	read := group.Group("", h.mwAuth(auth.ScopeMetricsRead), h.mwRateLimit())
+
+	read.GET("/value/:type/:name", h.get)
+
+	read.POST("/value/", h.getMetricValue)
+
+	read.POST("/values/", h.getMetricValues)
+
+	read.GET("/metadata/", h.listMetadata)
+
+	group.GET("/ping", h.dbPing)
+}
+
 // loadPrivateKey загружает закрытый ключ из файла.
 func loadPrivateKey(path string) (*rsa.PrivateKey, error) {
 	data, err := os.ReadFile(path)
@@ -144,6 +265,11 @@ func (h *handler) mwEncrypt() gin.HandlerFunc {
 
 		// парсим данные из тела запроса
 		body, err := io.ReadAll(c.Request.Body)
+		if isBodyTooLarge(err) {
+			h.bodyTooLarge(c, err)
+			return
+		}
+
 		if err != nil {
 			h.logger.Errorf("failed to read request body: %v", err)
 			c.Writer.WriteHeader(http.StatusBadRequest)
@@ -172,41 +298,105 @@ func (h *handler) mwEncrypt() gin.HandlerFunc {
 	}
 }
 
-// nwIpFilter middleware для фильтрации IP-адресов.
-func (h *handler) mwIPFilter() gin.HandlerFunc {
+// mwAuth middleware для проверки bearer-токена и прав доступа клиента.
+// Если аутентификация не настроена, запросы пропускаются без проверки.
+func (h *handler) mwAuth(scope string) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		if h.trustedSubnet == "" {
+		if h.auth == nil {
 			c.Next()
 			return
 		}
 
-		realIP := c.GetHeader("X-Real-IP")
-		if realIP == "" {
-			h.logger.Warnf("X-Real-IP header not found")
-			c.Writer.WriteHeader(http.StatusForbidden)
-			c.Abort()
+		identity, err := h.auth.Authorize(c.GetHeader("Authorization"), scope)
+		if err != nil {
+			h.logger.Warnf("access denied, uri: %s, error: %v", c.Request.RequestURI, err)
+
+			if errors.Is(err, auth.ErrForbidden) {
+				h.abort(c, http.StatusForbidden, codeForbidden, "scope "+scope+" required")
+				return
+			}
+
+			c.Header("WWW-Authenticate", "Bearer")
+			h.abort(c, http.StatusUnauthorized, codeUnauthorized, "valid bearer token required")
+			return
 		}
 
-		ip := net.ParseIP(realIP)
-		if ip == nil {
-			h.logger.Warnf("failed to parse IP address: %s", realIP)
-			c.Writer.WriteHeader(http.StatusForbidden)
-			c.Abort()
+		c.Request = c.Request.WithContext(auth.WithIdentity(c.Request.Context(), identity))
+
+		c.Next()
+	}
+}
+
+// mwIPFilter middleware для фильтрации запросов по IP-адресу клиента.
+// Адрес клиента сохраняется в контексте запроса.
+func (h *handler) mwIPFilter() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if h.ipFilter == nil {
+			c.Next()
 			return
 		}
 
-		_, subnet, err := net.ParseCIDR(h.trustedSubnet)
+		ip, err := h.ipFilter.ClientIP(c.Request)
+		if err == nil {
+			err = h.ipFilter.Check(ip)
+		}
+
 		if err != nil {
-			h.logger.Errorf("failed to parse trusted subnet: %v", err)
-			c.Writer.WriteHeader(http.StatusInternalServerError)
-			c.Abort()
+			reason := h.ipFilter.Reject(err)
+			h.logger.Warnw("request rejected by ip filter",
+				"reason", reason,
+				"remote_addr", c.Request.RemoteAddr,
+				"uri", c.Request.RequestURI,
+				"error", err,
+			)
+			h.abort(c, http.StatusForbidden, codeForbidden, "client address rejected: "+reason)
 			return
 		}
 
-		if !subnet.Contains(ip) {
-			h.logger.Warnf("IP address %s is not in trusted subnet %s", realIP, h.trustedSubnet)
-			c.Writer.WriteHeader(http.StatusForbidden)
-			c.Abort()
+		c.Request = c.Request.WithContext(ipfilter.WithClientIP(c.Request.Context(), ip))
+
+		c.Next()
+	}
+}
+
+func (h *handler) ipFilterState(ginCtx *gin.Context) {
+	var rejected map[string]int64
+	if h.ipFilter != nil {
+		rejected = h.ipFilter.Rejected()
+	}
+
+	ginCtx.JSON(http.StatusOK, gin.H{"rejected": rejected})
+}
+
+// clientKey возвращает ключ клиента для ограничения частоты запросов:
+// имя токена, если клиент аутентифицирован, иначе IP-адрес.
+func clientKey(r *http.Request) string {
+	if identity, ok := auth.IdentityFromContext(r.Context()); ok {
+		return "token:" + identity.Name
+	}
+
+	if ip, ok := ipfilter.ClientIPFromContext(r.Context()); ok {
+		return "ip:" + ip.String()
+	}
+
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		return "ip:" + host
+	}
+
+	return "ip:" + r.RemoteAddr
+}
+
+// mwRateLimit middleware для ограничения частоты запросов клиента.
+func (h *handler) mwRateLimit() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if h.limiter == nil {
+			c.Next()
+			return
+		}
+
+		key := clientKey(c.Request)
+		if retryAfter, ok := h.limiter.AllowRequest(key); !ok {
+			h.tooManyRequests(c, key, retryAfter)
 			return
 		}
 
@@ -214,6 +404,89 @@ func (h *handler) mwIPFilter() gin.HandlerFunc {
 	}
 }
 
+// agentIDHeader заголовок с идентификатором агента.
+const agentIDHeader = "X-Agent-ID"
+
+// mwClient middleware сохраняет в контексте источник записи метрик для учета лимитов кардинальности:
+// агентом считается идентификатор из заголовка X-Agent-ID, а без него клиент с ключом clientKey.
+// Арендатор берется из токена.
+func (h *handler) mwClient() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		client := model.Client{Agent: clientKey(c.Request)}
+
+		var token string
+		if identity, ok := auth.IdentityFromContext(c.Request.Context()); ok {
+			client.Tenant = identity.Tenant
+			token = identity.Name
+		}
+
+		if agentID := c.GetHeader(agentIDHeader); agentID != "" {
+			agent, err := application.AgentName(token, agentID)
+			if err != nil {
+				h.abort(c, http.StatusBadRequest, application.ErrorCode(err), application.ErrorMessage(err))
+				return
+			}
+
+			client.Agent = agent
+		}
+
+		c.Request = c.Request.WithContext(application.WithClient(c.Request.Context(), client))
+
+		c.Next()
+	}
+}
+
+// allowMetrics проверяет лимит клиента на количество метрик.
+// Если лимит исчерпан, отправляет ответ 429 и возвращает false.
+func (h *handler) allowMetrics(c *gin.Context, n int) bool {
+	if h.limiter == nil {
+		return true
+	}
+
+	key := clientKey(c.Request)
+	if retryAfter, ok := h.limiter.AllowMetrics(key, n); !ok {
+		h.tooManyRequests(c, key, retryAfter)
+		return false
+	}
+
+	return true
+}
+
+// allowChunk проверяет лимит метрик для части пакета. Лимит проверяется только для первой части:
+// после нее пакет уже частично применен, и ответ 429 оставил бы клиента без результата
+// примененных частей. Остальные части списываются в долг.
+func (h *handler) allowChunk(c *gin.Context, chunk, n int) bool {
+	if chunk == 0 || h.limiter == nil {
+		return h.allowMetrics(c, n)
+	}
+
+	h.limiter.ChargeMetrics(clientKey(c.Request), n)
+
+	return true
+}
+
+func (h *handler) tooManyRequests(c *gin.Context, key string, retryAfter time.Duration) {
+	seconds := int64(math.Ceil(retryAfter.Seconds()))
+	if seconds < 1 {
+		seconds = 1
+	}
+
+	h.logger.Warnf("rate limit exceeded, client: %s, retry after: %ds", key, seconds)
+
+	c.Header("Retry-After", strconv.FormatInt(seconds, 10))
+	h.abort(c, http.StatusTooManyRequests, codeRateLimited,
+		fmt.Sprintf("rate limit exceeded, retry after %d seconds", seconds))
+}
+
+func (h *handler) rateLimitState(ginCtx *gin.Context) {
+	if h.limiter == nil {
+		ginCtx.JSON(http.StatusOK, ratelimit.Snapshot{Clients: []ratelimit.State{}})
+		return
+	}
+
+	ginCtx.JSON(http.StatusOK, h.limiter.Snapshot())
+}
+
 // mwDecompress middleware для распаковки gzip-сжатых данных.
 func (h *handler) mwDecompress() gin.HandlerFunc {
 	return func(c *gin.Context) {
@@ -238,7 +511,12 @@ func (h *handler) mwDecompress() gin.HandlerFunc {
 			}
 		}()
 
-		c.Request.Body = io.NopCloser(gzipReader)
+		limit := h.maxUnzipSize
+		if h.unboundedBody(c) {
+			limit = 0
+		}
+
+		c.Request.Body = io.NopCloser(newLimitReader(gzipReader, limit))
 
 		c.Writer.Header().Set("Content-Encoding", gzipScheme)
 		c.Writer.Header().Set("Accept-Encoding", gzipScheme)
@@ -247,6 +525,31 @@ func (h *handler) mwDecompress() gin.HandlerFunc {
 	}
 }
 
+// mwTimeout middleware для ограничения времени обработки запроса.
+// Контекст запроса с дедлайном передается в приложение и хранилище,
+// поэтому по таймауту или при отключении клиента запросы к БД прерываются.
+// Поток метрик не ограничивается общим таймаутом, только явно заданным для его маршрута.
+func (h *handler) mwTimeout() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		timeout, ok := h.routeTimeouts[c.FullPath()]
+		if !ok && !isStreamRoute(c) {
+			timeout = h.requestTimeout
+		}
+
+		if timeout <= 0 {
+			c.Next()
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), timeout)
+		defer cancel()
+
+		c.Request = c.Request.WithContext(ctx)
+
+		c.Next()
+	}
+}
+
 // mwLog middleware для логирования запросов.
 func (h *handler) mwLog() gin.HandlerFunc {
 	return func(c *gin.Context) {
@@ -283,11 +586,19 @@ func (a *API) Shutdown(ctx context.Context) error {
 }
 
 type handler struct {
-	server        ServerService
-	logger        zap.SugaredLogger
-	privateKey    *rsa.PrivateKey
-	hashKey       string
-	trustedSubnet string
+	server         ServerService
+	alerts         AlertService
+	auth           *auth.Authenticator
+	ipFilter       *ipfilter.Filter
+	limiter        *ratelimit.Limiter
+	logger         zap.SugaredLogger
+	privateKey     *rsa.PrivateKey
+	routeTimeouts  map[string]time.Duration
+	hashKey        string
+	requestTimeout time.Duration
+	maxBodySize    int64
+	maxUnzipSize   int64
+	batchChunkSize int
 }
 
 func (h *handler) update(ginCtx *gin.Context) {
@@ -307,7 +618,7 @@ func (h *handler) update(ginCtx *gin.Context) {
 		v, err := strconv.Atoi(metricValue)
 		if err != nil {
 			h.logger.Errorf("failed to parse counter, value: %s, error: %v", metricValue, err)
-			ginCtx.Writer.WriteHeader(http.StatusBadRequest)
+			h.abort(ginCtx, http.StatusBadRequest, codeInvalidValue, "counter value must be an integer")
 			return
 		}
 
@@ -318,28 +629,24 @@ func (h *handler) update(ginCtx *gin.Context) {
 		v, err := strconv.ParseFloat(metricValue, 64)
 		if err != nil {
 			h.logger.Errorf("failed to parse gauge, value: %s, error: %v", metricValue, err)
-			ginCtx.Writer.WriteHeader(http.StatusBadRequest)
+			h.abort(ginCtx, http.StatusBadRequest, codeInvalidValue, "gauge value must be a number")
 			return
 		}
 
 		request.Value = &v
 	default:
 		h.logger.Errorf("unknown metric type: %s", metricType)
-		ginCtx.Writer.WriteHeader(http.StatusBadRequest)
+		h.abort(ginCtx, http.StatusBadRequest, application.CodeUnknownType, "unknown metric type, value: "+metricType)
 		return
 	}
 
-	err := h.server.UpdateMetric(context.TODO(), request)
+	if !h.allowMetrics(ginCtx, 1) {
+		return
+	}
+
+	err := h.server.UpdateMetric(ginCtx.Request.Context(), request)
 	if err != nil {
-		switch {
-		case errors.Is(err, application.ErrBadRequest):
-			ginCtx.Writer.WriteHeader(http.StatusBadRequest)
-		case errors.Is(err, application.ErrNotFound):
-			ginCtx.Writer.WriteHeader(http.StatusNotFound)
-		default:
-			h.logger.Errorf("failed to update metric: %v", err)
-			ginCtx.Writer.WriteHeader(http.StatusInternalServerError)
-		}
+		h.writeError(ginCtx, "failed to update metric", err)
 		return
 	}
 
@@ -349,132 +656,78 @@ func (h *handler) update(ginCtx *gin.Context) {
 func (h *handler) updateWithBody(ginCtx *gin.Context) {
 	var metric model.MetricRequest
 
-	err := ginCtx.BindJSON(&metric)
+	err := ginCtx.ShouldBindJSON(&metric)
 	if err != nil {
 		h.logger.Errorf("failed to bind json: %v", err)
-		ginCtx.Writer.WriteHeader(http.StatusBadRequest)
+		h.invalidBody(ginCtx, err)
+		return
+	}
+
+	if !h.allowMetrics(ginCtx, 1) {
 		return
 	}
 
-	err = h.server.UpdateMetric(context.TODO(), metric)
+	err = h.server.UpdateMetric(ginCtx.Request.Context(), metric)
 	if err != nil {
-		switch {
-		case errors.Is(err, application.ErrBadRequest):
-			ginCtx.Writer.WriteHeader(http.StatusBadRequest)
-		case errors.Is(err, application.ErrNotFound):
-			ginCtx.Writer.WriteHeader(http.StatusNotFound)
-		default:
-			h.logger.Errorf("failed to update metric: %v", err)
-			ginCtx.Writer.WriteHeader(http.StatusInternalServerError)
-		}
+		h.writeError(ginCtx, "failed to update metric", err)
 		return
 	}
 
 	ginCtx.Writer.WriteHeader(http.StatusOK)
 }
 
+// get возвращает значение метрики. По умолчанию значение отдается текстом,
+// JSON и protobuf выбираются заголовком Accept.
 func (h *handler) get(ginCtx *gin.Context) {
 	var (
 		metricType = ginCtx.Param("type")
 		metricName = ginCtx.Param("name")
 	)
 
-	value, err := h.server.GetMetric(context.TODO(), metricName, metricType)
-	if err != nil {
-		switch {
-		case errors.Is(err, application.ErrBadRequest):
-			ginCtx.Writer.WriteHeader(http.StatusBadRequest)
-		case errors.Is(err, application.ErrNotFound):
-			ginCtx.Writer.WriteHeader(http.StatusNotFound)
-		default:
-			h.logger.Errorf("failed to get metric: %v", err)
-			ginCtx.Writer.WriteHeader(http.StatusInternalServerError)
-		}
+	format, ok := h.negotiate(ginCtx, textFirst)
+	if !ok {
 		return
 	}
 
-	ginCtx.Writer.WriteHeader(http.StatusOK)
-	_, err = ginCtx.Writer.WriteString(value)
+	value, err := h.server.GetMetric(ginCtx.Request.Context(), metricName, metricType)
 	if err != nil {
-		h.logger.Errorf("failed to write response: %v", err)
-		ginCtx.Writer.WriteHeader(http.StatusInternalServerError)
+		h.writeError(ginCtx, "failed to get metric", err)
 		return
 	}
+
+	h.writeMetric(ginCtx, format, metricName, metricType, value)
 }
 
+// getMetricValue возвращает значение метрики, заданной в теле запроса. По умолчанию ответ
+// отдается в JSON, текст и protobuf выбираются заголовком Accept.
 func (h *handler) getMetricValue(ginCtx *gin.Context) {
-	var request model.MetricRequest
-
-	err := ginCtx.BindJSON(&request)
-	if err != nil {
-		h.logger.Errorf("failed to bind json: %v", err)
-		ginCtx.Writer.WriteHeader(http.StatusBadRequest)
-		return
-	}
-
-	value, err := h.server.GetMetric(context.TODO(), request.ID, request.MType)
-	if err != nil {
-		switch {
-		case errors.Is(err, application.ErrBadRequest):
-			ginCtx.Writer.WriteHeader(http.StatusBadRequest)
-		case errors.Is(err, application.ErrNotFound):
-			ginCtx.Writer.WriteHeader(http.StatusNotFound)
-		default:
-			h.logger.Errorf("failed to get metric: %v", err)
-			ginCtx.Writer.WriteHeader(http.StatusInternalServerError)
-		}
+	format, ok := h.negotiate(ginCtx, jsonFirst)
+	if !ok {
 		return
 	}
 
-	response := model.MetricRequest{
-		ID:    request.ID,
-		MType: request.MType,
-	}
-
-	switch request.MType {
-	case counterType:
-		v, newErr := strconv.Atoi(value)
-		if newErr != nil {
-			h.logger.Errorf("failed to parse counter, value: %s, error: %v", value, newErr)
-			ginCtx.Writer.WriteHeader(http.StatusInternalServerError)
-			return
-		}
-
-		metricValue := int64(v)
-
-		response.Delta = &metricValue
-	case gaugeType:
-		v, newErr := strconv.ParseFloat(value, 64)
-		if newErr != nil {
-			h.logger.Errorf("failed to parse gauge, value: %s, error: %v", value, newErr)
-			ginCtx.Writer.WriteHeader(http.StatusInternalServerError)
-			return
-		}
-
-		response.Value = &v
-	}
+	var request model.MetricRequest
 
-	bytes, err := json.Marshal(response)
+	err := ginCtx.ShouldBindJSON(&request)
 	if err != nil {
-		h.logger.Errorf("failed to marshal response: %v", err)
-		ginCtx.Writer.WriteHeader(http.StatusInternalServerError)
+		h.logger.Errorf("failed to bind json: %v", err)
+		h.invalidBody(ginCtx, err)
 		return
 	}
 
-	ginCtx.Writer.WriteHeader(http.StatusOK)
-	ginCtx.Header("Content-Type", "application/json")
-	_, err = ginCtx.Writer.Write(bytes)
+	value, err := h.server.GetMetric(ginCtx.Request.Context(), request.ID, request.MType)
 	if err != nil {
-		h.logger.Errorf("failed to write response: %v", err)
-		ginCtx.Writer.WriteHeader(http.StatusInternalServerError)
+		h.writeError(ginCtx, "failed to get metric", err)
 		return
 	}
+
+	h.writeMetric(ginCtx, format, request.ID, request.MType, value)
 }
 
 func (h *handler) metrics(ginCtx *gin.Context) {
 	ginCtx.Writer.WriteHeader(http.StatusOK)
 
-	metrics, err := h.server.GetMetrics(context.TODO())
+	metrics, err := h.server.GetMetrics(ginCtx.Request.Context())
 	if err != nil {
 		h.logger.Errorf("failed to get metrics: %v", err)
 		ginCtx.Writer.WriteHeader(http.StatusInternalServerError)
@@ -511,11 +764,17 @@ const metricsTemplate = `
         <tr>
             <th>Name</th>
             <th>Value</th>
+            <th>Unit</th>
+            <th>Description</th>
+            <th>Status</th>
         </tr>
         {{ range . }}
         <tr>
             <td>{{ .Name }}</td>
             <td>{{ .Value }}</td>
+            <td>{{ .Unit }}</td>
+            <td>{{ .Help }}</td>
+            <td>{{ if .Stale }}stale{{ end }}</td>
         </tr>
         {{ end }}
     </table>
@@ -593,31 +852,100 @@ const (
 	gaugeType   = "gauge"
 )
 
+// batchUpdate обновляет пакет метрик. Пакет читается и применяется частями по batchChunkSize метрик,
+// поэтому большой пакет не загружается в память целиком. Если чтение прервалось на середине
+// пакета, уже примененные части остаются записанными. В строгом режиме пакет читается целиком,
+// чтобы проверить все метрики до записи.
 func (h *handler) batchUpdate(ginCtx *gin.Context) {
-	var request []model.MetricRequest
-
-	err := ginCtx.BindJSON(&request)
+	opts, err := batchOptions(ginCtx)
 	if err != nil {
-		h.logger.Errorf("failed to bind json: %v", err)
-		ginCtx.Writer.WriteHeader(http.StatusBadRequest)
+		h.logger.Errorf("failed to parse batch options: %v", err)
+		h.abort(ginCtx, http.StatusBadRequest, codeInvalidValue, err.Error())
 		return
 	}
 
-	err = h.server.UpdateMetrics(context.TODO(), request)
-	if err != nil {
-		switch {
-		case errors.Is(err, application.ErrBadRequest):
-			ginCtx.Writer.WriteHeader(http.StatusBadRequest)
-		case errors.Is(err, application.ErrNotFound):
-			ginCtx.Writer.WriteHeader(http.StatusNotFound)
-		default:
-			h.logger.Errorf("failed to update metrics: %v", err)
-			ginCtx.Writer.WriteHeader(http.StatusInternalServerError)
+	chunkSize := h.chunkSize()
+	if opts.Strict {
+		chunkSize = 0
+	}
+
+	var (
+		decoder = newBatchDecoder(ginCtx.Request.Body)
+		total   = model.BatchResult{Items: []model.ItemResult{}}
+		offset  int
+	)
+
+	for chunk := 0; !decoder.done; chunk++ {
+		request, err := decoder.next(chunkSize)
+		if err != nil {
+			h.logger.Errorf("failed to decode batch: %v", err)
+
+			if isBodyTooLarge(err) {
+				h.bodyTooLarge(ginCtx, err)
+				return
+			}
+
+			h.abort(ginCtx, http.StatusBadRequest, codeInvalidBody,
+				fmt.Sprintf("invalid json body, %d metrics applied before the error", offset))
+			return
 		}
-		return
+
+		if !h.allowChunk(ginCtx, chunk, len(request)) {
+			return
+		}
+
+		result, err := h.server.UpdateMetrics(ginCtx.Request.Context(), request, chunkOptions(opts, chunk))
+		if err != nil {
+			if opts.Strict && errors.Is(err, application.ErrBadRequest) {
+				h.abort(ginCtx, http.StatusBadRequest, codeInvalidBatch, application.ErrorMessage(err),
+					rejectedDetails(result)...)
+				return
+			}
+
+			h.writeError(ginCtx, "failed to update metrics", err)
+			return
+		}
+
+		mergeResult(&total, result, offset, chunk)
+		offset += len(request)
 	}
 
-	ginCtx.Writer.WriteHeader(http.StatusOK)
+	if total.Replayed {
+		h.logger.Infof("batch already applied, idempotency key: %s", opts.IdempotencyKey)
+	}
+
+	if total.Rejected > 0 {
+		h.logger.Warnf("batch partially rejected, accepted: %d, rejected: %d", total.Accepted, total.Rejected)
+	}
+
+	ginCtx.JSON(http.StatusOK, total)
+}
+
+// maxIdempotencyKeyLength максимальная длина ключа идемпотентности.
+const maxIdempotencyKeyLength = 255
+
+// batchOptions разбирает параметры обработки пакета из запроса.
+// Параметр strict=true включает строгий режим: пакет с некорректной метрикой отклоняется целиком.
+// Заголовок Idempotency-Key задает ключ пакета: повтор пакета с тем же ключом не применяется.
+func batchOptions(ginCtx *gin.Context) (model.BatchOptions, error) {
+	opts := model.BatchOptions{
+		IdempotencyKey: ginCtx.GetHeader("Idempotency-Key"),
+	}
+
+	if len(opts.IdempotencyKey) > maxIdempotencyKeyLength {
+		return opts, fmt.Errorf("idempotency key is longer than %d bytes", maxIdempotencyKeyLength)
+	}
+
+	if value := ginCtx.Query("strict"); value != "" {
+		strict, err := strconv.ParseBool(value)
+		if err != nil {
+			return opts, fmt.Errorf("invalid strict parameter: %w", err)
+		}
+
+		opts.Strict = strict
+	}
+
+	return opts, nil
 }
 
 func (h *handler) encryptionMiddleware() gin.HandlerFunc {
@@ -5,6 +5,7 @@ import (
 	"bytes"
 	"context"
 	"errors"
+	"fmt"
 	"io"
 	"net/http"
 	"net/http/httptest"
@@ -19,6 +20,9 @@ import (
 
 	"metricalert/internal/server/core/application"
 	"metricalert/internal/server/core/model"
+	"metricalert/internal/server/infra/auth"
+	"metricalert/internal/server/infra/ipfilter"
+	"metricalert/internal/server/infra/ratelimit"
 )
 
 type MockServerService struct {
@@ -30,11 +34,62 @@ func (m *MockServerService) UpdateMetric(ctx context.Context, request model.Metr
 	return args.Error(0)
 }
 
-func (m *MockServerService) UpdateMetrics(ctx context.Context, request []model.MetricRequest) error {
-	args := m.Called(ctx, request)
+func (m *MockServerService) UpdateMetrics(ctx context.Context, request []model.MetricRequest,
+	opts model.BatchOptions) (model.BatchResult, error) {
+	args := m.Called(ctx, request, opts)
+	return args.Get(0).(model.BatchResult), args.Error(1)
+}
+
+func (m *MockServerService) DeleteMetrics(ctx context.Context, sel model.MetricSelector) ([]model.MetricRef, error) {
+	args := m.Called(ctx, sel)
+	return args.Get(0).([]model.MetricRef), args.Error(1)
+}
+
+func (m *MockServerService) ResetCounters(ctx context.Context, sel model.MetricSelector) ([]model.MetricRef, error) {
+	args := m.Called(ctx, sel)
+	return args.Get(0).([]model.MetricRef), args.Error(1)
+}
+
+func (m *MockServerService) RenameMetric(ctx context.Context, mType, from, to string) error {
+	args := m.Called(ctx, mType, from, to)
+	return args.Error(0)
+}
+
+func (m *MockServerService) ExportMetrics(ctx context.Context) ([]model.MetricState, error) {
+	args := m.Called(ctx)
+	return args.Get(0).([]model.MetricState), args.Error(1)
+}
+
+func (m *MockServerService) SetMetadata(ctx context.Context, meta model.MetricMeta) error {
+	args := m.Called(ctx, meta)
+	return args.Error(0)
+}
+
+func (m *MockServerService) DeleteMetadata(ctx context.Context, name string) error {
+	args := m.Called(ctx, name)
 	return args.Error(0)
 }
 
+func (m *MockServerService) ListMetadata(ctx context.Context) ([]model.MetricMeta, error) {
+	args := m.Called(ctx)
+	return args.Get(0).([]model.MetricMeta), args.Error(1)
+}
+
+func (m *MockServerService) RelabelRules(ctx context.Context) ([]model.RelabelRule, error) {
+	args := m.Called(ctx)
+	return args.Get(0).([]model.RelabelRule), args.Error(1)
+}
+
+func (m *MockServerService) ReloadRelabelRules(ctx context.Context) ([]model.RelabelRule, error) {
+	args := m.Called(ctx)
+	return args.Get(0).([]model.RelabelRule), args.Error(1)
+}
+
+func (m *MockServerService) CardinalityState(ctx context.Context) (model.CardinalityState, error) {
+	args := m.Called(ctx)
+	return args.Get(0).(model.CardinalityState), args.Error(1)
+}
+
 func (m *MockServerService) GetMetric(ctx context.Context, metricName, metricType string) (string, error) {
 	args := m.Called(ctx, metricName, metricType)
 	return args.String(0), args.Error(1)
@@ -80,6 +135,7 @@ func TestServerAPI_UpdateMetric(t *testing.T) {
 		}
 
 		c, _ := gin.CreateTestContext(nil)
+		c.Request = httptest.NewRequest(http.MethodPost, "/update/", nil)
 
 		h.update(c)
 
@@ -97,6 +153,7 @@ func TestServerAPI_UpdateMetric(t *testing.T) {
 		}
 
 		c, _ := gin.CreateTestContext(nil)
+		c.Request = httptest.NewRequest(http.MethodPost, "/update/", nil)
 
 		c.Params = append(c.Params, gin.Param{Key: "type", Value: "invalid"})
 
@@ -116,6 +173,7 @@ func TestServerAPI_UpdateMetric(t *testing.T) {
 		}
 
 		c, _ := gin.CreateTestContext(nil)
+		c.Request = httptest.NewRequest(http.MethodPost, "/update/", nil)
 
 		c.Params = append(c.Params, gin.Param{Key: "type", Value: "gauge"})
 
@@ -137,6 +195,7 @@ func TestServerAPI_UpdateMetric(t *testing.T) {
 		}
 
 		c, _ := gin.CreateTestContext(nil)
+		c.Request = httptest.NewRequest(http.MethodPost, "/update/", nil)
 
 		c.Params = append(c.Params, gin.Param{Key: "type", Value: "gauge"})
 		c.Params = append(c.Params, gin.Param{Key: "name", Value: "test"})
@@ -163,6 +222,7 @@ func TestServerAPI_UpdateMetric(t *testing.T) {
 		}
 
 		c, _ := gin.CreateTestContext(nil)
+		c.Request = httptest.NewRequest(http.MethodPost, "/update/", nil)
 
 		c.Params = append(c.Params, gin.Param{Key: "type", Value: "gauge"})
 		c.Params = append(c.Params, gin.Param{Key: "name", Value: "test"})
@@ -189,6 +249,7 @@ func TestServerAPI_UpdateMetric(t *testing.T) {
 		}
 
 		c, _ := gin.CreateTestContext(nil)
+		c.Request = httptest.NewRequest(http.MethodPost, "/update/", nil)
 
 		c.Params = append(c.Params, gin.Param{Key: "type", Value: "gauge"})
 		c.Params = append(c.Params, gin.Param{Key: "name", Value: "test"})
@@ -215,6 +276,7 @@ func TestServerAPI_UpdateMetric(t *testing.T) {
 		}
 
 		c, _ := gin.CreateTestContext(nil)
+		c.Request = httptest.NewRequest(http.MethodPost, "/update/", nil)
 
 		c.Params = append(c.Params, gin.Param{Key: "type", Value: "gauge"})
 		c.Params = append(c.Params, gin.Param{Key: "name", Value: "test"})
@@ -241,6 +303,7 @@ func TestServerAPI_UpdateMetric(t *testing.T) {
 		}
 
 		c, _ := gin.CreateTestContext(nil)
+		c.Request = httptest.NewRequest(http.MethodPost, "/update/", nil)
 
 		c.Params = append(c.Params, gin.Param{Key: "type", Value: "counter"})
 		c.Params = append(c.Params, gin.Param{Key: "name", Value: "test"})
@@ -267,6 +330,7 @@ func TestServerAPI_UpdateMetric(t *testing.T) {
 		}
 
 		c, _ := gin.CreateTestContext(nil)
+		c.Request = httptest.NewRequest(http.MethodPost, "/update/", nil)
 
 		c.Params = append(c.Params, gin.Param{Key: "type", Value: "counter"})
 		c.Params = append(c.Params, gin.Param{Key: "name", Value: "test"})
@@ -423,6 +487,7 @@ func TestServerAPI_GetMetric(t *testing.T) {
 		}
 
 		c, _ := gin.CreateTestContext(nil)
+		c.Request = httptest.NewRequest(http.MethodGet, "/value/", nil)
 
 		c.Params = append(c.Params, gin.Param{Key: "name", Value: "test"})
 
@@ -445,6 +510,7 @@ func TestServerAPI_GetMetric(t *testing.T) {
 		}
 
 		c, _ := gin.CreateTestContext(nil)
+		c.Request = httptest.NewRequest(http.MethodGet, "/value/", nil)
 
 		mockServerService.On("GetMetric", mock.Anything, mock.Anything, mock.Anything).
 			Return("", application.ErrNotFound)
@@ -465,6 +531,7 @@ func TestServerAPI_GetMetric(t *testing.T) {
 		}
 
 		c, _ := gin.CreateTestContext(nil)
+		c.Request = httptest.NewRequest(http.MethodGet, "/value/", nil)
 
 		mockServerService.On("GetMetric", mock.Anything, mock.Anything, mock.Anything).
 			Return("", application.ErrBadRequest)
@@ -486,6 +553,7 @@ func TestServerAPI_GetMetric(t *testing.T) {
 
 		recorder := httptest.NewRecorder()
 		c, _ := gin.CreateTestContext(recorder)
+		c.Request = httptest.NewRequest(http.MethodGet, "/value/", nil)
 
 		c.Params = append(c.Params, gin.Param{Key: "name", Value: "test"})
 
@@ -541,6 +609,7 @@ func TestServerAPI_GetMetricValue(t *testing.T) {
 
 		recorder := httptest.NewRecorder()
 		c, _ := gin.CreateTestContext(recorder)
+		c.Request = httptest.NewRequest(http.MethodPost, "/value/", nil)
 
 		h.getMetricValue(c)
 
@@ -734,6 +803,7 @@ func TestServerAPI_GetMetrics(t *testing.T) {
 		}
 		recorder := httptest.NewRecorder()
 		c, _ := gin.CreateTestContext(recorder)
+		c.Request = httptest.NewRequest(http.MethodGet, "/", nil)
 
 		mockServerService.On("GetMetrics", mock.Anything).
 			Return([]model.MetricData{}, errors.New("store error"))
@@ -755,6 +825,7 @@ func TestServerAPI_GetMetrics(t *testing.T) {
 
 		recorder := httptest.NewRecorder()
 		c, _ := gin.CreateTestContext(recorder)
+		c.Request = httptest.NewRequest(http.MethodGet, "/", nil)
 
 		mockServerService.On("GetMetrics", mock.Anything).
 			Return([]model.MetricData{{Name: "test"}}, nil)
@@ -992,3 +1063,283 @@ func TestServerAPI_Running(t *testing.T) {
 		assert.NoError(t, err)
 	})
 }
+
+func TestServerAPI_MwAuth(t *testing.T) {
+	authenticator, err := auth.New([]auth.TokenConfig{
+		{Name: "agent", Hash: auth.HashToken("agent-token"), Scopes: []string{auth.ScopeMetricsWrite}},
+	})
+	require.NoError(t, err)
+
+	tests := []struct {
+		name   string
+		header string
+		scope  string
+		want   int
+	}{
+		{name: "no token", scope: auth.ScopeMetricsWrite, want: http.StatusUnauthorized},
+		{name: "wrong token", header: "Bearer other", scope: auth.ScopeMetricsWrite, want: http.StatusUnauthorized},
+		{name: "missing scope", header: "Bearer agent-token", scope: auth.ScopeAdmin, want: http.StatusForbidden},
+		{name: "success", header: "Bearer agent-token", scope: auth.ScopeMetricsWrite, want: http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := handler{
+				auth:   authenticator,
+				logger: *zap.NewNop().Sugar(),
+			}
+
+			router := gin.New()
+			router.GET("/", h.mwAuth(tt.scope), func(c *gin.Context) {
+				identity, ok := auth.IdentityFromContext(c.Request.Context())
+				require.True(t, ok)
+				assert.Equal(t, "agent", identity.Name)
+
+				c.Status(http.StatusOK)
+			})
+
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tt.header != "" {
+				req.Header.Set("Authorization", tt.header)
+			}
+
+			recorder := httptest.NewRecorder()
+			router.ServeHTTP(recorder, req)
+
+			assert.Equal(t, tt.want, recorder.Code)
+		})
+	}
+
+	t.Run("auth disabled", func(t *testing.T) {
+		h := handler{logger: *zap.NewNop().Sugar()}
+
+		router := gin.New()
+		router.GET("/", h.mwAuth(auth.ScopeAdmin), func(c *gin.Context) {
+			c.Status(http.StatusOK)
+		})
+
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/", nil))
+
+		assert.Equal(t, http.StatusOK, recorder.Code)
+	})
+}
+
+func TestServerAPI_MwIPFilter(t *testing.T) {
+	filter, err := ipfilter.New(ipfilter.Config{
+		Allowed:        []string{"192.168.0.0/16", "2001:db8::/32"},
+		Denied:         []string{"192.168.10.0/24"},
+		TrustedProxies: []string{"10.0.0.1"},
+	})
+	require.NoError(t, err)
+
+	h := handler{
+		ipFilter: filter,
+		logger:   *zap.NewNop().Sugar(),
+	}
+
+	router := gin.New()
+	router.GET("/", h.mwIPFilter(), func(c *gin.Context) {
+		ip, ok := ipfilter.ClientIPFromContext(c.Request.Context())
+		require.True(t, ok)
+
+		c.String(http.StatusOK, ip.String())
+	})
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		realIP     string
+		want       int
+	}{
+		{name: "allowed peer", remoteAddr: "192.168.1.1:1234", want: http.StatusOK},
+		{name: "allowed ipv6 peer", remoteAddr: "[2001:db8::1]:1234", want: http.StatusOK},
+		{name: "denied peer", remoteAddr: "192.168.10.1:1234", want: http.StatusForbidden},
+		{name: "spoofed header", remoteAddr: "172.16.0.1:1234", realIP: "192.168.1.1", want: http.StatusForbidden},
+		{name: "header from proxy", remoteAddr: "10.0.0.1:1234", realIP: "192.168.1.1", want: http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.RemoteAddr = tt.remoteAddr
+			if tt.realIP != "" {
+				req.Header.Set("X-Real-IP", tt.realIP)
+			}
+
+			recorder := httptest.NewRecorder()
+			router.ServeHTTP(recorder, req)
+
+			assert.Equal(t, tt.want, recorder.Code)
+		})
+	}
+
+	assert.Equal(t, map[string]int64{"denied_subnet": 1, "not_allowed": 1}, filter.Rejected())
+}
+
+func TestServerAPI_RateLimit(t *testing.T) {
+	mockServerService := new(MockServerService)
+	mockServerService.On("UpdateMetrics", mock.Anything, mock.Anything, mock.Anything).Return(model.BatchResult{}, nil)
+
+	h := handler{
+		server: mockServerService,
+		limiter: ratelimit.New(ratelimit.Config{
+			RequestsPerSecond: 1,
+			RequestBurst:      2,
+			MetricsPerSecond:  1,
+			MetricsBurst:      3,
+		}),
+		logger: *zap.NewNop().Sugar(),
+	}
+
+	router := gin.New()
+	router.POST("/updates/", h.mwRateLimit(), h.batchUpdate)
+
+	send := func(body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/updates/", bytes.NewBufferString(body))
+		req.RemoteAddr = "192.168.1.1:1234"
+
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, req)
+
+		return recorder
+	}
+
+	recorder := send(`[{"id":"a","type":"gauge","value":1},{"id":"b","type":"gauge","value":1}]`)
+	assert.Equal(t, http.StatusOK, recorder.Code)
+
+	recorder = send(`[{"id":"a","type":"gauge","value":1},{"id":"b","type":"gauge","value":1}]`)
+	assert.Equal(t, http.StatusTooManyRequests, recorder.Code)
+	assert.Equal(t, "1", recorder.Header().Get("Retry-After"))
+
+	recorder = send(`[]`)
+	assert.Equal(t, http.StatusTooManyRequests, recorder.Code)
+	assert.NotEmpty(t, recorder.Header().Get("Retry-After"))
+
+	mockServerService.AssertNumberOfCalls(t, "UpdateMetrics", 1)
+}
+
+func TestServerAPI_RateLimitChunks(t *testing.T) {
+	mockServerService := new(MockServerService)
+	mockServerService.On("UpdateMetrics", mock.Anything, mock.Anything, mock.Anything).
+		Return(model.BatchResult{}, nil)
+
+	h := handler{
+		server:         mockServerService,
+		limiter:        ratelimit.New(ratelimit.Config{MetricsPerSecond: 1, MetricsBurst: 1}),
+		batchChunkSize: 1,
+		logger:         *zap.NewNop().Sugar(),
+	}
+
+	router := gin.New()
+	router.POST("/updates/", h.batchUpdate)
+
+	send := func() *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/updates/",
+			bytes.NewBufferString(`[{"id":"a","type":"gauge","value":1},{"id":"b","type":"gauge","value":1}]`))
+		req.RemoteAddr = "192.168.1.1:1234"
+
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, req)
+
+		return recorder
+	}
+
+	// вторая часть пакета не отклоняется после применения первой, а уходит в долг
+	recorder := send()
+	assert.Equal(t, http.StatusOK, recorder.Code)
+
+	calls := len(mockServerService.Calls)
+	assert.Greater(t, calls, 1)
+
+	recorder = send()
+	assert.Equal(t, http.StatusTooManyRequests, recorder.Code)
+	assert.Len(t, mockServerService.Calls, calls, "batch rejected before applying anything")
+}
+
+func TestServerAPI_MwClient(t *testing.T) {
+	h := handler{logger: *zap.NewNop().Sugar()}
+
+	var client model.Client
+
+	router := gin.New()
+	router.POST("/updates/", h.mwClient(), func(c *gin.Context) {
+		client, _ = application.ClientFromContext(c.Request.Context())
+		c.Status(http.StatusOK)
+	})
+
+	send := func(agentID string) int {
+		req := httptest.NewRequest(http.MethodPost, "/updates/", http.NoBody)
+		req.RemoteAddr = "192.168.1.1:1234"
+		if agentID != "" {
+			req.Header.Set("X-Agent-ID", agentID)
+		}
+
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, req)
+
+		return recorder.Code
+	}
+
+	assert.Equal(t, http.StatusOK, send(""))
+	assert.Equal(t, "ip:192.168.1.1", client.Agent)
+
+	// агенты за одним адресом различаются по идентификатору
+	assert.Equal(t, http.StatusOK, send("host-1"))
+	assert.Equal(t, "agent:host-1", client.Agent)
+
+	assert.Equal(t, http.StatusBadRequest, send("host 1"))
+}
+
+func TestServerAPI_MwTimeout(t *testing.T) {
+	h := handler{
+		routeTimeouts:  map[string]time.Duration{"/updates/": time.Minute},
+		requestTimeout: time.Second,
+	}
+
+	var deadlines = map[string]time.Duration{}
+
+	router := gin.New()
+	router.Use(h.mwTimeout())
+
+	handle := func(c *gin.Context) {
+		deadline, ok := c.Request.Context().Deadline()
+		require.True(t, ok)
+
+		deadlines[c.FullPath()] = time.Until(deadline)
+		c.Status(http.StatusOK)
+	}
+
+	router.POST("/updates/", handle)
+	router.GET("/value/:type/:name", handle)
+
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/updates/", nil))
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/value/gauge/a", nil))
+
+	assert.Greater(t, deadlines["/updates/"], 30*time.Second)
+	assert.LessOrEqual(t, deadlines["/value/:type/:name"], time.Second)
+}
+
+func TestServerAPI_UpdateTimeout(t *testing.T) {
+	mockServerService := new(MockServerService)
+	mockServerService.On("UpdateMetric", mock.Anything, mock.Anything).
+		Return(fmt.Errorf("failed to update gauge: %w", context.DeadlineExceeded))
+
+	h := handler{
+		server: mockServerService,
+		logger: *zap.NewNop().Sugar(),
+	}
+
+	recorder := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(recorder)
+	c.Request = httptest.NewRequest(http.MethodPost, "/update/gauge/test/1", nil)
+	c.Params = gin.Params{
+		{Key: "type", Value: "gauge"},
+		{Key: "name", Value: "test"},
+		{Key: "value", Value: "1"},
+	}
+
+	h.update(c)
+
+	assert.Equal(t, http.StatusGatewayTimeout, c.Writer.Status())
+}
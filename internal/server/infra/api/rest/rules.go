@@ -0,0 +1,193 @@
+package rest
+
+import (
+	_ "embed"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"metricalert/internal/server/core/alerting"
+	"metricalert/internal/server/infra/auth"
+)
+
+// rulesPage страница управления правилами оповещений. Страница обращается к API правил
+// с токеном, введенным пользователем, поэтому сама отдается без авторизации.
+//
+//go:embed rules.html
+var rulesPage []byte
+
+func (h *handler) rulesUI(ginCtx *gin.Context) {
+	ginCtx.Data(http.StatusOK, "text/html; charset=utf-8", rulesPage)
+}
+
+// listRules возвращает статические правила и текущие версии правил, управляемых через API.
+func (h *handler) listRules(ginCtx *gin.Context) {
+	rules := []alerting.RuleVersion{}
+	if h.alerts != nil {
+		var err error
+		if rules, err = h.alerts.Rules(ginCtx.Request.Context()); err != nil {
+			h.writeError(ginCtx, "failed to get alert rules", err)
+			return
+		}
+	}
+
+	ginCtx.JSON(http.StatusOK, gin.H{"rules": rules})
+}
+
+// getRule возвращает текущую версию правила.
+func (h *handler) getRule(ginCtx *gin.Context) {
+	if !h.requireAlerts(ginCtx) {
+		return
+	}
+
+	rule, err := h.alerts.Rule(ginCtx.Request.Context(), ginCtx.Param("name"))
+	if err != nil {
+		h.writeError(ginCtx, "failed to get alert rule", err)
+		return
+	}
+
+	ginCtx.JSON(http.StatusOK, rule)
+}
+
+// ruleVersions возвращает все версии правила от старых к новым.
+func (h *handler) ruleVersions(ginCtx *gin.Context) {
+	if !h.requireAlerts(ginCtx) {
+		return
+	}
+
+	versions, err := h.alerts.RuleVersions(ginCtx.Request.Context(), ginCtx.Param("name"))
+	if err != nil {
+		h.writeError(ginCtx, "failed to get alert rule versions", err)
+		return
+	}
+
+	ginCtx.JSON(http.StatusOK, gin.H{"versions": versions})
+}
+
+// createRule создает правило. Автором версии становится владелец токена.
+func (h *handler) createRule(ginCtx *gin.Context) {
+	if !h.requireAlerts(ginCtx) {
+		return
+	}
+
+	rule, ok := h.bindRule(ginCtx)
+	if !ok {
+		return
+	}
+
+	version, err := h.alerts.CreateRule(ginCtx.Request.Context(), rule, ruleAuthor(ginCtx))
+	if err != nil {
+		h.writeError(ginCtx, "failed to create alert rule", err)
+		return
+	}
+
+	h.logger.Infof("alert rule created, name: %s, by: %s", rule.Name, version.UpdatedBy)
+
+	ginCtx.JSON(http.StatusCreated, version)
+}
+
+// updateRule сохраняет новую версию правила. Имя правила берется из пути.
+// Необязательный параметр version задает ожидаемую текущую версию, при несовпадении возвращается 409.
+func (h *handler) updateRule(ginCtx *gin.Context) {
+	if !h.requireAlerts(ginCtx) {
+		return
+	}
+
+	expected, ok := h.queryVersion(ginCtx)
+	if !ok {
+		return
+	}
+
+	rule, ok := h.bindRule(ginCtx)
+	if !ok {
+		return
+	}
+
+	rule.Name = ginCtx.Param("name")
+
+	version, err := h.alerts.UpdateRule(ginCtx.Request.Context(), rule, expected, ruleAuthor(ginCtx))
+	if err != nil {
+		h.writeError(ginCtx, "failed to update alert rule", err)
+		return
+	}
+
+	h.logger.Infof("alert rule updated, name: %s, version: %d, by: %s", rule.Name, version.Version, version.UpdatedBy)
+
+	ginCtx.JSON(http.StatusOK, version)
+}
+
+// deleteRule удаляет правило. Параметр version проверяется как в updateRule.
+func (h *handler) deleteRule(ginCtx *gin.Context) {
+	if !h.requireAlerts(ginCtx) {
+		return
+	}
+
+	expected, ok := h.queryVersion(ginCtx)
+	if !ok {
+		return
+	}
+
+	name := ginCtx.Param("name")
+
+	if err := h.alerts.DeleteRule(ginCtx.Request.Context(), name, expected, ruleAuthor(ginCtx)); err != nil {
+		h.writeError(ginCtx, "failed to delete alert rule", err)
+		return
+	}
+
+	h.logger.Infof("alert rule deleted, name: %s", name)
+
+	ginCtx.Status(http.StatusNoContent)
+}
+
+// evaluateRule вычисляет правило по текущим значениям метрик без сохранения,
+// чтобы проверить его перед созданием или изменением.
+func (h *handler) evaluateRule(ginCtx *gin.Context) {
+	if !h.requireAlerts(ginCtx) {
+		return
+	}
+
+	rule, ok := h.bindRule(ginCtx)
+	if !ok {
+		return
+	}
+
+	results, err := h.alerts.EvaluateRule(ginCtx.Request.Context(), rule)
+	if err != nil {
+		h.writeError(ginCtx, "failed to evaluate alert rule", err)
+		return
+	}
+
+	ginCtx.JSON(http.StatusOK, gin.H{"results": results})
+}
+
+func (h *handler) bindRule(ginCtx *gin.Context) (alerting.Rule, bool) {
+	var rule alerting.Rule
+	if err := ginCtx.ShouldBindJSON(&rule); err != nil {
+		h.logger.Errorf("failed to bind json: %v", err)
+		h.invalidBody(ginCtx, err)
+
+		return rule, false
+	}
+
+	return rule, true
+}
+
+// queryVersion возвращает ожидаемую версию правила из параметра version, 0 если он не задан.
+func (h *handler) queryVersion(ginCtx *gin.Context) (int, bool) {
+	version, err := queryInt(ginCtx, "version", 0)
+	if err != nil || version < 0 {
+		h.abort(ginCtx, http.StatusBadRequest, codeInvalidValue, "invalid version parameter")
+		return 0, false
+	}
+
+	return version, true
+}
+
+// ruleAuthor возвращает имя владельца токена запроса.
+func ruleAuthor(ginCtx *gin.Context) string {
+	if identity, ok := auth.IdentityFromContext(ginCtx.Request.Context()); ok {
+		return identity.Name
+	}
+
+	return ""
+}
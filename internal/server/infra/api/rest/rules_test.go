@@ -0,0 +1,243 @@
+//nolint:wrapcheck,nolintlint,errcheck
+package rest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+
+	"metricalert/internal/server/core/alerting"
+	"metricalert/internal/server/infra/auth"
+)
+
+func TestServerAPI_Rules(t *testing.T) {
+	updated := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	rule := alerting.Rule{Name: "high_cpu", Kind: alerting.KindThreshold, Metric: "cpu", Op: ">", Threshold: 90}
+	version := alerting.RuleVersion{Rule: rule, Version: 2, UpdatedBy: "alice", UpdatedAt: updated}
+	ruleJSON := `{"name":"high_cpu","kind":"threshold","metric":"cpu","op":">","threshold":90}`
+	versionJSON := `{"rule":` + ruleJSON + `,"version":2,"updated_by":"alice","updated_at":"2024-01-01T00:00:00Z"}`
+
+	tests := []struct {
+		setup  func(m *MockAlertService)
+		name   string
+		method string
+		path   string
+		body   string
+		want   string
+		status int
+	}{
+		{
+			name:   "list rules",
+			method: http.MethodGet,
+			path:   "/alerts/rules",
+			setup: func(m *MockAlertService) {
+				m.On("Rules", mock.Anything).Return([]alerting.RuleVersion{
+					{Rule: alerting.Rule{Name: "disk_full", Kind: alerting.KindAbsence}, Static: true}, version,
+				}, nil)
+			},
+			status: http.StatusOK,
+			want: `{"rules":[{"rule":{"name":"disk_full","kind":"absence"},"version":0,"static":true},` +
+				versionJSON + `]}`,
+		},
+		{
+			name:   "get rule",
+			method: http.MethodGet,
+			path:   "/alerts/rules/high_cpu",
+			setup: func(m *MockAlertService) {
+				m.On("Rule", mock.Anything, "high_cpu").Return(version, nil)
+			},
+			status: http.StatusOK,
+			want:   versionJSON,
+		},
+		{
+			name:   "get missing rule",
+			method: http.MethodGet,
+			path:   "/alerts/rules/x",
+			setup: func(m *MockAlertService) {
+				m.On("Rule", mock.Anything, "x").Return(alerting.RuleVersion{}, alerting.ErrNotFound)
+			},
+			status: http.StatusNotFound,
+		},
+		{
+			name:   "rule versions",
+			method: http.MethodGet,
+			path:   "/alerts/rules/high_cpu/versions",
+			setup: func(m *MockAlertService) {
+				m.On("RuleVersions", mock.Anything, "high_cpu").Return([]alerting.RuleVersion{version}, nil)
+			},
+			status: http.StatusOK,
+			want:   `{"versions":[` + versionJSON + `]}`,
+		},
+		{
+			name:   "create rule",
+			method: http.MethodPost,
+			path:   "/alerts/rules",
+			body:   ruleJSON,
+			setup: func(m *MockAlertService) {
+				m.On("CreateRule", mock.Anything, rule, "").Return(version, nil)
+			},
+			status: http.StatusCreated,
+			want:   versionJSON,
+		},
+		{
+			name:   "create existing rule",
+			method: http.MethodPost,
+			path:   "/alerts/rules",
+			body:   ruleJSON,
+			setup: func(m *MockAlertService) {
+				m.On("CreateRule", mock.Anything, rule, "").Return(alerting.RuleVersion{}, alerting.ErrConflict)
+			},
+			status: http.StatusConflict,
+		},
+		{
+			name:   "create invalid rule",
+			method: http.MethodPost,
+			path:   "/alerts/rules",
+			body:   `{"name":"bad","kind":"threshold"}`,
+			setup: func(m *MockAlertService) {
+				m.On("CreateRule", mock.Anything, alerting.Rule{Name: "bad", Kind: alerting.KindThreshold}, "").
+					Return(alerting.RuleVersion{}, fmt.Errorf("rule %q: %w: %w", "bad", alerting.ErrInvalidRule,
+						errors.New("metric is required")))
+			},
+			status: http.StatusBadRequest,
+			want:   `{"error":{"code":"bad_request","message":"rule \"bad\": invalid rule: metric is required"}}`,
+		},
+		{
+			name:   "create invalid body",
+			method: http.MethodPost,
+			path:   "/alerts/rules",
+			body:   `{"name":1}`,
+			setup:  func(*MockAlertService) {},
+			status: http.StatusBadRequest,
+			want:   `{"error":{"code":"invalid_body","message":"invalid json body"}}`,
+		},
+		{
+			name:   "update rule",
+			method: http.MethodPut,
+			path:   "/alerts/rules/high_cpu?version=1",
+			body:   `{"name":"ignored","kind":"threshold","metric":"cpu","op":">","threshold":90}`,
+			setup: func(m *MockAlertService) {
+				m.On("UpdateRule", mock.Anything, rule, 1, "").Return(version, nil)
+			},
+			status: http.StatusOK,
+			want:   versionJSON,
+		},
+		{
+			name:   "update stale version",
+			method: http.MethodPut,
+			path:   "/alerts/rules/high_cpu?version=1",
+			body:   ruleJSON,
+			setup: func(m *MockAlertService) {
+				m.On("UpdateRule", mock.Anything, rule, 1, "").Return(alerting.RuleVersion{}, alerting.ErrConflict)
+			},
+			status: http.StatusConflict,
+		},
+		{
+			name:   "update invalid version",
+			method: http.MethodPut,
+			path:   "/alerts/rules/high_cpu?version=x",
+			body:   ruleJSON,
+			setup:  func(*MockAlertService) {},
+			status: http.StatusBadRequest,
+			want:   `{"error":{"code":"invalid_value","message":"invalid version parameter"}}`,
+		},
+		{
+			name:   "delete rule",
+			method: http.MethodDelete,
+			path:   "/alerts/rules/high_cpu",
+			setup: func(m *MockAlertService) {
+				m.On("DeleteRule", mock.Anything, "high_cpu", 0, "").Return(nil)
+			},
+			status: http.StatusNoContent,
+		},
+		{
+			name:   "delete negative version",
+			method: http.MethodDelete,
+			path:   "/alerts/rules/high_cpu?version=-1",
+			setup:  func(*MockAlertService) {},
+			status: http.StatusBadRequest,
+			want:   `{"error":{"code":"invalid_value","message":"invalid version parameter"}}`,
+		},
+		{
+			name:   "evaluate rule",
+			method: http.MethodPost,
+			path:   "/alerts/rules/evaluate",
+			body:   ruleJSON,
+			setup: func(m *MockAlertService) {
+				m.On("EvaluateRule", mock.Anything, rule).Return([]alerting.RuleResult{
+					{Metric: "cpu", MType: "gauge", State: alerting.StateFiring, Description: "value 95 > 90", Value: 95},
+				}, nil)
+			},
+			status: http.StatusOK,
+			want: `{"results":[{"metric":"cpu","type":"gauge","state":"firing",` +
+				`"description":"value 95 > 90","value":95}]}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			alerts := new(MockAlertService)
+			tt.setup(alerts)
+
+			recorder := httptest.NewRecorder()
+			newAlertsRouter(alerts).ServeHTTP(recorder,
+				httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body)))
+
+			assert.Equal(t, tt.status, recorder.Code)
+
+			if tt.want != "" {
+				assert.JSONEq(t, tt.want, recorder.Body.String())
+			}
+
+			alerts.AssertExpectations(t)
+		})
+	}
+}
+
+func TestServerAPI_RuleAuthor(t *testing.T) {
+	rule := alerting.Rule{Name: "high_cpu", Kind: alerting.KindThreshold, Metric: "cpu", Op: ">", Threshold: 90}
+
+	alerts := new(MockAlertService)
+	alerts.On("CreateRule", mock.Anything, rule, "ci").Return(alerting.RuleVersion{Rule: rule, Version: 1}, nil)
+
+	req := httptest.NewRequest(http.MethodPost, "/alerts/rules",
+		strings.NewReader(`{"name":"high_cpu","kind":"threshold","metric":"cpu","op":">","threshold":90}`))
+	req = req.WithContext(auth.WithIdentity(context.Background(), &auth.Identity{Name: "ci"}))
+
+	recorder := httptest.NewRecorder()
+	newAlertsRouter(alerts).ServeHTTP(recorder, req)
+
+	assert.Equal(t, http.StatusCreated, recorder.Code)
+	alerts.AssertExpectations(t)
+}
+
+func TestServerAPI_RulesNotConfigured(t *testing.T) {
+	recorder := httptest.NewRecorder()
+	newAlertsRouter(nil).ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/alerts/rules", nil))
+
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.JSONEq(t, `{"rules":[]}`, recorder.Body.String())
+
+	recorder = httptest.NewRecorder()
+	newAlertsRouter(nil).ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/alerts/rules/evaluate",
+		strings.NewReader(`{"name":"high_cpu"}`)))
+
+	assert.Equal(t, http.StatusServiceUnavailable, recorder.Code)
+}
+
+func TestServerAPI_RulesUI(t *testing.T) {
+	recorder := httptest.NewRecorder()
+	newAlertsRouter(nil).ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/alerts/ui", nil))
+
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.Equal(t, "text/html; charset=utf-8", recorder.Header().Get("Content-Type"))
+	assert.Contains(t, recorder.Body.String(), "/alerts/rules/evaluate")
+}
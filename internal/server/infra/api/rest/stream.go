@@ -0,0 +1,258 @@
+package rest
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"metricalert/internal/server/core/model"
+)
+
+const (
+	// streamRoute маршрут потоковой загрузки метрик в формате NDJSON.
+	streamRoute = "/updates/stream"
+	// maxStreamLineSize максимальная длина строки потока, более длинные строки отклоняются.
+	maxStreamLineSize = 1 << 20
+	// maxStreamErrors максимальное количество ошибок строк в ответе, остальные только подсчитываются.
+	maxStreamErrors = 100
+)
+
+// codeLineTooLong код ошибки строки потока, превышающей maxStreamLineSize.
+const codeLineTooLong = "line_too_long"
+
+// streamLineError описывает отклоненную строку потока.
+type streamLineError struct {
+	ID      string `json:"id,omitempty"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+	Line    int    `json:"line"`
+}
+
+// streamResult итог обработки потока метрик.
+type streamResult struct {
+	Errors          []streamLineError `json:"errors"`
+	Lines           int               `json:"lines"`
+	Accepted        int               `json:"accepted"`
+	Rejected        int               `json:"rejected"`
+	Deduplicated    int               `json:"deduplicated"`
+	Dropped         int               `json:"dropped,omitempty"`
+	Chunks          int               `json:"chunks"`
+	ReplayedChunks  int               `json:"replayed_chunks"`
+	ErrorsTruncated bool              `json:"errors_truncated,omitempty"`
+}
+
+func (r *streamResult) reject(line int, id, code, message string) {
+	r.Rejected++
+
+	if len(r.Errors) >= maxStreamErrors {
+		r.ErrorsTruncated = true
+		return
+	}
+
+	r.Errors = append(r.Errors, streamLineError{Line: line, ID: id, Code: code, Message: message})
+}
+
+// isStreamRoute проверяет, относится ли запрос к маршруту потоковой загрузки.
+func isStreamRoute(c *gin.Context) bool {
+	return strings.HasSuffix(c.FullPath(), streamRoute)
+}
+
+// unboundedBody проверяет, читается ли тело запроса без ограничения размера.
+// Поток читается построчно, поэтому его длина не ограничивается. Зашифрованное тело
+// расшифровывается целиком, поэтому для него ограничение сохраняется.
+func (h *handler) unboundedBody(c *gin.Context) bool {
+	return h.privateKey == nil && isStreamRoute(c)
+}
+
+// lineReader построчно читает поток, пропуская строки длиннее max.
+type lineReader struct {
+	r    *bufio.Reader
+	line int
+	max  int
+}
+
+func newLineReader(r io.Reader, maxSize int) *lineReader {
+	return &lineReader{r: bufio.NewReader(r), max: maxSize}
+}
+
+// next возвращает очередную непустую строку. Для строки длиннее max возвращает tooLong=true.
+// В конце потока возвращает io.EOF.
+func (l *lineReader) next() ([]byte, bool, error) {
+	for {
+		line, tooLong, err := l.readLine()
+		if err != nil || tooLong {
+			return nil, tooLong, err
+		}
+
+		if line = bytes.TrimSpace(line); len(line) > 0 {
+			return line, false, nil
+		}
+	}
+}
+
+func (l *lineReader) readLine() ([]byte, bool, error) {
+	var (
+		line    []byte
+		read    int
+		tooLong bool
+	)
+
+	for {
+		part, err := l.r.ReadSlice('\n')
+		read += len(part)
+
+		if !tooLong {
+			if len(line)+len(bytes.TrimRight(part, "\r\n")) > l.max {
+				tooLong = true
+				line = nil
+			} else {
+				line = append(line, part...)
+			}
+		}
+
+		switch {
+		case errors.Is(err, bufio.ErrBufferFull):
+			continue
+		case errors.Is(err, io.EOF):
+			if read == 0 {
+				return nil, false, io.EOF
+			}
+		case err != nil:
+			return nil, false, fmt.Errorf("can't read line %d: %w", l.line+1, err)
+		}
+
+		l.line++
+
+		return line, tooLong, nil
+	}
+}
+
+// streamUpdate принимает поток метрик в формате NDJSON: по одной метрике MetricRequest в строке.
+// Метрики применяются частями по batchChunkSize, каждая часть фиксируется сразу после чтения.
+// Некорректные строки отклоняются и не прерывают поток. Если чтение потока прервалось,
+// уже примененные части остаются записанными.
+func (h *handler) streamUpdate(ginCtx *gin.Context) {
+	opts, err := batchOptions(ginCtx)
+	if err != nil {
+		h.logger.Errorf("failed to parse stream options: %v", err)
+		h.abort(ginCtx, http.StatusBadRequest, codeInvalidValue, err.Error())
+		return
+	}
+
+	if opts.Strict {
+		h.abort(ginCtx, http.StatusBadRequest, codeInvalidValue, "strict mode is not supported for streams")
+		return
+	}
+
+	chunkSize := h.chunkSize()
+
+	var (
+		lines   = newLineReader(ginCtx.Request.Body, maxStreamLineSize)
+		total   = streamResult{Errors: []streamLineError{}}
+		chunk   = make([]model.MetricRequest, 0, chunkSize)
+		numbers = make([]int, 0, chunkSize)
+	)
+
+	for {
+		line, tooLong, err := lines.next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+
+		if err != nil {
+			h.logger.Errorf("failed to read stream: %v", err)
+
+			if isBodyTooLarge(err) {
+				h.bodyTooLarge(ginCtx, err)
+				return
+			}
+
+			h.abort(ginCtx, http.StatusBadRequest, codeInvalidBody,
+				fmt.Sprintf("can't read stream, %d metrics applied before the error", total.Accepted))
+			return
+		}
+
+		if tooLong {
+			total.reject(lines.line, "", codeLineTooLong,
+				fmt.Sprintf("line exceeds %d bytes", maxStreamLineSize))
+			continue
+		}
+
+		var metric model.MetricRequest
+		if err := json.Unmarshal(line, &metric); err != nil {
+			total.reject(lines.line, "", codeInvalidBody, "invalid json: "+err.Error())
+			continue
+		}
+
+		chunk = append(chunk, metric)
+		numbers = append(numbers, lines.line)
+
+		if len(chunk) < chunkSize {
+			continue
+		}
+
+		if !h.commitStreamChunk(ginCtx, &total, chunk, numbers, opts) {
+			return
+		}
+
+		chunk = make([]model.MetricRequest, 0, chunkSize)
+		numbers = make([]int, 0, chunkSize)
+	}
+
+	if len(chunk) > 0 && !h.commitStreamChunk(ginCtx, &total, chunk, numbers, opts) {
+		return
+	}
+
+	total.Lines = lines.line
+
+	if total.Rejected > 0 {
+		h.logger.Warnf("stream partially rejected, lines: %d, accepted: %d, rejected: %d",
+			total.Lines, total.Accepted, total.Rejected)
+	}
+
+	ginCtx.JSON(http.StatusOK, total)
+}
+
+// commitStreamChunk применяет часть потока. numbers содержит номера строк метрик части.
+// При ошибке отправляет ответ и возвращает false.
+func (h *handler) commitStreamChunk(
+	ginCtx *gin.Context,
+	total *streamResult,
+	chunk []model.MetricRequest,
+	numbers []int,
+	opts model.BatchOptions,
+) bool {
+	if !h.allowChunk(ginCtx, total.Chunks, len(chunk)) {
+		return false
+	}
+
+	result, err := h.server.UpdateMetrics(ginCtx.Request.Context(), chunk, chunkOptions(opts, total.Chunks))
+	if err != nil {
+		h.writeError(ginCtx, fmt.Sprintf("failed to update metrics, %d applied before the error", total.Accepted), err)
+		return false
+	}
+
+	total.Chunks++
+	total.Accepted += result.Accepted
+	total.Deduplicated += result.Deduplicated
+	total.Dropped += result.Dropped
+
+	if result.Replayed {
+		total.ReplayedChunks++
+	}
+
+	for _, item := range result.Items {
+		if item.Status == model.ItemRejected && item.Index < len(numbers) {
+			total.reject(numbers[item.Index], item.ID, item.Code, item.Message)
+		}
+	}
+
+	return true
+}
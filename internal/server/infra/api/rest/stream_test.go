@@ -0,0 +1,212 @@
+//nolint:wrapcheck,nolintlint,errcheck,forcetypeassert
+package rest
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"metricalert/internal/server/core/application"
+	"metricalert/internal/server/core/model"
+	"metricalert/internal/server/infra/ipfilter"
+)
+
+func newStreamAPI(t *testing.T, server ServerService, conf Config) http.Handler {
+	t.Helper()
+
+	conf.Server = server
+	conf.Logger = *zap.NewNop().Sugar()
+
+	return NewServerAPI(&conf).srv.Handler
+}
+
+func TestServerAPI_StreamUpdate(t *testing.T) {
+	const body = `{"id":"a","type":"gauge","value":1}
+{"id":"b","type":"gauge","value":2}
+
+{"id":"c","type":"gauge","value":3}
+not json
+{"id":"d","type":"gauge"}
+{"id":"e","type":"gauge","value":5}`
+
+	mockServerService := new(MockServerService)
+	mockServerService.On("UpdateMetrics", mock.Anything, mock.Anything, model.BatchOptions{IdempotencyKey: "key"}).
+		Return(model.BatchResult{
+			Items: []model.ItemResult{
+				{Index: 0, ID: "a", Status: model.ItemAccepted},
+				{Index: 1, ID: "b", Status: model.ItemAccepted},
+			},
+			Accepted: 2,
+			Replayed: true,
+		}, nil).Once()
+	mockServerService.On("UpdateMetrics", mock.Anything, mock.Anything, model.BatchOptions{IdempotencyKey: "key:1"}).
+		Return(model.BatchResult{
+			Items: []model.ItemResult{
+				{Index: 0, ID: "c", Status: model.ItemAccepted},
+				{Index: 1, ID: "d", Status: model.ItemRejected, Code: application.CodeMissingValue, Message: "value is required"},
+			},
+			Accepted: 1,
+			Rejected: 1,
+		}, nil).Once()
+	mockServerService.On("UpdateMetrics", mock.Anything, mock.Anything, model.BatchOptions{IdempotencyKey: "key:2"}).
+		Return(model.BatchResult{
+			Items:    []model.ItemResult{{Index: 0, ID: "e", Status: model.ItemAccepted}},
+			Accepted: 1,
+		}, nil).Once()
+
+	api := newStreamAPI(t, mockServerService, Config{MaxBodySize: 64, BatchChunkSize: 2})
+
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/updates/stream", strings.NewReader(body))
+	req.Header.Set("Idempotency-Key", "key")
+
+	recorder := httptest.NewRecorder()
+	api.ServeHTTP(recorder, req)
+
+	require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+
+	var result streamResult
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &result))
+
+	assert.Equal(t, 7, result.Lines)
+	assert.Equal(t, 4, result.Accepted)
+	assert.Equal(t, 2, result.Rejected)
+	assert.Equal(t, 3, result.Chunks)
+	assert.Equal(t, 1, result.ReplayedChunks)
+	assert.Equal(t, []streamLineError{
+		{Line: 5, Code: codeInvalidBody, Message: result.Errors[0].Message},
+		{Line: 6, ID: "d", Code: application.CodeMissingValue, Message: "value is required"},
+	}, result.Errors)
+
+	mockServerService.AssertExpectations(t)
+}
+
+func TestServerAPI_StreamUpdateMiddleware(t *testing.T) {
+	line := `{"id":"test","type":"gauge","value":1}` + "\n"
+	body := strings.Repeat(line, 100)
+
+	t.Run("gzip without body limit", func(t *testing.T) {
+		mockServerService := new(MockServerService)
+		mockServerService.On("UpdateMetrics", mock.Anything, mock.Anything, mock.Anything).
+			Return(model.BatchResult{Accepted: 25}, nil)
+
+		api := newStreamAPI(t, mockServerService, Config{
+			MaxBodySize:         64,
+			MaxDecompressedSize: 64,
+			BatchChunkSize:      25,
+		})
+
+		req := httptest.NewRequest(http.MethodPost, "/updates/stream", bytes.NewReader(gzipBody(t, []byte(body))))
+		req.Header.Set("Content-Encoding", "gzip")
+
+		recorder := httptest.NewRecorder()
+		api.ServeHTTP(recorder, req)
+
+		require.Equal(t, http.StatusOK, recorder.Code)
+
+		var result streamResult
+		require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &result))
+
+		assert.Equal(t, 100, result.Accepted)
+		assert.Equal(t, 4, result.Chunks)
+		mockServerService.AssertNumberOfCalls(t, "UpdateMetrics", 4)
+	})
+
+	t.Run("body limit still applies to batches", func(t *testing.T) {
+		api := newStreamAPI(t, new(MockServerService), Config{MaxBodySize: 64})
+
+		recorder := httptest.NewRecorder()
+		api.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/api/v1/updates/", strings.NewReader(body)))
+
+		assert.Equal(t, http.StatusRequestEntityTooLarge, recorder.Code)
+	})
+
+	t.Run("ip filter", func(t *testing.T) {
+		filter, err := ipfilter.New(ipfilter.Config{Denied: []string{"192.0.2.0/24"}})
+		require.NoError(t, err)
+
+		mockServerService := new(MockServerService)
+		api := newStreamAPI(t, mockServerService, Config{IPFilter: filter})
+
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/updates/stream", strings.NewReader(body))
+		req.RemoteAddr = "192.0.2.1:1234"
+
+		recorder := httptest.NewRecorder()
+		api.ServeHTTP(recorder, req)
+
+		assert.Equal(t, http.StatusForbidden, recorder.Code)
+		mockServerService.AssertNotCalled(t, "UpdateMetrics", mock.Anything, mock.Anything, mock.Anything)
+	})
+
+}
+
+func TestServerAPI_StreamUpdateErrors(t *testing.T) {
+	t.Run("strict mode", func(t *testing.T) {
+		api := newStreamAPI(t, new(MockServerService), Config{})
+
+		recorder := httptest.NewRecorder()
+		api.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/api/v1/updates/stream?strict=true", nil))
+
+		assert.Equal(t, http.StatusBadRequest, recorder.Code)
+	})
+
+	t.Run("store error", func(t *testing.T) {
+		mockServerService := new(MockServerService)
+		mockServerService.On("UpdateMetrics", mock.Anything, mock.Anything, mock.Anything).
+			Return(model.BatchResult{}, io.ErrUnexpectedEOF)
+
+		api := newStreamAPI(t, mockServerService, Config{})
+
+		recorder := httptest.NewRecorder()
+		api.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/api/v1/updates/stream",
+			strings.NewReader(`{"id":"a","type":"gauge","value":1}`)))
+
+		assert.Equal(t, http.StatusInternalServerError, recorder.Code)
+	})
+
+	t.Run("empty stream", func(t *testing.T) {
+		mockServerService := new(MockServerService)
+		api := newStreamAPI(t, mockServerService, Config{})
+
+		recorder := httptest.NewRecorder()
+		api.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/api/v1/updates/stream", strings.NewReader("\n\n")))
+
+		require.Equal(t, http.StatusOK, recorder.Code)
+		assert.JSONEq(t, `{"errors":[],"lines":2,"accepted":0,"rejected":0,"deduplicated":0,"chunks":0,"replayed_chunks":0}`,
+			recorder.Body.String())
+		mockServerService.AssertNotCalled(t, "UpdateMetrics", mock.Anything, mock.Anything, mock.Anything)
+	})
+}
+
+func TestLineReader(t *testing.T) {
+	long := strings.Repeat("x", 20)
+	lines := newLineReader(strings.NewReader("one\r\n\n"+long+"\n"+"two"), 10)
+
+	line, tooLong, err := lines.next()
+	require.NoError(t, err)
+	assert.False(t, tooLong)
+	assert.Equal(t, "one", string(line))
+	assert.Equal(t, 1, lines.line)
+
+	_, tooLong, err = lines.next()
+	require.NoError(t, err)
+	assert.True(t, tooLong)
+	assert.Equal(t, 3, lines.line)
+
+	line, _, err = lines.next()
+	require.NoError(t, err)
+	assert.Equal(t, "two", string(line))
+	assert.Equal(t, 4, lines.line)
+
+	_, _, err = lines.next()
+	assert.ErrorIs(t, err, io.EOF)
+	assert.Equal(t, 4, lines.line)
+}
@@ -0,0 +1,192 @@
+package rest
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+
+	"metricalert/internal/server/core/application"
+	"metricalert/internal/server/core/model"
+	pb "metricalert/proto"
+)
+
+// maxValuesQuery максимальное количество метрик в одном запросе POST /values/.
+const maxValuesQuery = 1000
+
+// codeNotAcceptable код ошибки, если ни один из форматов заголовка Accept не поддерживается.
+const codeNotAcceptable = "not_acceptable"
+
+// Форматы ответа при чтении значений метрик. Первый формат используется, если заголовок Accept не задан.
+var (
+	textFirst = []string{gin.MIMEPlain, gin.MIMEJSON, binding.MIMEPROTOBUF}
+	jsonFirst = []string{gin.MIMEJSON, gin.MIMEPlain, binding.MIMEPROTOBUF}
+)
+
+// metricValues ответ на запрос значений нескольких метрик.
+type metricValues struct {
+	Metrics []model.MetricRequest `json:"metrics"` // найденные метрики в порядке запроса
+	Missing []model.MetricRequest `json:"missing"` // метрики, которых нет в хранилище
+}
+
+// negotiate выбирает формат ответа по заголовку Accept.
+// Если ни один формат не подходит, отправляет ответ 406 и возвращает false.
+func (h *handler) negotiate(c *gin.Context, offers []string) (string, bool) {
+	format := c.NegotiateFormat(offers...)
+	if format == "" {
+		h.abort(c, http.StatusNotAcceptable, codeNotAcceptable,
+			"supported formats: "+strings.Join(offers, ", "))
+		return "", false
+	}
+
+	return format, true
+}
+
+// metricValue преобразует значение метрики из хранилища в MetricRequest.
+func metricValue(id, mType, value string) (model.MetricRequest, error) {
+	metric := model.MetricRequest{
+		ID:    id,
+		MType: mType,
+	}
+
+	switch mType {
+	case counterType:
+		delta, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return metric, fmt.Errorf("can't parse counter %q: %w", value, err)
+		}
+
+		metric.Delta = &delta
+	case gaugeType:
+		v, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return metric, fmt.Errorf("can't parse gauge %q: %w", value, err)
+		}
+
+		metric.Value = &v
+	}
+
+	return metric, nil
+}
+
+func metricToProto(metric model.MetricRequest) *pb.Metric {
+	result := &pb.Metric{
+		Id:   metric.ID,
+		Type: metric.MType,
+	}
+
+	if metric.Value != nil {
+		result.Value = *metric.Value
+	}
+
+	if metric.Delta != nil {
+		result.Delta = *metric.Delta
+	}
+
+	return result
+}
+
+// writeMetric отправляет значение метрики в выбранном формате.
+func (h *handler) writeMetric(c *gin.Context, format string, id, mType, value string) {
+	if format == gin.MIMEPlain {
+		c.String(http.StatusOK, value)
+		return
+	}
+
+	metric, err := metricValue(id, mType, value)
+	if err != nil {
+		h.logger.Errorf("failed to convert metric %s: %v", id, err)
+		h.abort(c, http.StatusInternalServerError, codeInternal, "internal server error")
+		return
+	}
+
+	if format == binding.MIMEPROTOBUF {
+		c.ProtoBuf(http.StatusOK, metricToProto(metric))
+		return
+	}
+
+	data, err := json.Marshal(metric)
+	if err != nil {
+		h.logger.Errorf("failed to marshal response: %v", err)
+		h.abort(c, http.StatusInternalServerError, codeInternal, "internal server error")
+		return
+	}
+
+	c.Data(http.StatusOK, gin.MIMEJSON, data)
+}
+
+// getMetricValues возвращает значения нескольких метрик за один запрос.
+// Тело запроса — JSON-массив объектов с полями id и type. Отсутствующие метрики
+// перечисляются в поле missing и не считаются ошибкой.
+func (h *handler) getMetricValues(ginCtx *gin.Context) {
+	format, ok := h.negotiate(ginCtx, jsonFirst)
+	if !ok {
+		return
+	}
+
+	var request []model.MetricRequest
+	if err := ginCtx.ShouldBindJSON(&request); err != nil {
+		h.logger.Errorf("failed to bind json: %v", err)
+		h.invalidBody(ginCtx, err)
+		return
+	}
+
+	if len(request) > maxValuesQuery {
+		h.abort(ginCtx, http.StatusBadRequest, codeInvalidValue,
+			fmt.Sprintf("at most %d metrics per request", maxValuesQuery))
+		return
+	}
+
+	response := metricValues{
+		Metrics: make([]model.MetricRequest, 0, len(request)),
+		Missing: []model.MetricRequest{},
+	}
+
+	var text strings.Builder
+
+	for _, query := range request {
+		value, err := h.server.GetMetric(ginCtx.Request.Context(), query.ID, query.MType)
+		if errors.Is(err, application.ErrNotFound) {
+			response.Missing = append(response.Missing, model.MetricRequest{ID: query.ID, MType: query.MType})
+			continue
+		}
+
+		if err != nil {
+			h.writeError(ginCtx, "failed to get metric "+query.ID, err)
+			return
+		}
+
+		metric, err := metricValue(query.ID, query.MType, value)
+		if err != nil {
+			h.logger.Errorf("failed to convert metric %s: %v", query.ID, err)
+			h.abort(ginCtx, http.StatusInternalServerError, codeInternal, "internal server error")
+			return
+		}
+
+		response.Metrics = append(response.Metrics, metric)
+		fmt.Fprintf(&text, "%s %s %s\n", query.MType, query.ID, value)
+	}
+
+	switch format {
+	case gin.MIMEPlain:
+		ginCtx.String(http.StatusOK, text.String())
+	case binding.MIMEPROTOBUF:
+		values := &pb.MetricValues{}
+		for _, metric := range response.Metrics {
+			values.Metrics = append(values.Metrics, metricToProto(metric))
+		}
+
+		for _, metric := range response.Missing {
+			values.Missing = append(values.Missing, metricToProto(metric))
+		}
+
+		ginCtx.ProtoBuf(http.StatusOK, values)
+	default:
+		ginCtx.JSON(http.StatusOK, response)
+	}
+}
@@ -0,0 +1,227 @@
+//nolint:wrapcheck,nolintlint,errcheck,forcetypeassert
+package rest
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"google.golang.org/protobuf/proto"
+
+	"metricalert/internal/server/core/application"
+	pb "metricalert/proto"
+)
+
+func TestServerAPI_ValueNegotiation(t *testing.T) {
+	mockServerService := new(MockServerService)
+	mockServerService.On("GetMetric", mock.Anything, "Alloc", gaugeType).Return("1.5", nil)
+	mockServerService.On("GetMetric", mock.Anything, "PollCount", counterType).Return("7", nil)
+
+	router := newV1Router(&handler{server: mockServerService, logger: *zap.NewNop().Sugar()})
+
+	tests := []struct {
+		name        string
+		method      string
+		path        string
+		body        string
+		accept      string
+		status      int
+		contentType string
+		want        string
+	}{
+		{
+			name:        "get defaults to text",
+			method:      http.MethodGet,
+			path:        "/value/gauge/Alloc",
+			status:      http.StatusOK,
+			contentType: "text/plain; charset=utf-8",
+			want:        "1.5",
+		},
+		{
+			name:        "get browser accept",
+			method:      http.MethodGet,
+			path:        "/value/gauge/Alloc",
+			accept:      "text/html,application/xhtml+xml,*/*;q=0.8",
+			status:      http.StatusOK,
+			contentType: "text/plain; charset=utf-8",
+			want:        "1.5",
+		},
+		{
+			name:        "get json",
+			method:      http.MethodGet,
+			path:        "/api/v1/value/counter/PollCount",
+			accept:      "application/json",
+			status:      http.StatusOK,
+			contentType: "application/json",
+			want:        `{"delta":7,"id":"PollCount","type":"counter"}`,
+		},
+		{
+			name:        "post defaults to json",
+			method:      http.MethodPost,
+			path:        "/value/",
+			body:        `{"id":"Alloc","type":"gauge"}`,
+			status:      http.StatusOK,
+			contentType: "application/json",
+			want:        `{"value":1.5,"id":"Alloc","type":"gauge"}`,
+		},
+		{
+			name:        "post text",
+			method:      http.MethodPost,
+			path:        "/api/v1/value/",
+			body:        `{"id":"PollCount","type":"counter"}`,
+			accept:      "text/plain",
+			status:      http.StatusOK,
+			contentType: "text/plain; charset=utf-8",
+			want:        "7",
+		},
+		{
+			name:   "not acceptable",
+			method: http.MethodGet,
+			path:   "/api/v1/value/gauge/Alloc",
+			accept: "application/xml",
+			status: http.StatusNotAcceptable,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+			if tt.accept != "" {
+				req.Header.Set("Accept", tt.accept)
+			}
+
+			recorder := httptest.NewRecorder()
+			router.ServeHTTP(recorder, req)
+
+			require.Equal(t, tt.status, recorder.Code)
+
+			if tt.status != http.StatusOK {
+				var resp errorResponse
+				require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &resp))
+				assert.Equal(t, codeNotAcceptable, resp.Error.Code)
+
+				return
+			}
+
+			assert.Equal(t, tt.contentType, recorder.Header().Get("Content-Type"))
+			assert.Equal(t, tt.want, recorder.Body.String())
+		})
+	}
+
+	t.Run("protobuf", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/value/gauge/Alloc", nil)
+		req.Header.Set("Accept", "application/x-protobuf")
+
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, req)
+
+		require.Equal(t, http.StatusOK, recorder.Code)
+		assert.Equal(t, "application/x-protobuf", recorder.Header().Get("Content-Type"))
+
+		var metric pb.Metric
+		require.NoError(t, proto.Unmarshal(recorder.Body.Bytes(), &metric))
+		assert.Equal(t, "Alloc", metric.GetId())
+		assert.Equal(t, gaugeType, metric.GetType())
+		assert.InDelta(t, 1.5, metric.GetValue(), 0)
+	})
+}
+
+func TestServerAPI_GetMetricValues(t *testing.T) {
+	const body = `[
+		{"id":"Alloc","type":"gauge"},
+		{"id":"Missing","type":"gauge"},
+		{"id":"PollCount","type":"counter"}
+	]`
+
+	newService := func() *MockServerService {
+		mockServerService := new(MockServerService)
+		mockServerService.On("GetMetric", mock.Anything, "Alloc", gaugeType).Return("1.5", nil)
+		mockServerService.On("GetMetric", mock.Anything, "PollCount", counterType).Return("7", nil)
+		mockServerService.On("GetMetric", mock.Anything, "Missing", gaugeType).Return("", application.ErrNotFound)
+
+		return mockServerService
+	}
+
+	t.Run("json", func(t *testing.T) {
+		router := newV1Router(&handler{server: newService(), logger: *zap.NewNop().Sugar()})
+
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/api/v1/values/", strings.NewReader(body)))
+
+		require.Equal(t, http.StatusOK, recorder.Code)
+		assert.JSONEq(t, `{
+			"metrics": [
+				{"id":"Alloc","type":"gauge","value":1.5},
+				{"id":"PollCount","type":"counter","delta":7}
+			],
+			"missing": [{"id":"Missing","type":"gauge"}]
+		}`, recorder.Body.String())
+	})
+
+	t.Run("text", func(t *testing.T) {
+		router := newV1Router(&handler{server: newService(), logger: *zap.NewNop().Sugar()})
+
+		req := httptest.NewRequest(http.MethodPost, "/values/", strings.NewReader(body))
+		req.Header.Set("Accept", "text/plain")
+
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, req)
+
+		require.Equal(t, http.StatusOK, recorder.Code)
+		assert.Equal(t, "gauge Alloc 1.5\ncounter PollCount 7\n", recorder.Body.String())
+	})
+
+	t.Run("protobuf", func(t *testing.T) {
+		router := newV1Router(&handler{server: newService(), logger: *zap.NewNop().Sugar()})
+
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/values/", strings.NewReader(body))
+		req.Header.Set("Accept", "application/x-protobuf")
+
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, req)
+
+		require.Equal(t, http.StatusOK, recorder.Code)
+
+		var values pb.MetricValues
+		require.NoError(t, proto.Unmarshal(recorder.Body.Bytes(), &values))
+		require.Len(t, values.GetMetrics(), 2)
+		assert.Equal(t, int64(7), values.GetMetrics()[1].GetDelta())
+		require.Len(t, values.GetMissing(), 1)
+		assert.Equal(t, "Missing", values.GetMissing()[0].GetId())
+	})
+
+	t.Run("too many metrics", func(t *testing.T) {
+		mockServerService := new(MockServerService)
+		router := newV1Router(&handler{server: mockServerService, logger: *zap.NewNop().Sugar()})
+
+		query := strings.Repeat(`{"id":"a","type":"gauge"},`, maxValuesQuery) + `{"id":"a","type":"gauge"}`
+
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/api/v1/values/",
+			strings.NewReader(fmt.Sprintf("[%s]", query))))
+
+		assert.Equal(t, http.StatusBadRequest, recorder.Code)
+		mockServerService.AssertNotCalled(t, "GetMetric", mock.Anything, mock.Anything, mock.Anything)
+	})
+
+	t.Run("store error", func(t *testing.T) {
+		mockServerService := new(MockServerService)
+		mockServerService.On("GetMetric", mock.Anything, mock.Anything, mock.Anything).
+			Return("", errors.New("store error"))
+
+		router := newV1Router(&handler{server: mockServerService, logger: *zap.NewNop().Sugar()})
+
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/api/v1/values/", strings.NewReader(body)))
+
+		assert.Equal(t, http.StatusInternalServerError, recorder.Code)
+	})
+}
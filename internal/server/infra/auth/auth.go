@@ -0,0 +1,169 @@
+// Package auth реализует аутентификацию клиентов по bearer-токенам.
+//
+// Токены задаются в конфигурации сервера и хранятся только в виде SHA-256 хеша.
+// Каждому токену назначается набор прав (scopes), которые проверяются
+// для каждого маршрута REST API и для каждого метода gRPC.
+//
+// Пример конфигурации:
+//
+//	"tokens": [
+//		{"name": "agent-1", "hash": "<sha256 hex>", "scopes": ["metrics:write"]},
+//		{"name": "grafana", "hash": "<sha256 hex>", "scopes": ["metrics:read"]}
+//	]
+package auth
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Права доступа.
+const (
+	ScopeMetricsWrite = "metrics:write"
+	ScopeMetricsRead  = "metrics:read"
+	ScopeAdmin        = "admin"
+)
+
+// Объявление ошибок.
+var (
+	ErrUnauthorized = errors.New("unauthorized")
+	ErrForbidden    = errors.New("forbidden")
+)
+
+// TokenConfig описывает токен в конфигурации сервера.
+type TokenConfig struct {
+	Name   string   `json:"name"`   // имя клиента, которому выдан токен
+	Hash   string   `json:"hash"`   // SHA-256 хеш токена в hex
+	Scopes []string `json:"scopes"` // права доступа
+	Tenant string   `json:"tenant"` // арендатор, к которому относятся метрики клиента
+}
+
+// Identity описывает аутентифицированного клиента.
+type Identity struct {
+	scopes map[string]struct{}
+	Name   string
+	Tenant string
+}
+
+// HasScope проверяет наличие права у клиента.
+// Право admin включает в себя все остальные права.
+func (i *Identity) HasScope(scope string) bool {
+	if i == nil {
+		return false
+	}
+
+	if _, ok := i.scopes[ScopeAdmin]; ok {
+		return true
+	}
+
+	_, ok := i.scopes[scope]
+
+	return ok
+}
+
+type token struct {
+	identity *Identity
+	hash     []byte
+}
+
+// Authenticator проверяет токены клиентов.
+type Authenticator struct {
+	tokens []token
+}
+
+// New создает новый экземпляр Authenticator.
+// Если список токенов пуст, возвращается nil: аутентификация отключена.
+func New(tokens []TokenConfig) (*Authenticator, error) {
+	if len(tokens) == 0 {
+		return nil, nil //nolint:nilnil // отсутствие токенов означает отключенную аутентификацию
+	}
+
+	a := &Authenticator{
+		tokens: make([]token, 0, len(tokens)),
+	}
+
+	for _, t := range tokens {
+		hash, err := hex.DecodeString(t.Hash)
+		if err != nil || len(hash) != sha256.Size {
+			return nil, fmt.Errorf("invalid hash for token %q", t.Name)
+		}
+
+		scopes := make(map[string]struct{}, len(t.Scopes))
+		for _, scope := range t.Scopes {
+			switch scope {
+			case ScopeMetricsWrite, ScopeMetricsRead, ScopeAdmin:
+				scopes[scope] = struct{}{}
+			default:
+				return nil, fmt.Errorf("unknown scope %q for token %q", scope, t.Name)
+			}
+		}
+
+		a.tokens = append(a.tokens, token{
+			identity: &Identity{Name: t.Name, Tenant: t.Tenant, scopes: scopes},
+			hash:     hash,
+		})
+	}
+
+	return a, nil
+}
+
+// HashToken возвращает SHA-256 хеш токена в hex, в котором он хранится в конфигурации.
+func HashToken(raw string) string {
+	sum := sha256.Sum256([]byte(raw))
+	return hex.EncodeToString(sum[:])
+}
+
+// Authenticate возвращает клиента по значению заголовка Authorization.
+func (a *Authenticator) Authenticate(header string) (*Identity, error) {
+	const prefix = "Bearer "
+	if len(header) <= len(prefix) || !strings.EqualFold(header[:len(prefix)], prefix) {
+		return nil, fmt.Errorf("missing bearer token: %w", ErrUnauthorized)
+	}
+
+	sum := sha256.Sum256([]byte(strings.TrimSpace(header[len(prefix):])))
+
+	var found *Identity
+	for _, t := range a.tokens {
+		if subtle.ConstantTimeCompare(sum[:], t.hash) == 1 {
+			found = t.identity
+		}
+	}
+
+	if found == nil {
+		return nil, fmt.Errorf("unknown token: %w", ErrUnauthorized)
+	}
+
+	return found, nil
+}
+
+// Authorize проверяет токен и наличие у клиента требуемого права.
+func (a *Authenticator) Authorize(header, scope string) (*Identity, error) {
+	identity, err := a.Authenticate(header)
+	if err != nil {
+		return nil, err
+	}
+
+	if !identity.HasScope(scope) {
+		return identity, fmt.Errorf("scope %s required: %w", scope, ErrForbidden)
+	}
+
+	return identity, nil
+}
+
+type identityKey struct{}
+
+// WithIdentity сохраняет клиента в контексте.
+func WithIdentity(ctx context.Context, identity *Identity) context.Context {
+	return context.WithValue(ctx, identityKey{}, identity)
+}
+
+// IdentityFromContext возвращает клиента из контекста.
+func IdentityFromContext(ctx context.Context) (*Identity, bool) {
+	identity, ok := ctx.Value(identityKey{}).(*Identity)
+	return identity, ok && identity != nil
+}
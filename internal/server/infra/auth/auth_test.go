@@ -0,0 +1,79 @@
+package auth
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNew(t *testing.T) {
+	t.Run("no tokens", func(t *testing.T) {
+		a, err := New(nil)
+		require.NoError(t, err)
+		assert.Nil(t, a)
+	})
+
+	t.Run("invalid hash", func(t *testing.T) {
+		_, err := New([]TokenConfig{{Name: "agent", Hash: "secret", Scopes: []string{ScopeMetricsWrite}}})
+		assert.Error(t, err)
+	})
+
+	t.Run("unknown scope", func(t *testing.T) {
+		_, err := New([]TokenConfig{{Name: "agent", Hash: HashToken("secret"), Scopes: []string{"metrics:delete"}}})
+		assert.Error(t, err)
+	})
+}
+
+func TestAuthenticator_Authorize(t *testing.T) {
+	a, err := New([]TokenConfig{
+		{Name: "agent", Hash: HashToken("agent-token"), Scopes: []string{ScopeMetricsWrite}, Tenant: "team"},
+		{Name: "root", Hash: HashToken("root-token"), Scopes: []string{ScopeAdmin}},
+	})
+	require.NoError(t, err)
+
+	tests := []struct {
+		name    string
+		header  string
+		scope   string
+		wantErr error
+		want    string
+	}{
+		{name: "missing header", scope: ScopeMetricsWrite, wantErr: ErrUnauthorized},
+		{name: "basic scheme", header: "Basic agent-token", scope: ScopeMetricsWrite, wantErr: ErrUnauthorized},
+		{name: "unknown token", header: "Bearer other", scope: ScopeMetricsWrite, wantErr: ErrUnauthorized},
+		{name: "scope granted", header: "Bearer agent-token", scope: ScopeMetricsWrite, want: "agent"},
+		{name: "lowercase scheme", header: "bearer agent-token", scope: ScopeMetricsWrite, want: "agent"},
+		{name: "scope missing", header: "Bearer agent-token", scope: ScopeMetricsRead, wantErr: ErrForbidden},
+		{name: "admin implies read", header: "Bearer root-token", scope: ScopeMetricsRead, want: "root"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			identity, err := a.Authorize(tt.header, tt.scope)
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, identity.Name)
+
+			if tt.want == "agent" {
+				assert.Equal(t, "team", identity.Tenant)
+			}
+		})
+	}
+}
+
+func TestIdentityFromContext(t *testing.T) {
+	_, ok := IdentityFromContext(context.Background())
+	assert.False(t, ok)
+
+	ctx := WithIdentity(context.Background(), &Identity{Name: "agent"})
+
+	identity, ok := IdentityFromContext(ctx)
+	require.True(t, ok)
+	assert.Equal(t, "agent", identity.Name)
+}
@@ -2,19 +2,42 @@ package grpc
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
+	"math"
 	"net"
+	"strconv"
+	"strings"
+	"time"
 
 	pb "metricalert/proto"
 
 	"metricalert/internal/server/core/application"
 	"metricalert/internal/server/core/model"
+	"metricalert/internal/server/infra/auth"
+	"metricalert/internal/server/infra/ratelimit"
 
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
 	"google.golang.org/grpc/reflection"
+	"google.golang.org/grpc/status"
 )
 
+// Config структура конфигурации gRPC-сервера.
+type Config struct {
+	Auth    *auth.Authenticator
+	Limiter *ratelimit.Limiter
+	Address string
+}
+
+// methodScopes права доступа, необходимые для вызова методов сервиса.
+var methodScopes = map[string]string{
+	pb.MetricsService_UpdateMetrics_FullMethodName: auth.ScopeMetricsWrite,
+}
+
 type MetricsServer struct {
 	pb.UnimplementedMetricsServiceServer
 	app *application.Application
@@ -36,25 +59,235 @@ func (s *MetricsServer) UpdateMetrics(ctx context.Context,
 		})
 	}
 
-	err := s.app.UpdateMetrics(ctx, metrics)
+	result, err := s.app.UpdateMetrics(ctx, metrics, model.BatchOptions{
+		IdempotencyKey: req.GetIdempotencyKey(),
+		Strict:         req.GetStrict(),
+	})
 	if err != nil {
+		if errors.Is(err, application.ErrBadRequest) {
+			return nil, status.Error(codes.InvalidArgument, rejectedMessage(err, result))
+		}
+
+		if errors.Is(err, application.ErrConflict) {
+			return nil, status.Error(codes.AlreadyExists, application.ErrorMessage(err))
+		}
+
 		return nil, fmt.Errorf("update metrics: %w", err)
 	}
 
-	return &pb.UpdateMetricsResponse{Status: "success"}, nil
+	resp := &pb.UpdateMetricsResponse{
+		Status:       "success",
+		Results:      make([]*pb.MetricResult, 0, len(result.Items)),
+		Accepted:     int32(result.Accepted),
+		Rejected:     int32(result.Rejected),
+		Deduplicated: int32(result.Deduplicated),
+		Replayed:     result.Replayed,
+		Dropped:      int32(result.Dropped),
+	}
+
+	if result.Rejected > 0 {
+		resp.Status = "partial"
+	}
+
+	for _, item := range result.Items {
+		resp.Results = append(resp.Results, &pb.MetricResult{
+			Index:   int32(item.Index),
+			Id:      item.ID,
+			Status:  item.Status,
+			Code:    item.Code,
+			Message: item.Message,
+		})
+	}
+
+	return resp, nil
+}
+
+// rejectedMessage формирует описание ошибки строгого режима со списком некорректных метрик.
+func rejectedMessage(err error, result model.BatchResult) string {
+	var b strings.Builder
+
+	b.WriteString(application.ErrorMessage(err))
+
+	for _, item := range result.Items {
+		if item.Status != model.ItemRejected || item.Code == application.CodeBatchRejected {
+			continue
+		}
+
+		fmt.Fprintf(&b, "; metric #%d %q: %s (%s)", item.Index, item.ID, item.Message, item.Code)
+	}
+
+	return b.String()
+}
+
+// authorize проверяет bearer-токен из метаданных запроса и права на вызов метода.
+// Методы, не перечисленные в methodScopes, требуют прав администратора.
+func authorize(ctx context.Context, authenticator *auth.Authenticator, method string) (context.Context, error) {
+	scope, ok := methodScopes[method]
+	if !ok {
+		scope = auth.ScopeAdmin
+	}
+
+	var header string
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if values := md.Get("authorization"); len(values) > 0 {
+			header = values[0]
+		}
+	}
+
+	identity, err := authenticator.Authorize(header, scope)
+	if err != nil {
+		if errors.Is(err, auth.ErrForbidden) {
+			return nil, status.Error(codes.PermissionDenied, err.Error())
+		}
+
+		return nil, status.Error(codes.Unauthenticated, err.Error())
+	}
+
+	return auth.WithIdentity(ctx, identity), nil
+}
+
+// authInterceptor проверяет авторизацию унарных вызовов.
+func authInterceptor(authenticator *auth.Authenticator) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		ctx, err := authorize(ctx, authenticator, info.FullMethod)
+		if err != nil {
+			return nil, err
+		}
+
+		return handler(ctx, req)
+	}
+}
+
+// authStreamInterceptor проверяет авторизацию потоковых вызовов, в том числе сервиса reflection.
+func authStreamInterceptor(authenticator *auth.Authenticator) grpc.StreamServerInterceptor {
+	return func(srv any, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		ctx, err := authorize(stream.Context(), authenticator, info.FullMethod)
+		if err != nil {
+			return err
+		}
+
+		return handler(srv, &identityStream{ServerStream: stream, ctx: ctx})
+	}
 }
 
-func StartGRPCServer(app *application.Application, address string) error {
-	server := grpc.NewServer()
+// identityStream поток, контекст которого содержит данные аутентифицированного клиента.
+type identityStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *identityStream) Context() context.Context {
+	return s.ctx
+}
+
+// clientKey возвращает ключ клиента для ограничения частоты запросов:
+// имя токена, если клиент аутентифицирован, иначе IP-адрес.
+func clientKey(ctx context.Context) string {
+	if identity, ok := auth.IdentityFromContext(ctx); ok {
+		return "token:" + identity.Name
+	}
+
+	if p, ok := peer.FromContext(ctx); ok && p.Addr != nil {
+		if host, _, err := net.SplitHostPort(p.Addr.String()); err == nil {
+			return "ip:" + host
+		}
+
+		return "ip:" + p.Addr.String()
+	}
+
+	return "ip:unknown"
+}
+
+// agentIDKey ключ метаданных с идентификатором агента.
+const agentIDKey = "x-agent-id"
+
+// clientInterceptor сохраняет в контексте источник записи метрик для учета лимитов кардинальности:
+// агентом считается идентификатор из метаданных x-agent-id, а без него клиент с ключом clientKey.
+func clientInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		client := model.Client{Agent: clientKey(ctx)}
+
+		var token string
+		if identity, ok := auth.IdentityFromContext(ctx); ok {
+			client.Tenant = identity.Tenant
+			token = identity.Name
+		}
+
+		if values := metadata.ValueFromIncomingContext(ctx, agentIDKey); len(values) > 0 && values[0] != "" {
+			agent, err := application.AgentName(token, values[0])
+			if err != nil {
+				return nil, status.Error(codes.InvalidArgument, application.ErrorMessage(err))
+			}
+
+			client.Agent = agent
+		}
+
+		return handler(application.WithClient(ctx, client), req)
+	}
+}
+
+// rateLimitInterceptor ограничивает частоту запросов и количество метрик от клиента.
+func rateLimitInterceptor(limiter *ratelimit.Limiter) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		key := clientKey(ctx)
+
+		if retryAfter, ok := limiter.AllowRequest(key); !ok {
+			return nil, resourceExhausted(ctx, key, retryAfter)
+		}
+
+		if update, ok := req.(*pb.UpdateMetricsRequest); ok {
+			if retryAfter, ok := limiter.AllowMetrics(key, len(update.GetMetrics())); !ok {
+				return nil, resourceExhausted(ctx, key, retryAfter)
+			}
+		}
+
+		return handler(ctx, req)
+	}
+}
+
+func resourceExhausted(ctx context.Context, key string, retryAfter time.Duration) error {
+	seconds := int64(math.Ceil(retryAfter.Seconds()))
+	if seconds < 1 {
+		seconds = 1
+	}
+
+	if err := grpc.SetHeader(ctx, metadata.Pairs("retry-after", strconv.FormatInt(seconds, 10))); err != nil {
+		log.Printf("can't set retry-after header: %v", err)
+	}
+
+	return status.Errorf(codes.ResourceExhausted, "rate limit exceeded for %s, retry after %ds", key, seconds)
+}
+
+func StartGRPCServer(app *application.Application, conf *Config) error {
+	var (
+		interceptors       []grpc.UnaryServerInterceptor
+		streamInterceptors []grpc.StreamServerInterceptor
+	)
+
+	if conf.Auth != nil {
+		interceptors = append(interceptors, authInterceptor(conf.Auth))
+		streamInterceptors = append(streamInterceptors, authStreamInterceptor(conf.Auth))
+	}
+
+	if conf.Limiter != nil {
+		interceptors = append(interceptors, rateLimitInterceptor(conf.Limiter))
+	}
+
+	interceptors = append(interceptors, clientInterceptor())
+
+	server := grpc.NewServer(
+		grpc.ChainUnaryInterceptor(interceptors...),
+		grpc.ChainStreamInterceptor(streamInterceptors...),
+	)
 	pb.RegisterMetricsServiceServer(server, NewMetricsServer(app))
 	reflection.Register(server)
 
-	lis, err := net.Listen("tcp", address)
+	lis, err := net.Listen("tcp", conf.Address)
 	if err != nil {
 		return fmt.Errorf("failed to listen: %w", err)
 	}
 
-	log.Printf("grpc server listening on %s", address)
+	log.Printf("grpc server listening on %s", conf.Address)
 
 	err = server.Serve(lis)
 	if err != nil {
@@ -0,0 +1,217 @@
+// Package ipfilter реализует фильтрацию запросов по IP-адресу клиента.
+//
+// Фильтр содержит списки разрешенных и запрещенных подсетей (IPv4 и IPv6)
+// и список доверенных прокси. Заголовки X-Forwarded-For и X-Real-IP учитываются
+// только для запросов, пришедших от доверенного прокси, иначе используется
+// адрес сокета. Отклоненные запросы подсчитываются по причинам.
+package ipfilter
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// Причины отклонения запроса.
+var (
+	ErrBadAddress = errors.New("bad_address")
+	ErrDenied     = errors.New("denied_subnet")
+	ErrNotAllowed = errors.New("not_allowed")
+)
+
+// Config параметры фильтра. Элементы списков — подсети в нотации CIDR или отдельные адреса.
+type Config struct {
+	Allowed        []string
+	Denied         []string
+	TrustedProxies []string
+}
+
+// Filter фильтр запросов по IP-адресу.
+type Filter struct {
+	mu       *sync.Mutex
+	rejected map[string]int64
+	allowed  []*net.IPNet
+	denied   []*net.IPNet
+	proxies  []*net.IPNet
+}
+
+// New создает новый экземпляр Filter.
+// Пустой список разрешенных подсетей означает, что разрешены все адреса, кроме запрещенных.
+func New(conf Config) (*Filter, error) {
+	allowed, err := parseNets(conf.Allowed)
+	if err != nil {
+		return nil, fmt.Errorf("can't parse allowed subnets: %w", err)
+	}
+
+	denied, err := parseNets(conf.Denied)
+	if err != nil {
+		return nil, fmt.Errorf("can't parse denied subnets: %w", err)
+	}
+
+	proxies, err := parseNets(conf.TrustedProxies)
+	if err != nil {
+		return nil, fmt.Errorf("can't parse trusted proxies: %w", err)
+	}
+
+	return &Filter{
+		mu:       &sync.Mutex{},
+		rejected: make(map[string]int64),
+		allowed:  allowed,
+		denied:   denied,
+		proxies:  proxies,
+	}, nil
+}
+
+func parseNets(list []string) ([]*net.IPNet, error) {
+	nets := make([]*net.IPNet, 0, len(list))
+	for _, item := range list {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+
+		if !strings.Contains(item, "/") {
+			ip := net.ParseIP(item)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid address: %s", item)
+			}
+
+			bits := 8 * net.IPv6len
+			if ip.To4() != nil {
+				ip = ip.To4()
+				bits = 8 * net.IPv4len
+			}
+
+			nets = append(nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+
+		_, subnet, err := net.ParseCIDR(item)
+		if err != nil {
+			return nil, fmt.Errorf("invalid subnet: %w", err)
+		}
+
+		nets = append(nets, subnet)
+	}
+
+	return nets, nil
+}
+
+func contains(nets []*net.IPNet, ip net.IP) bool {
+	for _, subnet := range nets {
+		if subnet.Contains(ip) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func parseIP(value string) net.IP {
+	value = strings.TrimSpace(value)
+	if host, _, err := net.SplitHostPort(value); err == nil {
+		value = host
+	}
+
+	return net.ParseIP(strings.Trim(value, "[]"))
+}
+
+// ClientIP возвращает адрес клиента.
+// Если запрос пришел от доверенного прокси, адрес берется из X-Forwarded-For
+// (первый справа адрес, не являющийся доверенным прокси) или из X-Real-IP.
+func (f *Filter) ClientIP(r *http.Request) (net.IP, error) {
+	peer := parseIP(r.RemoteAddr)
+	if peer == nil {
+		return nil, fmt.Errorf("can't parse peer address %q: %w", r.RemoteAddr, ErrBadAddress)
+	}
+
+	if !contains(f.proxies, peer) {
+		return peer, nil
+	}
+
+	if forwarded := r.Header.Get("X-Forwarded-For"); forwarded != "" {
+		hops := strings.Split(forwarded, ",")
+		for i := len(hops) - 1; i >= 0; i-- {
+			ip := parseIP(hops[i])
+			if ip == nil {
+				return nil, fmt.Errorf("can't parse X-Forwarded-For entry %q: %w", hops[i], ErrBadAddress)
+			}
+
+			if !contains(f.proxies, ip) {
+				return ip, nil
+			}
+		}
+	}
+
+	if realIP := r.Header.Get("X-Real-IP"); realIP != "" {
+		ip := parseIP(realIP)
+		if ip == nil {
+			return nil, fmt.Errorf("can't parse X-Real-IP %q: %w", realIP, ErrBadAddress)
+		}
+
+		return ip, nil
+	}
+
+	return peer, nil
+}
+
+// Check проверяет, разрешен ли адрес. Запрещенные подсети имеют приоритет над разрешенными.
+func (f *Filter) Check(ip net.IP) error {
+	if contains(f.denied, ip) {
+		return fmt.Errorf("address %s is in denied subnet: %w", ip, ErrDenied)
+	}
+
+	if len(f.allowed) > 0 && !contains(f.allowed, ip) {
+		return fmt.Errorf("address %s is not in allowed subnets: %w", ip, ErrNotAllowed)
+	}
+
+	return nil
+}
+
+// Reject учитывает отклоненный запрос и возвращает причину отклонения.
+func (f *Filter) Reject(err error) string {
+	reason := ErrBadAddress
+	switch {
+	case errors.Is(err, ErrDenied):
+		reason = ErrDenied
+	case errors.Is(err, ErrNotAllowed):
+		reason = ErrNotAllowed
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.rejected[reason.Error()]++
+
+	return reason.Error()
+}
+
+// Rejected возвращает количество отклоненных запросов по причинам.
+func (f *Filter) Rejected() map[string]int64 {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	result := make(map[string]int64, len(f.rejected))
+	for reason, count := range f.rejected {
+		result[reason] = count
+	}
+
+	return result
+}
+
+type clientIPKey struct{}
+
+// WithClientIP сохраняет адрес клиента в контексте.
+func WithClientIP(ctx context.Context, ip net.IP) context.Context {
+	return context.WithValue(ctx, clientIPKey{}, ip)
+}
+
+// ClientIPFromContext возвращает адрес клиента из контекста.
+func ClientIPFromContext(ctx context.Context) (net.IP, bool) {
+	ip, ok := ctx.Value(clientIPKey{}).(net.IP)
+	return ip, ok && ip != nil
+}
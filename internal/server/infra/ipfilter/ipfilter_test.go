@@ -0,0 +1,116 @@
+package ipfilter
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNew(t *testing.T) {
+	_, err := New(Config{Allowed: []string{"10.0.0.0/33"}})
+	assert.Error(t, err)
+
+	_, err = New(Config{TrustedProxies: []string{"proxy"}})
+	assert.Error(t, err)
+
+	f, err := New(Config{Allowed: []string{"10.0.0.0/8", "2001:db8::/32", "192.168.1.1"}})
+	require.NoError(t, err)
+	assert.Len(t, f.allowed, 3)
+}
+
+func TestFilter_ClientIP(t *testing.T) {
+	f, err := New(Config{TrustedProxies: []string{"10.0.0.1", "fd00::/8"}})
+	require.NoError(t, err)
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		headers    map[string]string
+		want       string
+		wantErr    bool
+	}{
+		{
+			name:       "untrusted peer ignores headers",
+			remoteAddr: "192.168.1.10:5000",
+			headers:    map[string]string{"X-Real-IP": "10.1.1.1", "X-Forwarded-For": "10.1.1.1"},
+			want:       "192.168.1.10",
+		},
+		{
+			name:       "trusted proxy with X-Forwarded-For",
+			remoteAddr: "10.0.0.1:5000",
+			headers:    map[string]string{"X-Forwarded-For": "1.1.1.1, 172.16.0.5, 10.0.0.1"},
+			want:       "172.16.0.5",
+		},
+		{
+			name:       "trusted proxy with X-Real-IP",
+			remoteAddr: "[fd00::1]:5000",
+			headers:    map[string]string{"X-Real-IP": "2001:db8::5"},
+			want:       "2001:db8::5",
+		},
+		{
+			name:       "trusted proxy without headers",
+			remoteAddr: "10.0.0.1:5000",
+			want:       "10.0.0.1",
+		},
+		{
+			name:       "bad forwarded entry",
+			remoteAddr: "10.0.0.1:5000",
+			headers:    map[string]string{"X-Forwarded-For": "unknown"},
+			wantErr:    true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.RemoteAddr = tt.remoteAddr
+			for k, v := range tt.headers {
+				req.Header.Set(k, v)
+			}
+
+			ip, err := f.ClientIP(req)
+			if tt.wantErr {
+				assert.ErrorIs(t, err, ErrBadAddress)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, ip.String())
+		})
+	}
+}
+
+func TestFilter_Check(t *testing.T) {
+	f, err := New(Config{
+		Allowed: []string{"10.0.0.0/8", "2001:db8::/32"},
+		Denied:  []string{"10.0.5.0/24"},
+	})
+	require.NoError(t, err)
+
+	assert.NoError(t, f.Check(net.ParseIP("10.1.2.3")))
+	assert.NoError(t, f.Check(net.ParseIP("2001:db8::1")))
+	assert.ErrorIs(t, f.Check(net.ParseIP("10.0.5.7")), ErrDenied)
+	assert.ErrorIs(t, f.Check(net.ParseIP("192.168.0.1")), ErrNotAllowed)
+	assert.ErrorIs(t, f.Check(net.ParseIP("2001:db9::1")), ErrNotAllowed)
+
+	open, err := New(Config{Denied: []string{"::1"}})
+	require.NoError(t, err)
+
+	assert.NoError(t, open.Check(net.ParseIP("8.8.8.8")))
+	assert.ErrorIs(t, open.Check(net.ParseIP("::1")), ErrDenied)
+}
+
+func TestFilter_Reject(t *testing.T) {
+	f, err := New(Config{})
+	require.NoError(t, err)
+
+	assert.Equal(t, "bad_address", f.Reject(ErrBadAddress))
+	assert.Equal(t, "not_allowed", f.Reject(ErrNotAllowed))
+	assert.Equal(t, "not_allowed", f.Reject(ErrNotAllowed))
+
+	assert.Equal(t, map[string]int64{"bad_address": 1, "not_allowed": 2}, f.Rejected())
+}
@@ -0,0 +1,156 @@
+package notify
+
+import (
+	"fmt"
+	"hash/fnv"
+	"maps"
+	"time"
+
+	"metricalert/internal/server/core/alerting"
+)
+
+// webhookMessage тело запроса webhook: уведомление и текст сообщения.
+type webhookMessage struct {
+	alerting.Notification
+	Message string `json:"message"`
+}
+
+func webhookPayload(_ *Config, msg Message, text string) any {
+	return webhookMessage{Notification: msg.Notification, Message: text}
+}
+
+// slackMessage сообщение входящего вебхука Slack.
+type slackMessage struct {
+	Text string `json:"text"`
+}
+
+func slackPayload(_ *Config, _ Message, text string) any {
+	return slackMessage{Text: text}
+}
+
+// telegramMessage параметры метода sendMessage Telegram Bot API.
+type telegramMessage struct {
+	ChatID    string `json:"chat_id"`
+	Text      string `json:"text"`
+	ParseMode string `json:"parse_mode,omitempty"`
+}
+
+func telegramPayload(conf *Config, _ Message, text string) any {
+	return telegramMessage{ChatID: conf.ChatID, Text: text, ParseMode: conf.ParseMode}
+}
+
+// alertmanagerVersion версия формата вебхука Alertmanager.
+const alertmanagerVersion = "4"
+
+// alertmanagerMessage уведомление в формате вебхука Alertmanager.
+type alertmanagerMessage struct {
+	GroupLabels       map[string]string   `json:"groupLabels"`
+	CommonLabels      map[string]string   `json:"commonLabels"`
+	CommonAnnotations map[string]string   `json:"commonAnnotations"`
+	Version           string              `json:"version"`
+	GroupKey          string              `json:"groupKey"`
+	Status            string              `json:"status"`
+	Receiver          string              `json:"receiver"`
+	ExternalURL       string              `json:"externalURL"`
+	Alerts            []alertmanagerAlert `json:"alerts"`
+	TruncatedAlerts   int                 `json:"truncatedAlerts"`
+}
+
+// alertmanagerAlert оповещение в формате вебхука Alertmanager.
+type alertmanagerAlert struct {
+	StartsAt     time.Time         `json:"startsAt"`
+	EndsAt       time.Time         `json:"endsAt"`
+	Labels       map[string]string `json:"labels"`
+	Annotations  map[string]string `json:"annotations"`
+	Status       string            `json:"status"`
+	GeneratorURL string            `json:"generatorURL"`
+	Fingerprint  string            `json:"fingerprint"`
+}
+
+// alertmanagerPayload строит уведомление в формате Alertmanager. Правило передается меткой
+// alertname, метрика, ее тип и агент метками metric, type и agent, описание аннотацией
+// description, текст сообщения общей аннотацией summary.
+func alertmanagerPayload(conf *Config, msg Message, text string) any {
+	payload := alertmanagerMessage{
+		GroupLabels:       make(map[string]string, len(msg.Labels)),
+		CommonAnnotations: map[string]string{"summary": text},
+		Version:           alertmanagerVersion,
+		GroupKey:          msg.GroupID,
+		Status:            msg.Status,
+		Receiver:          conf.Name,
+		Alerts:            make([]alertmanagerAlert, 0, len(msg.Alerts)),
+	}
+
+	for name, value := range msg.Labels {
+		payload.GroupLabels[alertmanagerLabel(name)] = value
+	}
+
+	for i, alert := range msg.Alerts {
+		labels := alertmanagerLabels(alert)
+
+		startsAt := alert.FiredAt
+		if startsAt.IsZero() {
+			startsAt = alert.ActiveAt
+		}
+
+		payload.Alerts = append(payload.Alerts, alertmanagerAlert{
+			StartsAt:    startsAt,
+			EndsAt:      alert.ResolvedAt,
+			Labels:      labels,
+			Annotations: map[string]string{"description": alert.Description},
+			Status:      alert.State,
+			Fingerprint: fingerprint(alert),
+		})
+
+		if i == 0 {
+			payload.CommonLabels = maps.Clone(labels)
+			continue
+		}
+
+		for name, value := range payload.CommonLabels {
+			if labels[name] != value {
+				delete(payload.CommonLabels, name)
+			}
+		}
+	}
+
+	if payload.CommonLabels == nil {
+		payload.CommonLabels = map[string]string{}
+	}
+
+	return payload
+}
+
+// alertmanagerLabel переименовывает поле rule в метку alertname, принятую в Alertmanager.
+func alertmanagerLabel(name string) string {
+	if name == alerting.MatchRule {
+		return "alertname"
+	}
+
+	return name
+}
+
+func alertmanagerLabels(alert alerting.Alert) map[string]string {
+	labels := maps.Clone(alert.Labels)
+	if labels == nil {
+		labels = make(map[string]string)
+	}
+
+	labels["alertname"] = alert.Rule
+
+	for name, value := range map[string]string{"metric": alert.Metric, "type": alert.MType, "agent": alert.Agent} {
+		if value != "" {
+			labels[name] = value
+		}
+	}
+
+	return labels
+}
+
+// fingerprint возвращает идентификатор оповещения, постоянный на всем его жизненном цикле.
+func fingerprint(alert alerting.Alert) string {
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(alert.Key()))
+
+	return fmt.Sprintf("%016x", h.Sum64())
+}
@@ -0,0 +1,113 @@
+//nolint:wrapcheck,nolintlint,errcheck
+package notify
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// receiver тестовый приемник уведомлений, запоминающий путь и тело последнего запроса.
+type receiver struct {
+	server *httptest.Server
+	path   string
+	body   string
+}
+
+func newReceiver(t *testing.T) *receiver {
+	t.Helper()
+
+	r := &receiver{}
+	r.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		body, _ := io.ReadAll(req.Body)
+		r.path, r.body = req.URL.Path, string(body)
+
+		if req.Method != http.MethodPost || req.Header.Get("Content-Type") != "application/json" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		_, _ = w.Write([]byte(`{"ok":true}`))
+	}))
+	t.Cleanup(r.server.Close)
+
+	return r
+}
+
+func TestFormats(t *testing.T) {
+	tests := []struct {
+		name string
+		conf Config
+		path string
+		want string
+	}{
+		{
+			name: "slack",
+			conf: Config{Type: TypeSlack, Template: "{{upper .Status}}: {{range .Firing}}{{.Metric}}={{.Value}}{{end}}"},
+			path: "/services/T0/B0/X",
+			want: `{"text":"FIRING: cpu_2=97.5"}`,
+		},
+		{
+			name: "telegram",
+			conf: Config{Type: TypeTelegram, ChatID: "-100123", ParseMode: "HTML",
+				Template: "<b>{{.Status}}</b> {{len .Alerts}} alerts"},
+			path: "/bot123:abc/sendMessage",
+			want: `{"chat_id":"-100123","text":"<b>firing</b> 2 alerts","parse_mode":"HTML"}`,
+		},
+		{
+			name: "alertmanager",
+			conf: Config{Type: TypeAlertmanager, Template: "{{len .Firing}} firing"},
+			path: "/hook",
+			want: `{
+				"version":"4","groupKey":"9f1c","truncatedAlerts":0,"status":"firing","receiver":"test",
+				"groupLabels":{"alertname":"high_cpu"},
+				"commonLabels":{"alertname":"high_cpu","severity":"page","type":"gauge"},
+				"commonAnnotations":{"summary":"1 firing"},
+				"externalURL":"",
+				"alerts":[
+					{"status":"resolved","labels":{"alertname":"high_cpu","metric":"cpu_1","type":"gauge","severity":"page"},
+					 "annotations":{"description":"value 20 > 90"},
+					 "startsAt":"2024-01-01T10:00:00Z","endsAt":"2024-01-01T10:05:00Z",
+					 "generatorURL":"","fingerprint":"` + fingerprint(testNotification().Alerts[0]) + `"},
+					{"status":"firing","labels":{"alertname":"high_cpu","metric":"cpu_2","type":"gauge","severity":"page"},
+					 "annotations":{"description":"value 97.5 > 90"},
+					 "startsAt":"2024-01-01T10:00:00Z","endsAt":"0001-01-01T00:00:00Z",
+					 "generatorURL":"","fingerprint":"` + fingerprint(testNotification().Alerts[1]) + `"}
+				]}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := newReceiver(t)
+
+			conf := tt.conf
+			conf.Name = "test"
+			conf.URL = r.server.URL + tt.path
+
+			channels, err := New([]Config{conf})
+			require.NoError(t, err)
+
+			require.NoError(t, channels["test"].Notify(context.Background(), testNotification()))
+			assert.Equal(t, tt.path, r.path)
+			assert.JSONEq(t, tt.want, r.body)
+		})
+	}
+}
+
+func TestFingerprint(t *testing.T) {
+	alerts := testNotification().Alerts
+
+	assert.Len(t, fingerprint(alerts[0]), 16)
+	assert.NotEqual(t, fingerprint(alerts[0]), fingerprint(alerts[1]))
+
+	// отпечаток не меняется при смене состояния и значения
+	resolved := alerts[1]
+	resolved.State, resolved.Value = "resolved", 10
+	assert.Equal(t, fingerprint(alerts[1]), fingerprint(resolved))
+}
@@ -0,0 +1,232 @@
+// Package notify реализует каналы доставки уведомлений об оповещениях.
+//
+// Канал отправляет уведомление POST-запросом в формате JSON; тело запроса зависит от типа канала:
+// webhook отправляет alerting.Notification с текстом сообщения, slack и telegram отправляют
+// текст сообщения во входящий вебхук Slack и методом sendMessage Telegram Bot API,
+// alertmanager отправляет уведомление в формате вебхука Alertmanager.
+// Текст сообщения строится шаблоном text/template, см. Message.
+// Ответ со статусом вне диапазона 2xx считается ошибкой доставки.
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"text/template"
+	"time"
+
+	"go.uber.org/zap"
+
+	"metricalert/internal/server/core/alerting"
+)
+
+// Типы каналов.
+const (
+	TypeWebhook      = "webhook"
+	TypeSlack        = "slack"
+	TypeTelegram     = "telegram"
+	TypeAlertmanager = "alertmanager"
+)
+
+const (
+	defaultTimeout   = 10 * time.Second
+	maxErrorBodySize = 1 << 10
+	telegramAPI      = "https://api.telegram.org"
+)
+
+// ErrInvalidChannel ошибка проверки параметров канала.
+var ErrInvalidChannel = errors.New("invalid notification channel")
+
+// Config параметры канала уведомлений. Headers добавляются к каждому запросу, например
+// для авторизации. Template задает шаблон текста сообщения, без него используется шаблон
+// по умолчанию. Нулевой Timeout заменяется значением по умолчанию 10s.
+//
+// Для telegram нужны ChatID и BotToken, URL по умолчанию строится по токену;
+// ParseMode (HTML, Markdown или MarkdownV2) передается в sendMessage как есть. Текст шаблона
+// по умолчанию экранируется для ParseMode, собственный шаблон экранирует значения сам
+// функциями html, markdown и markdownv2.
+type Config struct {
+	Headers   map[string]string `json:"headers,omitempty"`
+	Name      string            `json:"name"`
+	Type      string            `json:"type"`
+	URL       string            `json:"url,omitempty"`
+	Template  string            `json:"template,omitempty"`
+	ChatID    string            `json:"chat_id,omitempty"`
+	BotToken  string            `json:"bot_token,omitempty"`
+	ParseMode string            `json:"parse_mode,omitempty"`
+	Timeout   alerting.Duration `json:"timeout,omitempty"`
+}
+
+// New создает каналы по списку параметров. Имена каналов должны быть уникальны.
+func New(configs []Config) (map[string]alerting.Channel, error) {
+	channels := make(map[string]alerting.Channel, len(configs))
+
+	for _, conf := range configs {
+		if _, ok := channels[conf.Name]; ok {
+			return nil, fmt.Errorf("channel %q: %w: duplicate name", conf.Name, ErrInvalidChannel)
+		}
+
+		ch, err := newChannel(conf)
+		if err != nil {
+			return nil, fmt.Errorf("channel %q: %w: %w", conf.Name, ErrInvalidChannel, err)
+		}
+
+		channels[conf.Name] = ch
+	}
+
+	return channels, nil
+}
+
+// formatter строит тело запроса по уведомлению и тексту сообщения.
+type formatter func(conf *Config, msg Message, text string) any
+
+func newChannel(conf Config) (*channel, error) {
+	if strings.TrimSpace(conf.Name) == "" {
+		return nil, errors.New("empty name")
+	}
+
+	var (
+		format formatter
+		escape func(string) string
+	)
+
+	switch conf.Type {
+	case TypeWebhook:
+		format = webhookPayload
+	case TypeSlack:
+		format = slackPayload
+	case TypeTelegram:
+		if conf.ChatID == "" {
+			return nil, errors.New("telegram requires chat_id")
+		}
+
+		if conf.URL == "" {
+			if conf.BotToken == "" {
+				return nil, errors.New("telegram requires bot_token or url")
+			}
+
+			conf.URL = telegramAPI + "/bot" + conf.BotToken + "/sendMessage"
+		}
+
+		if conf.ParseMode != "" {
+			var ok bool
+			if escape, ok = escapers[strings.ToLower(conf.ParseMode)]; !ok {
+				return nil, fmt.Errorf("unknown parse_mode %q", conf.ParseMode)
+			}
+		}
+
+		format = telegramPayload
+	case TypeAlertmanager:
+		format = alertmanagerPayload
+	default:
+		return nil, fmt.Errorf("unknown type %q", conf.Type)
+	}
+
+	target, err := url.Parse(conf.URL)
+	if err != nil || (target.Scheme != "http" && target.Scheme != "https") || target.Host == "" {
+		// адрес telegram содержит токен бота, поэтому в ошибку не попадает
+		return nil, errors.New("url must be an absolute http or https address")
+	}
+
+	if conf.Timeout < 0 {
+		return nil, errors.New("negative timeout")
+	}
+
+	timeout := time.Duration(conf.Timeout)
+	if timeout == 0 {
+		timeout = defaultTimeout
+	}
+
+	tmpl, err := parseTemplate(conf.Name, conf.Template)
+	if err != nil {
+		return nil, err
+	}
+
+	if conf.Template != "" {
+		escape = nil
+	}
+
+	return &channel{
+		client: &http.Client{Timeout: timeout},
+		tmpl:   tmpl,
+		format: format,
+		escape: escape,
+		conf:   conf,
+	}, nil
+}
+
+// channel канал, отправляющий уведомления POST-запросом в формате JSON.
+type channel struct {
+	client *http.Client
+	tmpl   *template.Template
+	format formatter
+	escape func(string) string // экранирование текста шаблона по умолчанию для разметки
+	conf   Config
+}
+
+// Notify отправляет уведомление.
+func (c *channel) Notify(ctx context.Context, n alerting.Notification) error {
+	msg := Message{Notification: n}
+
+	text, err := render(c.tmpl, msg)
+	if err != nil {
+		return err
+	}
+
+	if c.escape != nil {
+		text = c.escape(text)
+	}
+
+	body, err := json.Marshal(c.format(&c.conf, msg, text))
+	if err != nil {
+		return fmt.Errorf("failed to marshal notification: %w", err)
+	}
+
+	return post(ctx, c.client, c.conf.URL, c.conf.Headers, body)
+}
+
+// post отправляет тело body в формате JSON и проверяет статус ответа.
+func post(ctx context.Context, client *http.Client, target string, headers map[string]string, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, target, bytes.NewReader(body))
+	if err != nil {
+		return errors.New("failed to create request")
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+
+	for name, value := range headers {
+		req.Header.Set(name, value)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		// ошибка клиента содержит адрес, в котором может быть токен, поэтому он отбрасывается
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			err = urlErr.Err
+		}
+
+		return fmt.Errorf("failed to send notification: %w", err)
+	}
+	defer func() {
+		if err := resp.Body.Close(); err != nil {
+			zap.L().Error("can't close response body", zap.Error(err))
+		}
+	}()
+
+	if resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusMultipleChoices {
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorBodySize))
+		return fmt.Errorf("unexpected status %d: %s", resp.StatusCode, strings.TrimSpace(string(message)))
+	}
+
+	// ответ вычитывается, чтобы соединение можно было переиспользовать
+	_, _ = io.Copy(io.Discard, resp.Body)
+
+	return nil
+}
@@ -0,0 +1,189 @@
+//nolint:wrapcheck,nolintlint,errcheck
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"metricalert/internal/server/core/alerting"
+)
+
+func TestNew(t *testing.T) {
+	tests := []struct {
+		name    string
+		configs []Config
+		wantErr bool
+	}{
+		{name: "webhook", configs: []Config{{Name: "oncall", Type: TypeWebhook, URL: "https://example.com/hook"}}},
+		{name: "chats", configs: []Config{
+			{Name: "slack", Type: TypeSlack, URL: "https://hooks.slack.com/services/T0/B0/X"},
+			{Name: "telegram", Type: TypeTelegram, BotToken: "123:abc", ChatID: "-100"},
+			{Name: "alertmanager", Type: TypeAlertmanager, URL: "http://localhost:9093/hook"},
+		}},
+		{name: "custom template", configs: []Config{
+			{Name: "a", Type: TypeSlack, URL: "https://example.com", Template: "{{.Status}}: {{len .Firing}} firing"},
+		}},
+		{name: "template syntax", configs: []Config{
+			{Name: "a", Type: TypeSlack, URL: "https://example.com", Template: "{{.Status"},
+		}, wantErr: true},
+		{name: "template unknown field", configs: []Config{
+			{Name: "a", Type: TypeSlack, URL: "https://example.com", Template: "{{.Severity}}"},
+		}, wantErr: true},
+		{name: "telegram without chat", configs: []Config{
+			{Name: "a", Type: TypeTelegram, BotToken: "123:abc"},
+		}, wantErr: true},
+		{name: "telegram unknown parse mode", configs: []Config{
+			{Name: "a", Type: TypeTelegram, BotToken: "123:abc", ChatID: "-100", ParseMode: "BBCode"},
+		}, wantErr: true},
+		{name: "telegram without token", configs: []Config{{Name: "a", Type: TypeTelegram, ChatID: "-100"}}, wantErr: true},
+		{name: "empty name", configs: []Config{{Type: TypeWebhook, URL: "https://example.com/hook"}}, wantErr: true},
+		{name: "unknown type", configs: []Config{{Name: "a", Type: "pager", URL: "https://example.com"}}, wantErr: true},
+		{name: "invalid url", configs: []Config{{Name: "a", Type: TypeWebhook, URL: "example.com/hook"}}, wantErr: true},
+		{name: "negative timeout", configs: []Config{
+			{Name: "a", Type: TypeWebhook, URL: "https://example.com", Timeout: alerting.Duration(-time.Second)},
+		}, wantErr: true},
+		{name: "duplicate name", configs: []Config{
+			{Name: "a", Type: TypeWebhook, URL: "https://example.com/1"},
+			{Name: "a", Type: TypeWebhook, URL: "https://example.com/2"},
+		}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			channels, err := New(tt.configs)
+			if tt.wantErr {
+				assert.ErrorIs(t, err, ErrInvalidChannel)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Len(t, channels, len(tt.configs))
+		})
+	}
+}
+
+func TestWebhook_Notify(t *testing.T) {
+	var (
+		body   []byte
+		header http.Header
+	)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ = io.ReadAll(r.Body)
+		header = r.Header
+
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	channels, err := New([]Config{{
+		Name: "oncall", Type: TypeWebhook, URL: server.URL, Headers: map[string]string{"Authorization": "Bearer secret"},
+	}})
+	require.NoError(t, err)
+
+	notification := alerting.Notification{
+		Labels:  map[string]string{"rule": "high_cpu"},
+		GroupID: "9f1c",
+		Status:  alerting.StateFiring,
+		Channel: "oncall",
+		Alerts: []alerting.Alert{{
+			Rule: "high_cpu", Metric: "cpu", State: alerting.StateFiring, Value: 95, Description: "value 95 > 90",
+		}},
+	}
+
+	require.NoError(t, channels["oncall"].Notify(context.Background(), notification))
+
+	var received webhookMessage
+	require.NoError(t, json.Unmarshal(body, &received))
+	assert.Equal(t, notification, received.Notification)
+	assert.Equal(t, "[FIRING] rule=high_cpu\n- high_cpu cpu: value 95 > 90", received.Message)
+	assert.Equal(t, "application/json", header.Get("Content-Type"))
+	assert.Equal(t, "Bearer secret", header.Get("Authorization"))
+}
+
+func TestWebhook_NotifyError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		http.Error(w, "receiver is down", http.StatusBadGateway)
+	}))
+	defer server.Close()
+
+	channels, err := New([]Config{{Name: "oncall", Type: TypeWebhook, URL: server.URL}})
+	require.NoError(t, err)
+
+	err = channels["oncall"].Notify(context.Background(), alerting.Notification{Status: alerting.StateFiring})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "unexpected status 502: receiver is down")
+}
+
+func TestTelegram_DefaultURL(t *testing.T) {
+	ch, err := newChannel(Config{Name: "tg", Type: TypeTelegram, BotToken: "123:abc", ChatID: "-100"})
+	require.NoError(t, err)
+	assert.Equal(t, "https://api.telegram.org/bot123:abc/sendMessage", ch.conf.URL)
+}
+
+func TestTelegram_ParseMode(t *testing.T) {
+	notification := alerting.Notification{
+		Status: alerting.StateFiring,
+		Alerts: []alerting.Alert{{Rule: "slow_io", Metric: "disk_<sda>", Description: "value 5 > 1"}},
+	}
+
+	tests := []struct {
+		name     string
+		mode     string
+		template string
+		want     string
+	}{
+		{name: "plain", want: "[FIRING]\n- slow_io disk_<sda>: value 5 > 1"},
+		{name: "html", mode: "HTML", want: "[FIRING]\n- slow_io disk_&lt;sda&gt;: value 5 &gt; 1"},
+		{name: "markdown", mode: "Markdown", want: `\[FIRING]` + "\n" + `- slow\_io disk\_<sda>: value 5 > 1`},
+		{
+			name: "markdown v2", mode: "MarkdownV2",
+			want: `\[FIRING\]` + "\n" + `\- slow\_io disk\_<sda\>: value 5 \> 1`,
+		},
+		{
+			name: "custom template", mode: "HTML", template: `<b>{{.Status}}</b> {{html (index .Alerts 0).Metric}}`,
+			want: "<b>firing</b> disk_&lt;sda&gt;",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got telegramMessage
+
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				assert.NoError(t, json.NewDecoder(r.Body).Decode(&got))
+			}))
+			defer server.Close()
+
+			channels, err := New([]Config{{
+				Name: "tg", Type: TypeTelegram, URL: server.URL, ChatID: "-100", ParseMode: tt.mode, Template: tt.template,
+			}})
+			require.NoError(t, err)
+			require.NoError(t, channels["tg"].Notify(context.Background(), notification))
+
+			assert.Equal(t, tt.want, got.Text)
+			assert.Equal(t, tt.mode, got.ParseMode)
+		})
+	}
+}
+
+func TestPost_HidesURL(t *testing.T) {
+	server := httptest.NewServer(http.NotFoundHandler())
+	target := server.URL + "/bot123:secret/sendMessage"
+	server.Close()
+
+	channels, err := New([]Config{{Name: "tg", Type: TypeTelegram, URL: target, ChatID: "-100"}})
+	require.NoError(t, err)
+
+	err = channels["tg"].Notify(context.Background(), alerting.Notification{Status: alerting.StateFiring})
+	require.Error(t, err)
+	assert.NotContains(t, err.Error(), "secret")
+}
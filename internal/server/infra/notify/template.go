@@ -0,0 +1,128 @@
+package notify
+
+import (
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"strings"
+	"text/template"
+	"time"
+
+	"metricalert/internal/server/core/alerting"
+)
+
+// defaultTemplate шаблон сообщения по умолчанию: статус, поля группировки и строка на оповещение.
+const defaultTemplate = `[{{upper .Status}}]{{range $name, $value := .Labels}} {{$name}}={{$value}}{{end}}
+{{range .Alerts}}- {{.Rule}}{{with .Metric}} {{.}}{{end}}{{with .Agent}} agent {{.}}{{end}}: {{.Description}}` +
+	`{{if .FiredAt.IsZero | not}}, fired {{timestamp .FiredAt}}{{end}}` +
+	`{{if .ResolvedAt.IsZero | not}}, resolved {{timestamp .ResolvedAt}}{{end}}
+{{end}}`
+
+// Message данные шаблона сообщения: уведомление о группе оповещений. Каждое оповещение
+// в Alerts содержит правило Rule, значение Value, метки Labels, описание Description,
+// время срабатывания FiredAt и разрешения ResolvedAt.
+//
+// Кроме стандартных функций text/template в шаблоне доступны upper, lower, join (strings.Join),
+// timestamp, которая форматирует время в RFC 3339, и html, markdown, markdownv2, которые
+// экранируют текст для режимов разметки telegram HTML, Markdown и MarkdownV2.
+type Message struct {
+	alerting.Notification
+}
+
+// Firing возвращает срабатывающие оповещения.
+func (m Message) Firing() []alerting.Alert {
+	return m.filter(alerting.StateFiring)
+}
+
+// Resolved возвращает разрешенные оповещения.
+func (m Message) Resolved() []alerting.Alert {
+	return m.filter(alerting.StateResolved)
+}
+
+func (m Message) filter(state string) []alerting.Alert {
+	var alerts []alerting.Alert
+
+	for _, alert := range m.Alerts {
+		if alert.State == state {
+			alerts = append(alerts, alert)
+		}
+	}
+
+	return alerts
+}
+
+// Экранирование специальных символов разметки telegram.
+var (
+	markdownEscaper   = strings.NewReplacer("_", `\_`, "*", `\*`, "`", "\\`", "[", `\[`)
+	markdownV2Escaper = strings.NewReplacer(
+		`\`, `\\`, "_", `\_`, "*", `\*`, "[", `\[`, "]", `\]`, "(", `\(`, ")", `\)`, "~", `\~`, "`", "\\`",
+		">", `\>`, "#", `\#`, "+", `\+`, "-", `\-`, "=", `\=`, "|", `\|`, "{", `\{`, "}", `\}`, ".", `\.`, "!", `\!`,
+	)
+)
+
+// escapers функции экранирования по режиму разметки telegram parse_mode в нижнем регистре.
+var escapers = map[string]func(string) string{
+	"html":       html.EscapeString,
+	"markdown":   markdownEscaper.Replace,
+	"markdownv2": markdownV2Escaper.Replace,
+}
+
+var templateFuncs = template.FuncMap{
+	"upper": strings.ToUpper,
+	"lower": strings.ToLower,
+	"join":  strings.Join,
+	"timestamp": func(t time.Time) string {
+		return t.Format(time.RFC3339)
+	},
+	"html":       escapers["html"],
+	"markdown":   escapers["markdown"],
+	"markdownv2": escapers["markdownv2"],
+}
+
+// sampleMessage уведомление, на котором шаблон проверяется при создании канала.
+var sampleMessage = Message{Notification: alerting.Notification{
+	Labels:  map[string]string{alerting.MatchRule: "sample"},
+	GroupID: "0",
+	Status:  alerting.StateFiring,
+	Alerts: []alerting.Alert{{
+		Rule: "sample", Metric: "sample", MType: "gauge", State: alerting.StateFiring,
+		Labels: map[string]string{}, ActiveAt: time.Unix(0, 0).UTC(), FiredAt: time.Unix(0, 0).UTC(),
+	}},
+}}
+
+// parseTemplate разбирает шаблон сообщения и проверяет его на пробном уведомлении,
+// чтобы ошибки в именах полей обнаруживались при запуске, а не при отправке.
+func parseTemplate(name, text string) (*template.Template, error) {
+	if text == "" {
+		text = defaultTemplate
+	}
+
+	tmpl, err := template.New(name).Funcs(templateFuncs).Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("invalid template: %w", err)
+	}
+
+	if err = tmpl.Execute(io.Discard, sampleMessage); err != nil {
+		return nil, fmt.Errorf("invalid template: %w", err)
+	}
+
+	return tmpl, nil
+}
+
+// render строит текст сообщения по шаблону. Пустое сообщение считается ошибкой:
+// чаты такие сообщения не принимают.
+func render(tmpl *template.Template, msg Message) (string, error) {
+	var text strings.Builder
+
+	if err := tmpl.Execute(&text, msg); err != nil {
+		return "", fmt.Errorf("failed to render template: %w", err)
+	}
+
+	result := strings.TrimSpace(text.String())
+	if result == "" {
+		return "", errors.New("failed to render template: empty message")
+	}
+
+	return result, nil
+}
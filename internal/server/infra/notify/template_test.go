@@ -0,0 +1,83 @@
+//nolint:wrapcheck,nolintlint,errcheck
+package notify
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"metricalert/internal/server/core/alerting"
+)
+
+func testNotification() alerting.Notification {
+	fired := time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC)
+
+	return alerting.Notification{
+		Labels:  map[string]string{"rule": "high_cpu"},
+		GroupID: "9f1c",
+		Status:  alerting.StateFiring,
+		Channel: "oncall",
+		Alerts: []alerting.Alert{
+			{
+				Rule: "high_cpu", Metric: "cpu_1", MType: "gauge", State: alerting.StateResolved, Value: 20,
+				Labels: map[string]string{"severity": "page"}, Description: "value 20 > 90",
+				ActiveAt: fired, FiredAt: fired, ResolvedAt: fired.Add(5 * time.Minute),
+			},
+			{
+				Rule: "high_cpu", Metric: "cpu_2", MType: "gauge", State: alerting.StateFiring, Value: 97.5,
+				Labels: map[string]string{"severity": "page"}, Description: "value 97.5 > 90",
+				ActiveAt: fired, FiredAt: fired,
+			},
+		},
+	}
+}
+
+func TestRender(t *testing.T) {
+	tests := []struct {
+		name     string
+		template string
+		want     string
+		wantErr  bool
+	}{
+		{
+			name: "default",
+			want: "[FIRING] rule=high_cpu\n" +
+				"- high_cpu cpu_1: value 20 > 90, fired 2024-01-01T10:00:00Z, resolved 2024-01-01T10:05:00Z\n" +
+				"- high_cpu cpu_2: value 97.5 > 90, fired 2024-01-01T10:00:00Z",
+		},
+		{
+			name: "custom",
+			template: `{{range .Firing}}{{.Rule}} {{.Metric}}={{.Value}} severity={{.Labels.severity}}` +
+				` since {{.FiredAt.Format "15:04"}}{{end}}; resolved: {{len .Resolved}}`,
+			want: "high_cpu cpu_2=97.5 severity=page since 10:00; resolved: 1",
+		},
+		{
+			name:     "functions",
+			template: `{{lower .Status}} {{upper .Channel}} {{join (index .Alerts 0).SilencedBy ","}}`,
+			want:     "firing ONCALL",
+		},
+		{
+			name:     "empty",
+			template: `{{if eq .Status "resolved"}}done{{end}}`,
+			wantErr:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpl, err := parseTemplate("test", tt.template)
+			require.NoError(t, err)
+
+			text, err := render(tmpl, Message{Notification: testNotification()})
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, text)
+		})
+	}
+}
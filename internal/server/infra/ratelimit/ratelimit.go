@@ -0,0 +1,242 @@
+// Package ratelimit реализует ограничение частоты запросов клиентов.
+//
+// Для каждого клиента (имя токена или IP-адрес) заводятся два token bucket:
+// на количество запросов в секунду и на количество метрик в секунду.
+// Пакет метрик, превышающий размер bucket, принимается только при полном bucket
+// и уводит его в минус, поэтому средняя скорость не превышает заданную.
+package ratelimit
+
+import (
+	"math"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Config параметры ограничителя. Нулевая скорость отключает соответствующее ограничение.
+type Config struct {
+	RequestsPerSecond float64
+	MetricsPerSecond  float64
+	RequestBurst      int
+	MetricsBurst      int
+}
+
+type bucket struct {
+	last   time.Time
+	tokens float64
+}
+
+type limit struct {
+	buckets map[string]*bucket
+	rate    float64
+	burst   float64
+}
+
+func newLimit(rate float64, burst int) *limit {
+	if rate <= 0 {
+		return nil
+	}
+
+	b := float64(burst)
+	if b <= 0 {
+		b = math.Ceil(rate)
+	}
+
+	return &limit{
+		buckets: make(map[string]*bucket),
+		rate:    rate,
+		burst:   b,
+	}
+}
+
+// refill возвращает bucket клиента с учетом накопленных с прошлого обращения токенов.
+func (l *limit) refill(key string, now time.Time) *bucket {
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: l.burst, last: now}
+		l.buckets[key] = b
+
+		return b
+	}
+
+	b.tokens = math.Min(l.burst, b.tokens+now.Sub(b.last).Seconds()*l.rate)
+	b.last = now
+
+	return b
+}
+
+func (l *limit) take(key string, n float64, now time.Time) (time.Duration, bool) {
+	b := l.refill(key, now)
+
+	need := math.Min(n, l.burst)
+	if b.tokens >= need {
+		b.tokens -= n
+		return 0, true
+	}
+
+	return time.Duration((need - b.tokens) / l.rate * float64(time.Second)), false
+}
+
+// charge списывает n токенов без проверки, bucket может уйти в минус.
+func (l *limit) charge(key string, n float64, now time.Time) {
+	l.refill(key, now).tokens -= n
+}
+
+// prune удаляет полностью восстановившиеся bucket, они ничем не отличаются от новых.
+func (l *limit) prune(now time.Time) {
+	for key := range l.buckets {
+		if l.refill(key, now).tokens >= l.burst {
+			delete(l.buckets, key)
+		}
+	}
+}
+
+// Limiter ограничитель частоты запросов.
+type Limiter struct {
+	lastPrune time.Time
+	mu        *sync.Mutex
+	requests  *limit
+	metrics   *limit
+	now       func() time.Time
+}
+
+// New создает новый экземпляр Limiter.
+// Если обе скорости нулевые, возвращается nil: ограничение отключено.
+func New(conf Config) *Limiter {
+	requests := newLimit(conf.RequestsPerSecond, conf.RequestBurst)
+	metrics := newLimit(conf.MetricsPerSecond, conf.MetricsBurst)
+
+	if requests == nil && metrics == nil {
+		return nil
+	}
+
+	return &Limiter{
+		mu:       &sync.Mutex{},
+		requests: requests,
+		metrics:  metrics,
+		now:      time.Now,
+	}
+}
+
+// AllowRequest учитывает запрос клиента.
+// Если лимит исчерпан, возвращает false и время, через которое стоит повторить запрос.
+func (l *Limiter) AllowRequest(key string) (time.Duration, bool) {
+	return l.take(l.requests, key, 1)
+}
+
+// AllowMetrics учитывает n метрик, присланных клиентом.
+// Если лимит исчерпан, возвращает false и время, через которое стоит повторить запрос.
+func (l *Limiter) AllowMetrics(key string, n int) (time.Duration, bool) {
+	return l.take(l.metrics, key, float64(n))
+}
+
+// ChargeMetrics учитывает n метрик без проверки лимита. Используется для продолжения пакета,
+// первая часть которого уже прошла AllowMetrics: прерывать частично примененный пакет нельзя,
+// поэтому остаток списывается в долг и задерживает следующие запросы клиента.
+func (l *Limiter) ChargeMetrics(key string, n int) {
+	if l.metrics == nil {
+		return
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.metrics.charge(key, float64(n), l.now())
+}
+
+func (l *Limiter) take(lim *limit, key string, n float64) (time.Duration, bool) {
+	if lim == nil {
+		return 0, true
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	l.pruneLocked(now)
+
+	return lim.take(key, n, now)
+}
+
+func (l *Limiter) pruneLocked(now time.Time) {
+	const pruneInterval = time.Minute
+	if now.Sub(l.lastPrune) < pruneInterval {
+		return
+	}
+
+	l.lastPrune = now
+
+	for _, lim := range []*limit{l.requests, l.metrics} {
+		if lim != nil {
+			lim.prune(now)
+		}
+	}
+}
+
+// State состояние ограничителя для клиента.
+type State struct {
+	RequestTokens *float64 `json:"request_tokens,omitempty"`
+	MetricTokens  *float64 `json:"metric_tokens,omitempty"`
+	Key           string   `json:"key"`
+}
+
+// Snapshot содержит параметры ограничителя и состояние активных клиентов.
+type Snapshot struct {
+	Clients           []State `json:"clients"`
+	RequestsPerSecond float64 `json:"requests_per_second"`
+	RequestBurst      float64 `json:"request_burst"`
+	MetricsPerSecond  float64 `json:"metrics_per_second"`
+	MetricsBurst      float64 `json:"metrics_burst"`
+}
+
+// Snapshot возвращает текущее состояние ограничителя.
+func (l *Limiter) Snapshot() Snapshot {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	states := make(map[string]*State)
+
+	get := func(key string) *State {
+		s, ok := states[key]
+		if !ok {
+			s = &State{Key: key}
+			states[key] = s
+		}
+
+		return s
+	}
+
+	var snapshot Snapshot
+
+	if l.requests != nil {
+		snapshot.RequestsPerSecond = l.requests.rate
+		snapshot.RequestBurst = l.requests.burst
+
+		for key := range l.requests.buckets {
+			tokens := l.requests.refill(key, now).tokens
+			get(key).RequestTokens = &tokens
+		}
+	}
+
+	if l.metrics != nil {
+		snapshot.MetricsPerSecond = l.metrics.rate
+		snapshot.MetricsBurst = l.metrics.burst
+
+		for key := range l.metrics.buckets {
+			tokens := l.metrics.refill(key, now).tokens
+			get(key).MetricTokens = &tokens
+		}
+	}
+
+	snapshot.Clients = make([]State, 0, len(states))
+	for _, s := range states {
+		snapshot.Clients = append(snapshot.Clients, *s)
+	}
+
+	sort.Slice(snapshot.Clients, func(i, j int) bool {
+		return snapshot.Clients[i].Key < snapshot.Clients[j].Key
+	})
+
+	return snapshot
+}
@@ -0,0 +1,112 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestLimiter(conf Config) (*Limiter, *time.Time) {
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	l := New(conf)
+	l.now = func() time.Time { return now }
+
+	return l, &now
+}
+
+func TestNew(t *testing.T) {
+	assert.Nil(t, New(Config{}))
+	assert.NotNil(t, New(Config{MetricsPerSecond: 1}))
+}
+
+func TestLimiter_AllowRequest(t *testing.T) {
+	l, now := newTestLimiter(Config{RequestsPerSecond: 2, RequestBurst: 2})
+
+	_, ok := l.AllowRequest("a")
+	assert.True(t, ok)
+	_, ok = l.AllowRequest("a")
+	assert.True(t, ok)
+
+	retryAfter, ok := l.AllowRequest("a")
+	assert.False(t, ok)
+	assert.Equal(t, 500*time.Millisecond, retryAfter)
+
+	_, ok = l.AllowRequest("b")
+	assert.True(t, ok, "clients have separate buckets")
+
+	*now = now.Add(500 * time.Millisecond)
+
+	_, ok = l.AllowRequest("a")
+	assert.True(t, ok)
+
+	_, ok = l.AllowMetrics("a", 1000)
+	assert.True(t, ok, "metrics are not limited")
+}
+
+func TestLimiter_AllowMetrics(t *testing.T) {
+	l, now := newTestLimiter(Config{MetricsPerSecond: 10})
+
+	_, ok := l.AllowMetrics("a", 4)
+	assert.True(t, ok)
+
+	retryAfter, ok := l.AllowMetrics("a", 7)
+	assert.False(t, ok)
+	assert.Equal(t, 100*time.Millisecond, retryAfter)
+
+	*now = now.Add(time.Second)
+
+	// Пакет больше bucket принимается только при полном bucket и уводит его в минус.
+	_, ok = l.AllowMetrics("a", 25)
+	assert.True(t, ok)
+
+	retryAfter, ok = l.AllowMetrics("a", 1)
+	assert.False(t, ok)
+	assert.Equal(t, 1600*time.Millisecond, retryAfter)
+}
+
+func TestLimiter_ChargeMetrics(t *testing.T) {
+	l, now := newTestLimiter(Config{MetricsPerSecond: 10})
+
+	_, ok := l.AllowMetrics("a", 10)
+	assert.True(t, ok)
+
+	// Продолжение пакета списывается без отказа, долг задерживает следующие запросы.
+	l.ChargeMetrics("a", 10)
+
+	*now = now.Add(time.Second)
+
+	retryAfter, ok := l.AllowMetrics("a", 1)
+	assert.False(t, ok)
+	assert.Equal(t, 100*time.Millisecond, retryAfter)
+
+	New(Config{RequestsPerSecond: 1}).ChargeMetrics("a", 10)
+}
+
+func TestLimiter_Snapshot(t *testing.T) {
+	l, now := newTestLimiter(Config{RequestsPerSecond: 1, MetricsPerSecond: 10, MetricsBurst: 20})
+
+	l.AllowRequest("b")
+	l.AllowMetrics("a", 5)
+
+	snapshot := l.Snapshot()
+	assert.InDelta(t, 1, snapshot.RequestBurst, 0)
+	assert.InDelta(t, 20, snapshot.MetricsBurst, 0)
+	require.Len(t, snapshot.Clients, 2)
+
+	assert.Equal(t, "a", snapshot.Clients[0].Key)
+	assert.Nil(t, snapshot.Clients[0].RequestTokens)
+	assert.InDelta(t, 15, *snapshot.Clients[0].MetricTokens, 0.001)
+
+	assert.Equal(t, "b", snapshot.Clients[1].Key)
+	assert.InDelta(t, 0, *snapshot.Clients[1].RequestTokens, 0.001)
+
+	*now = now.Add(2 * time.Minute)
+	l.AllowRequest("c")
+
+	snapshot = l.Snapshot()
+	require.Len(t, snapshot.Clients, 1, "idle buckets are pruned")
+	assert.Equal(t, "c", snapshot.Clients[0].Key)
+}
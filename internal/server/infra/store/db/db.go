@@ -10,8 +10,10 @@ package db
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"sort"
 	"time"
 
 	"github.com/jackc/pgerrcode"
@@ -20,6 +22,7 @@ import (
 	"github.com/jackc/pgx/v5/pgxpool"
 	"go.uber.org/zap"
 
+	"metricalert/internal/server/core/model"
 	"metricalert/internal/server/core/repositories"
 )
 
@@ -71,7 +74,7 @@ func (s *Store) UpdateGauge(ctx context.Context, name string, value float64) err
 		ON CONFLICT on constraint gauge_metrics_name_key DO 
 		    UPDATE SET value = $2, updated_at = now();`
 
-	return retry(func() error {
+	return retry(ctx, func() error {
 		_, err := s.pool.Exec(ctx, query, name, value)
 		if err != nil {
 			return fmt.Errorf("can't exec: %w", err)
@@ -102,7 +105,7 @@ func (s *Store) UpdateGauges(ctx context.Context, gauges map[string]float64) err
 		}
 	}()
 
-	return retry(func() error {
+	return retry(ctx, func() error {
 		_, err := br.Exec()
 		if err != nil {
 			return fmt.Errorf("can't exec: %w", err)
@@ -120,7 +123,7 @@ func (s *Store) UpdateCounter(ctx context.Context, name string, value int64) err
 		ON CONFLICT on constraint counter_metrics_name_key DO 
 		    UPDATE SET value = counter_metrics.value + $2, updated_at = now();`
 
-	return retry(func() error {
+	return retry(ctx, func() error {
 		_, err := s.pool.Exec(ctx, query, name, value)
 		if err != nil {
 			return fmt.Errorf("can't exec: %w", err)
@@ -151,7 +154,7 @@ func (s *Store) UpdateCounters(ctx context.Context, counters map[string]int64) e
 		}
 	}()
 
-	return retry(func() error {
+	return retry(ctx, func() error {
 		_, err := br.Exec()
 		if err != nil {
 			return fmt.Errorf("can't exec: %w", err)
@@ -171,7 +174,7 @@ func (s *Store) GetGauge(ctx context.Context, name string) (float64, error) {
 	var value float64
 	row := s.pool.QueryRow(ctx, query, name)
 
-	return value, retry(func() error {
+	return value, retry(ctx, func() error {
 		return row.Scan(&value)
 	})
 }
@@ -186,11 +189,431 @@ func (s *Store) GetCounter(ctx context.Context, name string) (int64, error) {
 	var value int64
 	row := s.pool.QueryRow(ctx, query, name)
 
-	return value, retry(func() error {
+	return value, retry(ctx, func() error {
 		return row.Scan(&value)
 	})
 }
 
+// DeleteGauges удаляет метрики типа gauge. Отсутствующие имена пропускаются.
+func (s *Store) DeleteGauges(ctx context.Context, names []string) error {
+	query := `
+		DELETE FROM gauge_metrics
+		WHERE name = ANY($1);`
+
+	return retry(ctx, func() error {
+		_, err := s.pool.Exec(ctx, query, names)
+		if err != nil {
+			return fmt.Errorf("can't exec: %w", err)
+		}
+
+		return nil
+	})
+}
+
+// DeleteCounters удаляет метрики типа counter. Отсутствующие имена пропускаются.
+func (s *Store) DeleteCounters(ctx context.Context, names []string) error {
+	query := `
+		DELETE FROM counter_metrics
+		WHERE name = ANY($1);`
+
+	return retry(ctx, func() error {
+		_, err := s.pool.Exec(ctx, query, names)
+		if err != nil {
+			return fmt.Errorf("can't exec: %w", err)
+		}
+
+		return nil
+	})
+}
+
+// ExpireGauges удаляет метрики типа gauge, которые не обновлялись с момента, заданного для имени
+// в cutoffs. Условие на updated_at проверяется в запросе удаления, поэтому метрика, обновленная
+// после выбора кандидатов, сохраняется. Возвращает отсортированные имена удаленных метрик.
+func (s *Store) ExpireGauges(ctx context.Context, cutoffs map[string]time.Time) ([]string, error) {
+	return s.expire(ctx, "gauge_metrics", cutoffs)
+}
+
+// ExpireCounters удаляет метрики типа counter аналогично ExpireGauges.
+func (s *Store) ExpireCounters(ctx context.Context, cutoffs map[string]time.Time) ([]string, error) {
+	return s.expire(ctx, "counter_metrics", cutoffs)
+}
+
+// expire удаляет из таблицы метрики, обновленные раньше своего cutoff.
+// Столбец updated_at хранится в поясе сессии, как и в updateTimes.
+func (s *Store) expire(ctx context.Context, table string, cutoffs map[string]time.Time) ([]string, error) {
+	if len(cutoffs) == 0 {
+		return nil, nil
+	}
+
+	query := `
+		DELETE FROM ` + table + ` AS m
+		USING unnest($1::text[], $2::timestamptz[]) AS e(name, cutoff)
+		WHERE m.name = e.name
+		  AND m.updated_at AT TIME ZONE current_setting('TimeZone') < e.cutoff
+		RETURNING m.name;`
+
+	names := make([]string, 0, len(cutoffs))
+	times := make([]time.Time, 0, len(cutoffs))
+
+	for name, cutoff := range cutoffs {
+		names = append(names, name)
+		times = append(times, cutoff)
+	}
+
+	var deleted []string
+
+	err := retry(ctx, func() error {
+		deleted = deleted[:0]
+
+		rows, err := s.pool.Query(ctx, query, names, times)
+		if err != nil {
+			return fmt.Errorf("can't query: %w", err)
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			var name string
+			if err = rows.Scan(&name); err != nil {
+				return fmt.Errorf("can't scan: %w", err)
+			}
+			deleted = append(deleted, name)
+		}
+
+		return nil
+	})
+
+	sort.Strings(deleted)
+
+	return deleted, err
+}
+
+// ResetCounters обнуляет метрики типа counter. Отсутствующие имена пропускаются.
+func (s *Store) ResetCounters(ctx context.Context, names []string) error {
+	query := `
+		UPDATE counter_metrics
+		SET value = 0, updated_at = now()
+		WHERE name = ANY($1);`
+
+	return retry(ctx, func() error {
+		_, err := s.pool.Exec(ctx, query, names)
+		if err != nil {
+			return fmt.Errorf("can't exec: %w", err)
+		}
+
+		return nil
+	})
+}
+
+// GetBatchResult возвращает сохраненный результат обработки пакета по ключу идемпотентности.
+// Если ключ не найден или срок его хранения истек, возвращается repositories.ErrNotFound.
+func (s *Store) GetBatchResult(ctx context.Context, key string) (model.BatchResult, error) {
+	query := `
+		SELECT result
+		FROM batch_results
+		WHERE key = $1 AND expires_at > now();`
+
+	var (
+		data   []byte
+		result model.BatchResult
+	)
+
+	err := retry(ctx, func() error {
+		return s.pool.QueryRow(ctx, query, key).Scan(&data)
+	})
+	if err != nil {
+		return result, err
+	}
+
+	if err = json.Unmarshal(data, &result); err != nil {
+		return result, fmt.Errorf("can't unmarshal batch result: %w", err)
+	}
+
+	return result, nil
+}
+
+// SaveBatchResult сохраняет результат обработки пакета до момента expiresAt.
+// Записи с истекшим сроком хранения при этом удаляются.
+func (s *Store) SaveBatchResult(ctx context.Context, key string, result model.BatchResult, expiresAt time.Time) error {
+	query := `
+		INSERT INTO batch_results (key, result, expires_at)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (key) DO
+		    UPDATE SET result = $2, expires_at = $3;`
+
+	cleanup := `
+		DELETE FROM batch_results
+		WHERE expires_at <= now();`
+
+	data, err := json.Marshal(result)
+	if err != nil {
+		return fmt.Errorf("can't marshal batch result: %w", err)
+	}
+
+	return retry(ctx, func() error {
+		if _, err := s.pool.Exec(ctx, cleanup); err != nil {
+			return fmt.Errorf("can't exec: %w", err)
+		}
+
+		if _, err := s.pool.Exec(ctx, query, key, data, expiresAt); err != nil {
+			return fmt.Errorf("can't exec: %w", err)
+		}
+
+		return nil
+	})
+}
+
+// GetSilences возвращает заглушки оповещений.
+func (s *Store) GetSilences(ctx context.Context) ([]model.SilenceRecord, error) {
+	query := `
+		SELECT id, silence
+		FROM alert_silences;`
+
+	var silences []model.SilenceRecord
+
+	err := retry(ctx, func() error {
+		silences = silences[:0]
+
+		rows, err := s.pool.Query(ctx, query)
+		if err != nil {
+			return fmt.Errorf("can't query: %w", err)
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			var silence model.SilenceRecord
+			if err = rows.Scan(&silence.ID, &silence.Silence); err != nil {
+				return fmt.Errorf("can't scan: %w", err)
+			}
+
+			silences = append(silences, silence)
+		}
+
+		return nil
+	})
+
+	return silences, err
+}
+
+// SaveSilence добавляет или заменяет заглушку оповещений.
+func (s *Store) SaveSilence(ctx context.Context, silence model.SilenceRecord) error {
+	query := `
+		INSERT INTO alert_silences (id, silence)
+		VALUES ($1, $2)
+		ON CONFLICT (id) DO
+		    UPDATE SET silence = $2;`
+
+	return retry(ctx, func() error {
+		if _, err := s.pool.Exec(ctx, query, silence.ID, []byte(silence.Silence)); err != nil {
+			return fmt.Errorf("can't exec: %w", err)
+		}
+
+		return nil
+	})
+}
+
+// DeleteSilence удаляет заглушку оповещений.
+func (s *Store) DeleteSilence(ctx context.Context, id string) error {
+	query := `
+		DELETE FROM alert_silences
+		WHERE id = $1;`
+
+	return retry(ctx, func() error {
+		if _, err := s.pool.Exec(ctx, query, id); err != nil {
+			return fmt.Errorf("can't exec: %w", err)
+		}
+
+		return nil
+	})
+}
+
+// GetActiveAlerts возвращает активные оповещения.
+func (s *Store) GetActiveAlerts(ctx context.Context) ([]model.AlertRecord, error) {
+	query := `
+		SELECT key, alert
+		FROM alerts;`
+
+	var alerts []model.AlertRecord
+
+	err := retry(ctx, func() error {
+		alerts = alerts[:0]
+
+		rows, err := s.pool.Query(ctx, query)
+		if err != nil {
+			return fmt.Errorf("can't query: %w", err)
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			var alert model.AlertRecord
+			if err = rows.Scan(&alert.Key, &alert.Alert); err != nil {
+				return fmt.Errorf("can't scan: %w", err)
+			}
+
+			alerts = append(alerts, alert)
+		}
+
+		return nil
+	})
+
+	return alerts, err
+}
+
+// SaveTransitions одним пакетом добавляет переходы в журнал alert_history и обновляет
+// по ним активные оповещения в таблице alerts.
+func (s *Store) SaveTransitions(ctx context.Context, transitions []model.TransitionRecord) error {
+	history := `
+		INSERT INTO alert_history (at, rule, from_state, to_state, alert)
+		VALUES ($1, $2, $3, $4, $5);`
+
+	upsert := `
+		INSERT INTO alerts (key, alert)
+		VALUES ($1, $2)
+		ON CONFLICT (key) DO
+		    UPDATE SET alert = $2;`
+
+	remove := `
+		DELETE FROM alerts
+		WHERE key = $1;`
+
+	batch := &pgx.Batch{}
+
+	for _, t := range transitions {
+		data := []byte(t.Alert)
+
+		batch.Queue(history, t.At, t.Rule, t.From, t.To, data)
+
+		if t.Resolved {
+			batch.Queue(remove, t.Key)
+		} else {
+			batch.Queue(upsert, t.Key, data)
+		}
+	}
+
+	br := s.pool.SendBatch(ctx, batch)
+	defer func() {
+		if err := br.Close(); err != nil {
+			zap.L().Error("can't close batch", zap.Error(err))
+		}
+	}()
+
+	for range batch.Len() {
+		if _, err := br.Exec(); err != nil {
+			return fmt.Errorf("can't exec: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// GetAlertHistory возвращает страницу журнала переходов от новых к старым и общее число переходов.
+func (s *Store) GetAlertHistory(ctx context.Context, offset, limit int) ([]model.TransitionRecord, int, error) {
+	count := `
+		SELECT count(*)
+		FROM alert_history;`
+
+	query := `
+		SELECT at, rule, from_state, to_state, alert
+		FROM alert_history
+		ORDER BY id DESC
+		LIMIT $1 OFFSET $2;`
+
+	var (
+		total       int
+		transitions []model.TransitionRecord
+	)
+
+	err := retry(ctx, func() error {
+		transitions = transitions[:0]
+
+		if err := s.pool.QueryRow(ctx, count).Scan(&total); err != nil {
+			return fmt.Errorf("can't count: %w", err)
+		}
+
+		rows, err := s.pool.Query(ctx, query, limit, offset)
+		if err != nil {
+			return fmt.Errorf("can't query: %w", err)
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			var t model.TransitionRecord
+			if err = rows.Scan(&t.At, &t.Rule, &t.From, &t.To, &t.Alert); err != nil {
+				return fmt.Errorf("can't scan: %w", err)
+			}
+
+			transitions = append(transitions, t)
+		}
+
+		return nil
+	})
+
+	return transitions, total, err
+}
+
+// GetRuleVersions возвращает версии правил оповещений.
+func (s *Store) GetRuleVersions(ctx context.Context) ([]model.RuleVersionRecord, error) {
+	query := `
+		SELECT name, version, data
+		FROM alert_rules
+		ORDER BY name, version;`
+
+	var versions []model.RuleVersionRecord
+
+	err := retry(ctx, func() error {
+		versions = versions[:0]
+
+		rows, err := s.pool.Query(ctx, query)
+		if err != nil {
+			return fmt.Errorf("can't query: %w", err)
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			var version model.RuleVersionRecord
+			if err = rows.Scan(&version.Name, &version.Number, &version.Version); err != nil {
+				return fmt.Errorf("can't scan: %w", err)
+			}
+
+			versions = append(versions, version)
+		}
+
+		return nil
+	})
+
+	return versions, err
+}
+
+// SaveRuleVersion добавляет версию правила оповещений. Если версия с тем же номером
+// уже сохранена, возвращается ошибка repositories.ErrConflict.
+func (s *Store) SaveRuleVersion(ctx context.Context, version model.RuleVersionRecord) error {
+	query := `
+		INSERT INTO alert_rules (name, version, data)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (name, version) DO NOTHING;`
+
+	var (
+		tag pgconn.CommandTag
+		err error
+	)
+
+	err = retry(ctx, func() error {
+		if tag, err = s.pool.Exec(ctx, query, version.Name, version.Number, []byte(version.Version)); err != nil {
+			return fmt.Errorf("can't exec: %w", err)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("rule %q version %d: %w", version.Name, version.Number, repositories.ErrConflict)
+	}
+
+	return nil
+}
+
 // Close закрывает соединение с базой данных.
 func (s *Store) Close() error {
 	s.pool.Close()
@@ -205,7 +628,7 @@ func (s *Store) GetGaugeList(ctx context.Context) (map[string]float64, error) {
 
 	result := make(map[string]float64)
 
-	return result, retry(func() error {
+	return result, retry(ctx, func() error {
 		rows, err := s.pool.Query(ctx, query)
 		if err != nil {
 			return fmt.Errorf("can't query: %w", err)
@@ -233,7 +656,7 @@ func (s *Store) GetCounterList(ctx context.Context) (map[string]int64, error) {
 
 	result := make(map[string]int64)
 
-	return result, retry(func() error {
+	return result, retry(ctx, func() error {
 		rows, err := s.pool.Query(ctx, query)
 		if err != nil {
 			return fmt.Errorf("can't query: %w", err)
@@ -253,6 +676,129 @@ func (s *Store) GetCounterList(ctx context.Context) (map[string]int64, error) {
 	})
 }
 
+// GetUpdateTimes возвращает время последнего обновления метрик из столбца updated_at.
+func (s *Store) GetUpdateTimes(ctx context.Context) (model.UpdateTimes, error) {
+	gauges, err := s.updateTimes(ctx, "gauge_metrics")
+	if err != nil {
+		return model.UpdateTimes{}, err
+	}
+
+	counters, err := s.updateTimes(ctx, "counter_metrics")
+	if err != nil {
+		return model.UpdateTimes{}, err
+	}
+
+	return model.UpdateTimes{Gauges: gauges, Counters: counters}, nil
+}
+
+// updateTimes читает время обновления метрик таблицы. Столбец updated_at хранится без
+// часового пояса в поясе сессии, поэтому пояс сессии указывается явно.
+func (s *Store) updateTimes(ctx context.Context, table string) (map[string]time.Time, error) {
+	query := `
+		SELECT name, updated_at AT TIME ZONE current_setting('TimeZone')
+		FROM ` + table + `;`
+
+	result := make(map[string]time.Time)
+
+	return result, retry(ctx, func() error {
+		rows, err := s.pool.Query(ctx, query)
+		if err != nil {
+			return fmt.Errorf("can't query: %w", err)
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			var name string
+			var updatedAt time.Time
+			if err = rows.Scan(&name, &updatedAt); err != nil {
+				return fmt.Errorf("can't scan: %w", err)
+			}
+			result[name] = updatedAt
+		}
+
+		return nil
+	})
+}
+
+// GetAgentActivity возвращает время последнего отчета каждого агента.
+func (s *Store) GetAgentActivity(ctx context.Context) (map[string]time.Time, error) {
+	query := `
+		SELECT agent, last_seen
+		FROM agent_activity;`
+
+	result := make(map[string]time.Time)
+
+	return result, retry(ctx, func() error {
+		rows, err := s.pool.Query(ctx, query)
+		if err != nil {
+			return fmt.Errorf("can't query: %w", err)
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			var agent string
+			var lastSeen time.Time
+			if err = rows.Scan(&agent, &lastSeen); err != nil {
+				return fmt.Errorf("can't scan: %w", err)
+			}
+			result[agent] = lastSeen
+		}
+
+		return nil
+	})
+}
+
+// SaveAgentActivity сохраняет время отчета агента, если оно позже сохраненного.
+func (s *Store) SaveAgentActivity(ctx context.Context, agent string, at time.Time) error {
+	query := `
+		INSERT INTO agent_activity (agent, last_seen)
+		VALUES ($1, $2)
+		ON CONFLICT (agent) DO
+		    UPDATE SET last_seen = GREATEST(agent_activity.last_seen, $2);`
+
+	return retry(ctx, func() error {
+		if _, err := s.pool.Exec(ctx, query, agent, at); err != nil {
+			return fmt.Errorf("can't exec: %w", err)
+		}
+
+		return nil
+	})
+}
+
+// ExpireAgents удаляет агентов, не присылавших отчетов с момента cutoff, и возвращает их имена.
+func (s *Store) ExpireAgents(ctx context.Context, cutoff time.Time) ([]string, error) {
+	query := `
+		DELETE FROM agent_activity
+		WHERE last_seen < $1
+		RETURNING agent;`
+
+	var deleted []string
+
+	err := retry(ctx, func() error {
+		deleted = deleted[:0]
+
+		rows, err := s.pool.Query(ctx, query, cutoff)
+		if err != nil {
+			return fmt.Errorf("can't query: %w", err)
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			var agent string
+			if err = rows.Scan(&agent); err != nil {
+				return fmt.Errorf("can't scan: %w", err)
+			}
+			deleted = append(deleted, agent)
+		}
+
+		return nil
+	})
+
+	sort.Strings(deleted)
+
+	return deleted, err
+}
+
 // Ping проверяет соединение с базой данных.
 func (s *Store) Ping(ctx context.Context) error {
 	err := s.pool.Ping(ctx)
@@ -274,7 +820,9 @@ func isRetrievableError(err error) bool {
 	return false
 }
 
-func retry(operation func() error) error {
+// retry выполняет операцию с повторными попытками при ошибках соединения.
+// Ожидание между попытками прерывается при отмене контекста.
+func retry(ctx context.Context, operation func() error) error {
 	const maxRetries = 3
 	retryIntervals := []time.Duration{1 * time.Second, 3 * time.Second, 5 * time.Second}
 
@@ -295,8 +843,13 @@ func retry(operation func() error) error {
 
 		lastErr = err
 		if i < maxRetries {
-			time.Sleep(retryIntervals[i])
-			continue
+			timer := time.NewTimer(retryIntervals[i])
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return fmt.Errorf("operation canceled after %d retries: %w", i+1, errors.Join(ctx.Err(), lastErr))
+			case <-timer.C:
+			}
 		}
 	}
 
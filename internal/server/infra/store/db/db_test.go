@@ -3,11 +3,20 @@ package db
 
 import (
 	"context"
+	"encoding/json"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/jackc/pgerrcode"
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"metricalert/internal/server/core/model"
+	"metricalert/internal/server/core/repositories"
 )
 
 func ExampleNew() {
@@ -267,3 +276,383 @@ func TestStore_PingError(t *testing.T) {
 
 	mockPool.AssertExpectations(t)
 }
+
+func TestStore_UpdateGaugeCanceled(t *testing.T) {
+	mockPool := new(MockPool)
+
+	mockPool.On("Exec", mock.Anything, mock.Anything, mock.Anything).
+		Return(pgconn.CommandTag{}, &pgconn.PgError{Code: pgerrcode.ConnectionFailure})
+
+	store := &Store{pool: mockPool}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	err := store.UpdateGauge(ctx, "test", 1.1)
+
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Less(t, time.Since(start), time.Second, "retry must not sleep after the context is done")
+	mockPool.AssertNumberOfCalls(t, "Exec", 1)
+}
+
+func TestStore_GetBatchResult(t *testing.T) {
+	mockPool := new(MockPool)
+	mockRow := new(MockRow)
+
+	mockPool.On("QueryRow", mock.Anything, mock.Anything, mock.Anything).Return(mockRow)
+	mockRow.On("Scan", mock.Anything).Run(func(args mock.Arguments) {
+		*(args.Get(0).(*[]byte)) = []byte(`{"items":[],"accepted":2}`)
+	}).Return(nil)
+
+	store := &Store{pool: mockPool}
+
+	result, err := store.GetBatchResult(context.Background(), "key")
+	assert.Nil(t, err)
+	assert.Equal(t, 2, result.Accepted)
+
+	mockPool.AssertExpectations(t)
+	mockRow.AssertExpectations(t)
+}
+
+func TestStore_GetBatchResultNotFound(t *testing.T) {
+	mockPool := new(MockPool)
+	mockRow := new(MockRow)
+
+	mockPool.On("QueryRow", mock.Anything, mock.Anything, mock.Anything).Return(mockRow)
+	mockRow.On("Scan", mock.Anything).Return(pgx.ErrNoRows)
+
+	store := &Store{pool: mockPool}
+
+	_, err := store.GetBatchResult(context.Background(), "key")
+	assert.ErrorIs(t, err, repositories.ErrNotFound)
+}
+
+func TestStore_SaveBatchResult(t *testing.T) {
+	mockPool := new(MockPool)
+
+	mockPool.On("Exec", mock.Anything, mock.Anything, mock.Anything).
+		Return(pgconn.NewCommandTag("INSERT 1"), nil)
+
+	store := &Store{pool: mockPool}
+
+	err := store.SaveBatchResult(context.Background(), "key", model.BatchResult{Accepted: 1}, time.Now().Add(time.Hour))
+	assert.Nil(t, err)
+
+	mockPool.AssertNumberOfCalls(t, "Exec", 2)
+}
+
+func TestStore_DeleteAndReset(t *testing.T) {
+	mockPool := new(MockPool)
+
+	names := []string{"a", "b"}
+	mockPool.On("Exec", mock.Anything, mock.MatchedBy(func(sql string) bool {
+		return strings.Contains(sql, "DELETE FROM gauge_metrics")
+	}), []interface{}{names}).Return(pgconn.NewCommandTag("DELETE 2"), nil).Once()
+	mockPool.On("Exec", mock.Anything, mock.MatchedBy(func(sql string) bool {
+		return strings.Contains(sql, "DELETE FROM counter_metrics")
+	}), []interface{}{names}).Return(pgconn.NewCommandTag("DELETE 2"), nil).Once()
+	mockPool.On("Exec", mock.Anything, mock.MatchedBy(func(sql string) bool {
+		return strings.Contains(sql, "UPDATE counter_metrics")
+	}), []interface{}{names}).Return(pgconn.NewCommandTag("UPDATE 2"), nil).Once()
+
+	store := &Store{pool: mockPool}
+
+	assert.Nil(t, store.DeleteGauges(context.Background(), names))
+	assert.Nil(t, store.DeleteCounters(context.Background(), names))
+	assert.Nil(t, store.ResetCounters(context.Background(), names))
+
+	mockPool.AssertExpectations(t)
+}
+
+func TestStore_DeleteGaugesError(t *testing.T) {
+	mockPool := new(MockPool)
+
+	mockPool.On("Exec", mock.Anything, mock.Anything, mock.Anything).
+		Return(pgconn.CommandTag{}, &pgconn.PgError{Code: pgerrcode.UndefinedTable})
+
+	store := &Store{pool: mockPool}
+
+	err := store.DeleteGauges(context.Background(), []string{"a"})
+	assert.NotNil(t, err)
+	mockPool.AssertNumberOfCalls(t, "Exec", 1)
+}
+
+func TestStore_Expire(t *testing.T) {
+	mockPool := new(MockPool)
+	mockRows := new(MockRow)
+
+	cutoff := time.Now()
+
+	mockPool.On("Query", mock.Anything, mock.MatchedBy(func(sql string) bool {
+		return strings.Contains(sql, "DELETE FROM gauge_metrics") && strings.Contains(sql, "updated_at")
+	}), []interface{}{[]string{"a"}, []time.Time{cutoff}}).Return(mockRows, nil).Once()
+	mockRows.On("Close").Return(nil)
+	mockRows.On("Next").Return(true).Once()
+	mockRows.On("Next").Return(false)
+	mockRows.On("Scan", mock.Anything).Run(func(args mock.Arguments) {
+		*args.Get(0).(*string) = "a"
+	}).Return(nil)
+
+	store := &Store{pool: mockPool}
+
+	deleted, err := store.ExpireGauges(context.Background(), map[string]time.Time{"a": cutoff})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"a"}, deleted)
+
+	// без кандидатов запрос не выполняется
+	deleted, err = store.ExpireCounters(context.Background(), nil)
+	assert.Nil(t, err)
+	assert.Empty(t, deleted)
+
+	mockPool.AssertExpectations(t)
+}
+
+func TestStore_AgentActivity(t *testing.T) {
+	mockPool := new(MockPool)
+	mockRows := new(MockRow)
+
+	seen := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	mockPool.On("Exec", mock.Anything, mock.MatchedBy(func(sql string) bool {
+		return strings.Contains(sql, "INSERT INTO agent_activity") && strings.Contains(sql, "GREATEST")
+	}), []interface{}{"agent:a", seen}).Return(pgconn.NewCommandTag("INSERT 1"), nil).Once()
+	mockPool.On("Query", mock.Anything, mock.MatchedBy(func(sql string) bool {
+		return strings.Contains(sql, "DELETE FROM agent_activity") && strings.Contains(sql, "last_seen < $1")
+	}), []interface{}{seen}).Return(mockRows, nil).Once()
+	mockRows.On("Close").Return(nil)
+	mockRows.On("Next").Return(true).Once()
+	mockRows.On("Next").Return(false)
+	mockRows.On("Scan", mock.Anything).Run(func(args mock.Arguments) {
+		*args.Get(0).(*string) = "agent:b"
+	}).Return(nil)
+
+	store := &Store{pool: mockPool}
+
+	assert.Nil(t, store.SaveAgentActivity(context.Background(), "agent:a", seen))
+
+	deleted, err := store.ExpireAgents(context.Background(), seen)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"agent:b"}, deleted)
+
+	mockPool.AssertExpectations(t)
+}
+
+func TestStore_GetUpdateTimes(t *testing.T) {
+	mockPool := new(MockPool)
+	mockRows := new(MockRow)
+
+	mockPool.On("Query", mock.Anything, mock.MatchedBy(func(sql string) bool {
+		return strings.Contains(sql, "updated_at") && strings.Contains(sql, "gauge_metrics")
+	}), mock.Anything).Return(mockRows, nil).Once()
+	mockPool.On("Query", mock.Anything, mock.MatchedBy(func(sql string) bool {
+		return strings.Contains(sql, "updated_at") && strings.Contains(sql, "counter_metrics")
+	}), mock.Anything).Return(mockRows, nil).Once()
+	mockRows.On("Close").Return(nil)
+	mockRows.On("Next").Return(true).Once()
+	mockRows.On("Next").Return(false)
+	mockRows.On("Scan", mock.Anything, mock.Anything).Return(nil)
+
+	store := &Store{pool: mockPool}
+
+	times, err := store.GetUpdateTimes(context.Background())
+	assert.Nil(t, err)
+	assert.Len(t, times.Gauges, 1)
+	assert.Empty(t, times.Counters)
+
+	mockPool.AssertExpectations(t)
+}
+
+func TestStore_GetUpdateTimesError(t *testing.T) {
+	mockPool := new(MockPool)
+
+	mockPool.On("Query", mock.Anything, mock.Anything, mock.Anything).Return(new(MockRow), assert.AnError)
+
+	store := &Store{pool: mockPool}
+
+	_, err := store.GetUpdateTimes(context.Background())
+	assert.ErrorIs(t, err, assert.AnError)
+}
+
+func TestStore_Silences(t *testing.T) {
+	mockPool := new(MockPool)
+	mockRows := new(MockRow)
+
+	mockPool.On("Query", mock.Anything, mock.MatchedBy(func(sql string) bool {
+		return strings.Contains(sql, "FROM alert_silences")
+	}), mock.Anything).Return(mockRows, nil).Once()
+	mockRows.On("Close").Return(nil)
+	mockRows.On("Next").Return(true).Once()
+	mockRows.On("Next").Return(false)
+	mockRows.On("Scan", mock.Anything, mock.Anything).Run(func(args mock.Arguments) {
+		*(args.Get(0).(*string)) = "a1"
+		*(args.Get(1).(*json.RawMessage)) = json.RawMessage(`{"id":"a1","created_by":"ops"}`)
+	}).Return(nil)
+
+	mockPool.On("Exec", mock.Anything, mock.MatchedBy(func(sql string) bool {
+		return strings.Contains(sql, "INSERT INTO alert_silences")
+	}), mock.MatchedBy(func(args []interface{}) bool {
+		return len(args) == 2 && args[0] == "a1"
+	})).Return(pgconn.NewCommandTag("INSERT 1"), nil).Once()
+	mockPool.On("Exec", mock.Anything, mock.MatchedBy(func(sql string) bool {
+		return strings.Contains(sql, "DELETE FROM alert_silences")
+	}), []interface{}{"a1"}).Return(pgconn.NewCommandTag("DELETE 1"), nil).Once()
+
+	store := &Store{pool: mockPool}
+	ctx := context.Background()
+
+	silences, err := store.GetSilences(ctx)
+	assert.Nil(t, err)
+	assert.Equal(t, []model.SilenceRecord{{ID: "a1", Silence: json.RawMessage(`{"id":"a1","created_by":"ops"}`)}},
+		silences)
+
+	assert.Nil(t, store.SaveSilence(ctx, silences[0]))
+	assert.Nil(t, store.DeleteSilence(ctx, "a1"))
+
+	mockPool.AssertExpectations(t)
+}
+
+func TestStore_SaveTransitions(t *testing.T) {
+	mockPool := new(MockPool)
+	mockBatchResults := new(MockBatchResults)
+
+	mockPool.On("SendBatch", mock.Anything, mock.MatchedBy(func(b *pgx.Batch) bool {
+		// переход в журнал и обновление активного оповещения на каждый переход
+		return b.Len() == 4 &&
+			strings.Contains(b.QueuedQueries[1].SQL, "INSERT INTO alerts") &&
+			strings.Contains(b.QueuedQueries[3].SQL, "DELETE FROM alerts")
+	})).Return(mockBatchResults)
+	mockBatchResults.On("Close").Return(nil)
+	mockBatchResults.On("Exec").Return(pgconn.NewCommandTag("INSERT 1"), nil).Times(4)
+
+	store := &Store{pool: mockPool}
+
+	err := store.SaveTransitions(context.Background(), []model.TransitionRecord{
+		{Key: "high_cpu/gauge/cpu", Rule: "high_cpu", From: "pending", To: "firing", Alert: json.RawMessage(`{}`)},
+		{Key: "high_cpu/gauge/cpu", Rule: "high_cpu", From: "firing", To: "resolved", Alert: json.RawMessage(`{}`),
+			Resolved: true},
+	})
+	assert.Nil(t, err)
+
+	mockPool.AssertExpectations(t)
+	mockBatchResults.AssertExpectations(t)
+}
+
+func TestStore_SaveTransitionsError(t *testing.T) {
+	mockPool := new(MockPool)
+	mockBatchResults := new(MockBatchResults)
+
+	mockPool.On("SendBatch", mock.Anything, mock.Anything).Return(mockBatchResults)
+	mockBatchResults.On("Close").Return(nil)
+	mockBatchResults.On("Exec").Return(pgconn.CommandTag{}, assert.AnError)
+
+	store := &Store{pool: mockPool}
+
+	err := store.SaveTransitions(context.Background(), []model.TransitionRecord{{To: "pending"}})
+	assert.ErrorIs(t, err, assert.AnError)
+}
+
+func TestStore_AlertState(t *testing.T) {
+	mockPool := new(MockPool)
+	mockAlerts := new(MockRow)
+	mockCount := new(MockRow)
+	mockHistory := new(MockRow)
+
+	alert := json.RawMessage(`{"rule":"high_cpu","state":"firing","value":95}`)
+
+	mockPool.On("Query", mock.Anything, mock.MatchedBy(func(sql string) bool {
+		return strings.Contains(sql, "FROM alerts;")
+	}), mock.Anything).Return(mockAlerts, nil).Once()
+	mockAlerts.On("Close").Return(nil)
+	mockAlerts.On("Next").Return(true).Once()
+	mockAlerts.On("Next").Return(false)
+	mockAlerts.On("Scan", mock.Anything, mock.Anything).Run(func(args mock.Arguments) {
+		*(args.Get(0).(*string)) = "high_cpu/gauge/cpu"
+		*(args.Get(1).(*json.RawMessage)) = alert
+	}).Return(nil)
+
+	mockPool.On("QueryRow", mock.Anything, mock.MatchedBy(func(sql string) bool {
+		return strings.Contains(sql, "count(*)")
+	}), mock.Anything).Return(mockCount).Once()
+	mockCount.On("Scan", mock.Anything).Run(func(args mock.Arguments) {
+		*(args.Get(0).(*int)) = 7
+	}).Return(nil)
+
+	at := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	mockPool.On("Query", mock.Anything, mock.MatchedBy(func(sql string) bool {
+		return strings.Contains(sql, "FROM alert_history")
+	}), []interface{}{10, 5}).Return(mockHistory, nil).Once()
+	mockHistory.On("Close").Return(nil)
+	mockHistory.On("Next").Return(true).Once()
+	mockHistory.On("Next").Return(false)
+	mockHistory.On("Scan", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything).
+		Run(func(args mock.Arguments) {
+			*(args.Get(0).(*time.Time)) = at
+			*(args.Get(1).(*string)) = "high_cpu"
+			*(args.Get(2).(*string)) = "pending"
+			*(args.Get(3).(*string)) = "firing"
+			*(args.Get(4).(*json.RawMessage)) = alert
+		}).Return(nil)
+
+	store := &Store{pool: mockPool}
+	ctx := context.Background()
+
+	alerts, err := store.GetActiveAlerts(ctx)
+	assert.Nil(t, err)
+	assert.Equal(t, []model.AlertRecord{{Key: "high_cpu/gauge/cpu", Alert: alert}}, alerts)
+
+	history, total, err := store.GetAlertHistory(ctx, 5, 10)
+	assert.Nil(t, err)
+	assert.Equal(t, 7, total)
+	assert.Equal(t, []model.TransitionRecord{{At: at, Rule: "high_cpu", From: "pending", To: "firing", Alert: alert}},
+		history)
+
+	mockPool.AssertExpectations(t)
+}
+
+func TestStore_RuleVersions(t *testing.T) {
+	mockPool := new(MockPool)
+	mockRows := new(MockRow)
+
+	data := json.RawMessage(`{"rule":{"name":"high_cpu","kind":"threshold"},"version":1,"updated_by":"alice"}`)
+
+	mockPool.On("Query", mock.Anything, mock.MatchedBy(func(sql string) bool {
+		return strings.Contains(sql, "FROM alert_rules")
+	}), mock.Anything).Return(mockRows, nil).Once()
+	mockRows.On("Close").Return(nil)
+	mockRows.On("Next").Return(true).Once()
+	mockRows.On("Next").Return(false)
+	mockRows.On("Scan", mock.Anything, mock.Anything, mock.Anything).Run(func(args mock.Arguments) {
+		*(args.Get(0).(*string)) = "high_cpu"
+		*(args.Get(1).(*int)) = 1
+		*(args.Get(2).(*json.RawMessage)) = data
+	}).Return(nil)
+
+	isInsert := mock.MatchedBy(func(sql string) bool {
+		return strings.Contains(sql, "INSERT INTO alert_rules")
+	})
+	mockPool.On("Exec", mock.Anything, isInsert, mock.MatchedBy(func(args []interface{}) bool {
+		return len(args) == 3 && args[0] == "high_cpu" && args[1] == 2
+	})).Return(pgconn.NewCommandTag("INSERT 0 1"), nil).Once()
+	mockPool.On("Exec", mock.Anything, isInsert, mock.MatchedBy(func(args []interface{}) bool {
+		return len(args) == 3 && args[1] == 1
+	})).Return(pgconn.NewCommandTag("INSERT 0 0"), nil).Once()
+
+	store := &Store{pool: mockPool}
+	ctx := context.Background()
+
+	versions, err := store.GetRuleVersions(ctx)
+	assert.Nil(t, err)
+	require.Len(t, versions, 1)
+	assert.Equal(t, model.RuleVersionRecord{Name: "high_cpu", Number: 1, Version: data}, versions[0])
+
+	next := versions[0]
+	next.Number = 2
+	assert.Nil(t, store.SaveRuleVersion(ctx, next))
+
+	// версия с тем же номером уже сохранена конкурентным запросом
+	assert.ErrorIs(t, store.SaveRuleVersion(ctx, versions[0]), repositories.ErrConflict)
+
+	mockPool.AssertExpectations(t)
+}
@@ -28,6 +28,49 @@ func createTables(ctx context.Context, pool *pgxpool.Pool) error {
         CONSTRAINT counter_metrics_name_key UNIQUE (name)
     );`
 
+	batchTable := `
+    CREATE TABLE IF NOT EXISTS batch_results (
+        key TEXT PRIMARY KEY,
+        result JSONB NOT NULL,
+        expires_at TIMESTAMPTZ NOT NULL
+    );`
+
+	agentTable := `
+    CREATE TABLE IF NOT EXISTS agent_activity (
+        agent TEXT PRIMARY KEY,
+        last_seen TIMESTAMPTZ NOT NULL
+    );`
+
+	silenceTable := `
+    CREATE TABLE IF NOT EXISTS alert_silences (
+        id TEXT PRIMARY KEY,
+        silence JSONB NOT NULL
+    );`
+
+	alertTable := `
+    CREATE TABLE IF NOT EXISTS alerts (
+        key TEXT PRIMARY KEY,
+        alert JSONB NOT NULL
+    );`
+
+	historyTable := `
+    CREATE TABLE IF NOT EXISTS alert_history (
+        id BIGINT GENERATED ALWAYS AS IDENTITY PRIMARY KEY,
+        at TIMESTAMPTZ NOT NULL,
+        rule TEXT NOT NULL,
+        from_state TEXT NOT NULL,
+        to_state TEXT NOT NULL,
+        alert JSONB NOT NULL
+    );`
+
+	ruleTable := `
+    CREATE TABLE IF NOT EXISTS alert_rules (
+        name TEXT NOT NULL,
+        version INTEGER NOT NULL,
+        data JSONB NOT NULL,
+        PRIMARY KEY (name, version)
+    );`
+
 	tx, err := pool.Begin(ctx)
 	if err != nil {
 		return fmt.Errorf("err starting transaction: %w", err)
@@ -43,6 +86,36 @@ func createTables(ctx context.Context, pool *pgxpool.Pool) error {
 		return fmt.Errorf("err creating counter_metrics table: %w", err)
 	}
 
+	if _, err := tx.Exec(ctx, batchTable); err != nil {
+		_ = tx.Rollback(ctx)
+		return fmt.Errorf("err creating batch_results table: %w", err)
+	}
+
+	if _, err := tx.Exec(ctx, agentTable); err != nil {
+		_ = tx.Rollback(ctx)
+		return fmt.Errorf("err creating agent_activity table: %w", err)
+	}
+
+	if _, err := tx.Exec(ctx, silenceTable); err != nil {
+		_ = tx.Rollback(ctx)
+		return fmt.Errorf("err creating alert_silences table: %w", err)
+	}
+
+	if _, err := tx.Exec(ctx, alertTable); err != nil {
+		_ = tx.Rollback(ctx)
+		return fmt.Errorf("err creating alerts table: %w", err)
+	}
+
+	if _, err := tx.Exec(ctx, historyTable); err != nil {
+		_ = tx.Rollback(ctx)
+		return fmt.Errorf("err creating alert_history table: %w", err)
+	}
+
+	if _, err := tx.Exec(ctx, ruleTable); err != nil {
+		_ = tx.Rollback(ctx)
+		return fmt.Errorf("err creating alert_rules table: %w", err)
+	}
+
 	if err := tx.Commit(ctx); err != nil {
 		return fmt.Errorf("err committing transaction: %w", err)
 	}
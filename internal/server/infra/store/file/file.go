@@ -1,6 +1,7 @@
 // Package file реализует хранилище метрик в файле.
 //
-// В файле хранятся метрики типа gauge и counter.
+// В файле хранятся метрики типа gauge и counter, время их последнего обновления, время последнего отчета агентов,
+// заглушки оповещений, активные оповещения и журнал их переходов.
 //
 // При создании нового хранилища из файла, происходит чтение файла и восстановление метрик.
 //
@@ -20,6 +21,7 @@ import (
 	"sync"
 	"time"
 
+	"metricalert/internal/server/core/model"
 	"metricalert/internal/server/infra/store/memory"
 )
 
@@ -63,6 +65,15 @@ func NewStore(conf *Config) (*Store, error) {
 
 	s.RestoreGauges(metrics.Gauges)
 	s.RestoreCounters(metrics.Counters)
+	s.RestoreBatchResults(metrics.Batches)
+	s.RestoreAgentActivity(metrics.Agents)
+	s.RestoreSilences(metrics.Silences)
+	s.RestoreAlertState(metrics.Alerts, metrics.AlertHistory)
+	s.RestoreRuleVersions(metrics.RuleVersions)
+
+	if metrics.Updated != nil {
+		s.RestoreUpdateTimes(*metrics.Updated)
+	}
 
 	return s, nil
 }
@@ -77,8 +88,16 @@ func (s *Store) Sync(ctx context.Context) {
 }
 
 type metric struct {
-	Gauges   map[string]float64 `json:"gauges"`
-	Counters map[string]int64   `json:"counters"`
+	Gauges   map[string]float64            `json:"gauges"`
+	Counters map[string]int64              `json:"counters"`
+	Batches  map[string]memory.BatchRecord `json:"batches,omitempty"`
+	Updated  *model.UpdateTimes            `json:"updated,omitempty"`
+	Agents   map[string]time.Time          `json:"agents,omitempty"`
+	Silences []model.SilenceRecord         `json:"silences,omitempty"`
+	Alerts   []model.AlertRecord           `json:"alerts,omitempty"`
+
+	AlertHistory []model.TransitionRecord  `json:"alert_history,omitempty"`
+	RuleVersions []model.RuleVersionRecord `json:"rule_versions,omitempty"`
 }
 
 // UpdateGauge обновляет значение метрики в файле типа gauge.
@@ -115,9 +134,39 @@ func (s *Store) saveToFile(ctx context.Context) error {
 		return fmt.Errorf("can't get counter list: %w", err)
 	}
 
+	updated, err := s.GetUpdateTimes(ctx)
+	if err != nil {
+		return fmt.Errorf("can't get update times: %w", err)
+	}
+
+	agents, err := s.GetAgentActivity(ctx)
+	if err != nil {
+		return fmt.Errorf("can't get agent activity: %w", err)
+	}
+
+	silences, err := s.GetSilences(ctx)
+	if err != nil {
+		return fmt.Errorf("can't get silences: %w", err)
+	}
+
+	alerts, history := s.AlertState()
+
+	rules, err := s.GetRuleVersions(ctx)
+	if err != nil {
+		return fmt.Errorf("can't get rule versions: %w", err)
+	}
+
 	metrics := metric{
 		Gauges:   gaugeList,
 		Counters: counterList,
+		Batches:  s.BatchResults(),
+		Updated:  &updated,
+		Agents:   agents,
+		Silences: silences,
+		Alerts:   alerts,
+
+		AlertHistory: history,
+		RuleVersions: rules,
 	}
 
 	bytes, err := json.Marshal(metrics)
@@ -125,6 +174,12 @@ func (s *Store) saveToFile(ctx context.Context) error {
 		return fmt.Errorf("can't marshal data: %w", err)
 	}
 
+	// новый снимок может быть короче предыдущего, поэтому файл перезаписывается целиком
+	err = s.file.Truncate(0)
+	if err != nil {
+		return fmt.Errorf("can't truncate file: %w", err)
+	}
+
 	_, err = s.file.Seek(0, 0)
 	if err != nil {
 		return fmt.Errorf("can't seek file: %w", err)
@@ -158,6 +213,96 @@ func (s *Store) UpdateCounters(ctx context.Context, counters map[string]int64) e
 	return nil
 }
 
+// DeleteGauges удаляет метрики типа gauge и сразу сохраняет снимок в файл.
+func (s *Store) DeleteGauges(ctx context.Context, names []string) error {
+	err := s.Store.DeleteGauges(ctx, names)
+	if err != nil {
+		return fmt.Errorf("can't delete gauges: %w", err)
+	}
+
+	return s.saveToFile(ctx)
+}
+
+// DeleteCounters удаляет метрики типа counter и сразу сохраняет снимок в файл.
+func (s *Store) DeleteCounters(ctx context.Context, names []string) error {
+	err := s.Store.DeleteCounters(ctx, names)
+	if err != nil {
+		return fmt.Errorf("can't delete counters: %w", err)
+	}
+
+	return s.saveToFile(ctx)
+}
+
+// ExpireGauges удаляет устаревшие метрики типа gauge и, если что-то удалено, сразу сохраняет снимок в файл.
+func (s *Store) ExpireGauges(ctx context.Context, cutoffs map[string]time.Time) ([]string, error) {
+	deleted, err := s.Store.ExpireGauges(ctx, cutoffs)
+	if err != nil || len(deleted) == 0 {
+		return deleted, err
+	}
+
+	return deleted, s.saveToFile(ctx)
+}
+
+// ExpireCounters удаляет устаревшие метрики типа counter и, если что-то удалено, сразу сохраняет снимок в файл.
+func (s *Store) ExpireCounters(ctx context.Context, cutoffs map[string]time.Time) ([]string, error) {
+	deleted, err := s.Store.ExpireCounters(ctx, cutoffs)
+	if err != nil || len(deleted) == 0 {
+		return deleted, err
+	}
+
+	return deleted, s.saveToFile(ctx)
+}
+
+// ExpireAgents удаляет агентов, давно не присылавших отчетов, и, если что-то удалено, сразу сохраняет снимок в файл.
+func (s *Store) ExpireAgents(ctx context.Context, cutoff time.Time) ([]string, error) {
+	deleted, err := s.Store.ExpireAgents(ctx, cutoff)
+	if err != nil || len(deleted) == 0 {
+		return deleted, err
+	}
+
+	return deleted, s.saveToFile(ctx)
+}
+
+// ResetCounters обнуляет метрики типа counter и сразу сохраняет снимок в файл.
+func (s *Store) ResetCounters(ctx context.Context, names []string) error {
+	err := s.Store.ResetCounters(ctx, names)
+	if err != nil {
+		return fmt.Errorf("can't reset counters: %w", err)
+	}
+
+	return s.saveToFile(ctx)
+}
+
+// SaveSilence сохраняет заглушку оповещений и сразу сохраняет снимок в файл.
+func (s *Store) SaveSilence(ctx context.Context, silence model.SilenceRecord) error {
+	err := s.Store.SaveSilence(ctx, silence)
+	if err != nil {
+		return fmt.Errorf("can't save silence: %w", err)
+	}
+
+	return s.saveToFile(ctx)
+}
+
+// DeleteSilence удаляет заглушку оповещений и сразу сохраняет снимок в файл.
+func (s *Store) DeleteSilence(ctx context.Context, id string) error {
+	err := s.Store.DeleteSilence(ctx, id)
+	if err != nil {
+		return fmt.Errorf("can't delete silence: %w", err)
+	}
+
+	return s.saveToFile(ctx)
+}
+
+// SaveTransitions сохраняет переходы оповещений и сразу сохраняет снимок в файл.
+func (s *Store) SaveTransitions(ctx context.Context, transitions []model.TransitionRecord) error {
+	err := s.Store.SaveTransitions(ctx, transitions)
+	if err != nil {
+		return fmt.Errorf("can't save alert transitions: %w", err)
+	}
+
+	return s.saveToFile(ctx)
+}
+
 // GetGauge возвращает значение метрики из файла типа gauge.
 func (s *Store) GetGauge(ctx context.Context, name string) (float64, error) {
 	value, err := s.Store.GetGauge(ctx, name)
@@ -219,3 +364,13 @@ func (s *Store) GetCounterList(ctx context.Context) (map[string]int64, error) {
 func (s *Store) Ping(_ context.Context) error {
 	return nil
 }
+
+// SaveRuleVersion сохраняет версию правила оповещений и сразу сохраняет снимок в файл.
+func (s *Store) SaveRuleVersion(ctx context.Context, version model.RuleVersionRecord) error {
+	err := s.Store.SaveRuleVersion(ctx, version)
+	if err != nil {
+		return fmt.Errorf("can't save rule version: %w", err)
+	}
+
+	return s.saveToFile(ctx)
+}
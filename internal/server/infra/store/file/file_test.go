@@ -2,6 +2,7 @@ package file
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"os"
 	"testing"
@@ -10,6 +11,7 @@ import (
 	"github.com/google/uuid"
 	"github.com/stretchr/testify/assert"
 
+	"metricalert/internal/server/core/model"
 	"metricalert/internal/server/core/repositories"
 	"metricalert/internal/server/infra/store/memory"
 )
@@ -617,3 +619,259 @@ func ExampleStore_Ping() {
 
 	// Output:
 }
+
+func TestStore_BatchResultPersisted(t *testing.T) {
+	store, fileName := testInitModule()
+	defer testDone(fileName)
+
+	result := model.BatchResult{Accepted: 1, Items: []model.ItemResult{{ID: "test", Status: model.ItemAccepted}}}
+
+	err := store.SaveBatchResult(context.Background(), "key", result, time.Now().Add(time.Hour))
+	assert.Nil(t, err)
+
+	err = store.Close()
+	assert.Nil(t, err)
+
+	restored, err := NewStore(&Config{
+		MemoryStore:   &memory.Config{},
+		FilePath:      fileName,
+		StoreInterval: 1,
+	})
+	assert.Nil(t, err)
+	defer func() {
+		_ = restored.Close()
+	}()
+
+	saved, err := restored.GetBatchResult(context.Background(), "key")
+	assert.Nil(t, err)
+	assert.Equal(t, result, saved)
+}
+
+func TestStore_DeletePersisted(t *testing.T) {
+	store, fileName := testInitModule()
+	defer testDone(fileName)
+	defer func() {
+		_ = store.Close()
+	}()
+
+	ctx := context.Background()
+
+	assert.Nil(t, store.UpdateGauge(ctx, "gauge", 1))
+	assert.Nil(t, store.UpdateCounter(ctx, "counter", 5))
+	assert.Nil(t, store.UpdateCounter(ctx, "deleted", 1))
+
+	assert.Nil(t, store.DeleteGauges(ctx, []string{"gauge"}))
+	assert.Nil(t, store.DeleteCounters(ctx, []string{"deleted"}))
+	assert.Nil(t, store.ResetCounters(ctx, []string{"counter"}))
+
+	// снимок сохраняется сразу, не дожидаясь закрытия хранилища
+	data, err := os.ReadFile(fileName)
+	assert.Nil(t, err)
+
+	var snapshot metric
+	assert.Nil(t, json.Unmarshal(data, &snapshot))
+	assert.Empty(t, snapshot.Gauges)
+	assert.Equal(t, map[string]int64{"counter": 0}, snapshot.Counters)
+	assert.NotNil(t, snapshot.Updated)
+	assert.Empty(t, snapshot.Updated.Gauges)
+	assert.Contains(t, snapshot.Updated.Counters, "counter")
+	assert.NotContains(t, snapshot.Updated.Counters, "deleted")
+
+	deleted, err := store.ExpireCounters(ctx, map[string]time.Time{"counter": time.Now().Add(time.Second)})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"counter"}, deleted)
+
+	data, err = os.ReadFile(fileName)
+	assert.Nil(t, err)
+
+	snapshot = metric{}
+	assert.Nil(t, json.Unmarshal(data, &snapshot))
+	assert.Empty(t, snapshot.Counters)
+}
+
+func TestStore_UpdateTimesPersisted(t *testing.T) {
+	store, fileName := testInitModule()
+	defer testDone(fileName)
+
+	ctx := context.Background()
+
+	assert.Nil(t, store.UpdateGauge(ctx, "gauge", 1))
+	assert.Nil(t, store.UpdateCounter(ctx, "counter", 1))
+
+	saved, err := store.GetUpdateTimes(ctx)
+	assert.Nil(t, err)
+	assert.Nil(t, store.Close())
+
+	restored, err := NewStore(&Config{
+		MemoryStore:   &memory.Config{},
+		FilePath:      fileName,
+		StoreInterval: 1,
+	})
+	assert.Nil(t, err)
+	defer func() {
+		_ = restored.Close()
+	}()
+
+	times, err := restored.GetUpdateTimes(ctx)
+	assert.Nil(t, err)
+	assert.True(t, saved.Gauges["gauge"].Equal(times.Gauges["gauge"]))
+	assert.True(t, saved.Counters["counter"].Equal(times.Counters["counter"]))
+}
+
+func TestStore_AgentActivityPersisted(t *testing.T) {
+	store, fileName := testInitModule()
+	defer testDone(fileName)
+
+	ctx := context.Background()
+	seen := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	assert.Nil(t, store.SaveAgentActivity(ctx, "agent:a", seen))
+	assert.Nil(t, store.SaveAgentActivity(ctx, "agent:b", seen.Add(time.Hour)))
+	assert.Nil(t, store.Close())
+
+	restored, err := NewStore(&Config{
+		MemoryStore:   &memory.Config{},
+		FilePath:      fileName,
+		StoreInterval: 1,
+	})
+	assert.Nil(t, err)
+	defer func() {
+		_ = restored.Close()
+	}()
+
+	agents, err := restored.GetAgentActivity(ctx)
+	assert.Nil(t, err)
+	assert.Len(t, agents, 2)
+	assert.True(t, seen.Equal(agents["agent:a"]))
+
+	// удаление агента сразу сохраняется в файл
+	deleted, err := restored.ExpireAgents(ctx, seen.Add(time.Minute))
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"agent:a"}, deleted)
+
+	data, err := os.ReadFile(fileName)
+	assert.Nil(t, err)
+	assert.NotContains(t, string(data), "agent:a")
+	assert.Contains(t, string(data), "agent:b")
+}
+
+func TestStore_RestoreWithoutUpdateTimes(t *testing.T) {
+	fileName := uuid.New().String()
+	defer testDone(fileName)
+
+	// снимок, сохраненный до появления времени обновления метрик
+	err := os.WriteFile(fileName, []byte(`{"gauges":{"gauge":1},"counters":{"counter":2}}`), 0o600)
+	assert.Nil(t, err)
+
+	before := time.Now()
+
+	store, err := NewStore(&Config{
+		MemoryStore:   &memory.Config{},
+		FilePath:      fileName,
+		StoreInterval: 1,
+	})
+	assert.Nil(t, err)
+	defer func() {
+		_ = store.Close()
+	}()
+
+	times, err := store.GetUpdateTimes(context.Background())
+	assert.Nil(t, err)
+	assert.False(t, times.Gauges["gauge"].Before(before))
+	assert.False(t, times.Counters["counter"].Before(before))
+}
+
+func TestStore_SilencesPersisted(t *testing.T) {
+	store, fileName := testInitModule()
+	defer testDone(fileName)
+
+	ctx := context.Background()
+	silence := model.SilenceRecord{ID: "a1", Silence: json.RawMessage(`{"id":"a1","created_by":"ops"}`)}
+
+	assert.Nil(t, store.SaveSilence(ctx, silence))
+	assert.Nil(t, store.SaveSilence(ctx, model.SilenceRecord{ID: "b2", Silence: json.RawMessage(`{"id":"b2"}`)}))
+	assert.Nil(t, store.DeleteSilence(ctx, "b2"))
+
+	// заглушки сохраняются в файл сразу, без ожидания периодической записи
+	restored, err := NewStore(&Config{
+		MemoryStore:   &memory.Config{},
+		FilePath:      fileName,
+		StoreInterval: time.Hour,
+	})
+	assert.Nil(t, err)
+	defer func() {
+		_ = restored.Close()
+		_ = store.Close()
+	}()
+
+	silences, err := restored.GetSilences(ctx)
+	assert.Nil(t, err)
+	assert.Equal(t, []model.SilenceRecord{silence}, silences)
+}
+
+func TestStore_AlertStatePersisted(t *testing.T) {
+	store, fileName := testInitModule()
+	defer testDone(fileName)
+
+	ctx := context.Background()
+	transition := model.TransitionRecord{
+		At:    time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+		Key:   "high_cpu/gauge/cpu",
+		Rule:  "high_cpu",
+		From:  "pending",
+		To:    "firing",
+		Alert: json.RawMessage(`{"rule":"high_cpu","state":"firing"}`),
+	}
+
+	assert.Nil(t, store.SaveTransitions(ctx, []model.TransitionRecord{transition}))
+
+	// состояние оповещений сохраняется в файл сразу, без ожидания периодической записи
+	restored, err := NewStore(&Config{
+		MemoryStore:   &memory.Config{},
+		FilePath:      fileName,
+		StoreInterval: time.Hour,
+	})
+	assert.Nil(t, err)
+	defer func() {
+		_ = restored.Close()
+		_ = store.Close()
+	}()
+
+	alerts, err := restored.GetActiveAlerts(ctx)
+	assert.Nil(t, err)
+	assert.Equal(t, []model.AlertRecord{{Key: transition.Key, Alert: transition.Alert}}, alerts)
+
+	history, total, err := restored.GetAlertHistory(ctx, 0, 10)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, total)
+	assert.Equal(t, []model.TransitionRecord{transition}, history)
+}
+
+func TestStore_RuleVersionsPersisted(t *testing.T) {
+	store, fileName := testInitModule()
+	defer testDone(fileName)
+
+	ctx := context.Background()
+	version := model.RuleVersionRecord{
+		Name:    "high_cpu",
+		Number:  1,
+		Version: json.RawMessage(`{"rule":{"name":"high_cpu"},"version":1}`),
+	}
+
+	assert.Nil(t, store.SaveRuleVersion(ctx, version))
+
+	restored, err := NewStore(&Config{
+		MemoryStore:   &memory.Config{},
+		FilePath:      fileName,
+		StoreInterval: time.Hour,
+	})
+	assert.Nil(t, err)
+	defer func() {
+		_ = restored.Close()
+		_ = store.Close()
+	}()
+
+	versions, err := restored.GetRuleVersions(ctx)
+	assert.Nil(t, err)
+	assert.Equal(t, []model.RuleVersionRecord{version}, versions)
+}
@@ -4,30 +4,72 @@
 //
 // Для хранения метрик используются два словаря: gauges и counters.
 // Для обеспечения потокобезопасности используются мьютексы.
+// Время последнего обновления каждой метрики хранится в словарях gaugeTimes и counterTimes,
+// время последнего отчета каждого агента — в словаре agents.
+// Журнал переходов оповещений ограничен последними alertHistoryLimit записями.
 package memory
 
 import (
 	"context"
+	"fmt"
+	"maps"
+	"slices"
 	"sync"
+	"time"
 
+	"metricalert/internal/server/core/model"
 	"metricalert/internal/server/core/repositories"
 )
 
 // Store структура хранит метрики в памяти.
 type Store struct {
-	gauges    map[string]float64
-	counters  map[string]int64
-	gaugesM   *sync.Mutex
-	countersM *sync.Mutex
+	gauges   map[string]float64
+	counters map[string]int64
+	batches  map[string]BatchRecord
+	agents   map[string]time.Time
+	silences map[string]model.SilenceRecord
+	alerts   map[string]model.AlertRecord
+	history  []model.TransitionRecord
+	rules    []model.RuleVersionRecord
+	// время последнего обновления метрик, защищено мьютексами gaugesM и countersM
+	gaugeTimes   map[string]time.Time
+	counterTimes map[string]time.Time
+	gaugesM      *sync.Mutex
+	countersM    *sync.Mutex
+	batchesM     *sync.Mutex
+	agentsM      *sync.Mutex
+	silencesM    *sync.Mutex
+	alertsM      *sync.Mutex
+	rulesM       *sync.Mutex
+}
+
+// alertHistoryLimit количество последних переходов оповещений, которые хранятся в памяти и в файле.
+const alertHistoryLimit = 10000
+
+// BatchRecord результат обработки пакета метрик, сохраненный по ключу идемпотентности.
+type BatchRecord struct {
+	ExpiresAt time.Time         `json:"expires_at"`
+	Result    model.BatchResult `json:"result"`
 }
 
 // NewStore создает новый экземпляр Store.
 func NewStore(config *Config) *Store {
 	return &Store{
-		gauges:    make(map[string]float64),
-		counters:  make(map[string]int64),
-		gaugesM:   &sync.Mutex{},
-		countersM: &sync.Mutex{},
+		gauges:       make(map[string]float64),
+		counters:     make(map[string]int64),
+		batches:      make(map[string]BatchRecord),
+		agents:       make(map[string]time.Time),
+		silences:     make(map[string]model.SilenceRecord),
+		alerts:       make(map[string]model.AlertRecord),
+		gaugeTimes:   make(map[string]time.Time),
+		counterTimes: make(map[string]time.Time),
+		gaugesM:      &sync.Mutex{},
+		countersM:    &sync.Mutex{},
+		batchesM:     &sync.Mutex{},
+		agentsM:      &sync.Mutex{},
+		silencesM:    &sync.Mutex{},
+		alertsM:      &sync.Mutex{},
+		rulesM:       &sync.Mutex{},
 	}
 }
 
@@ -37,6 +79,7 @@ func (s *Store) UpdateGauge(_ context.Context, name string, value float64) error
 	defer s.gaugesM.Unlock()
 
 	s.gauges[name] = value
+	s.gaugeTimes[name] = time.Now()
 
 	return nil
 }
@@ -46,8 +89,10 @@ func (s *Store) UpdateGauges(_ context.Context, gauges map[string]float64) error
 	s.gaugesM.Lock()
 	defer s.gaugesM.Unlock()
 
+	now := time.Now()
 	for name, value := range gauges {
 		s.gauges[name] = value
+		s.gaugeTimes[name] = now
 	}
 
 	return nil
@@ -59,6 +104,7 @@ func (s *Store) UpdateCounter(_ context.Context, name string, value int64) error
 	defer s.countersM.Unlock()
 
 	s.counters[name] += value
+	s.counterTimes[name] = time.Now()
 
 	return nil
 }
@@ -68,8 +114,10 @@ func (s *Store) UpdateCounters(_ context.Context, counters map[string]int64) err
 	s.countersM.Lock()
 	defer s.countersM.Unlock()
 
+	now := time.Now()
 	for name, value := range counters {
 		s.counters[name] += value
+		s.counterTimes[name] = now
 	}
 
 	return nil
@@ -77,6 +125,9 @@ func (s *Store) UpdateCounters(_ context.Context, counters map[string]int64) err
 
 // GetGauge возвращает значение метрики типа gauge.
 func (s *Store) GetGauge(_ context.Context, name string) (float64, error) {
+	s.gaugesM.Lock()
+	defer s.gaugesM.Unlock()
+
 	val, ok := s.gauges[name]
 	if !ok {
 		return 0, repositories.ErrNotFound
@@ -87,6 +138,9 @@ func (s *Store) GetGauge(_ context.Context, name string) (float64, error) {
 
 // GetCounter возвращает значение метрики типа counter.
 func (s *Store) GetCounter(_ context.Context, name string) (int64, error) {
+	s.countersM.Lock()
+	defer s.countersM.Unlock()
+
 	val, ok := s.counters[name]
 	if !ok {
 		return 0, repositories.ErrNotFound
@@ -94,30 +148,434 @@ func (s *Store) GetCounter(_ context.Context, name string) (int64, error) {
 	return val, nil
 }
 
-// GetGaugeList возвращает список метрик типа gauge.
+// GetGaugeList возвращает копию списка метрик типа gauge: вызывающий может обходить и изменять ее,
+// пока метрики обновляются.
 func (s *Store) GetGaugeList(_ context.Context) (map[string]float64, error) {
-	return s.gauges, nil
+	s.gaugesM.Lock()
+	defer s.gaugesM.Unlock()
+
+	return maps.Clone(s.gauges), nil
 }
 
-// GetCounterList возвращает список метрик типа counter.
+// GetCounterList возвращает копию списка метрик типа counter.
 func (s *Store) GetCounterList(_ context.Context) (map[string]int64, error) {
-	return s.counters, nil
+	s.countersM.Lock()
+	defer s.countersM.Unlock()
+
+	return maps.Clone(s.counters), nil
+}
+
+// DeleteGauges удаляет метрики типа gauge. Отсутствующие имена пропускаются.
+func (s *Store) DeleteGauges(_ context.Context, names []string) error {
+	s.gaugesM.Lock()
+	defer s.gaugesM.Unlock()
+
+	for _, name := range names {
+		delete(s.gauges, name)
+		delete(s.gaugeTimes, name)
+	}
+
+	return nil
+}
+
+// DeleteCounters удаляет метрики типа counter. Отсутствующие имена пропускаются.
+func (s *Store) DeleteCounters(_ context.Context, names []string) error {
+	s.countersM.Lock()
+	defer s.countersM.Unlock()
+
+	for _, name := range names {
+		delete(s.counters, name)
+		delete(s.counterTimes, name)
+	}
+
+	return nil
+}
+
+// ExpireGauges удаляет метрики типа gauge, которые не обновлялись с момента, заданного для имени
+// в cutoffs. Время обновления проверяется под блокировкой, поэтому метрика, обновленная после
+// выбора кандидатов на удаление, сохраняется. Возвращает отсортированные имена удаленных метрик.
+func (s *Store) ExpireGauges(_ context.Context, cutoffs map[string]time.Time) ([]string, error) {
+	s.gaugesM.Lock()
+	defer s.gaugesM.Unlock()
+
+	deleted := expire(cutoffs, s.gaugeTimes, func(name string) {
+		delete(s.gauges, name)
+	})
+
+	return deleted, nil
+}
+
+// ExpireCounters удаляет метрики типа counter аналогично ExpireGauges.
+func (s *Store) ExpireCounters(_ context.Context, cutoffs map[string]time.Time) ([]string, error) {
+	s.countersM.Lock()
+	defer s.countersM.Unlock()
+
+	deleted := expire(cutoffs, s.counterTimes, func(name string) {
+		delete(s.counters, name)
+	})
+
+	return deleted, nil
+}
+
+// expire удаляет из times имена, обновленные раньше своего cutoff, и вызывает для них remove.
+func expire(cutoffs map[string]time.Time, times map[string]time.Time, remove func(name string)) []string {
+	deleted := make([]string, 0, len(cutoffs))
+
+	for name, cutoff := range cutoffs {
+		updatedAt, ok := times[name]
+		if !ok || !updatedAt.Before(cutoff) {
+			continue
+		}
+
+		remove(name)
+		delete(times, name)
+
+		deleted = append(deleted, name)
+	}
+
+	slices.Sort(deleted)
+
+	return deleted
+}
+
+// ResetCounters обнуляет метрики типа counter. Отсутствующие имена пропускаются.
+func (s *Store) ResetCounters(_ context.Context, names []string) error {
+	s.countersM.Lock()
+	defer s.countersM.Unlock()
+
+	now := time.Now()
+	for _, name := range names {
+		if _, ok := s.counters[name]; ok {
+			s.counters[name] = 0
+			s.counterTimes[name] = now
+		}
+	}
+
+	return nil
 }
 
 // RestoreGauges восстанавливает значения метрик типа gauge.
+// Временем обновления восстановленных метрик считается момент восстановления.
 func (s *Store) RestoreGauges(gauges map[string]float64) {
 	s.gaugesM.Lock()
 	defer s.gaugesM.Unlock()
 
 	s.gauges = gauges
+	s.gaugeTimes = restoreTimes(gauges, nil)
 }
 
 // RestoreCounters восстанавливает значения метрик типа counter.
+// Временем обновления восстановленных метрик считается момент восстановления.
 func (s *Store) RestoreCounters(counters map[string]int64) {
 	s.countersM.Lock()
 	defer s.countersM.Unlock()
 
 	s.counters = counters
+	s.counterTimes = restoreTimes(counters, nil)
+}
+
+// GetUpdateTimes возвращает копию времени последнего обновления метрик.
+func (s *Store) GetUpdateTimes(_ context.Context) (model.UpdateTimes, error) {
+	s.gaugesM.Lock()
+	gauges := maps.Clone(s.gaugeTimes)
+	s.gaugesM.Unlock()
+
+	s.countersM.Lock()
+	counters := maps.Clone(s.counterTimes)
+	s.countersM.Unlock()
+
+	return model.UpdateTimes{Gauges: gauges, Counters: counters}, nil
+}
+
+// RestoreUpdateTimes восстанавливает время последнего обновления метрик.
+// Время метрик, отсутствующих в хранилище, пропускается, а метрик без сохраненного времени
+// остается равным моменту восстановления.
+func (s *Store) RestoreUpdateTimes(times model.UpdateTimes) {
+	s.gaugesM.Lock()
+	s.gaugeTimes = restoreTimes(s.gauges, times.Gauges)
+	s.gaugesM.Unlock()
+
+	s.countersM.Lock()
+	s.counterTimes = restoreTimes(s.counters, times.Counters)
+	s.countersM.Unlock()
+}
+
+// restoreTimes возвращает время обновления для каждой метрики из values:
+// сохраненное в saved или текущее, если сохраненного нет.
+func restoreTimes[T any](values map[string]T, saved map[string]time.Time) map[string]time.Time {
+	now := time.Now()
+
+	result := make(map[string]time.Time, len(values))
+	for name := range values {
+		updatedAt, ok := saved[name]
+		if !ok {
+			updatedAt = now
+		}
+
+		result[name] = updatedAt
+	}
+
+	return result
+}
+
+// GetBatchResult возвращает сохраненный результат обработки пакета по ключу идемпотентности.
+// Если ключ не найден или срок его хранения истек, возвращается repositories.ErrNotFound.
+func (s *Store) GetBatchResult(_ context.Context, key string) (model.BatchResult, error) {
+	s.batchesM.Lock()
+	defer s.batchesM.Unlock()
+
+	record, ok := s.batches[key]
+	if !ok || !time.Now().Before(record.ExpiresAt) {
+		return model.BatchResult{}, repositories.ErrNotFound
+	}
+
+	return record.Result, nil
+}
+
+// SaveBatchResult сохраняет результат обработки пакета до момента expiresAt.
+// Записи с истекшим сроком хранения при этом удаляются.
+func (s *Store) SaveBatchResult(_ context.Context, key string, result model.BatchResult, expiresAt time.Time) error {
+	s.batchesM.Lock()
+	defer s.batchesM.Unlock()
+
+	now := time.Now()
+	for k, record := range s.batches {
+		if !now.Before(record.ExpiresAt) {
+			delete(s.batches, k)
+		}
+	}
+
+	s.batches[key] = BatchRecord{Result: result, ExpiresAt: expiresAt}
+
+	return nil
+}
+
+// BatchResults возвращает копию сохраненных результатов обработки пакетов.
+func (s *Store) BatchResults() map[string]BatchRecord {
+	s.batchesM.Lock()
+	defer s.batchesM.Unlock()
+
+	result := make(map[string]BatchRecord, len(s.batches))
+	for key, record := range s.batches {
+		result[key] = record
+	}
+
+	return result
+}
+
+// RestoreBatchResults восстанавливает сохраненные результаты обработки пакетов.
+func (s *Store) RestoreBatchResults(batches map[string]BatchRecord) {
+	s.batchesM.Lock()
+	defer s.batchesM.Unlock()
+
+	if batches == nil {
+		batches = make(map[string]BatchRecord)
+	}
+
+	s.batches = batches
+}
+
+// GetAgentActivity возвращает время последнего отчета каждого агента.
+func (s *Store) GetAgentActivity(_ context.Context) (map[string]time.Time, error) {
+	s.agentsM.Lock()
+	defer s.agentsM.Unlock()
+
+	return maps.Clone(s.agents), nil
+}
+
+// SaveAgentActivity сохраняет время отчета агента, если оно позже сохраненного.
+func (s *Store) SaveAgentActivity(_ context.Context, agent string, at time.Time) error {
+	s.agentsM.Lock()
+	defer s.agentsM.Unlock()
+
+	if at.After(s.agents[agent]) {
+		s.agents[agent] = at
+	}
+
+	return nil
+}
+
+// ExpireAgents удаляет агентов, не присылавших отчетов с момента cutoff, и возвращает их имена.
+func (s *Store) ExpireAgents(_ context.Context, cutoff time.Time) ([]string, error) {
+	s.agentsM.Lock()
+	defer s.agentsM.Unlock()
+
+	var deleted []string
+
+	for agent, lastSeen := range s.agents {
+		if lastSeen.Before(cutoff) {
+			delete(s.agents, agent)
+			deleted = append(deleted, agent)
+		}
+	}
+
+	slices.Sort(deleted)
+
+	return deleted, nil
+}
+
+// RestoreAgentActivity восстанавливает время последнего отчета агентов.
+func (s *Store) RestoreAgentActivity(agents map[string]time.Time) {
+	s.agentsM.Lock()
+	defer s.agentsM.Unlock()
+
+	if agents == nil {
+		agents = make(map[string]time.Time)
+	}
+
+	s.agents = agents
+}
+
+// GetSilences возвращает заглушки оповещений.
+func (s *Store) GetSilences(_ context.Context) ([]model.SilenceRecord, error) {
+	s.silencesM.Lock()
+	defer s.silencesM.Unlock()
+
+	silences := make([]model.SilenceRecord, 0, len(s.silences))
+	for _, silence := range s.silences {
+		silences = append(silences, silence)
+	}
+
+	return silences, nil
+}
+
+// SaveSilence добавляет или заменяет заглушку оповещений.
+func (s *Store) SaveSilence(_ context.Context, silence model.SilenceRecord) error {
+	s.silencesM.Lock()
+	defer s.silencesM.Unlock()
+
+	s.silences[silence.ID] = silence
+
+	return nil
+}
+
+// DeleteSilence удаляет заглушку оповещений.
+func (s *Store) DeleteSilence(_ context.Context, id string) error {
+	s.silencesM.Lock()
+	defer s.silencesM.Unlock()
+
+	delete(s.silences, id)
+
+	return nil
+}
+
+// RestoreSilences восстанавливает сохраненные заглушки оповещений.
+func (s *Store) RestoreSilences(silences []model.SilenceRecord) {
+	s.silencesM.Lock()
+	defer s.silencesM.Unlock()
+
+	s.silences = make(map[string]model.SilenceRecord, len(silences))
+	for _, silence := range silences {
+		s.silences[silence.ID] = silence
+	}
+}
+
+// GetActiveAlerts возвращает активные оповещения.
+func (s *Store) GetActiveAlerts(_ context.Context) ([]model.AlertRecord, error) {
+	s.alertsM.Lock()
+	defer s.alertsM.Unlock()
+
+	alerts := make([]model.AlertRecord, 0, len(s.alerts))
+	for _, alert := range s.alerts {
+		alerts = append(alerts, alert)
+	}
+
+	return alerts, nil
+}
+
+// SaveTransitions добавляет переходы в журнал и обновляет по ним активные оповещения.
+func (s *Store) SaveTransitions(_ context.Context, transitions []model.TransitionRecord) error {
+	s.alertsM.Lock()
+	defer s.alertsM.Unlock()
+
+	for _, t := range transitions {
+		if t.Resolved {
+			delete(s.alerts, t.Key)
+		} else {
+			s.alerts[t.Key] = model.AlertRecord{Key: t.Key, Alert: t.Alert}
+		}
+	}
+
+	s.history = append(s.history, transitions...)
+	if len(s.history) > alertHistoryLimit {
+		s.history = slices.Clone(s.history[len(s.history)-alertHistoryLimit:])
+	}
+
+	return nil
+}
+
+// GetAlertHistory возвращает страницу журнала переходов от новых к старым и общее число переходов.
+func (s *Store) GetAlertHistory(_ context.Context, offset, limit int) ([]model.TransitionRecord, int, error) {
+	s.alertsM.Lock()
+	defer s.alertsM.Unlock()
+
+	total := len(s.history)
+	page := make([]model.TransitionRecord, 0, min(limit, max(total-offset, 0)))
+
+	for i := total - 1 - offset; i >= 0 && len(page) < limit; i-- {
+		page = append(page, s.history[i])
+	}
+
+	return page, total, nil
+}
+
+// AlertState возвращает копию активных оповещений и журнала переходов.
+func (s *Store) AlertState() ([]model.AlertRecord, []model.TransitionRecord) {
+	s.alertsM.Lock()
+	defer s.alertsM.Unlock()
+
+	alerts := make([]model.AlertRecord, 0, len(s.alerts))
+	for _, alert := range s.alerts {
+		alerts = append(alerts, alert)
+	}
+
+	return alerts, slices.Clone(s.history)
+}
+
+// RestoreAlertState восстанавливает активные оповещения и журнал переходов.
+func (s *Store) RestoreAlertState(alerts []model.AlertRecord, history []model.TransitionRecord) {
+	s.alertsM.Lock()
+	defer s.alertsM.Unlock()
+
+	s.alerts = make(map[string]model.AlertRecord, len(alerts))
+	for _, alert := range alerts {
+		s.alerts[alert.Key] = alert
+	}
+
+	s.history = history
+}
+
+// GetRuleVersions возвращает версии правил оповещений в порядке сохранения.
+func (s *Store) GetRuleVersions(_ context.Context) ([]model.RuleVersionRecord, error) {
+	s.rulesM.Lock()
+	defer s.rulesM.Unlock()
+
+	return slices.Clone(s.rules), nil
+}
+
+// SaveRuleVersion добавляет версию правила оповещений. Если версия с тем же номером
+// уже сохранена, возвращается ошибка repositories.ErrConflict.
+func (s *Store) SaveRuleVersion(_ context.Context, version model.RuleVersionRecord) error {
+	s.rulesM.Lock()
+	defer s.rulesM.Unlock()
+
+	for _, v := range s.rules {
+		if v.Name == version.Name && v.Number == version.Number {
+			return fmt.Errorf("rule %q version %d: %w", version.Name, version.Number, repositories.ErrConflict)
+		}
+	}
+
+	s.rules = append(s.rules, version)
+
+	return nil
+}
+
+// RestoreRuleVersions восстанавливает сохраненные версии правил оповещений.
+func (s *Store) RestoreRuleVersions(versions []model.RuleVersionRecord) {
+	s.rulesM.Lock()
+	defer s.rulesM.Unlock()
+
+	s.rules = versions
 }
 
 // Close закрывает хранилище.
@@ -2,10 +2,14 @@ package memory
 
 import (
 	"context"
+	"fmt"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 
+	"metricalert/internal/server/core/model"
 	"metricalert/internal/server/core/repositories"
 )
 
@@ -242,6 +246,51 @@ func TestStore_GetGaugeList(t *testing.T) {
 	assert.Equal(t, 2.2, list["test2"])
 }
 
+func TestStore_ConcurrentReadWrite(t *testing.T) {
+	s := NewStore(&Config{})
+	ctx := context.Background()
+	done := make(chan struct{})
+
+	// список метрик обходится и изменяется, пока агенты обновляют метрики;
+	// запускается с -race, чтобы гонка обнаруживалась детектором
+	go func() {
+		defer close(done)
+
+		for i := range 1000 {
+			name := fmt.Sprintf("metric_%d", i%50)
+			assert.NoError(t, s.UpdateGauges(ctx, map[string]float64{name: float64(i)}))
+			assert.NoError(t, s.UpdateCounters(ctx, map[string]int64{name: 1}))
+		}
+	}()
+
+	for range 1000 {
+		gauges, err := s.GetGaugeList(ctx)
+		require.NoError(t, err)
+
+		for name := range gauges {
+			delete(gauges, name)
+		}
+
+		counters, err := s.GetCounterList(ctx)
+		require.NoError(t, err)
+
+		for name, value := range counters {
+			counters[name] = value + 1
+		}
+
+		_, _ = s.GetGauge(ctx, "metric_0")
+		_, _ = s.GetCounter(ctx, "metric_0")
+	}
+
+	<-done
+
+	// изменения возвращенных копий не попадают в хранилище
+	counters, err := s.GetCounterList(ctx)
+	require.NoError(t, err)
+	assert.Len(t, counters, 50)
+	assert.Equal(t, int64(20), counters["metric_0"])
+}
+
 func ExampleStore_GetCounterList() {
 	s := NewStore(&Config{}) // Инициализация хранилища
 
@@ -333,3 +382,244 @@ func ExampleStore_Close() {
 
 	// Output:
 }
+
+func TestStore_BatchResult(t *testing.T) {
+	s := NewStore(&Config{})
+	ctx := context.Background()
+
+	_, err := s.GetBatchResult(ctx, "key")
+	assert.ErrorIs(t, err, repositories.ErrNotFound)
+
+	result := model.BatchResult{Accepted: 1, Items: []model.ItemResult{{ID: "test", Status: model.ItemAccepted}}}
+
+	err = s.SaveBatchResult(ctx, "expired", result, time.Now().Add(-time.Second))
+	assert.Nil(t, err)
+
+	_, err = s.GetBatchResult(ctx, "expired")
+	assert.ErrorIs(t, err, repositories.ErrNotFound)
+
+	err = s.SaveBatchResult(ctx, "key", result, time.Now().Add(time.Hour))
+	assert.Nil(t, err)
+
+	saved, err := s.GetBatchResult(ctx, "key")
+	assert.Nil(t, err)
+	assert.Equal(t, result, saved)
+
+	// запись с истекшим сроком удаляется при сохранении следующей
+	assert.Len(t, s.BatchResults(), 1)
+}
+
+func TestStore_DeleteAndReset(t *testing.T) {
+	s := NewStore(&Config{})
+	ctx := context.Background()
+
+	assert.Nil(t, s.UpdateGauges(ctx, map[string]float64{"a": 1, "b": 2}))
+	assert.Nil(t, s.UpdateCounters(ctx, map[string]int64{"c": 3, "d": 4}))
+
+	assert.Nil(t, s.DeleteGauges(ctx, []string{"a", "missing"}))
+	assert.Nil(t, s.DeleteCounters(ctx, []string{"c"}))
+	assert.Nil(t, s.ResetCounters(ctx, []string{"d", "missing"}))
+
+	_, err := s.GetGauge(ctx, "a")
+	assert.ErrorIs(t, err, repositories.ErrNotFound)
+
+	_, err = s.GetCounter(ctx, "c")
+	assert.ErrorIs(t, err, repositories.ErrNotFound)
+
+	counter, err := s.GetCounter(ctx, "d")
+	assert.Nil(t, err)
+	assert.Equal(t, int64(0), counter)
+
+	// сброс не создает отсутствующие счетчики
+	_, err = s.GetCounter(ctx, "missing")
+	assert.ErrorIs(t, err, repositories.ErrNotFound)
+
+	gauge, err := s.GetGauge(ctx, "b")
+	assert.Nil(t, err)
+	assert.InDelta(t, 2.0, gauge, 0)
+}
+
+func TestStore_Expire(t *testing.T) {
+	s := NewStore(&Config{})
+	ctx := context.Background()
+
+	assert.Nil(t, s.UpdateGauges(ctx, map[string]float64{"a": 1, "b": 2}))
+	assert.Nil(t, s.UpdateCounter(ctx, "c", 3))
+
+	cutoff := time.Now().Add(time.Second)
+
+	// b обновлена после отсечки и не удаляется
+	s.gaugeTimes["b"] = cutoff.Add(time.Second)
+
+	deleted, err := s.ExpireGauges(ctx, map[string]time.Time{"a": cutoff, "b": cutoff, "missing": cutoff})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"a"}, deleted)
+
+	deleted, err = s.ExpireCounters(ctx, map[string]time.Time{"c": cutoff})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"c"}, deleted)
+
+	_, err = s.GetGauge(ctx, "a")
+	assert.ErrorIs(t, err, repositories.ErrNotFound)
+
+	_, err = s.GetGauge(ctx, "b")
+	assert.Nil(t, err)
+
+	_, err = s.GetCounter(ctx, "c")
+	assert.ErrorIs(t, err, repositories.ErrNotFound)
+}
+
+func TestStore_AgentActivity(t *testing.T) {
+	s := NewStore(&Config{})
+	ctx := context.Background()
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	assert.Nil(t, s.SaveAgentActivity(ctx, "agent:a", now))
+	assert.Nil(t, s.SaveAgentActivity(ctx, "agent:b", now.Add(time.Hour)))
+
+	// более раннее время отчета не затирает сохраненное
+	assert.Nil(t, s.SaveAgentActivity(ctx, "agent:b", now))
+
+	agents, err := s.GetAgentActivity(ctx)
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]time.Time{"agent:a": now, "agent:b": now.Add(time.Hour)}, agents)
+
+	deleted, err := s.ExpireAgents(ctx, now.Add(time.Minute))
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"agent:a"}, deleted)
+
+	agents, err = s.GetAgentActivity(ctx)
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]time.Time{"agent:b": now.Add(time.Hour)}, agents)
+}
+
+func TestStore_UpdateTimes(t *testing.T) {
+	s := NewStore(&Config{})
+	ctx := context.Background()
+
+	before := time.Now()
+
+	assert.Nil(t, s.UpdateGauge(ctx, "a", 1))
+	assert.Nil(t, s.UpdateGauges(ctx, map[string]float64{"b": 2}))
+	assert.Nil(t, s.UpdateCounter(ctx, "c", 3))
+	assert.Nil(t, s.UpdateCounters(ctx, map[string]int64{"d": 4}))
+	assert.Nil(t, s.DeleteGauges(ctx, []string{"b"}))
+
+	times, err := s.GetUpdateTimes(ctx)
+	assert.Nil(t, err)
+	assert.Len(t, times.Gauges, 1)
+	assert.Len(t, times.Counters, 2)
+	assert.False(t, times.Gauges["a"].Before(before))
+	assert.False(t, times.Counters["d"].Before(before))
+
+	// возвращается копия, изменение которой не затрагивает хранилище
+	delete(times.Gauges, "a")
+
+	times, err = s.GetUpdateTimes(ctx)
+	assert.Nil(t, err)
+	assert.Contains(t, times.Gauges, "a")
+
+	old := before.Add(-time.Hour)
+	s.RestoreUpdateTimes(model.UpdateTimes{
+		Gauges:   map[string]time.Time{"a": old, "missing": old},
+		Counters: map[string]time.Time{"c": old},
+	})
+
+	times, err = s.GetUpdateTimes(ctx)
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]time.Time{"a": old}, times.Gauges)
+	assert.True(t, times.Counters["c"].Equal(old))
+	assert.False(t, times.Counters["d"].Before(before))
+}
+
+func TestStore_Silences(t *testing.T) {
+	s := NewStore(&Config{})
+	ctx := context.Background()
+
+	silence := model.SilenceRecord{ID: "a1", Silence: []byte(`{"id":"a1"}`)}
+	assert.Nil(t, s.SaveSilence(ctx, silence))
+
+	silence.Silence = []byte(`{"id":"a1","comment":"deploy"}`)
+	assert.Nil(t, s.SaveSilence(ctx, silence))
+
+	silences, err := s.GetSilences(ctx)
+	assert.Nil(t, err)
+	assert.Equal(t, []model.SilenceRecord{silence}, silences)
+
+	assert.Nil(t, s.DeleteSilence(ctx, "a1"))
+
+	silences, err = s.GetSilences(ctx)
+	assert.Nil(t, err)
+	assert.Empty(t, silences)
+}
+
+func TestStore_AlertState(t *testing.T) {
+	s := NewStore(&Config{})
+	ctx := context.Background()
+
+	pending := model.TransitionRecord{Key: "high_cpu/gauge/cpu", From: "inactive", To: "pending", Alert: []byte(`1`)}
+	firing := model.TransitionRecord{Key: "high_cpu/gauge/cpu", From: "pending", To: "firing", Alert: []byte(`2`)}
+	resolved := model.TransitionRecord{
+		Key: "high_cpu/gauge/cpu", From: "firing", To: "resolved", Alert: []byte(`3`), Resolved: true,
+	}
+
+	assert.Nil(t, s.SaveTransitions(ctx, []model.TransitionRecord{pending, firing}))
+
+	alerts, err := s.GetActiveAlerts(ctx)
+	assert.Nil(t, err)
+	assert.Equal(t, []model.AlertRecord{{Key: "high_cpu/gauge/cpu", Alert: []byte(`2`)}}, alerts)
+
+	assert.Nil(t, s.SaveTransitions(ctx, []model.TransitionRecord{resolved}))
+
+	alerts, err = s.GetActiveAlerts(ctx)
+	assert.Nil(t, err)
+	assert.Empty(t, alerts)
+
+	history, total, err := s.GetAlertHistory(ctx, 1, 1)
+	assert.Nil(t, err)
+	assert.Equal(t, 3, total)
+	assert.Equal(t, []model.TransitionRecord{firing}, history)
+
+	history, _, err = s.GetAlertHistory(ctx, 5, 10)
+	assert.Nil(t, err)
+	assert.Empty(t, history)
+}
+
+func TestStore_AlertHistoryLimit(t *testing.T) {
+	s := NewStore(&Config{})
+	ctx := context.Background()
+
+	transitions := make([]model.TransitionRecord, alertHistoryLimit+1)
+	for i := range transitions {
+		transitions[i] = model.TransitionRecord{Key: "a", Resolved: true, Alert: []byte(fmt.Sprint(i))}
+	}
+
+	assert.Nil(t, s.SaveTransitions(ctx, transitions))
+
+	history, total, err := s.GetAlertHistory(ctx, alertHistoryLimit-1, 10)
+	assert.Nil(t, err)
+	assert.Equal(t, alertHistoryLimit, total)
+	require.Len(t, history, 1)
+	assert.Equal(t, "1", string(history[0].Alert))
+}
+
+func TestStore_RuleVersions(t *testing.T) {
+	s := NewStore(&Config{})
+	ctx := context.Background()
+
+	versions := []model.RuleVersionRecord{
+		{Name: "high_cpu", Number: 1, Version: []byte(`{"version":1}`)},
+		{Name: "high_cpu", Number: 2, Version: []byte(`{"version":2}`)},
+	}
+
+	for _, v := range versions {
+		assert.Nil(t, s.SaveRuleVersion(ctx, v))
+	}
+
+	err := s.SaveRuleVersion(ctx, model.RuleVersionRecord{Name: "high_cpu", Number: 2})
+	assert.ErrorIs(t, err, repositories.ErrConflict)
+
+	stored, err := s.GetRuleVersions(ctx)
+	assert.Nil(t, err)
+	assert.Equal(t, versions, stored)
+}
@@ -32,7 +32,9 @@ package store
 import (
 	"context"
 	"fmt"
+	"time"
 
+	"metricalert/internal/server/core/model"
 	"metricalert/internal/server/infra/store/db"
 	"metricalert/internal/server/infra/store/file"
 	"metricalert/internal/server/infra/store/memory"
@@ -48,6 +50,25 @@ type Store interface {
 	GetCounterList(context.Context) (map[string]int64, error)
 	GetGauge(ctx context.Context, name string) (float64, error)
 	GetCounter(ctx context.Context, name string) (int64, error)
+	DeleteGauges(ctx context.Context, names []string) error
+	DeleteCounters(ctx context.Context, names []string) error
+	ExpireGauges(ctx context.Context, cutoffs map[string]time.Time) ([]string, error)
+	ExpireCounters(ctx context.Context, cutoffs map[string]time.Time) ([]string, error)
+	ResetCounters(ctx context.Context, names []string) error
+	GetUpdateTimes(ctx context.Context) (model.UpdateTimes, error)
+	GetAgentActivity(ctx context.Context) (map[string]time.Time, error)
+	SaveAgentActivity(ctx context.Context, agent string, at time.Time) error
+	ExpireAgents(ctx context.Context, cutoff time.Time) ([]string, error)
+	GetBatchResult(ctx context.Context, key string) (model.BatchResult, error)
+	SaveBatchResult(ctx context.Context, key string, result model.BatchResult, expiresAt time.Time) error
+	GetSilences(ctx context.Context) ([]model.SilenceRecord, error)
+	SaveSilence(ctx context.Context, silence model.SilenceRecord) error
+	DeleteSilence(ctx context.Context, id string) error
+	GetActiveAlerts(ctx context.Context) ([]model.AlertRecord, error)
+	SaveTransitions(ctx context.Context, transitions []model.TransitionRecord) error
+	GetAlertHistory(ctx context.Context, offset, limit int) ([]model.TransitionRecord, int, error)
+	GetRuleVersions(ctx context.Context) ([]model.RuleVersionRecord, error)
+	SaveRuleVersion(ctx context.Context, version model.RuleVersionRecord) error
 	Close() error
 	Ping(ctx context.Context) error
 	Sync(ctx context.Context)
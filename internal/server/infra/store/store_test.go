@@ -2,6 +2,7 @@ package store
 
 import (
 	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -11,14 +12,23 @@ import (
 )
 
 func ExampleNewStore() {
-	_, _ = NewStore(Config{
+	dir, err := os.MkdirTemp("", "store")
+	if err != nil {
+		return
+	}
+	defer func() { _ = os.RemoveAll(dir) }()
+
+	store, err := NewStore(Config{
 		File: &file.Config{
 			StoreInterval: 1,
 			Restore:       true,
-			FilePath:      "test",
+			FilePath:      filepath.Join(dir, "metrics.json"),
 		},
 		DB: nil,
 	})
+	if err == nil {
+		_ = store.Close()
+	}
 	// Output:
 }
 
@@ -61,12 +71,11 @@ func TestNewStore(t *testing.T) {
 			File: &file.Config{
 				StoreInterval: 1,
 				Restore:       true,
-				FilePath:      "test",
+				FilePath:      filepath.Join(t.TempDir(), "metrics.json"),
 			},
 		})
 		defer func() {
 			_ = store.Close()
-			_ = os.Remove("test")
 		}()
 
 		assert.NotNil(t, store)
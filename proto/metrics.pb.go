@@ -22,10 +22,12 @@ const (
 )
 
 type UpdateMetricsRequest struct {
-	state         protoimpl.MessageState `protogen:"open.v1"`
-	Metrics       []*Metric              `protobuf:"bytes,1,rep,name=metrics,proto3" json:"metrics,omitempty"`
-	unknownFields protoimpl.UnknownFields
-	sizeCache     protoimpl.SizeCache
+	state          protoimpl.MessageState `protogen:"open.v1"`
+	Metrics        []*Metric              `protobuf:"bytes,1,rep,name=metrics,proto3" json:"metrics,omitempty"`
+	Strict         bool                   `protobuf:"varint,2,opt,name=strict,proto3" json:"strict,omitempty"`                                      // reject the whole batch if any metric is invalid
+	IdempotencyKey string                 `protobuf:"bytes,3,opt,name=idempotency_key,json=idempotencyKey,proto3" json:"idempotency_key,omitempty"` // a retried batch with the same key is not applied again
+	unknownFields  protoimpl.UnknownFields
+	sizeCache      protoimpl.SizeCache
 }
 
 func (x *UpdateMetricsRequest) Reset() {
@@ -65,9 +67,29 @@ func (x *UpdateMetricsRequest) GetMetrics() []*Metric {
 	return nil
 }
 
+func (x *UpdateMetricsRequest) GetStrict() bool {
+	if x != nil {
+		return x.Strict
+	}
+	return false
+}
+
+func (x *UpdateMetricsRequest) GetIdempotencyKey() string {
+	if x != nil {
+		return x.IdempotencyKey
+	}
+	return ""
+}
+
 type UpdateMetricsResponse struct {
 	state         protoimpl.MessageState `protogen:"open.v1"`
-	Status        string                 `protobuf:"bytes,1,opt,name=status,proto3" json:"status,omitempty"`
+	Status        string                 `protobuf:"bytes,1,opt,name=status,proto3" json:"status,omitempty"` // "success" or "partial"
+	Results       []*MetricResult        `protobuf:"bytes,2,rep,name=results,proto3" json:"results,omitempty"`
+	Accepted      int32                  `protobuf:"varint,3,opt,name=accepted,proto3" json:"accepted,omitempty"`
+	Rejected      int32                  `protobuf:"varint,4,opt,name=rejected,proto3" json:"rejected,omitempty"`
+	Deduplicated  int32                  `protobuf:"varint,5,opt,name=deduplicated,proto3" json:"deduplicated,omitempty"`
+	Replayed      bool                   `protobuf:"varint,6,opt,name=replayed,proto3" json:"replayed,omitempty"` // the batch with this idempotency key was already applied
+	Dropped       int32                  `protobuf:"varint,7,opt,name=dropped,proto3" json:"dropped,omitempty"`   // new metrics dropped over the cardinality limit
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
 }
@@ -109,6 +131,48 @@ func (x *UpdateMetricsResponse) GetStatus() string {
 	return ""
 }
 
+func (x *UpdateMetricsResponse) GetResults() []*MetricResult {
+	if x != nil {
+		return x.Results
+	}
+	return nil
+}
+
+func (x *UpdateMetricsResponse) GetAccepted() int32 {
+	if x != nil {
+		return x.Accepted
+	}
+	return 0
+}
+
+func (x *UpdateMetricsResponse) GetRejected() int32 {
+	if x != nil {
+		return x.Rejected
+	}
+	return 0
+}
+
+func (x *UpdateMetricsResponse) GetDeduplicated() int32 {
+	if x != nil {
+		return x.Deduplicated
+	}
+	return 0
+}
+
+func (x *UpdateMetricsResponse) GetReplayed() bool {
+	if x != nil {
+		return x.Replayed
+	}
+	return false
+}
+
+func (x *UpdateMetricsResponse) GetDropped() int32 {
+	if x != nil {
+		return x.Dropped
+	}
+	return 0
+}
+
 type Metric struct {
 	state         protoimpl.MessageState `protogen:"open.v1"`
 	Id            string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
@@ -177,20 +241,165 @@ func (x *Metric) GetDelta() int64 {
 	return 0
 }
 
+type MetricResult struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Index         int32                  `protobuf:"varint,1,opt,name=index,proto3" json:"index,omitempty"`
+	Id            string                 `protobuf:"bytes,2,opt,name=id,proto3" json:"id,omitempty"`
+	Status        string                 `protobuf:"bytes,3,opt,name=status,proto3" json:"status,omitempty"` // "accepted", "rejected" or "deduplicated"
+	Code          string                 `protobuf:"bytes,4,opt,name=code,proto3" json:"code,omitempty"`
+	Message       string                 `protobuf:"bytes,5,opt,name=message,proto3" json:"message,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *MetricResult) Reset() {
+	*x = MetricResult{}
+	mi := &file_proto_metrics_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *MetricResult) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*MetricResult) ProtoMessage() {}
+
+func (x *MetricResult) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_metrics_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use MetricResult.ProtoReflect.Descriptor instead.
+func (*MetricResult) Descriptor() ([]byte, []int) {
+	return file_proto_metrics_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *MetricResult) GetIndex() int32 {
+	if x != nil {
+		return x.Index
+	}
+	return 0
+}
+
+func (x *MetricResult) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+func (x *MetricResult) GetStatus() string {
+	if x != nil {
+		return x.Status
+	}
+	return ""
+}
+
+func (x *MetricResult) GetCode() string {
+	if x != nil {
+		return x.Code
+	}
+	return ""
+}
+
+func (x *MetricResult) GetMessage() string {
+	if x != nil {
+		return x.Message
+	}
+	return ""
+}
+
+type MetricValues struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Metrics       []*Metric              `protobuf:"bytes,1,rep,name=metrics,proto3" json:"metrics,omitempty"` // found metrics in request order
+	Missing       []*Metric              `protobuf:"bytes,2,rep,name=missing,proto3" json:"missing,omitempty"` // requested metrics that do not exist, only id and type are set
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *MetricValues) Reset() {
+	*x = MetricValues{}
+	mi := &file_proto_metrics_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *MetricValues) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*MetricValues) ProtoMessage() {}
+
+func (x *MetricValues) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_metrics_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use MetricValues.ProtoReflect.Descriptor instead.
+func (*MetricValues) Descriptor() ([]byte, []int) {
+	return file_proto_metrics_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *MetricValues) GetMetrics() []*Metric {
+	if x != nil {
+		return x.Metrics
+	}
+	return nil
+}
+
+func (x *MetricValues) GetMissing() []*Metric {
+	if x != nil {
+		return x.Missing
+	}
+	return nil
+}
+
 var File_proto_metrics_proto protoreflect.FileDescriptor
 
 const file_proto_metrics_proto_rawDesc = "" +
 	"\n" +
-	"\x13proto/metrics.proto\x12\ametrics\"A\n" +
+	"\x13proto/metrics.proto\x12\ametrics\"\x82\x01\n" +
 	"\x14UpdateMetricsRequest\x12)\n" +
-	"\ametrics\x18\x01 \x03(\v2\x0f.metrics.MetricR\ametrics\"/\n" +
+	"\ametrics\x18\x01 \x03(\v2\x0f.metrics.MetricR\ametrics\x12\x16\n" +
+	"\x06strict\x18\x02 \x01(\bR\x06strict\x12'\n" +
+	"\x0fidempotency_key\x18\x03 \x01(\tR\x0eidempotencyKey\"\xf2\x01\n" +
 	"\x15UpdateMetricsResponse\x12\x16\n" +
-	"\x06status\x18\x01 \x01(\tR\x06status\"X\n" +
+	"\x06status\x18\x01 \x01(\tR\x06status\x12/\n" +
+	"\aresults\x18\x02 \x03(\v2\x15.metrics.MetricResultR\aresults\x12\x1a\n" +
+	"\baccepted\x18\x03 \x01(\x05R\baccepted\x12\x1a\n" +
+	"\brejected\x18\x04 \x01(\x05R\brejected\x12\"\n" +
+	"\fdeduplicated\x18\x05 \x01(\x05R\fdeduplicated\x12\x1a\n" +
+	"\breplayed\x18\x06 \x01(\bR\breplayed\x12\x18\n" +
+	"\adropped\x18\a \x01(\x05R\adropped\"X\n" +
 	"\x06Metric\x12\x0e\n" +
 	"\x02id\x18\x01 \x01(\tR\x02id\x12\x12\n" +
 	"\x04type\x18\x02 \x01(\tR\x04type\x12\x14\n" +
 	"\x05value\x18\x03 \x01(\x01R\x05value\x12\x14\n" +
-	"\x05delta\x18\x04 \x01(\x03R\x05delta2`\n" +
+	"\x05delta\x18\x04 \x01(\x03R\x05delta\"z\n" +
+	"\fMetricResult\x12\x14\n" +
+	"\x05index\x18\x01 \x01(\x05R\x05index\x12\x0e\n" +
+	"\x02id\x18\x02 \x01(\tR\x02id\x12\x16\n" +
+	"\x06status\x18\x03 \x01(\tR\x06status\x12\x12\n" +
+	"\x04code\x18\x04 \x01(\tR\x04code\x12\x18\n" +
+	"\amessage\x18\x05 \x01(\tR\amessage\"d\n" +
+	"\fMetricValues\x12)\n" +
+	"\ametrics\x18\x01 \x03(\v2\x0f.metrics.MetricR\ametrics\x12)\n" +
+	"\amissing\x18\x02 \x03(\v2\x0f.metrics.MetricR\amissing2`\n" +
 	"\x0eMetricsService\x12N\n" +
 	"\rUpdateMetrics\x12\x1d.metrics.UpdateMetricsRequest\x1a\x1e.metrics.UpdateMetricsResponseB\bZ\x06proto/b\x06proto3"
 
@@ -206,21 +415,26 @@ func file_proto_metrics_proto_rawDescGZIP() []byte {
 	return file_proto_metrics_proto_rawDescData
 }
 
-var file_proto_metrics_proto_msgTypes = make([]protoimpl.MessageInfo, 3)
+var file_proto_metrics_proto_msgTypes = make([]protoimpl.MessageInfo, 5)
 var file_proto_metrics_proto_goTypes = []any{
 	(*UpdateMetricsRequest)(nil),  // 0: metrics.UpdateMetricsRequest
 	(*UpdateMetricsResponse)(nil), // 1: metrics.UpdateMetricsResponse
 	(*Metric)(nil),                // 2: metrics.Metric
+	(*MetricResult)(nil),          // 3: metrics.MetricResult
+	(*MetricValues)(nil),          // 4: metrics.MetricValues
 }
 var file_proto_metrics_proto_depIdxs = []int32{
 	2, // 0: metrics.UpdateMetricsRequest.metrics:type_name -> metrics.Metric
-	0, // 1: metrics.MetricsService.UpdateMetrics:input_type -> metrics.UpdateMetricsRequest
-	1, // 2: metrics.MetricsService.UpdateMetrics:output_type -> metrics.UpdateMetricsResponse
-	2, // [2:3] is the sub-list for method output_type
-	1, // [1:2] is the sub-list for method input_type
-	1, // [1:1] is the sub-list for extension type_name
-	1, // [1:1] is the sub-list for extension extendee
-	0, // [0:1] is the sub-list for field type_name
+	3, // 1: metrics.UpdateMetricsResponse.results:type_name -> metrics.MetricResult
+	2, // 2: metrics.MetricValues.metrics:type_name -> metrics.Metric
+	2, // 3: metrics.MetricValues.missing:type_name -> metrics.Metric
+	0, // 4: metrics.MetricsService.UpdateMetrics:input_type -> metrics.UpdateMetricsRequest
+	1, // 5: metrics.MetricsService.UpdateMetrics:output_type -> metrics.UpdateMetricsResponse
+	5, // [5:6] is the sub-list for method output_type
+	4, // [4:5] is the sub-list for method input_type
+	4, // [4:4] is the sub-list for extension type_name
+	4, // [4:4] is the sub-list for extension extendee
+	0, // [0:4] is the sub-list for field type_name
 }
 
 func init() { file_proto_metrics_proto_init() }
@@ -234,7 +448,7 @@ func file_proto_metrics_proto_init() {
 			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
 			RawDescriptor: unsafe.Slice(unsafe.StringData(file_proto_metrics_proto_rawDesc), len(file_proto_metrics_proto_rawDesc)),
 			NumEnums:      0,
-			NumMessages:   3,
+			NumMessages:   5,
 			NumExtensions: 0,
 			NumServices:   1,
 		},